@@ -52,12 +52,12 @@ func main() {
 	// configure the network live:
 	group.Go(func() error {
 		// connect both upper and lower to the printer
-		ConnectString(upper.Out, printer.In)
-		ConnectString(lower.Out, printer.In)
+		network.ConnectString(upper.Out, printer.In)
+		network.ConnectString(lower.Out, printer.In)
 
 		// This starts changing the Hello connection between upper and lower.
 		for {
-			helloToUpper := ConnectString(hello.Out, upper.In)
+			helloToUpper := network.ConnectString(hello.Out, upper.In)
 
 			select {
 			case <-time.After(3 * time.Second):
@@ -67,7 +67,7 @@ func main() {
 
 			helloToUpper.Cut()
 
-			helloToLower := ConnectString(hello.Out, lower.In)
+			helloToLower := network.ConnectString(hello.Out, lower.In)
 			select {
 			case <-time.After(3 * time.Second):
 			case <-ctx.Done():
@@ -92,6 +92,13 @@ func ConnectString(out chan string, in chan string) *StringConnection {
 	return &conn
 }
 
+// ConnectString creates a connection that is cut when the network stops.
+func (net *Network) ConnectString(out chan string, in chan string) *StringConnection {
+	conn := ConnectString(out, in)
+	net.track(conn)
+	return conn
+}
+
 type StringConnection struct {
 	cut    sync.Once
 	stop   chan struct{}
@@ -122,8 +129,16 @@ func (conn *StringConnection) pump(out, in chan string) {
 	}()
 }
 
-func (conn *StringConnection) Cut() {
+// Stop signals the pump to exit without waiting for it.
+func (conn *StringConnection) Stop() {
 	conn.cut.Do(func() { close(conn.stop) })
+}
+
+// Exited is closed after the pump has exited.
+func (conn *StringConnection) Exited() <-chan struct{} { return conn.exited }
+
+func (conn *StringConnection) Cut() {
+	conn.Stop()
 	<-conn.exited
 }
 
@@ -2,17 +2,34 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
+// PumpExitTimeout is how long Run waits for connection pumps to exit.
+const PumpExitTimeout = time.Second
+
 type Component interface {
 	Name() string
 	Run(context.Context) error
 }
 
+// Connection is a pump that moves messages between components.
+type Connection interface {
+	// Stop signals the pump to exit without waiting.
+	Stop()
+	// Exited is closed when the pump has exited.
+	Exited() <-chan struct{}
+}
+
 type Network struct {
 	list []Component
+
+	mu    sync.Mutex
+	conns []Connection
 }
 
 func (net *Network) Add(com Component) {
@@ -29,5 +46,63 @@ func (net *Network) Run(ctx context.Context) error {
 		})
 	}
 
-	return group.Wait()
+	err := group.Wait()
+	if cutErr := net.cutAll(); err == nil {
+		err = cutErr
+	}
+	return err
+}
+
+// track registers the connection so that it is cut when Run exits.
+func (net *Network) track(conn Connection) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+
+	// forget the connections that have already been cut
+	alive := net.conns[:0]
+	for _, c := range net.conns {
+		select {
+		case <-c.Exited():
+		default:
+			alive = append(alive, c)
+		}
+	}
+	net.conns = append(alive, conn)
+}
+
+// cutAll stops every tracked connection and verifies that the pumps exit.
+func (net *Network) cutAll() error {
+	net.mu.Lock()
+	conns := net.conns
+	net.conns = nil
+	net.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Stop()
+	}
+
+	timeout := time.NewTimer(PumpExitTimeout)
+	defer timeout.Stop()
+
+	leaked := 0
+	for _, conn := range conns {
+		select {
+		case <-conn.Exited():
+		case <-timeout.C:
+			// the timer has fired, check the rest without waiting
+			leaked++
+			for _, rest := range conns {
+				if rest == conn {
+					continue
+				}
+				select {
+				case <-rest.Exited():
+				default:
+					leaked++
+				}
+			}
+			return fmt.Errorf("%d of %d connection pumps did not exit within %v", leaked, len(conns), PumpExitTimeout)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"fbp.example/flow/bench"
+)
+
+// benchmark measures the throughput of the standard pipelines
+// over each transport.
+func benchmark(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := flags.Int("n", 1000000, "number of values sent through each pipeline")
+	pipelines := flags.String("pipeline", "", "comma separated pipelines to run, default all")
+	transports := flags.String("transport", "", "comma separated transports to use, default all")
+	_ = flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PIPELINE\tTRANSPORT\tVALUES/S\tNS/VALUE")
+	for _, p := range bench.Pipelines {
+		if !selected(*pipelines, p.Name) {
+			continue
+		}
+		for _, t := range bench.Transports {
+			if !selected(*transports, t.Name) {
+				continue
+			}
+			r, err := bench.Run(ctx, p, t, *n)
+			if err != nil {
+				w.Flush()
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			fmt.Fprintf(w, "%s\t%s\t%.0f\t%.1f\n", p.Name, t.Name, r.PerSecond(), r.NsPerValue())
+			// show the progress, the minimum width keeps the rows aligned
+			w.Flush()
+		}
+	}
+	w.Flush()
+	return 0
+}
+
+// selected reports whether name is in the comma separated list,
+// an empty list selects everything.
+func selected(list, name string) bool {
+	if list == "" {
+		return true
+	}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fbp.example/flow"
+	"fbp.example/flow/std"
+	"fbp.example/flow/std/text"
+)
+
+// builtins are the standard components available to every graph,
+// integrations add their own with flow.Register.
+var builtins = flow.Registry{
+	"FileRead": func() flow.Component { return std.NewFileRead() },
+	"Stdin":    func() flow.Component { return std.NewStdin() },
+	"Stdout":   func() flow.Component { return std.NewStdout[string]() },
+	"Stderr":   func() flow.Component { return std.NewStderr[string]() },
+
+	"Upper":        func() flow.Component { return &text.Upper{} },
+	"Lower":        func() flow.Component { return &text.Lower{} },
+	"TrimSpace":    func() flow.Component { return &text.TrimSpace{} },
+	"SplitLines":   func() flow.Component { return &text.SplitLines{} },
+	"Replace":      func() flow.Component { return &text.Replace{} },
+	"RegexMatch":   func() flow.Component { return &text.RegexMatch{} },
+	"RegexExtract": func() flow.Component { return &text.RegexExtract{} },
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"fbp.example/flow"
+)
+
+func graph(args []string) int {
+	if len(args) < 1 {
+		usage()
+		return 2
+	}
+	switch args[0] {
+	case "lint":
+		return lint(args[1:])
+	case "fmt":
+		return format(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "flow: unknown graph command %q\n", args[0])
+		usage()
+		return 2
+	}
+}
+
+// lint checks that the graphs can be wired up with the registered
+// components, have no port with several wires into it nor cycles of
+// unbuffered connections, and reports the ports left unconnected.
+func lint(args []string) int {
+	flags := flag.NewFlagSet("graph lint", flag.ExitOnError)
+	params := paramFlag(flags)
+	pluginFlag(flags)
+	strict := flags.Bool("strict", false, "fail when ports are left unconnected")
+	_ = flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, file := range flags.Args() {
+		net := &flow.Network{Registry: builtins, Params: params}
+		if err := net.SetupFile(file); err != nil {
+			var errs flow.WiringErrors
+			switch err := err.(type) {
+			case flow.WiringErrors:
+				errs = err
+			case flow.WiringError:
+				errs = flow.WiringErrors{err}
+			default:
+				errs = flow.WiringErrors{{Err: err}}
+			}
+			for _, err := range errs {
+				// positions contain the file name
+				if err.Pos.Line == 0 {
+					fmt.Fprintf(os.Stderr, "%s: ", file)
+				}
+				fmt.Fprintln(os.Stderr, err)
+			}
+			status = 1
+			continue
+		}
+		if err := net.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			status = 1
+		}
+		for _, port := range net.Unconnected() {
+			fmt.Fprintf(os.Stderr, "%s: %s is not connected\n", file, port)
+			if *strict {
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+// format prints the canonically formatted graphs.
+func format(args []string) int {
+	flags := flag.NewFlagSet("graph fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	list := flags.Bool("l", false, "list the files whose formatting differs and fail")
+	_ = flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, file := range flags.Args() {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		formatted, err := flow.FormatWiring(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%v\n", file, err)
+			status = 1
+			continue
+		}
+
+		switch {
+		case *list:
+			if !bytes.Equal(src, formatted) {
+				fmt.Println(file)
+				status = 1
+			}
+		case *write:
+			if !bytes.Equal(src, formatted) {
+				if err := os.WriteFile(file, formatted, 0o644); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					status = 1
+				}
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	return status
+}
@@ -0,0 +1,5 @@
+//go:build kafka
+
+package main
+
+import _ "fbp.example/flow/ext/kafka"
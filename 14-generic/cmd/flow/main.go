@@ -0,0 +1,237 @@
+// Command flow runs networks defined in graph files.
+//
+//	flow run [-param NAME=VALUE] [-timeout d] [-grace d] graph.fbp
+//
+// loads the graph, creates the components from the registered types and
+// runs the network until it completes or is interrupted. On exit it prints
+// the number of packets delivered over each connection and the error,
+// when the network failed.
+//
+// An interrupted network is stopped with flow.Network.Shutdown, which
+// lets it drain for the -grace period. The components that fail to stop
+// in time are reported, along with the ports they are blocked on.
+//
+// With -admin it serves the status of the network as JSON, which can be
+// watched with
+//
+//	flow top [-interval d] localhost:6060
+//
+// showing the throughput and queue depth of the connections and which
+// components are blocked sending or receiving. The same information is
+// shown in a browser at /dashboard/. The health checks of the components
+// are served at /health, see flow.HealthChecker. With -profile n, 1 in n
+// packets is traced and the latencies between the components are served
+// at /profile, see flow.Profiler.
+//
+//	flow graph lint [-param NAME=VALUE] [-strict] graph.fbp...
+//
+// checks that the graphs refer to existing components and ports with
+// matching types and that their cycles contain a feedback connection,
+// and reports the ports left unconnected.
+//
+//	flow graph fmt [-w | -l] graph.fbp...
+//
+// formats the graphs canonically. With -l it lists the files that
+// are not formatted and fails, which is useful in CI.
+//
+//	flow bench [-n values] [-pipeline names] [-transport names]
+//
+// measures the throughput of the standard pipelines of package bench.
+//
+// Integrations are included with build tags, e.g. go build -tags kafka,
+// other components can be loaded from Go plugins with -plugin, see
+// flow.LoadPlugin. The plugins listed in $FLOW_PLUGINS, separated by the
+// OS path list separator, are loaded by every command.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"fbp.example/flow"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := loadPlugins(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "run":
+		os.Exit(run(os.Args[2:]))
+	case "graph":
+		os.Exit(graph(os.Args[2:]))
+	case "top":
+		os.Exit(top(os.Args[2:]))
+	case "bench":
+		os.Exit(benchmark(os.Args[2:]))
+	case "help", "-h", "-help", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "flow: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "\tflow run [flags] graph.fbp")
+	fmt.Fprintln(os.Stderr, "\tflow top [flags] address")
+	fmt.Fprintln(os.Stderr, "\tflow graph lint [flags] graph.fbp...")
+	fmt.Fprintln(os.Stderr, "\tflow graph fmt [flags] graph.fbp...")
+	fmt.Fprintln(os.Stderr, "\tflow bench [flags]")
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	params := paramFlag(flags)
+	pluginFlag(flags)
+	timeout := flags.Duration("timeout", 0, "stop the network after the duration")
+	grace := flags.Duration("grace", 5*time.Second, "time to drain the network when stopping, before cancelling it")
+	admin := flags.String("admin", "", "serve the network status on the address, e.g. localhost:6060")
+	profile := flags.Int("profile", 0, "trace 1 in `n` packets to measure the latencies, served with -admin")
+	flags.Usage = func() {
+		usage()
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	net := &flow.Network{Registry: builtins, Params: params}
+	if *profile > 0 {
+		net.Profiler = &flow.Profiler{Every: *profile}
+	}
+	if err := net.SetupFile(flags.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var expired <-chan time.Time
+	if *timeout > 0 {
+		timer := time.NewTimer(*timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// the network is stopped gracefully, sources first
+	finished, stopping, reported := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(reported)
+		select {
+		case <-interrupted.Done():
+		case <-expired:
+		case <-finished:
+			return
+		}
+		close(stopping)
+		ctx, cancel := context.WithTimeout(context.Background(), *grace)
+		defer cancel()
+		if err := net.Shutdown(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}()
+
+	if *admin != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/", net.AdminHandler())
+		mux.Handle("/dashboard/", net.DashboardHandler())
+		server := &http.Server{Addr: *admin, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				fmt.Fprintln(os.Stderr, "admin:", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	start := time.Now()
+	err := net.RunToCompletion(context.Background())
+	close(finished)
+	<-reported
+	// stopping the network is not a failure
+	select {
+	case <-stopping:
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+	default:
+	}
+
+	summary(os.Stderr, net, time.Since(start), err)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// paramFlag adds the -param flag, which sets graph parameters.
+func paramFlag(flags *flag.FlagSet) map[string]string {
+	params := map[string]string{}
+	flags.Func("param", "graph parameter as NAME=VALUE, can be repeated", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok || name == "" {
+			return errors.New("expected NAME=VALUE")
+		}
+		params[name] = value
+		return nil
+	})
+	return params
+}
+
+// pluginFlag adds the -plugin flag, which loads components from Go plugins.
+func pluginFlag(flags *flag.FlagSet) {
+	flags.Func("plugin", "load components from the Go plugin, can be repeated", flow.LoadPlugin)
+}
+
+// loadPlugins loads the plugins listed in $FLOW_PLUGINS.
+func loadPlugins() error {
+	for _, path := range filepath.SplitList(os.Getenv("FLOW_PLUGINS")) {
+		if path == "" {
+			continue
+		}
+		if err := flow.LoadPlugin(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summary prints the packets delivered per connection and the error.
+func summary(w io.Writer, net *flow.Network, elapsed time.Duration, err error) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONNECTION\tPACKETS")
+	var total uint64
+	for _, s := range net.Stats() {
+		fmt.Fprintf(tw, "%s\t%d\n", s.Name, s.Packets)
+		total += s.Packets
+	}
+	fmt.Fprintf(tw, "total\t%d\tin %v\n", total, elapsed.Round(time.Millisecond))
+	_ = tw.Flush()
+
+	if err != nil {
+		fmt.Fprintln(w, "error:", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// top periodically shows the status of a network served by
+// Network.AdminHandler, e.g. by flow run -admin.
+func top(args []string) int {
+	flags := flag.NewFlagSet("top", flag.ExitOnError)
+	interval := flags.Duration("interval", time.Second, "refresh interval")
+	count := flags.Int("n", 0, "number of updates, 0 means until interrupted")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	url := flags.Arg(0)
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var prev *flow.Status
+	for i := 0; *count == 0 || i < *count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return 0
+			case <-time.After(*interval):
+			}
+		}
+
+		status, err := fetchStatus(ctx, url)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		// clear the screen
+		fmt.Print("\x1b[H\x1b[2J")
+		render(os.Stdout, status, prev)
+		prev = status
+	}
+	return 0
+}
+
+func fetchStatus(ctx context.Context, url string) (*flow.Status, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var status flow.Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return &status, nil
+}
+
+// render prints the status, the throughput is calculated from the
+// difference to the previous status.
+func render(w io.Writer, status, prev *flow.Status) {
+	before := map[string]uint64{}
+	var elapsed float64
+	if prev != nil {
+		for _, conn := range prev.Connections {
+			before[conn.Name] = conn.Packets
+		}
+		elapsed = status.Time.Sub(prev.Time).Seconds()
+	}
+
+	state := "running"
+	if status.Paused {
+		state = "paused"
+	}
+	fmt.Fprintf(w, "%s  %s\n\n", status.Time.Format("15:04:05"), state)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONNECTION\tPACKETS/S\tPACKETS\tQUEUED\tUNACKED")
+	for _, conn := range status.Connections {
+		rate := "-"
+		if last, ok := before[conn.Name]; ok && elapsed > 0 && conn.Packets >= last {
+			rate = fmt.Sprintf("%.1f", float64(conn.Packets-last)/elapsed)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\n", conn.Name, rate, conn.Packets, conn.Queued, conn.Unacked)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w)
+
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tSTATE")
+	for _, c := range status.Components {
+		fmt.Fprintf(tw, "%s\t%s\n", c.Name, c.State)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,80 @@
+// Command flowscaffold generates the boilerplate for a new component
+// and a table-driven test for it.
+//
+//	flowscaffold -name Upper -in In:string -out Out:string
+//
+// writes upper.go and upper_test.go to the current directory. It can be
+// used with go:generate:
+//
+//	//go:generate go run fbp.example/cmd/flowscaffold -name Upper -in In:string -out Out:string
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fbp.example/flow/flowgen"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("flowscaffold: ")
+
+	var c flowgen.Component
+	flag.StringVar(&c.Name, "name", "", "name of the component")
+	flag.StringVar(&c.Package, "pkg", "", "package name, defaults to $GOPACKAGE or main")
+	dir := flag.String("dir", ".", "output directory")
+	force := flag.Bool("f", false, "overwrite existing files")
+	flag.Func("in", "In port as Name:Type, can be repeated", portFlag(&c.In))
+	flag.Func("out", "Out port as Name:Type, can be repeated", portFlag(&c.Out))
+	flag.Func("import", "package used by the port types, can be repeated", func(s string) error {
+		c.Imports = append(c.Imports, s)
+		return nil
+	})
+	flag.Parse()
+
+	if c.Name == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if c.Package == "" {
+		c.Package = os.Getenv("GOPACKAGE")
+	}
+
+	src, test, err := flowgen.Scaffold(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	base := filepath.Join(*dir, strings.ToLower(c.Name))
+	for file, data := range map[string][]byte{base + ".go": src, base + "_test.go": test} {
+		if err := write(file, data, *force); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func portFlag(ports *[]flowgen.Port) func(string) error {
+	return func(s string) error {
+		p, err := flowgen.ParsePort(s)
+		if err != nil {
+			return err
+		}
+		*ports = append(*ports, p)
+		return nil
+	}
+}
+
+// write writes the file, unless it already exists.
+func write(file string, data []byte, force bool) error {
+	if !force {
+		if _, err := os.Stat(file); err == nil {
+			return errors.New(file + " already exists, use -f to overwrite")
+		}
+	}
+	return os.WriteFile(file, data, 0o644)
+}
@@ -0,0 +1,656 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRedeliver is the default time after which an unacknowledged
+// packet is delivered again.
+const DefaultRedeliver = 30 * time.Second
+
+// AckOut is the sending side of an acknowledged connection.
+//
+// Packets sent through AckOut stay in the connection until the receiver
+// acknowledges them, which gives at-least-once delivery.
+//
+// Packets may carry an ID given with SendID, the receiving AckIn uses
+// it to discard redelivered duplicates, see AckIn.DedupWindow.
+//
+// Acknowledged connections are not supported by RunSequential.
+type AckOut[T any] struct {
+	mu      sync.Mutex
+	conn    *AckConn[T]
+	changed chan struct{}
+	bound   binding
+
+	waiting int32
+	sent    uint32
+}
+
+// AckIn is the receiving side of an acknowledged connection.
+type AckIn[T any] struct {
+	mu      sync.Mutex
+	conn    *AckConn[T]
+	changed chan struct{}
+	bound   binding
+
+	// Redeliver is the time after which an unacknowledged packet is
+	// delivered again, defaults to DefaultRedeliver.
+	Redeliver time.Duration
+	// DedupWindow is the number of acknowledged packet IDs remembered.
+	// A packet whose ID is in the window, or which duplicates a packet
+	// that is still unacknowledged, is discarded without delivery.
+	// Zero disables deduplication.
+	DedupWindow int
+
+	waiting  int32
+	received uint32
+
+	dedup dedupWindow
+}
+
+// Delivery is a packet received from AckIn.
+//
+// Exactly one of Ack or Nack should be called once the packet has been
+// handled. Calling them again has no effect.
+type Delivery[T any] struct {
+	Value T
+	// ID is the packet ID given to SendID, empty for Send.
+	ID string
+	// Attempt is the number of times the packet has been delivered.
+	Attempt int
+
+	conn *AckConn[T]
+	id   uint64
+}
+
+// Ack marks the packet as handled.
+func (d Delivery[T]) Ack() {
+	if d.conn != nil {
+		d.conn.settle(d.id, false)
+	}
+}
+
+// Nack returns the packet to the connection for immediate redelivery.
+func (d Delivery[T]) Nack() {
+	if d.conn != nil {
+		d.conn.settle(d.id, true)
+	}
+}
+
+// AckConn is a connection between an AckOut and an AckIn.
+type AckConn[T any] struct {
+	from *AckOut[T]
+	to   *AckIn[T]
+
+	mu       sync.Mutex
+	changed  chan struct{}
+	queue    []*ackItem[T]
+	inflight map[uint64]*ackItem[T]
+	nextID   uint64
+	closed   bool
+	// acked counts the acknowledged packets.
+	acked uint64
+}
+
+type ackItem[T any] struct {
+	id       uint64
+	key      string
+	value    T
+	attempts int
+	deadline time.Time
+}
+
+// ackCapacity is the number of packets queued in an AckConn before Send blocks.
+const ackCapacity = 1
+
+// ConnectAck connects an acknowledged connection.
+//
+// Like Connect, ConnectAck returns an error when to is already connected.
+func ConnectAck[T any](from *AckOut[T], to *AckIn[T]) (*AckConn[T], error) {
+	conn := &AckConn[T]{
+		from:     from,
+		to:       to,
+		inflight: make(map[uint64]*ackItem[T]),
+	}
+
+	to.mu.Lock()
+	if to.conn != nil {
+		to.mu.Unlock()
+		return nil, errInConnected(to)
+	}
+	to.conn = conn
+	notify(&to.changed)
+	to.mu.Unlock()
+
+	attachAck(&from.mu, &from.conn, &from.changed, conn)
+
+	if net := conn.network(); net != nil {
+		net.register(conn)
+	}
+	return conn, nil
+}
+
+// Disconnect detaches the connection from the ports,
+// unacknowledged packets are lost.
+func (conn *AckConn[T]) Disconnect() {
+	from, to := conn.ports()
+	detachAck(&from.mu, &from.conn, &from.changed, conn)
+	detachAck(&to.mu, &to.conn, &to.changed, conn)
+
+	if net := conn.network(); net != nil {
+		net.unregister(conn)
+	}
+}
+
+// ports returns the ports of the connection.
+func (conn *AckConn[T]) ports() (*AckOut[T], *AckIn[T]) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.from, conn.to
+}
+
+func (conn *AckConn[T]) ends() (outPort, inPort) { return conn.ports() }
+
+// retarget moves the connection to other ports, see Network.Replace.
+// The packets delivered to the previous receiver stay unacknowledged
+// until they are acknowledged or redelivered.
+func (conn *AckConn[T]) retarget(from outPort, to inPort) error {
+	out, ok1 := from.(*AckOut[T])
+	in, ok2 := to.(*AckIn[T])
+	if !ok1 || !ok2 {
+		return fmt.Errorf("cannot connect acknowledged %v to %v", from.elemType(), to.elemType())
+	}
+
+	conn.mu.Lock()
+	oldFrom, oldTo := conn.from, conn.to
+	conn.from, conn.to = out, in
+	// wakes up the previous receiver waiting in recv
+	notify(&conn.changed)
+	conn.mu.Unlock()
+
+	if oldFrom != out {
+		detachAck(&oldFrom.mu, &oldFrom.conn, &oldFrom.changed, conn)
+		attachAck(&out.mu, &out.conn, &out.changed, conn)
+	}
+	if oldTo != in {
+		detachAck(&oldTo.mu, &oldTo.conn, &oldTo.changed, conn)
+		attachAck(&in.mu, &in.conn, &in.changed, conn)
+	}
+	return nil
+}
+
+// attachAck sets the connection of a port.
+func attachAck[T any](mu *sync.Mutex, port **AckConn[T], changed *chan struct{}, conn *AckConn[T]) {
+	mu.Lock()
+	defer mu.Unlock()
+	*port = conn
+	notify(changed)
+}
+
+// detachAck clears the connection of a port, when it's conn.
+func detachAck[T any](mu *sync.Mutex, port **AckConn[T], changed *chan struct{}, conn *AckConn[T]) {
+	mu.Lock()
+	defer mu.Unlock()
+	if *port == conn {
+		*port = nil
+		notify(changed)
+	}
+}
+
+// String returns the port names of the connection.
+func (conn *AckConn[T]) String() string {
+	from, to := conn.ports()
+	return portName(from.boundTo()) + " -> " + portName(to.boundTo())
+}
+
+func (conn *AckConn[T]) network() *Network {
+	from, to := conn.ports()
+	if net := from.boundTo().net; net != nil {
+		return net
+	}
+	return to.boundTo().net
+}
+
+// Unacked returns the number of packets that have been delivered,
+// but not yet acknowledged.
+func (conn *AckConn[T]) Unacked() int {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return len(conn.inflight)
+}
+
+// packets returns the number of acknowledged packets.
+func (conn *AckConn[T]) packets() uint64 {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.acked
+}
+
+// queued returns the number of packets waiting to be received.
+func (conn *AckConn[T]) queued() int {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return len(conn.queue)
+}
+
+// Redeliver returns all the unacknowledged packets to the queue,
+// e.g. after the receiving component has been restarted.
+func (conn *AckConn[T]) Redeliver() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.requeue(func(*ackItem[T]) bool { return true })
+}
+
+// requeue moves the matching inflight packets to the front of the queue
+// in the order they were sent, conn.mu must be held.
+func (conn *AckConn[T]) requeue(match func(*ackItem[T]) bool) {
+	var items []*ackItem[T]
+	for id, item := range conn.inflight {
+		if match(item) {
+			items = append(items, item)
+			delete(conn.inflight, id)
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+	sortItems(items)
+	conn.queue = append(items, conn.queue...)
+	notify(&conn.changed)
+}
+
+func sortItems[T any](items []*ackItem[T]) {
+	// the lists are short, insertion sort is sufficient
+	for i := 1; i < len(items); i++ {
+		for k := i; k > 0 && items[k].id < items[k-1].id; k-- {
+			items[k], items[k-1] = items[k-1], items[k]
+		}
+	}
+}
+
+func (conn *AckConn[T]) settle(id uint64, nack bool) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	item, ok := conn.inflight[id]
+	if !ok {
+		return
+	}
+	if nack {
+		conn.requeue(func(it *ackItem[T]) bool { return it == item })
+		return
+	}
+	delete(conn.inflight, id)
+	conn.acked++
+	notify(&conn.changed)
+	if item.key != "" {
+		conn.to.dedup.add(item.key, conn.to.DedupWindow)
+	}
+}
+
+// wait waits for a change in the connection or until the deadline,
+// conn.mu must be held.
+func (conn *AckConn[T]) wait(ctx context.Context, deadline time.Time) error {
+	if conn.changed == nil {
+		conn.changed = make(chan struct{})
+	}
+	changed := conn.changed
+
+	conn.mu.Unlock()
+	defer conn.mu.Lock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		clock := ClockFrom(ctx)
+		timer := clock.NewTimer(deadline.Sub(clock.Now()))
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-changed:
+	case <-timeout:
+	}
+	return nil
+}
+
+func (conn *AckConn[T]) send(ctx context.Context, key string, v T) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	for len(conn.queue) >= ackCapacity {
+		if conn.closed {
+			return ErrClosed
+		}
+		if err := conn.wait(ctx, time.Time{}); err != nil {
+			return err
+		}
+	}
+	if conn.closed {
+		return ErrClosed
+	}
+
+	if key != "" && conn.to.DedupWindow > 0 && conn.holds(key) {
+		return nil
+	}
+
+	conn.nextID++
+	conn.queue = append(conn.queue, &ackItem[T]{id: conn.nextID, key: key, value: v})
+	notify(&conn.changed)
+	return nil
+}
+
+// holds reports whether a packet with the key is queued or unacknowledged,
+// conn.mu must be held.
+func (conn *AckConn[T]) holds(key string) bool {
+	for _, item := range conn.queue {
+		if item.key == key {
+			return true
+		}
+	}
+	for _, item := range conn.inflight {
+		if item.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (conn *AckConn[T]) close() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.closed = true
+	notify(&conn.changed)
+}
+
+// recv receives the next packet for in, it returns errRetry when the
+// connection has been moved to another receiver.
+func (conn *AckConn[T]) recv(ctx context.Context, in *AckIn[T], redeliver time.Duration) (Delivery[T], error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	clock := ClockFrom(ctx)
+	for {
+		if conn.to != in {
+			return Delivery[T]{}, errRetry
+		}
+		now := clock.Now()
+		conn.requeue(func(item *ackItem[T]) bool { return !now.Before(item.deadline) })
+
+		if len(conn.queue) > 0 {
+			item := conn.queue[0]
+			conn.queue[0] = nil
+			conn.queue = conn.queue[1:]
+
+			item.attempts++
+			item.deadline = now.Add(redeliver)
+			conn.inflight[item.id] = item
+			notify(&conn.changed)
+
+			return Delivery[T]{Value: item.value, ID: item.key, Attempt: item.attempts, conn: conn, id: item.id}, nil
+		}
+
+		// the stream ends once everything has been acknowledged,
+		// until then packets may need to be redelivered
+		if conn.closed && len(conn.inflight) == 0 {
+			return Delivery[T]{}, EOS
+		}
+
+		var next time.Time
+		for _, item := range conn.inflight {
+			if next.IsZero() || item.deadline.Before(next) {
+				next = item.deadline
+			}
+		}
+		if err := conn.wait(ctx, next); err != nil {
+			return Delivery[T]{}, err
+		}
+	}
+}
+
+// pending reports whether there are packets waiting to be delivered.
+func (conn *AckConn[T]) pending() bool {
+	if conn == nil {
+		return false
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return len(conn.queue) > 0 || len(conn.inflight) > 0
+}
+
+// currentAck returns the connection of the port and a channel
+// that is closed when it changes.
+func currentAck[T any](mu *sync.Mutex, conn **AckConn[T], changed *chan struct{}) (*AckConn[T], chan struct{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if *changed == nil {
+		*changed = make(chan struct{})
+	}
+	return *conn, *changed
+}
+
+// notify closes and clears the broadcast channel.
+func notify(changed *chan struct{}) {
+	if *changed != nil {
+		close(*changed)
+		*changed = nil
+	}
+}
+
+// Send waits until the connection accepts v.
+func (out *AckOut[T]) Send(ctx context.Context, v T) error {
+	return out.SendID(ctx, "", v)
+}
+
+// SendID sends v with a packet ID. The ID should be derived from the
+// packet, so that it stays the same when the packet is sent again,
+// e.g. after the sending component has been restarted.
+func (out *AckOut[T]) SendID(ctx context.Context, id string, v T) error {
+	atomic.AddInt32(&out.waiting, 1)
+	defer atomic.AddInt32(&out.waiting, -1)
+	for {
+		conn, changed := currentAck(&out.mu, &out.conn, &out.changed)
+		if conn != nil {
+			err := conn.send(ctx, id, v)
+			if err == nil {
+				atomic.AddUint32(&out.sent, 1)
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Close signals end of stream. The receiver gets EOS once all the
+// packets have been acknowledged.
+func (out *AckOut[T]) Close(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	conn, _ := currentAck(&out.mu, &out.conn, &out.changed)
+	if conn != nil {
+		conn.close()
+	}
+	return nil
+}
+
+// Connected reports whether the AckOut is connected.
+func (out *AckOut[T]) Connected() bool {
+	conn, _ := currentAck(&out.mu, &out.conn, &out.changed)
+	return conn != nil
+}
+
+// Recv waits for the next packet, which must be acknowledged.
+func (in *AckIn[T]) Recv(ctx context.Context) (Delivery[T], error) {
+	redeliver := in.Redeliver
+	if redeliver <= 0 {
+		redeliver = DefaultRedeliver
+	}
+
+	atomic.AddInt32(&in.waiting, 1)
+	defer atomic.AddInt32(&in.waiting, -1)
+	for {
+		conn, changed := currentAck(&in.mu, &in.conn, &in.changed)
+		if conn != nil {
+			d, err := conn.recv(ctx, in, redeliver)
+			if err == errRetry {
+				continue
+			}
+			if err == nil && d.ID != "" && in.dedup.contains(d.ID) {
+				d.Ack()
+				continue
+			}
+			if err == nil || err == EOS {
+				atomic.AddUint32(&in.received, 1)
+			}
+			return d, err
+		}
+		select {
+		case <-ctx.Done():
+			return Delivery[T]{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Connected reports whether the AckIn is connected.
+func (in *AckIn[T]) Connected() bool {
+	conn, _ := currentAck(&in.mu, &in.conn, &in.changed)
+	return conn != nil
+}
+
+// Requeue returns all the unacknowledged packets for redelivery. The
+// network calls it when it restarts the receiving component, see
+// WithRestartOnStall.
+func (in *AckIn[T]) Requeue() {
+	conn, _ := currentAck(&in.mu, &in.conn, &in.changed)
+	if conn != nil {
+		conn.Redeliver()
+	}
+}
+
+// requeueAcks returns the unacknowledged packets of the AckIn ports
+// of c for redelivery, see AckIn.Requeue.
+func requeueAcks(c Component) {
+	for _, p := range portsOf(c) {
+		if in, ok := p.(interface{ Requeue() }); ok {
+			in.Requeue()
+		}
+	}
+}
+
+// ackPort is implemented by AckIn and AckOut.
+type ackPort interface{ acknowledged() }
+
+func (in *AckIn[T]) acknowledged()   {}
+func (out *AckOut[T]) acknowledged() {}
+
+func (in *AckIn[T]) elemType() reflect.Type   { return reflect.TypeOf((*T)(nil)).Elem() }
+func (out *AckOut[T]) elemType() reflect.Type { return reflect.TypeOf((*T)(nil)).Elem() }
+
+func (in *AckIn[T]) bind(b binding)   { in.mu.Lock(); in.bound = b; in.mu.Unlock() }
+func (out *AckOut[T]) bind(b binding) { out.mu.Lock(); out.bound = b; out.mu.Unlock() }
+
+func (in *AckIn[T]) boundTo() binding   { in.mu.Lock(); defer in.mu.Unlock(); return in.bound }
+func (out *AckOut[T]) boundTo() binding { out.mu.Lock(); defer out.mu.Unlock(); return out.bound }
+
+func (in *AckIn[T]) newOut() outPort { return &AckOut[T]{} }
+func (out *AckOut[T]) newIn() inPort { return &AckIn[T]{} }
+
+func (in *AckIn[T]) activity() (blocked bool, received uint32) {
+	conn, _ := currentAck(&in.mu, &in.conn, &in.changed)
+	blocked = atomic.LoadInt32(&in.waiting) > 0 && !conn.pending()
+	return blocked, atomic.LoadUint32(&in.received)
+}
+
+func (in *AckIn[T]) empty() bool {
+	conn, _ := currentAck(&in.mu, &in.conn, &in.changed)
+	return !conn.pending()
+}
+
+func (out *AckOut[T]) sending() bool { return atomic.LoadInt32(&out.waiting) > 0 }
+
+// recvAny acknowledges the packet immediately, the untyped receiver
+// takes over the responsibility for it.
+func (in *AckIn[T]) recvAny(ctx context.Context) (any, error) {
+	d, err := in.Recv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.Ack()
+	return d.Value, nil
+}
+
+// connect ignores opts, the acknowledged connections are always buffered.
+func (out *AckOut[T]) connect(to inPort, opts ...ConnOption) (Connection, error) {
+	in, ok := to.(*AckIn[T])
+	if !ok {
+		return nil, fmt.Errorf("cannot connect acknowledged %v to %T", out.elemType(), to)
+	}
+	conn, err := ConnectAck(out, in)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (out *AckOut[T]) sendAny(ctx context.Context, v any) error {
+	tv, ok := v.(T)
+	if !ok {
+		return fmt.Errorf("cannot send %T to %v", v, out.elemType())
+	}
+	return out.Send(ctx, tv)
+}
+
+func (out *AckOut[T]) closeAny(ctx context.Context) error { return out.Close(ctx) }
+
+// dedupWindow remembers the most recent packet IDs.
+type dedupWindow struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	ring []string
+	next int
+}
+
+func (w *dedupWindow) contains(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.seen[id]
+	return ok
+}
+
+// add remembers id, forgetting the oldest one when the window is full.
+func (w *dedupWindow) add(id string, size int) {
+	if size <= 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seen == nil {
+		w.seen = make(map[string]struct{}, size)
+	}
+	if _, ok := w.seen[id]; ok {
+		return
+	}
+	if len(w.ring) < size {
+		w.ring = append(w.ring, id)
+	} else {
+		delete(w.seen, w.ring[w.next])
+		w.ring[w.next] = id
+		w.next = (w.next + 1) % len(w.ring)
+	}
+	w.seen[id] = struct{}{}
+}
@@ -0,0 +1,177 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+)
+
+func TestAckRedeliverClock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	clock := flowtest.NewClock(time.Time{})
+	ctx = flow.WithClock(ctx, clock)
+
+	var out flow.AckOut[int]
+	in := flow.AckIn[int]{Redeliver: time.Minute}
+	if _, err := flow.ConnectAck(&out, &in); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Send(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := in.Recv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the packet is not acknowledged, so the next Recv waits for the redelivery
+	received := make(chan flow.Delivery[int])
+	go func() {
+		d, err := in.Recv(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- d
+	}()
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+
+	second := <-received
+	if second.Value != first.Value || second.Attempt != 2 {
+		t.Fatalf("redelivered %d on attempt %d, expected %d on attempt 2", second.Value, second.Attempt, first.Value)
+	}
+	second.Ack()
+}
+
+type ackSource struct {
+	Out flow.AckOut[int]
+}
+
+func (s *ackSource) Run(ctx context.Context) error {
+	if err := s.Out.Send(ctx, 1); err != nil {
+		return err
+	}
+	return s.Out.Close(ctx)
+}
+
+// forgetful doesn't acknowledge the first delivery of a packet and
+// waits until it's cancelled, the later deliveries are acknowledged.
+type forgetful struct {
+	In flow.AckIn[int]
+
+	attempts chan int
+}
+
+func (f *forgetful) Run(ctx context.Context) error {
+	for {
+		d, err := f.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			// cancelled for a restart or a replacement
+			return nil
+		}
+		f.attempts <- d.Attempt
+		if d.Attempt == 1 {
+			<-ctx.Done()
+			return nil
+		}
+		d.Ack()
+	}
+}
+
+// next returns the attempt of the next delivery, zero when ctx is done.
+func (f *forgetful) next(ctx context.Context) int {
+	select {
+	case attempt := <-f.attempts:
+		return attempt
+	case <-ctx.Done():
+		return 0
+	}
+}
+
+func TestAckRestartOnStall(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var net flow.Network
+	src := &ackSource{}
+	dst := &forgetful{attempts: make(chan int, 2)}
+	net.Add(src, dst)
+	if _, err := flow.ConnectAck(&src.Out, &dst.In); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.Configure(dst, flow.WithStallTimeout(20*time.Millisecond), flow.WithRestartOnStall()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := net.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []int{1, 2} {
+		if attempt := dst.next(ctx); attempt != expected {
+			t.Fatalf("delivered on attempt %d, expected %d", attempt, expected)
+		}
+	}
+}
+
+// waiter receives a packet and waits for the next one
+// without acknowledging it.
+type waiter struct {
+	In flow.AckIn[int]
+
+	received chan struct{}
+}
+
+func (w *waiter) Run(ctx context.Context) error {
+	if _, err := w.In.Recv(ctx); err != nil {
+		return err
+	}
+	close(w.received)
+	_, err := w.In.Recv(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func TestReplaceAck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var net flow.Network
+	src := &ackSource{}
+	old := &waiter{received: make(chan struct{})}
+	net.Add(src, old)
+	conn, err := flow.ConnectAck(&src.Out, &old.In)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- net.Run(ctx) }()
+
+	<-old.received
+	dst := &forgetful{attempts: make(chan int, 1)}
+	if err := net.Replace(ctx, old, dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if attempt := dst.next(ctx); attempt != 2 {
+		t.Fatalf("delivered on attempt %d, expected 2", attempt)
+	}
+	if conn.Unacked() != 0 {
+		t.Fatalf("%d packets unacknowledged", conn.Unacked())
+	}
+}
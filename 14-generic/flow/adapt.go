@@ -0,0 +1,161 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Adapter is a connection between ports of different types,
+// which converts every packet on the way.
+//
+// It's also a Component, which does the conversion.
+type Adapter[A, B any] struct {
+	in      In[A]
+	out     Out[B]
+	convert func(A) B
+
+	src *Conn[A]
+	dst *Conn[B]
+}
+
+// Adapt connects ports of different types with a converter.
+// The options configure the connection from the adapter to the In port.
+//
+// When either of the ports has been added to a network, the adapter is
+// added to the same network, otherwise the caller must run it. Adapt must
+// be called before the network is started and it's not supported by
+// RunSequential. For a conversion within a type, WithMap avoids the
+// adapter. Like Connect, Adapt returns an error when to is already
+// connected.
+func Adapt[A, B any](from *Out[A], to *In[B], convert func(A) B, opts ...ConnOption) (*Adapter[A, B], error) {
+	a := &Adapter[A, B]{convert: convert}
+
+	net := from.boundTo().net
+	if net == nil {
+		net = to.boundTo().net
+	}
+	name := portName(from.boundTo()) + " -> " + portName(to.boundTo())
+	a.in.bind(binding{net: net, name: "adapt(" + name + ")"})
+	a.out.bind(binding{net: net, name: "adapt(" + name + ")"})
+
+	var err error
+	if a.dst, err = Connect(&a.out, to, opts...); err != nil {
+		return nil, err
+	}
+	if a.src, err = Connect(from, &a.in); err != nil {
+		a.dst.Disconnect()
+		return nil, err
+	}
+	if net != nil {
+		net.addNamed(net.uniqueName("adapt"), a)
+	}
+	return a, nil
+}
+
+// Disconnect disconnects the ports.
+func (a *Adapter[A, B]) Disconnect() {
+	a.src.Disconnect()
+	a.dst.Disconnect()
+}
+
+// String returns the port names of the connection.
+func (a *Adapter[A, B]) String() string {
+	return portName(a.src.from.bound) + " -> " + portName(a.dst.to.bound)
+}
+
+// packets returns the number of converted packets delivered to the receiver.
+func (a *Adapter[A, B]) packets() uint64 { return a.dst.packets() }
+
+// Run converts the packets until end of stream.
+func (a *Adapter[A, B]) Run(ctx context.Context) error {
+	for {
+		v, err := a.in.Recv(ctx)
+		if errors.Is(err, EOS) {
+			return a.out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if err := a.out.Send(ctx, a.convert(v)); err != nil {
+			return err
+		}
+	}
+}
+
+// idle lets RunToCompletion finish while the adapter waits for packets.
+func (a *Adapter[A, B]) idle() bool {
+	blocked, _ := a.in.activity()
+	return blocked
+}
+
+var conversions struct {
+	sync.Mutex
+	adapt map[[2]reflect.Type]func(from outPort, to inPort, opts []ConnOption) (Connection, bool, error)
+}
+
+// RegisterConversion makes Network.WireUp connect an Out[A] to an In[B]
+// through an adapter using convert.
+//
+// RegisterConversion panics when the conversion is already registered.
+func RegisterConversion[A, B any](convert func(A) B) {
+	key := [2]reflect.Type{
+		reflect.TypeOf((*A)(nil)).Elem(),
+		reflect.TypeOf((*B)(nil)).Elem(),
+	}
+
+	conversions.Lock()
+	defer conversions.Unlock()
+	if _, dup := conversions.adapt[key]; dup {
+		panic(fmt.Sprintf("flow: RegisterConversion called twice for %v to %v", key[0], key[1]))
+	}
+	if conversions.adapt == nil {
+		conversions.adapt = make(map[[2]reflect.Type]func(outPort, inPort, []ConnOption) (Connection, bool, error))
+	}
+	conversions.adapt[key] = func(from outPort, to inPort, opts []ConnOption) (Connection, bool, error) {
+		out, ok := from.(*Out[A])
+		if !ok {
+			return nil, false, nil
+		}
+		in, ok := to.(*In[B])
+		if !ok {
+			return nil, false, nil
+		}
+		a, err := Adapt(out, in, convert, opts...)
+		if err != nil {
+			return nil, true, err
+		}
+		return a, true, nil
+	}
+}
+
+// connectPorts connects the ports directly, through a registered
+// conversion or through a bridge when one of them is an interface.
+func (net *Network) connectPorts(src outPort, dst inPort, opts ...ConnOption) (Connection, error) {
+	if isConnected(dst) {
+		return nil, errInConnected(dst)
+	}
+
+	key := [2]reflect.Type{src.elemType(), dst.elemType()}
+	if key[0] != key[1] {
+		conversions.Lock()
+		adapt, ok := conversions.adapt[key]
+		conversions.Unlock()
+		if ok {
+			if conn, ok, err := adapt(src, dst, opts); ok {
+				return conn, err
+			}
+		}
+	}
+
+	bridged, err := needsBridge(key[0], key[1])
+	if err != nil {
+		return nil, err
+	}
+	if bridged {
+		return net.bridgePorts(src, dst, opts...)
+	}
+	return src.connect(dst, opts...)
+}
@@ -0,0 +1,126 @@
+package flow
+
+import "sync"
+
+// WithAdaptive makes the connection use a queue, whose capacity adapts
+// to the traffic within min and max. Multiple goroutines may Send
+// concurrently.
+//
+// The capacity is reconsidered every time capacity values have been
+// received: it's doubled when the sender found the queue full and it's
+// halved when the queue stayed at most a quarter full. A bursty sender
+// gets a larger buffer, while a steady one keeps the memory use low.
+func WithAdaptive(min, max int) ConnOption {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return func(c *connConfig) {
+		c.ring = adaptiveRing
+		c.size, c.max = min, max
+	}
+}
+
+// adaptive is a circular buffer that is resized based on blocking.
+type adaptive[T any] struct {
+	mu    sync.Mutex
+	buf   []T
+	head  int
+	count int
+
+	min, max int
+
+	// statistics since the capacity was last reconsidered
+	received int
+	blocked  bool
+	peak     int
+}
+
+func newAdaptive[T any](min, max int) *adaptive[T] {
+	return &adaptive[T]{buf: make([]T, min), min: min, max: max}
+}
+
+func (q *adaptive[T]) push(v T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.count >= len(q.buf) {
+		q.blocked = true
+		return false
+	}
+	q.buf[(q.head+q.count)%len(q.buf)] = v
+	q.count++
+	if q.count > q.peak {
+		q.peak = q.count
+	}
+	return true
+}
+
+func (q *adaptive[T]) pop() (v T, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.count == 0 {
+		return v, false
+	}
+	v = q.buf[q.head]
+	q.buf[q.head] = *new(T)
+	q.head = (q.head + 1) % len(q.buf)
+	q.count--
+
+	q.received++
+	if q.received >= len(q.buf) {
+		q.adapt()
+	}
+	return v, true
+}
+
+// adapt resizes the buffer, q.mu must be held.
+func (q *adaptive[T]) adapt() {
+	size := len(q.buf)
+	switch {
+	case q.blocked && size < q.max:
+		size *= 2
+		if size > q.max {
+			size = q.max
+		}
+	case !q.blocked && q.peak <= size/4 && size > q.min:
+		size /= 2
+		if size < q.min {
+			size = q.min
+		}
+		if size < q.count {
+			size = q.count
+		}
+	}
+	if size != len(q.buf) {
+		buf := make([]T, size)
+		for i := 0; i < q.count; i++ {
+			buf[i] = q.buf[(q.head+i)%len(q.buf)]
+		}
+		q.buf, q.head = buf, 0
+	}
+	q.received, q.blocked, q.peak = 0, false, q.count
+}
+
+func (q *adaptive[T]) values() []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	vs := make([]T, q.count)
+	for i := range vs {
+		vs[i] = q.buf[(q.head+i)%len(q.buf)]
+	}
+	return vs
+}
+
+func (q *adaptive[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+func (q *adaptive[T]) cap() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.buf)
+}
@@ -0,0 +1,225 @@
+package flow
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+)
+
+// Status describes the activity of a running network at some moment.
+type Status struct {
+	Time        time.Time         `json:"time"`
+	Paused      bool              `json:"paused,omitempty"`
+	Components  []ComponentStatus `json:"components"`
+	Connections []ConnStatus      `json:"connections"`
+}
+
+// ComponentStatus describes what a component is doing.
+type ComponentStatus struct {
+	Name  Name  `json:"name"`
+	State State `json:"state"`
+	// Stalls is the number of times the component stalled,
+	// see WithStallTimeout.
+	Stalls uint64 `json:"stalls,omitempty"`
+}
+
+// State is the state of a component derived from its ports.
+type State string
+
+const (
+	// Running components are neither blocked sending nor receiving.
+	Running = State("running")
+	// Sending components are blocked sending to one of their Out ports.
+	Sending = State("sending")
+	// Receiving components wait for input on one of their In ports.
+	Receiving = State("receiving")
+)
+
+// ConnStatus describes the traffic on a connection.
+type ConnStatus struct {
+	Name  string    `json:"name"`
+	State ConnState `json:"state,omitempty"`
+	// Packets is the total number of delivered packets, see ConnStats.
+	Packets uint64 `json:"packets"`
+	// Queued is the number of packets waiting to be received.
+	Queued int `json:"queued"`
+	// Capacity is the number of packets the connection can queue,
+	// it changes over time with WithAdaptive.
+	Capacity int `json:"capacity,omitempty"`
+	// Unacked is the number of unacknowledged packets on an AckConn.
+	Unacked int `json:"unacked,omitempty"`
+	// Filtered is the number of packets dropped or diverted by the
+	// filter of the connection, see WithFilter.
+	Filtered uint64 `json:"filtered,omitempty"`
+	// Cancelled is the number of cancelled packets dropped by the
+	// connection, see Network.ContextCancel.
+	Cancelled uint64 `json:"cancelled,omitempty"`
+}
+
+// queuer is implemented by connections that buffer packets.
+type queuer interface {
+	queued() int
+}
+
+// Status returns the current activity of the network.
+func (net *Network) Status() Status {
+	conns := net.Connections()
+	net.mu.Lock()
+	components := append([]Component(nil), net.components...)
+	net.mu.Unlock()
+
+	status := Status{
+		Time:        time.Now(),
+		Paused:      net.Paused(),
+		Components:  make([]ComponentStatus, 0, len(components)),
+		Connections: make([]ConnStatus, 0, len(conns)),
+	}
+
+	for _, c := range components {
+		name, _ := net.Name(c)
+		status.Components = append(status.Components, ComponentStatus{
+			Name:   name,
+			State:  stateOf(c),
+			Stalls: net.stallsOf(c),
+		})
+	}
+	sort.Slice(status.Components, func(i, k int) bool {
+		return status.Components[i].Name < status.Components[k].Name
+	})
+
+	for _, conn := range conns {
+		s := ConnStatus{Name: conn.String()}
+		if c, ok := conn.(counter); ok {
+			s.Packets = c.packets()
+		}
+		if q, ok := conn.(queuer); ok {
+			s.Queued = q.queued()
+		}
+		if c, ok := conn.(interface{ State() ConnState }); ok {
+			s.State = c.State()
+		}
+		if c, ok := conn.(interface{ Capacity() int }); ok {
+			s.Capacity = c.Capacity()
+		}
+		if u, ok := conn.(interface{ Unacked() int }); ok {
+			s.Unacked = u.Unacked()
+		}
+		if f, ok := conn.(interface{ Filtered() uint64 }); ok {
+			s.Filtered = f.Filtered()
+		}
+		if c, ok := conn.(interface{ Cancelled() uint64 }); ok {
+			s.Cancelled = c.Cancelled()
+		}
+		status.Connections = append(status.Connections, s)
+	}
+	sort.Slice(status.Connections, func(i, k int) bool {
+		return status.Connections[i].Name < status.Connections[k].Name
+	})
+	return status
+}
+
+// stateOf derives the state of the component from its ports,
+// similarly to RunToCompletion.
+func stateOf(c Component) State {
+	receiving := false
+	for _, p := range portsOf(c) {
+		switch p := p.(type) {
+		case outPort:
+			if p.sending() {
+				return Sending
+			}
+		case inPort:
+			blocked, _ := p.activity()
+			receiving = receiving || blocked
+		}
+	}
+	if idler, ok := c.(idler); ok {
+		receiving = idler.idle()
+	}
+	if receiving {
+		return Receiving
+	}
+	return Running
+}
+
+// AdminHandler returns a handler, which serves the Status of the
+// network as JSON. It's used by the flow top command.
+//
+// Paths ending with /health serve the Health of the network instead,
+// with status 503 when it's unhealthy, e.g. for a Kubernetes probe.
+// Paths ending with /profile serve the Profile of Network.Profiler.
+// Paths ending with /values/Name serve the value Name of Network.Values,
+// a PUT or POST with a JSON body, which must decode into the type of
+// the current value, updates it.
+func (net *Network) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if dir, name := path.Split(r.URL.Path); name != "" && path.Base(dir) == "values" {
+			net.serveValue(w, r, name)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		var result any = net.Status()
+		if path.Base(r.URL.Path) == "health" {
+			health := net.Health(r.Context())
+			if !health.Healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			result = health
+		}
+		if path.Base(r.URL.Path) == "profile" {
+			if net.Profiler == nil {
+				http.Error(w, "network has no profiler", http.StatusNotFound)
+				return
+			}
+			result = net.Profiler.Profile()
+		}
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(result)
+	})
+}
+
+// maxValueSize limits the size of a value updated with AdminHandler.
+const maxValueSize = 1 << 20
+
+// serveValue serves and updates the value called name.
+func (net *Network) serveValue(w http.ResponseWriter, r *http.Request, name string) {
+	v, ok := net.Values.Get(name)
+	if !ok {
+		http.Error(w, "value "+name+" does not exist", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(v)
+	case http.MethodPut, http.MethodPost:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := net.Values.setJSON(name, data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,50 @@
+package flow_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fbp.example/flow"
+)
+
+func TestAdminValues(t *testing.T) {
+	var net flow.Network
+	if err := net.Values.Set("rate", 5); err != nil {
+		t.Fatal(err)
+	}
+	handler := net.AdminHandler()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := serve(http.MethodPut, "/values/rate", "7"); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT: status %d: %s", w.Code, w.Body)
+	}
+	if v, _ := net.Values.Get("rate"); v != 7 {
+		t.Fatalf("rate is %v, expected 7", v)
+	}
+	if w := serve(http.MethodGet, "/values/rate", ""); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "7" {
+		t.Fatalf("GET: status %d: %s", w.Code, w.Body)
+	}
+
+	if w := serve(http.MethodPost, "/values/rate", `"fast"`); w.Code != http.StatusBadRequest {
+		t.Fatalf("POST of a string: status %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+	if v, _ := net.Values.Get("rate"); v != 7 {
+		t.Fatalf("rate changed to %v by an invalid update", v)
+	}
+	if w := serve(http.MethodPut, "/values/missing", "1"); w.Code != http.StatusNotFound {
+		t.Fatalf("PUT of a missing value: status %d, expected %d", w.Code, http.StatusNotFound)
+	}
+	if w := serve(http.MethodDelete, "/values/rate", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("DELETE: status %d, expected %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w := serve(http.MethodPut, "/status", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT of the status: status %d, expected %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,122 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// InAny receives values of any type, it's useful for components
+// whose types are only known at runtime.
+//
+// Network.WireUp connects typed ports to InAny and OutAny ports through
+// a bridge, which fails the network when an OutAny sends a value that
+// doesn't fit the receiving port.
+type InAny = In[any]
+
+// OutAny sends values of any type, see InAny.
+type OutAny = Out[any]
+
+// As asserts that v has type T.
+func As[T any](v any) (T, error) {
+	tv, ok := v.(T)
+	if !ok {
+		return tv, fmt.Errorf("expected %v, got %T", reflect.TypeOf((*T)(nil)).Elem(), v)
+	}
+	return tv, nil
+}
+
+// RecvAs receives a value from in and asserts that it has type T.
+func RecvAs[T any](ctx context.Context, in *InAny) (T, error) {
+	v, err := in.Recv(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return As[T](v)
+}
+
+// needsBridge reports whether the types differ, but may be compatible
+// at runtime, because one of them is an interface.
+func needsBridge(from, to reflect.Type) (bool, error) {
+	if from == to {
+		return false, nil
+	}
+	switch {
+	case to.Kind() == reflect.Interface && from.AssignableTo(to):
+		return true, nil
+	case from.Kind() == reflect.Interface && (to.Kind() == reflect.Interface || to.Implements(from)):
+		return true, nil
+	case from.Kind() == reflect.Interface || to.Kind() == reflect.Interface:
+		return false, fmt.Errorf("cannot connect %v to %v", from, to)
+	}
+	return false, nil
+}
+
+// bridgePorts connects ports of different types, which are compatible
+// at runtime, with an untyped forwarder.
+// The options apply to the connection from the bridge to dst.
+func (net *Network) bridgePorts(src outPort, dst inPort, opts ...ConnOption) (Connection, error) {
+	name := portName(src.boundTo()) + " -> " + portName(dst.boundTo())
+	b := &bridge{name: name}
+
+	b.in = src.newIn()
+	b.in.bind(binding{net: net, name: "bridge(" + name + ")"})
+	b.out = dst.newOut()
+	b.out.bind(binding{net: net, name: "bridge(" + name + ")"})
+
+	var err error
+	if b.src, err = src.connect(b.in); err != nil {
+		return nil, err
+	}
+	if b.dst, err = b.out.connect(dst, opts...); err != nil {
+		b.src.Disconnect()
+		return nil, err
+	}
+	net.addNamed(net.uniqueName("bridge"), b)
+	return b, nil
+}
+
+// bridge forwards values between ports of different types.
+type bridge struct {
+	name string
+	in   inPort
+	out  outPort
+
+	src, dst Connection
+}
+
+func (b *bridge) Run(ctx context.Context) error {
+	for {
+		v, err := b.in.recvAny(ctx)
+		if errors.Is(err, EOS) {
+			return b.out.closeAny(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if err := b.out.sendAny(ctx, v); err != nil {
+			return fmt.Errorf("%s: %w", b.name, err)
+		}
+	}
+}
+
+func (b *bridge) idle() bool {
+	blocked, _ := b.in.activity()
+	return blocked
+}
+
+func (b *bridge) Disconnect() {
+	b.src.Disconnect()
+	b.dst.Disconnect()
+}
+
+func (b *bridge) packets() uint64 {
+	if c, ok := b.dst.(counter); ok {
+		return c.packets()
+	}
+	return 0
+}
+
+func (b *bridge) String() string { return b.name }
@@ -0,0 +1,287 @@
+// Package bench measures the throughput of standard pipelines.
+//
+// Each pipeline sends a number of integers from a source to a sink
+// through pass-through components, the result is the time it took for
+// all of them to arrive:
+//
+//	r, err := bench.Run(ctx, bench.Pipelines[0], bench.Transports[0], 1e6)
+//	fmt.Println(r)
+//
+// The benchmarks of the package run the pipelines over every transport,
+// so that regressions are caught with the usual tools:
+//
+//	go test -bench . fbp.example/flow/bench
+//
+// The command flow bench runs all the combinations.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/std"
+)
+
+// Shape is the layout of a pipeline.
+type Shape int
+
+const (
+	// Chain connects Width components in a row.
+	Chain Shape = iota
+	// FanOutIn distributes the values round-robin over Width components
+	// and merges them back.
+	FanOutIn
+	// Router sends each value to one of Width components by its value
+	// and merges them back.
+	Router
+)
+
+// The fan-in reads the inputs in turn, because the components started
+// by an unordered merge can't run with RunSequential. This works as the
+// values are sequential and spread evenly by both shapes.
+
+// Pipeline is a standard pipeline.
+type Pipeline struct {
+	Name  string
+	Shape Shape
+	Width int
+}
+
+// Pipelines contains the standard pipelines.
+var Pipelines = []Pipeline{
+	{Name: "chain-1", Shape: Chain, Width: 1},
+	{Name: "chain-10", Shape: Chain, Width: 10},
+	{Name: "fan-4", Shape: FanOutIn, Width: 4},
+	{Name: "router-4", Shape: Router, Width: 4},
+}
+
+// Transport is a way of moving the values through the pipeline.
+type Transport struct {
+	Name string
+	// Batch sends the values in slices of Batch values,
+	// zero sends them one by one.
+	Batch int
+	// Conn configures the connections.
+	Conn []flow.ConnOption
+	// Run runs the network until all the components have returned,
+	// e.g. (*flow.Network).Run.
+	Run func(net *flow.Network, ctx context.Context) error
+}
+
+// Transports contains the standard transports.
+var Transports = []Transport{
+	{Name: "chan", Run: (*flow.Network).Run},
+	{Name: "spsc", Conn: []flow.ConnOption{flow.WithSPSC(1024)}, Run: (*flow.Network).Run},
+	{Name: "adaptive", Conn: []flow.ConnOption{flow.WithAdaptive(1, 1024)}, Run: (*flow.Network).Run},
+	{Name: "sequential", Run: (*flow.Network).RunSequential},
+	{Name: "batch-64", Batch: 64, Run: (*flow.Network).Run},
+}
+
+// Result is the measured throughput.
+type Result struct {
+	Pipeline  string
+	Transport string
+	// Values is the number of values that arrived at the sink.
+	Values  int
+	Elapsed time.Duration
+}
+
+// PerSecond returns the number of values per second.
+func (r Result) PerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Values) / r.Elapsed.Seconds()
+}
+
+// NsPerValue returns the average time per value.
+func (r Result) NsPerValue() float64 {
+	if r.Values == 0 {
+		return 0
+	}
+	return float64(r.Elapsed.Nanoseconds()) / float64(r.Values)
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s/%s: %d values in %v, %.0f values/s, %.1f ns/value",
+		r.Pipeline, r.Transport, r.Values, r.Elapsed, r.PerSecond(), r.NsPerValue())
+}
+
+// Run sends n values through the pipeline.
+func Run(ctx context.Context, p Pipeline, t Transport, n int) (Result, error) {
+	net := &flow.Network{}
+	var arrived func() int
+	var err error
+	if t.Batch > 0 {
+		size := t.Batch
+		arrived, err = build(net, p, t.Conn, packets[[]int]{
+			count: (n + size - 1) / size,
+			make: func(i int) []int {
+				batch := make([]int, 0, size)
+				for v := i * size; v < n && len(batch) < size; v++ {
+					batch = append(batch, v)
+				}
+				return batch
+			},
+			size: func(batch []int) int { return len(batch) },
+			key:  func(batch []int) int { return batch[0] / size },
+		})
+	} else {
+		arrived, err = build(net, p, t.Conn, packets[int]{
+			count: n,
+			make:  func(i int) int { return i },
+			size:  func(int) int { return 1 },
+			key:   func(v int) int { return v },
+		})
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	start := time.Now()
+	err = t.Run(net, ctx)
+	r := Result{
+		Pipeline:  p.Name,
+		Transport: t.Name,
+		Values:    arrived(),
+		Elapsed:   time.Since(start),
+	}
+	if err != nil {
+		return r, err
+	}
+	if r.Values != n {
+		return r, fmt.Errorf("%s/%s: %d of %d values arrived", p.Name, t.Name, r.Values, n)
+	}
+	return r, nil
+}
+
+// packets describes the packets sent through a pipeline.
+type packets[T any] struct {
+	count int
+	make  func(i int) T
+	// size is the number of values in the packet.
+	size func(T) int
+	// key is used by Router.
+	key func(T) int
+}
+
+// build adds the pipeline to the network, arrived returns the number
+// of values received by the sink.
+func build[T any](net *flow.Network, p Pipeline, opts []flow.ConnOption, packets packets[T]) (arrived func() int, err error) {
+	if p.Width <= 0 {
+		return nil, errors.New("pipeline " + p.Name + " has no components")
+	}
+
+	src := &source[T]{packets: packets}
+	dst := &sink[T]{size: packets.size}
+	net.AddNamed("source", src)
+	net.AddNamed("sink", dst)
+
+	// connect keeps the first error
+	connect := func(from *flow.Out[T], to *flow.In[T]) {
+		if err == nil {
+			_, err = flow.Connect(from, to, opts...)
+		}
+	}
+
+	switch p.Shape {
+	case Chain:
+		out := &src.Out
+		for i := 0; i < p.Width; i++ {
+			stage := &pass[T]{}
+			net.AddNamed(flow.Name("pass"+strconv.Itoa(i)), stage)
+			connect(out, &stage.In)
+			out = &stage.Out
+		}
+		connect(out, &dst.In)
+
+	case FanOutIn, Router:
+		next := -1
+		route := func(T) int {
+			next = (next + 1) % p.Width
+			return next
+		}
+		if p.Shape == Router {
+			route = func(v T) int { return packets.key(v) % p.Width }
+		}
+		split := std.NewSplit[T](p.Width, route)
+		net.AddNamed("split", split)
+		connect(&src.Out, &split.In)
+
+		merge := std.NewMerge[T](p.Width, true)
+		for i := range split.Out {
+			stage := &pass[T]{}
+			net.AddNamed(flow.Name("pass"+strconv.Itoa(i)), stage)
+			connect(&split.Out[i], &stage.In)
+			connect(&stage.Out, &merge.In[i])
+		}
+		net.AddNamed("merge", merge)
+		connect(&merge.Out, &dst.In)
+
+	default:
+		return nil, fmt.Errorf("pipeline %s has unknown shape %d", p.Name, p.Shape)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() int { return dst.count }, nil
+}
+
+type source[T any] struct {
+	Out flow.Out[T]
+
+	packets packets[T]
+}
+
+func (s *source[T]) Run(ctx context.Context) error {
+	for i := 0; i < s.packets.count; i++ {
+		if err := s.Out.Send(ctx, s.packets.make(i)); err != nil {
+			return err
+		}
+	}
+	return s.Out.Close(ctx)
+}
+
+type pass[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+}
+
+func (p *pass[T]) Run(ctx context.Context) error {
+	for {
+		v, err := p.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return p.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+type sink[T any] struct {
+	In flow.In[T]
+
+	size  func(T) int
+	count int
+}
+
+func (s *sink[T]) Run(ctx context.Context) error {
+	for {
+		v, err := s.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.count += s.size(v)
+	}
+}
@@ -0,0 +1,48 @@
+package bench_test
+
+import (
+	"context"
+	"testing"
+
+	"fbp.example/flow/bench"
+)
+
+func TestRun(t *testing.T) {
+	for _, p := range bench.Pipelines {
+		for _, tr := range bench.Transports {
+			t.Run(p.Name+"/"+tr.Name, func(t *testing.T) {
+				r, err := bench.Run(context.Background(), p, tr, 1000)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r.Values != 1000 {
+					t.Fatalf("%d values arrived, expected 1000", r.Values)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkChain(b *testing.B)  { benchmark(b, bench.Chain) }
+func BenchmarkFanOut(b *testing.B) { benchmark(b, bench.FanOutIn) }
+func BenchmarkRouter(b *testing.B) { benchmark(b, bench.Router) }
+
+// benchmark sends b.N values through the pipelines of the shape over
+// each transport and reports the throughput as values/s.
+func benchmark(b *testing.B, shape bench.Shape) {
+	for _, p := range bench.Pipelines {
+		if p.Shape != shape {
+			continue
+		}
+		for _, t := range bench.Transports {
+			b.Run(p.Name+"/"+t.Name, func(b *testing.B) {
+				b.ReportAllocs()
+				r, err := bench.Run(context.Background(), p, t, b.N)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(r.PerSecond(), "values/s")
+			})
+		}
+	}
+}
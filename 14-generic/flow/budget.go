@@ -0,0 +1,195 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Budget limits how much a component can process.
+type Budget struct {
+	// Procs limits how many instances of the component process packets
+	// at the same time, similarly to GOMAXPROCS. This mostly matters
+	// for components created with Scale. Zero means no limit.
+	Procs int
+	// Rate limits how many packets per second the component receives.
+	// Zero means no limit.
+	Rate float64
+	// Burst is how many packets can be received at once, when
+	// the component has been idle. Values below 1 are treated as 1.
+	Burst int
+}
+
+// WithRateLimit limits the deliveries over the connection to n per
+// duration, making Send wait when the upstream is faster. Up to n
+// packets are delivered at once after an idle period. With RunSequential
+// the wait holds up the whole network.
+func WithRateLimit(n int, per time.Duration) ConnOption {
+	return func(c *connConfig) {
+		if n > 0 && per > 0 {
+			c.rate = float64(n) / per.Seconds()
+			c.burst = n
+		}
+	}
+}
+
+// SetBudget limits the processing of component c.
+//
+// An instance of the component is considered to be processing while
+// any of its inputs holds a packet, i.e. from the moment Recv returns
+// a packet until Recv is called again on the same input.
+// SetBudget must be called before the network is started.
+func (net *Network) SetBudget(c Component, budget Budget) error {
+	if budget.Procs < 0 || budget.Rate < 0 {
+		return errors.New("budget cannot be negative")
+	}
+	name, ok := net.Name(c)
+	if !ok {
+		return errors.New("component is not part of the network")
+	}
+
+	b := newBudget(budget)
+	bindLimit := func(ports map[string]port, instance string) {
+		h := &holder{budget: b}
+		for field, p := range ports {
+			p.bind(binding{net: net, name: instance + "." + field, limit: &limiter{holder: h}})
+		}
+	}
+
+	if inst, ok := c.(instancer); ok {
+		for i, instance := range inst.instances() {
+			bindLimit(portsOf(instance), string(name)+"#"+strconv.Itoa(i))
+		}
+		// the shared ports are only used for dispatching
+		for field, p := range portsOf(c) {
+			p.bind(binding{net: net, name: string(name) + "." + field})
+		}
+		return nil
+	}
+
+	bindLimit(portsOf(c), string(name))
+	return nil
+}
+
+// instancer is implemented by components that run multiple instances.
+type instancer interface {
+	instances() []Component
+}
+
+// budget is the shared state between the instances of a component.
+type budget struct {
+	procs chan struct{}
+
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBudget(b Budget) *budget {
+	x := &budget{rate: b.Rate, burst: float64(b.Burst)}
+	if b.Procs > 0 {
+		x.procs = make(chan struct{}, b.Procs)
+	}
+	if x.burst < 1 {
+		x.burst = 1
+	}
+	x.tokens = x.burst
+	return x
+}
+
+// take waits until a packet can be received according to the rate.
+func (b *budget) take(ctx context.Context) error {
+	if b.rate <= 0 {
+		return nil
+	}
+	clock := ClockFrom(ctx)
+	for {
+		b.mu.Lock()
+		now := clock.Now()
+		if !b.last.IsZero() {
+			b.tokens += now.Sub(b.last).Seconds() * b.rate
+			if b.tokens > b.burst {
+				b.tokens = b.burst
+			}
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// holder tracks the budget usage of a single instance.
+type holder struct {
+	budget *budget
+
+	mu sync.Mutex
+	// held is the number of inputs holding a packet,
+	// the instance holds a proc while it is above zero.
+	held int
+}
+
+// limiter tracks the budget usage of a single input of an instance.
+type limiter struct {
+	holder *holder
+	// held is guarded by holder.mu.
+	held bool
+}
+
+// release is called before the input starts waiting for a packet.
+func (l *limiter) release() {
+	h := l.holder
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !l.held {
+		return
+	}
+	l.held = false
+	h.held--
+	if h.held == 0 {
+		<-h.budget.procs
+	}
+}
+
+// acquire is called after the input has received a packet.
+func (l *limiter) acquire(ctx context.Context) error {
+	h := l.holder
+	if err := h.budget.take(ctx); err != nil {
+		return err
+	}
+	if h.budget.procs == nil {
+		return nil
+	}
+
+	// the other inputs of the instance wait for the proc here,
+	// so that only one of them takes it
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.held == 0 {
+		select {
+		case h.budget.procs <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	l.held = true
+	h.held++
+	return nil
+}
@@ -0,0 +1,171 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+type sequence struct {
+	N   int
+	Out flow.Out[int]
+}
+
+func (s *sequence) Run(ctx context.Context) error {
+	for i := 0; i < s.N; i++ {
+		if err := s.Out.Send(ctx, i); err != nil {
+			return err
+		}
+	}
+	return s.Out.Close(ctx)
+}
+
+func TestBudgetMerge(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var net flow.Network
+	a, b := &sequence{N: 100}, &sequence{N: 100}
+	merge := std.NewMerge[int](2, false)
+	count := std.NewCount[int]()
+	net.Add(a, b, merge, count)
+	flowtest.Connect(t, &a.Out, &merge.In[0])
+	flowtest.Connect(t, &b.Out, &merge.In[1])
+	flowtest.Connect(t, &merge.Out, &count.In)
+	if err := net.SetBudget(merge, flow.Budget{Procs: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := net.RunToCompletion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := count.Value(); got != 200 {
+		t.Fatalf("counted %d, expected 200", got)
+	}
+}
+
+// pairs receives from both inputs concurrently and checks that
+// at most max instances hold a packet at the same time.
+type pairs struct {
+	A, B flow.In[int]
+
+	max    int32
+	active *int32
+	failed *int32
+}
+
+func (p *pairs) Run(ctx context.Context) error {
+	var mu sync.Mutex
+	holding := 0
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, in := range []*flow.In[int]{&p.A, &p.B} {
+		in := in
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, err := in.Recv(ctx)
+				if errors.Is(err, flow.EOS) {
+					return
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				mu.Lock()
+				if holding++; holding == 1 {
+					if atomic.AddInt32(p.active, 1) > p.max {
+						atomic.StoreInt32(p.failed, 1)
+					}
+				}
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				if holding--; holding == 0 {
+					atomic.AddInt32(p.active, -1)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+func TestBudgetProcs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var active, failed int32
+	var net flow.Network
+	a, b := &sequence{N: 50}, &sequence{N: 50}
+	p := &pairs{max: 1, active: &active, failed: &failed}
+	scaled := flow.Scale(p, 3)
+	net.Add(a, b, scaled)
+	flowtest.Connect(t, &a.Out, &p.A)
+	flowtest.Connect(t, &b.Out, &p.B)
+	if err := net.SetBudget(scaled, flow.Budget{Procs: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := net.RunToCompletion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&failed) != 0 {
+		t.Fatal("more than one instance was processing at the same time")
+	}
+}
+
+func TestRateLimitClock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	clock := flowtest.NewClock(time.Time{})
+	ctx = flow.WithClock(ctx, clock)
+
+	var out flow.Out[int]
+	var in flow.In[int]
+	flowtest.Connect(t, &out, &in, flow.WithSPSC(4), flow.WithRateLimit(1, time.Second))
+	if err := out.Send(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the budget is spent, the second packet waits for the clock
+	sent := make(chan error)
+	go func() { sent <- out.Send(ctx, 1) }()
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-sent:
+		t.Fatalf("send over the rate returned %v", err)
+	default:
+	}
+	clock.Advance(time.Second)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if v, err := in.Recv(ctx); err != nil || v != i {
+			t.Fatalf("received %d, %v, expected %d", v, err, i)
+		}
+	}
+}
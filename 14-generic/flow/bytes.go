@@ -0,0 +1,104 @@
+package flow
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	Bytes lets large payloads pass through a graph without copying,
+	including fan-outs where several components read the same data.
+
+	Every reference to Bytes is owned by one component. A component
+	sending the same Bytes to several outputs calls Retain once for
+	each extra output, e.g. std.Broadcast does it through the
+	package-level Retain. Every receiver calls Release once it's done,
+	the last Release returns the buffer to its pool.
+
+	The data is read with Data, which must not be modified, as the
+	other references see the same memory. Mutable returns the data for
+	modification only when there are no other references. Both panic
+	after the last Release, so that use after release is caught.
+*/
+
+// Bytes is a reference counted byte slice.
+type Bytes struct {
+	refs int32
+	data []byte
+	pool *BytesPool
+}
+
+// NewBytes wraps data with a single reference. The data is not
+// recycled after the last Release.
+func NewBytes(data []byte) *Bytes {
+	return &Bytes{refs: 1, data: data}
+}
+
+// Len returns the length of the data.
+func (b *Bytes) Len() int { return len(b.Data()) }
+
+// Data returns the data for reading.
+func (b *Bytes) Data() []byte {
+	if atomic.LoadInt32(&b.refs) <= 0 {
+		panic("flow: Bytes used after release")
+	}
+	return b.data
+}
+
+// Mutable returns the data for modification,
+// it panics when other references exist.
+func (b *Bytes) Mutable() []byte {
+	switch refs := atomic.LoadInt32(&b.refs); {
+	case refs <= 0:
+		panic("flow: Bytes used after release")
+	case refs > 1:
+		panic("flow: Bytes modified while shared")
+	}
+	return b.data
+}
+
+// Retain adds a reference, which must be released separately.
+func (b *Bytes) Retain() {
+	if atomic.AddInt32(&b.refs, 1) <= 1 {
+		panic("flow: Bytes retained after release")
+	}
+}
+
+// Release drops a reference, the last one recycles the buffer.
+func (b *Bytes) Release() {
+	switch refs := atomic.AddInt32(&b.refs, -1); {
+	case refs < 0:
+		panic("flow: Bytes released too many times")
+	case refs == 0 && b.pool != nil:
+		b.pool.pool.Put(b)
+	}
+}
+
+// BytesPool recycles the buffers of Bytes. It works best for payloads
+// of similar size, as a buffer is reused only when it's large enough.
+//
+// The zero value is ready to use.
+type BytesPool struct {
+	pool sync.Pool
+}
+
+// Get returns Bytes of length n with a single reference.
+// The contents are not cleared.
+func (pool *BytesPool) Get(n int) *Bytes {
+	b, ok := pool.pool.Get().(*Bytes)
+	if !ok || cap(b.data) < n {
+		b = &Bytes{data: make([]byte, n), pool: pool}
+	}
+	b.data = b.data[:n]
+	atomic.StoreInt32(&b.refs, 1)
+	return b
+}
+
+// Retain adds a reference to v when it's reference counted, such as
+// Bytes. Components sending a value to several outputs call it once
+// for each extra output.
+func Retain(v any) {
+	if r, ok := v.(interface{ Retain() }); ok {
+		r.Retain()
+	}
+}
@@ -0,0 +1,94 @@
+package flow
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Chaos randomly drops, duplicates and delays the packets sent by the
+// components of a network, see Network.Chaos, for testing how the graph
+// copes with them. The probabilities are between 0 and 1.
+//
+// The std package contains components doing the same on a single
+// connection, which can also reorder the packets.
+type Chaos struct {
+	// Drop is the probability of a packet being dropped and released,
+	// see Release.
+	Drop float64
+	// Duplicate is the probability of a packet being sent twice, the
+	// copies are the same value, hence it doesn't mix with the pooled
+	// packets nor with Network.TrackOwnership.
+	Duplicate float64
+	// Delay is the probability of a packet being delayed by a random
+	// duration up to MaxDelay before it's sent.
+	Delay    float64
+	MaxDelay time.Duration
+	// Seed seeds the random decisions, zero uses a random seed.
+	Seed int64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// chaos is the fate of a packet.
+type chaos struct {
+	drop      bool
+	duplicate bool
+	delay     time.Duration
+}
+
+// decide decides the fate of a packet.
+func (c *Chaos) decide() chaos {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rng == nil {
+		seed := c.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		c.rng = rand.New(rand.NewSource(seed))
+	}
+
+	var fate chaos
+	if c.rng.Float64() < c.Drop {
+		fate.drop = true
+		return fate
+	}
+	fate.duplicate = c.rng.Float64() < c.Duplicate
+	if c.rng.Float64() < c.Delay && c.MaxDelay > 0 {
+		fate.delay = time.Duration(c.rng.Int63n(int64(c.MaxDelay)))
+	}
+	return fate
+}
+
+// chaotic returns the chaos applied to the packets sent from the port,
+// nil when there's none. Only the ports of the nodes are affected.
+func (b binding) chaotic() *Chaos {
+	if b.net == nil || b.net.Chaos == nil {
+		return nil
+	}
+	if _, _, ok := b.node(); !ok {
+		return nil
+	}
+	return b.net.Chaos
+}
+
+// sendChaos sends v according to the fate decided by c.
+func (out *Out[T]) sendChaos(ctx context.Context, c *Chaos, v T, priority int) error {
+	fate := c.decide()
+	if fate.drop {
+		Release(v)
+		return nil
+	}
+	if err := Sleep(ctx, fate.delay); err != nil {
+		return err
+	}
+	if fate.duplicate {
+		if err := out.sendChecked(ctx, v, priority); err != nil {
+			return err
+		}
+	}
+	return out.sendChecked(ctx, v, priority)
+}
@@ -0,0 +1,176 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCheckpointInterval is the default time between checkpoints.
+const DefaultCheckpointInterval = time.Minute
+
+// CheckpointStore persists the checkpoints of a network.
+type CheckpointStore interface {
+	// Save replaces the previous checkpoint.
+	Save(ctx context.Context, snap *Snapshot) error
+	// Load returns the last saved checkpoint, nil when there is none.
+	Load(ctx context.Context) (*Snapshot, error)
+}
+
+// Checkpoints configures Network.RunCheckpointed.
+type Checkpoints struct {
+	Store CheckpointStore
+	// Interval is the time between checkpoints,
+	// defaults to DefaultCheckpointInterval.
+	Interval time.Duration
+	// Encoding encodes the pending packets, defaults to JSON.
+	Encoding Encoding
+}
+
+// RunCheckpointed runs the network like Run, saving a snapshot to the
+// store periodically. When the store contains a checkpoint, the network
+// is restored from it before starting, so that a crashed pipeline
+// resumes from the last checkpoint.
+//
+// The network is paused while taking the snapshot, once the deliveries
+// in progress have finished, see Network.Snapshot for what is included.
+// The interval is measured with Network.Clock.
+func (net *Network) RunCheckpointed(ctx context.Context, cp Checkpoints) error {
+	if cp.Store == nil {
+		return errors.New("checkpoint store must be specified")
+	}
+	interval := cp.Interval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+
+	last, err := cp.Store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load checkpoint: %w", err)
+	}
+	if last != nil {
+		if err := net.Restore(ctx, last, cp.Encoding); err != nil {
+			return err
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- net.Run(runCtx) }()
+
+	ticker := ClockFrom(net.withClock(ctx)).NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C():
+			if err := net.checkpoint(runCtx, cp); err != nil {
+				cancel()
+				<-done
+				return err
+			}
+		}
+	}
+}
+
+// checkpoint saves a snapshot of the paused network.
+func (net *Network) checkpoint(ctx context.Context, cp Checkpoints) error {
+	wasPaused := net.Paused()
+	net.Pause()
+	// the deliveries in progress finish before the snapshot is taken
+	err := net.settle(ctx)
+	var snap *Snapshot
+	if err == nil {
+		snap, err = net.Snapshot(ctx, cp.Encoding)
+	}
+	if !wasPaused {
+		net.Resume()
+	}
+	if err != nil {
+		return err
+	}
+	if err := cp.Store.Save(ctx, snap); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// FileStore stores the checkpoint as JSON in a file.
+//
+// The file is replaced atomically, so a crash while saving
+// keeps the previous checkpoint.
+type FileStore struct {
+	Path string
+}
+
+func (store FileStore) Save(ctx context.Context, snap *Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.Path, data)
+}
+
+// writeFileAtomic replaces the file at path with data, so that the
+// file contains either the previous or the new data after a crash.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (store FileStore) Load(ctx context.Context) (*Snapshot, error) {
+	data, err := os.ReadFile(store.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%s: %w", store.Path, err)
+	}
+	return &snap, nil
+}
+
+// MemoryStore keeps the checkpoint in memory, it's useful for testing.
+type MemoryStore struct {
+	mu   sync.Mutex
+	last *Snapshot
+}
+
+func (store *MemoryStore) Save(ctx context.Context, snap *Snapshot) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.last = snap
+	return nil
+}
+
+func (store *MemoryStore) Load(ctx context.Context) (*Snapshot, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.last, nil
+}
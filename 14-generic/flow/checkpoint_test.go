@@ -0,0 +1,164 @@
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+)
+
+// resumable sends the numbers up to N, remembering the next one
+// in its snapshot.
+type resumable struct {
+	Out flow.Out[int]
+	N   int
+
+	mu   sync.Mutex
+	next int
+}
+
+func (r *resumable) Run(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		next := r.next
+		r.mu.Unlock()
+		if next >= r.N {
+			return r.Out.Close(ctx)
+		}
+		if err := r.Out.Send(ctx, next); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.next++
+		r.mu.Unlock()
+	}
+}
+
+func (r *resumable) Snapshot(ctx context.Context) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.Marshal(r.next)
+}
+
+func (r *resumable) Restore(ctx context.Context, state []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.Unmarshal(state, &r.next)
+}
+
+// journal slowly collects the received values into its snapshot.
+type journal struct {
+	In flow.In[int]
+
+	mu     sync.Mutex
+	values []int
+}
+
+func (j *journal) Run(ctx context.Context) error {
+	for {
+		v, err := j.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		time.Sleep(100 * time.Microsecond)
+		j.mu.Lock()
+		j.values = append(j.values, v)
+		j.mu.Unlock()
+	}
+}
+
+func (j *journal) Values() []int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]int(nil), j.values...)
+}
+
+func (j *journal) Snapshot(ctx context.Context) ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return json.Marshal(j.values)
+}
+
+func (j *journal) Restore(ctx context.Context, state []byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return json.Unmarshal(state, &j.values)
+}
+
+func TestRunCheckpointedResume(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const n = 300
+	build := func() (*flow.Network, *journal) {
+		net := &flow.Network{}
+		src, dst := &resumable{N: n}, &journal{}
+		net.AddNamed("src", src)
+		net.AddNamed("dst", dst)
+		flowtest.Connect(t, &src.Out, &dst.In, flow.WithSPSC(8))
+		return net, dst
+	}
+
+	store := &flow.MemoryStore{}
+	clock := flowtest.NewClock(time.Time{})
+	net, dst := build()
+	net.Clock = clock
+
+	runCtx, crash := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- net.RunCheckpointed(runCtx, flow.Checkpoints{Store: store, Interval: time.Minute})
+	}()
+
+	for len(dst.Values()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// the ticker of the network clock triggers the checkpoint
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	for {
+		snap, err := store.Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap != nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("no checkpoint was saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	crash()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if len(dst.Values()) == n {
+		t.Fatal("the network finished before crashing")
+	}
+
+	resumed, dst := build()
+	if err := resumed.RunCheckpointed(ctx, flow.Checkpoints{Store: store}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every value is received once, in order
+	expected := make([]int, n)
+	for i := range expected {
+		expected[i] = i
+	}
+	if got := dst.Values(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("received %d values after resuming, expected 0..%d: %v", len(got), n-1, got)
+	}
+}
@@ -0,0 +1,91 @@
+package flow
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and creates timers.
+//
+// Components that depend on time should use ClockFrom(ctx) instead of
+// the time package, so that tests can control the time by setting
+// Network.Clock, see flowtest.Clock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the Clock equivalent of time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is the Clock equivalent of time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the Clock using the time package.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+type clockKey struct{}
+
+// WithClock returns a context, which makes ClockFrom return clock.
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// ClockFrom returns the clock of the network running the component,
+// RealClock when the network doesn't have one.
+func ClockFrom(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock
+	}
+	return RealClock
+}
+
+// Sleep waits for d according to the clock of ctx or until ctx is cancelled.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := ClockFrom(ctx).NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// withClock adds the clock of the network to ctx.
+func (net *Network) withClock(ctx context.Context) context.Context {
+	if net.Clock == nil {
+		return ctx
+	}
+	return WithClock(ctx, net.Clock)
+}
@@ -0,0 +1,63 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec converts values to bytes and back, so they can leave the process.
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte, v *T) error
+}
+
+// Encoding is the untyped form of Codec, used where the types
+// are only known at runtime.
+//
+// Unmarshal is given a pointer to the value.
+type Encoding interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSON encodes values with encoding/json.
+	JSON Encoding = jsonEncoding{}
+	// Gob encodes values with encoding/gob, each value is encoded
+	// separately including its type information.
+	Gob Encoding = gobEncoding{}
+)
+
+// CodecFor returns a Codec that uses enc.
+func CodecFor[T any](enc Encoding) Codec[T] { return typedCodec[T]{enc} }
+
+// JSONCodec returns a Codec that uses JSON.
+func JSONCodec[T any]() Codec[T] { return CodecFor[T](JSON) }
+
+// GobCodec returns a Codec that uses Gob.
+func GobCodec[T any]() Codec[T] { return CodecFor[T](Gob) }
+
+type typedCodec[T any] struct{ enc Encoding }
+
+func (c typedCodec[T]) Marshal(v T) ([]byte, error)       { return c.enc.Marshal(v) }
+func (c typedCodec[T]) Unmarshal(data []byte, v *T) error { return c.enc.Unmarshal(data, v) }
+
+type jsonEncoding struct{}
+
+func (jsonEncoding) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonEncoding) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobEncoding struct{}
+
+func (gobEncoding) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobEncoding) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
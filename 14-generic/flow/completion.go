@@ -0,0 +1,185 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// quiescencePoll is how often RunToCompletion checks whether the network has finished.
+const quiescencePoll = 5 * time.Millisecond
+
+// idler can be implemented by components that wait on something other than In ports.
+type idler interface {
+	// idle reports whether the component is waiting for an external event.
+	idle() bool
+}
+
+// receiving reports whether a component is blocked in Recv on one of
+// the inputs, while none of them has values waiting, and how many values
+// the inputs have received.
+func receiving(inputs []inPort) (blocked bool, received uint64) {
+	for _, in := range inputs {
+		if !in.empty() {
+			return false, 0
+		}
+		b, n := in.activity()
+		blocked = blocked || b
+		received += uint64(n)
+	}
+	return blocked, received
+}
+
+// RunToCompletion runs the network until all the sources have finished
+// and all the packets have been processed.
+//
+// Sources finish by returning from Run, which usually is accompanied by
+// closing their Out ports. The network is considered finished when every
+// remaining component is blocked in Recv and there are no pending packets
+// on any of its inputs.
+// At that point the remaining components are cancelled and
+// RunToCompletion returns.
+//
+// Components returning EOS are treated as finished successfully.
+// Lifecycle hooks are called the same way as in Run.
+func (net *Network) RunToCompletion(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(net.withClock(ctx))
+	defer cancel()
+
+	if err := net.initialize(ctx); err != nil {
+		return err
+	}
+
+	type tracked struct {
+		// mu protects component and inputs, which change with Replace
+		mu        sync.Mutex
+		component Component
+		inputs    []inPort
+		done      int32
+	}
+
+	track := func(t *tracked, c Component) {
+		inputs := inputsOf(c)
+		t.mu.Lock()
+		t.component, t.inputs = c, inputs
+		t.mu.Unlock()
+	}
+
+	all := make([]*tracked, 0, len(net.components))
+	for _, c := range net.components {
+		t := &tracked{}
+		track(t, c)
+		all = append(all, t)
+	}
+
+	// quiescent checks whether every running component is blocked in Recv.
+	quiescent := func() (bool, uint64) {
+		net.mu.Lock()
+		replacing := len(net.replacing)
+		net.mu.Unlock()
+		if replacing > 0 {
+			return false, 0
+		}
+
+		var total uint64
+		for _, t := range all {
+			if atomic.LoadInt32(&t.done) != 0 {
+				continue
+			}
+			t.mu.Lock()
+			component, inputs := t.component, t.inputs
+			t.mu.Unlock()
+
+			if idler, ok := component.(idler); ok {
+				if !idler.idle() {
+					return false, 0
+				}
+				continue
+			}
+
+			blocked, received := receiving(inputs)
+			if !blocked {
+				return false, 0
+			}
+			total += received
+		}
+		return true, total
+	}
+
+	var completed int32
+	var stopped sync.WaitGroup
+	stopped.Add(1)
+	stop := make(chan struct{})
+	go func() {
+		defer stopped.Done()
+		ticker := time.NewTicker(quiescencePoll)
+		defer ticker.Stop()
+
+		var last uint64
+		var idleTicks int
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			ok, total := quiescent()
+			if !ok || (idleTicks > 0 && total != last) {
+				idleTicks = 0
+				continue
+			}
+			last = total
+			idleTicks++
+			// require two consecutive stable observations to avoid
+			// catching a packet in the middle of a handoff
+			if idleTicks >= 2 {
+				atomic.StoreInt32(&completed, 1)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	await := net.hold()
+	var g errgroup.Group
+	for _, t := range all {
+		t := t
+		g.Go(func() error {
+			defer atomic.StoreInt32(&t.done, 1)
+			err := net.run(ctx, t.component, func(c Component) { track(t, c) })
+			if errors.Is(err, EOS) {
+				return nil
+			}
+			if err != nil && atomic.LoadInt32(&completed) != 0 && errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		})
+	}
+
+	var readyErr error
+	g.Go(func() error {
+		if readyErr = await(ctx); readyErr != nil {
+			cancel()
+		}
+		return nil
+	})
+	err := g.Wait()
+	if readyErr != nil {
+		err = readyErr
+	}
+	close(stop)
+	stopped.Wait()
+
+	if downErr := shutdown(ctx, net.components); err == nil {
+		err = downErr
+	}
+	return err
+}
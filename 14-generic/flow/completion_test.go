@@ -0,0 +1,67 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+)
+
+// silent returns without sending anything nor closing Out.
+type silent struct {
+	Out flow.Out[int]
+}
+
+func (s *silent) Run(ctx context.Context) error { return nil }
+
+// slowSide receives A and B concurrently, processing the values of B slowly.
+type slowSide struct {
+	A, B flow.In[int]
+
+	processed int32
+}
+
+func (s *slowSide) Run(ctx context.Context) error {
+	go func() {
+		for {
+			if _, err := s.A.Recv(ctx); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		_, err := s.B.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			<-ctx.Done()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		time.Sleep(30 * time.Millisecond)
+		atomic.AddInt32(&s.processed, 1)
+	}
+}
+
+func TestRunToCompletionQueuedInput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var net flow.Network
+	a, b, dst := &silent{}, &sequence{N: 3}, &slowSide{}
+	net.Add(a, b, dst)
+	flowtest.Connect(t, &a.Out, &dst.A)
+	flowtest.Connect(t, &b.Out, &dst.B, flow.WithSPSC(8))
+
+	// dst is blocked on A while B still has values queued
+	if err := net.RunToCompletion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&dst.processed); n != 3 {
+		t.Fatalf("processed %d values of B, expected 3", n)
+	}
+}
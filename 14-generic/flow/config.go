@@ -0,0 +1,173 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Config is an input port for the configuration of a component, which
+// replaces constructor parameters:
+//
+//	type Hello struct {
+//		Config flow.Config[HelloConfig]
+//		Out    flow.Out[string]
+//	}
+//
+//	func (h *Hello) Run(ctx context.Context) error {
+//		config, err := h.Config.Await(ctx)
+//		...
+//	}
+//
+// The configuration is usually given as an IIP, '{"count":3}' -> hello.Config,
+// but the port can be connected as any other In to receive live updates,
+// or updated with Network.Send. The configuration is kept between the
+// runs of the component.
+type Config[T any] struct {
+	In[T]
+
+	mu      sync.Mutex
+	value   T
+	version uint64
+	// changed is closed when the next configuration arrives
+	changed chan struct{}
+	// watching is set while receive is running
+	watching bool
+	// done is closed when receive returns with err
+	done chan struct{}
+	err  error
+}
+
+// configPort is implemented by Config, its In is wired in its place.
+type configPort interface {
+	configIn() port
+	setAny(v any)
+}
+
+func (c *Config[T]) configIn() port { return &c.In }
+
+func (c *Config[T]) setAny(v any) {
+	tv, _ := v.(T)
+	c.Set(tv)
+}
+
+// Await returns the configuration, waiting until the first one has
+// arrived. Afterwards the updates are received in the background until
+// ctx is cancelled or the port is closed, see Get and Changed.
+//
+// Await fails when the port is closed before any configuration arrives.
+func (c *Config[T]) Await(ctx context.Context) (T, error) {
+	if c.In.boundTo().sequential() != nil {
+		return c.awaitSequential(ctx)
+	}
+
+	c.mu.Lock()
+	if !c.watching {
+		c.watching = true
+		c.done = make(chan struct{})
+		go c.receive(ctx, c.done)
+	}
+	done := c.done
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		value, version := c.value, c.version
+		if c.changed == nil {
+			c.changed = make(chan struct{})
+		}
+		changed := c.changed
+		c.mu.Unlock()
+		if version > 0 {
+			return value, nil
+		}
+
+		select {
+		case <-changed:
+		case <-done:
+			c.mu.Lock()
+			value, version, err := c.value, c.version, c.err
+			c.mu.Unlock()
+			if version > 0 {
+				return value, nil
+			}
+			return value, fmt.Errorf("config %s: %w", portName(c.boundTo()), err)
+		case <-ctx.Done():
+			return value, ctx.Err()
+		}
+	}
+}
+
+// awaitSequential receives the first configuration in the calling
+// goroutine, as RunSequential doesn't allow receiving in the background.
+// The updates are not received.
+func (c *Config[T]) awaitSequential(ctx context.Context) (T, error) {
+	if value, version := c.Get(); version > 0 {
+		return value, nil
+	}
+	v, err := c.In.Recv(ctx)
+	if errors.Is(err, EOS) {
+		err = errors.New("closed without a configuration")
+	}
+	if err != nil {
+		return v, fmt.Errorf("config %s: %w", portName(c.boundTo()), err)
+	}
+	c.Set(v)
+	return v, nil
+}
+
+// receive stores the configurations received from the port.
+func (c *Config[T]) receive(ctx context.Context, done chan struct{}) {
+	var err error
+	defer func() {
+		c.mu.Lock()
+		c.watching = false
+		c.err = err
+		c.mu.Unlock()
+		close(done)
+	}()
+
+	for {
+		var v T
+		v, err = c.In.Recv(ctx)
+		if errors.Is(err, EOS) {
+			err = errors.New("closed without a configuration")
+		}
+		if err != nil {
+			return
+		}
+		c.Set(v)
+	}
+}
+
+// Get returns the latest configuration and its version, which counts
+// the received configurations. The version is zero until the first one.
+func (c *Config[T]) Get() (T, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value, c.version
+}
+
+// Set replaces the configuration as if it had been received.
+func (c *Config[T]) Set(v T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value = v
+	c.version++
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+}
+
+// Changed returns a channel, which is closed when the configuration
+// following the current one arrives.
+func (c *Config[T]) Changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.changed == nil {
+		c.changed = make(chan struct{})
+	}
+	return c.changed
+}
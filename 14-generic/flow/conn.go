@@ -0,0 +1,245 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Conn is a connection between an Out and an In.
+type Conn[T any] struct {
+	// delivered counts the values handed to the receiver, filtered the
+	// ones dropped by filter and cancelled the cancelled ones, they're
+	// first to keep them 64-bit aligned.
+	delivered uint64
+	filtered  uint64
+	cancelled uint64
+
+	// mu protects from and to, which change with Network.Replace
+	mu   sync.Mutex
+	from *Out[T]
+	to   *In[T]
+
+	data   chan packet[T]
+	closed sync.Once
+	eos    bool
+
+	// used by RunSequential, traces parallels queue in Network.Simulate
+	queue    []packet[T]
+	traces   []int
+	sender   *task
+	receiver *task
+
+	// rate limits the deliveries, see WithRateLimit
+	rate *budget
+	// filter and divert route the packets, see WithFilter
+	filter func(T) bool
+	divert *Conn[T]
+	// mapper transforms the packets, see WithMap
+	mapper func(T) T
+	// prioritized orders the queue of RunSequential, see WithPriority
+	prioritized bool
+
+	// used by the ring buffer transports, see WithSPSC
+	ring             ring[packet[T]]
+	notEmpty         chan struct{}
+	notFull          chan struct{}
+	sleepingSenders  int32
+	sleepingReceiver int32
+
+	// restored are the packets loaded by Network.Restore or left in the
+	// ring buffer of RunSharded, which are received before the others,
+	// unrestored is their number
+	restored   []packet[T]
+	unrestored int32
+
+	// ended is set once the sender has closed the connection
+	ended        int32
+	disconnected int32
+}
+
+// Connect connects the ports, by default with an unbuffered channel.
+//
+// An In has at most one upstream connection, Connect returns an error
+// when to is already connected, as the first connection would be
+// silently cut off. Several streams are combined with a component such
+// as std.Merge.
+func Connect[T any](from *Out[T], to *In[T], opts ...ConnOption) (*Conn[T], error) {
+	var config connConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	conn := &Conn[T]{}
+	conn.from = from
+	conn.to = to
+	conn.data = make(chan packet[T])
+	if config.rate > 0 {
+		conn.rate = newBudget(Budget{Rate: config.rate, Burst: config.burst})
+	}
+	conn.prioritized = config.ring == priorityRing
+	if conn.ring = newPacketRing[T](config); conn.ring != nil {
+		conn.notEmpty = make(chan struct{}, 1)
+		conn.notFull = make(chan struct{}, 1)
+	}
+	conn.setMapper(config)
+	if err := conn.setFilter(config); err != nil {
+		return nil, err
+	}
+
+	if !to.attachFirst(conn) {
+		if conn.divert != nil {
+			conn.divert.Disconnect()
+		}
+		return nil, errInConnected(to)
+	}
+	if net := conn.network(); net != nil {
+		net.register(conn)
+		net.emit(ConnEvent{Kind: Connected, Conn: conn})
+	}
+	conn.from.attach(conn)
+	return conn, nil
+}
+
+func (conn *Conn[T]) Disconnect() {
+	if conn.divert != nil {
+		conn.divert.Disconnect()
+	}
+	from, to := conn.ports()
+	from.detach(conn)
+	to.detach(conn)
+	if !atomic.CompareAndSwapInt32(&conn.disconnected, 0, 1) {
+		return
+	}
+
+	if net := conn.network(); net != nil {
+		net.unregister(conn)
+		net.emit(ConnEvent{Kind: Disconnected, Conn: conn})
+		if n := conn.queued(); n > 0 {
+			net.emit(ConnEvent{Kind: Dropped, Conn: conn, Packets: n})
+		}
+	}
+}
+
+// String returns the port names of the connection.
+func (conn *Conn[T]) String() string {
+	from, to := conn.ports()
+	return portName(from.bound) + " -> " + portName(to.bound)
+}
+
+// ports returns the connected ports.
+func (conn *Conn[T]) ports() (*Out[T], *In[T]) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.from, conn.to
+}
+
+// retarget moves the connection to other ports, keeping the queued
+// values. The old ports must not be used concurrently.
+func (conn *Conn[T]) retarget(from outPort, to inPort) error {
+	out, ok1 := from.(*Out[T])
+	in, ok2 := to.(*In[T])
+	if !ok1 || !ok2 {
+		return fmt.Errorf("cannot connect %v to %v", from.elemType(), to.elemType())
+	}
+
+	conn.mu.Lock()
+	oldFrom, oldTo := conn.from, conn.to
+	conn.from, conn.to = out, in
+	conn.mu.Unlock()
+
+	if oldFrom != out {
+		oldFrom.detach(conn)
+		out.attach(conn)
+	}
+	if oldTo != in {
+		oldTo.detach(conn)
+		in.attach(conn)
+	}
+	return nil
+}
+
+// network returns the network either of the ports belongs to.
+func (conn *Conn[T]) network() *Network {
+	from, to := conn.ports()
+	if from.bound.net != nil {
+		return from.bound.net
+	}
+	return to.bound.net
+}
+
+// receiving reports whether the receiver is blocked in Recv.
+func (conn *Conn[T]) receiving() bool {
+	_, to := conn.ports()
+	return atomic.LoadInt32(&to.waiting) > 0
+}
+
+// received returns the number of values the receiver has received.
+func (conn *Conn[T]) received() uint32 {
+	_, to := conn.ports()
+	return atomic.LoadUint32(&to.received)
+}
+
+// packets returns the number of values delivered over the connection.
+func (conn *Conn[T]) packets() uint64 {
+	return atomic.LoadUint64(&conn.delivered)
+}
+
+// queued returns the number of values waiting to be received.
+func (conn *Conn[T]) queued() int {
+	n := int(atomic.LoadInt32(&conn.unrestored))
+	if conn.ring != nil {
+		return n + conn.ring.len()
+	}
+	return n + len(conn.data)
+}
+
+// Capacity returns the number of values the connection can queue,
+// zero for an unbuffered connection.
+func (conn *Conn[T]) Capacity() int {
+	if conn.ring != nil {
+		return conn.ring.cap()
+	}
+	return cap(conn.data)
+}
+
+// channel returns the underlying channel, nil conn returns nil.
+func (conn *Conn[T]) channel() chan packet[T] {
+	if conn == nil {
+		return nil
+	}
+	return conn.data
+}
+
+// close signals end of stream.
+func (conn *Conn[T]) close() {
+	conn.closed.Do(func() {
+		conn.eos = true
+		close(conn.data)
+		atomic.StoreInt32(&conn.ended, 1)
+		if conn.ring != nil {
+			signal(conn.notEmpty)
+		}
+		if net := conn.network(); net != nil {
+			net.emit(ConnEvent{Kind: Closed, Conn: conn})
+		}
+		if conn.divert != nil {
+			out, _ := conn.divert.ports()
+			_ = out.Close(context.Background())
+		}
+	})
+}
+
+func portName(b binding) string {
+	if b.name == "" {
+		return "?"
+	}
+	return b.name
+}
+
+// errInConnected is returned when connecting an In, which already has
+// an upstream connection.
+func errInConnected(in port) error {
+	return fmt.Errorf("%s is already connected", portName(in.boundTo()))
+}
@@ -0,0 +1,227 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+/*
+	Commands such as pause or flush are sent to a component out-of-band,
+	through an In port of Commands called Control by convention, which
+	the component serves with a Controller. RecvControlled replaces the
+	Recv of the data ports: the pending commands are handled before the
+	next value is received, and a command arriving meanwhile interrupts
+	the waiting for the value. While the component is paused, it handles
+	only the commands.
+
+		type Batcher struct {
+			In      flow.In[string]
+			Out     flow.Out[[]string]
+			Control flow.Control
+
+			batch []string
+		}
+
+		func (b *Batcher) Run(ctx context.Context) error {
+			ctl := flow.NewController(&b.Control, func(ctx context.Context, cmd flow.Command) error {
+				if cmd.Kind == flow.CommandFlush {
+					return b.flush(ctx)
+				}
+				return nil
+			})
+			for {
+				v, err := flow.RecvControlled(ctx, ctl, &b.In)
+				...
+			}
+		}
+
+	The Control port may stay unconnected, and once it's closed only the
+	data is received. A Controller waits for the commands in a goroutine,
+	hence it can't be used with RunSequential or RunSharded.
+*/
+
+// CommandKind identifies a Command.
+type CommandKind string
+
+const (
+	// CommandPause stops receiving data until CommandResume.
+	CommandPause CommandKind = "pause"
+	// CommandResume continues receiving data after CommandPause.
+	CommandResume CommandKind = "resume"
+	// CommandFlush asks the component to send the values it's holding.
+	CommandFlush CommandKind = "flush"
+	// CommandReconfigure asks the component to apply Params.
+	CommandReconfigure CommandKind = "reconfigure"
+)
+
+// Command is an out-of-band instruction to a component, see Control.
+type Command struct {
+	Kind   CommandKind       `json:"kind"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Control is the port of a component receiving Commands.
+type Control = In[Command]
+
+// ControlPort is the conventional name of the Control port.
+const ControlPort PortName = "Control"
+
+// Controller interleaves the commands from a Control port with the
+// data received by RecvControlled. A Controller must be used only by
+// a single goroutine.
+type Controller struct {
+	control *Control
+	handle  func(context.Context, Command) error
+	paused  bool
+
+	mu       sync.Mutex
+	started  bool
+	pending  []Command
+	arrived  chan struct{}
+	err      error
+	receiver context.CancelFunc
+}
+
+// NewController returns a Controller for the commands from control,
+// handle is called with each of them, including CommandPause and
+// CommandResume, which the Controller handles itself as well. handle
+// may be nil.
+func NewController(control *Control, handle func(context.Context, Command) error) *Controller {
+	return &Controller{
+		control: control,
+		handle:  handle,
+		arrived: make(chan struct{}, 1),
+	}
+}
+
+// Paused reports whether the component has been paused by CommandPause.
+func (ctl *Controller) Paused() bool { return ctl.paused }
+
+// start starts forwarding the commands, the goroutine exits when ctx
+// is cancelled or the Control port is closed.
+func (ctl *Controller) start(ctx context.Context) {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if ctl.started {
+		return
+	}
+	ctl.started = true
+	go func() {
+		for {
+			cmd, err := ctl.control.Recv(ctx)
+			ctl.mu.Lock()
+			if err == nil {
+				ctl.pending = append(ctl.pending, cmd)
+			} else if !errors.Is(err, EOS) && ctx.Err() == nil {
+				ctl.err = err
+			}
+			if ctl.receiver != nil {
+				ctl.receiver()
+			}
+			ctl.mu.Unlock()
+			select {
+			case ctl.arrived <- struct{}{}:
+			default:
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Handle handles the pending commands, it's called by RecvControlled and
+// can be called by components that wait for something else than data.
+func (ctl *Controller) Handle(ctx context.Context) error {
+	ctl.start(ctx)
+	for {
+		ctl.mu.Lock()
+		if ctl.err != nil {
+			err := ctl.err
+			ctl.mu.Unlock()
+			return err
+		}
+		if len(ctl.pending) == 0 {
+			ctl.mu.Unlock()
+			return nil
+		}
+		cmd := ctl.pending[0]
+		ctl.pending[0] = Command{}
+		ctl.pending = ctl.pending[1:]
+		ctl.mu.Unlock()
+
+		switch cmd.Kind {
+		case CommandPause:
+			ctl.paused = true
+		case CommandResume:
+			ctl.paused = false
+		}
+		if ctl.handle != nil {
+			if err := ctl.handle(ctx, cmd); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// interruptible returns a context for receiving data, which is cancelled
+// when a command arrives. It reports false when a command has already
+// arrived.
+func (ctl *Controller) interruptible(ctx context.Context) (context.Context, bool) {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if len(ctl.pending) > 0 || ctl.err != nil {
+		return nil, false
+	}
+	ctx, ctl.receiver = context.WithCancel(ctx)
+	return ctx, true
+}
+
+// received stops interrupting the data receive.
+func (ctl *Controller) received() {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	ctl.receiver()
+	ctl.receiver = nil
+}
+
+// RecvControlled receives a value from in, handling the commands of ctl
+// before it, see Control. A value received together with a command is
+// returned after the command has been handled.
+func RecvControlled[T any](ctx context.Context, ctl *Controller, in *In[T]) (T, error) {
+	var zero T
+	for {
+		if err := ctl.Handle(ctx); err != nil {
+			return zero, err
+		}
+		if ctl.paused {
+			select {
+			case <-ctx.Done():
+				return zero, ctx.Err()
+			case <-ctl.arrived:
+			}
+			continue
+		}
+
+		recvCtx, ok := ctl.interruptible(ctx)
+		if !ok {
+			continue
+		}
+		v, err := in.Recv(recvCtx)
+		interrupted := err != nil && recvCtx.Err() != nil && ctx.Err() == nil
+		ctl.received()
+		if interrupted {
+			// by a command
+			continue
+		}
+		if err != nil {
+			return v, err
+		}
+		if err := ctl.Handle(ctx); err != nil {
+			Release(v)
+			return zero, err
+		}
+		return v, nil
+	}
+}
@@ -0,0 +1,133 @@
+package flow
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// DashboardHandler returns a handler serving a web UI, which shows the
+// topology of the network, the packet rates and the component states.
+// The UI can pause and resume the network, cut connections and
+// re-create them afterwards and send values to ports, see Network.Send.
+//
+// The handler can be mounted at any path ending with a slash:
+//
+//	http.Handle("/debug/flow/", net.DashboardHandler())
+//
+// Only plain connections created with Connect can be cut.
+func (net *Network) DashboardHandler() http.Handler {
+	return &dashboard{net: net, cut: map[string]splicer{}}
+}
+
+type dashboard struct {
+	net *Network
+
+	mu sync.Mutex
+	// cut contains the connections disconnected from the dashboard.
+	cut map[string]splicer
+}
+
+// dashboardStatus is the Status with the cut connections.
+type dashboardStatus struct {
+	Status
+	Cut []string `json:"cut"`
+}
+
+func (d *dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := path.Base(r.URL.Path)
+	switch action {
+	case "status":
+		d.status(w)
+		return
+	case "pause", "resume", "disconnect", "connect", "send":
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(dashboardPage)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	switch action {
+	case "pause":
+		d.net.Pause()
+	case "resume":
+		d.net.Resume()
+	case "disconnect":
+		err = d.disconnect(r.FormValue("conn"))
+	case "connect":
+		err = d.connect(r.FormValue("conn"))
+	case "send":
+		err = d.net.Send(r.Context(), Name(r.FormValue("node")), PortName(r.FormValue("port")), r.FormValue("value"))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *dashboard) status(w http.ResponseWriter) {
+	status := dashboardStatus{Status: d.net.Status(), Cut: []string{}}
+	d.mu.Lock()
+	for name := range d.cut {
+		status.Cut = append(status.Cut, name)
+	}
+	d.mu.Unlock()
+	sort.Strings(status.Cut)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(status)
+}
+
+// disconnect cuts the named connection and remembers its ends.
+func (d *dashboard) disconnect(name string) error {
+	for _, conn := range d.net.Connections() {
+		if conn.String() != name {
+			continue
+		}
+		s, ok := conn.(splicer)
+		if !ok {
+			return fmt.Errorf("cannot cut %q", name)
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		conn.Disconnect()
+		d.cut[name] = s
+		return nil
+	}
+	return fmt.Errorf("connection %q does not exist", name)
+}
+
+// connect re-creates a connection cut by disconnect.
+func (d *dashboard) connect(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.cut[name]
+	if !ok {
+		return fmt.Errorf("connection %q has not been cut", name)
+	}
+	from, to := s.ends()
+	if _, err := from.connect(to); err != nil {
+		return err
+	}
+	delete(d.cut, name)
+	return nil
+}
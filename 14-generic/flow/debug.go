@@ -0,0 +1,266 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotPaused is returned by Step when the network is not paused.
+var ErrNotPaused = errors.New("network is not paused")
+
+// stepPoll is how often Step checks whether a receiver has become ready.
+const stepPoll = time.Millisecond
+
+// errRetry is used by gate to signal that the connection changed while waiting.
+var errRetry = errors.New("retry")
+
+// stepper holds deliveries while the network is paused.
+type stepper struct {
+	paused int32
+
+	mu      sync.Mutex
+	resumed chan struct{}
+	arrived chan struct{}
+	waiters []*stepWaiter
+}
+
+// stepWaiter is a delivery waiting for permission.
+type stepWaiter struct {
+	conn    Connection
+	granted bool
+	grant   chan struct{}
+	done    chan bool
+}
+
+// Pause stops new packet deliveries between the components.
+//
+// Deliveries that have already started are not affected.
+func (net *Network) Pause() {
+	s := &net.debug
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if atomic.LoadInt32(&s.paused) != 0 {
+		return
+	}
+	s.resumed = make(chan struct{})
+	if s.arrived == nil {
+		s.arrived = make(chan struct{})
+	}
+	atomic.StoreInt32(&s.paused, 1)
+}
+
+// Resume continues packet deliveries after Pause.
+func (net *Network) Resume() {
+	s := &net.debug
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if atomic.LoadInt32(&s.paused) == 0 {
+		return
+	}
+	atomic.StoreInt32(&s.paused, 0)
+	close(s.resumed)
+	s.waiters = nil
+}
+
+// Paused returns whether the network is paused.
+func (net *Network) Paused() bool { return atomic.LoadInt32(&net.debug.paused) != 0 }
+
+// Step allows a single packet delivery while the network is paused.
+//
+// Step waits until some component tries to send a packet and the packet
+// has been received on the other end. It returns the connection that
+// delivered the packet. Pending deliveries are allowed in the order they
+// arrived, skipping the ones where the receiver isn't waiting in Recv.
+func (net *Network) Step(ctx context.Context) (Connection, error) {
+	s := &net.debug
+	for {
+		s.mu.Lock()
+		if atomic.LoadInt32(&s.paused) == 0 {
+			s.mu.Unlock()
+			return nil, ErrNotPaused
+		}
+
+		// pick the first delivery that can be received
+		var w *stepWaiter
+		var recv receiver
+		for i, x := range s.waiters {
+			if r, ok := x.conn.(receiver); ok && r.receiving() {
+				w, recv = x, r
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				break
+			}
+		}
+		if w == nil {
+			arrived := s.arrived
+			s.mu.Unlock()
+
+			// the receivers are not tracked, so poll for them
+			poll := time.NewTimer(stepPoll)
+			select {
+			case <-ctx.Done():
+				poll.Stop()
+				return nil, ctx.Err()
+			case <-arrived:
+				poll.Stop()
+			case <-poll.C:
+			}
+			continue
+		}
+		w.granted = true
+		s.mu.Unlock()
+
+		before := recv.received()
+		close(w.grant)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case delivered := <-w.done:
+			if !delivered {
+				continue
+			}
+		}
+
+		// The sender finishes before the receiver has updated its state,
+		// wait for the receiver so that the next Step sees it correctly.
+		for recv.received() == before {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			runtime.Gosched()
+		}
+		return w.conn, nil
+	}
+}
+
+// settle waits until the paused network has settled: every component
+// waits either in Recv for an empty input or in Send, and their
+// progress has stayed the same since the previous poll.
+func (net *Network) settle(ctx context.Context) error {
+	var last uint64
+	for i := 0; ; i++ {
+		progress, settled := net.settled()
+		if settled && i > 0 && progress == last {
+			return nil
+		}
+		last = progress
+
+		// the components are not tracked, so poll for them
+		poll := time.NewTimer(stepPoll)
+		select {
+		case <-ctx.Done():
+			poll.Stop()
+			return ctx.Err()
+		case <-poll.C:
+		}
+	}
+}
+
+// settled reports whether the running components wait for packets or
+// to deliver them, and returns their progress, see progressOf.
+func (net *Network) settled() (progress uint64, settled bool) {
+	net.mu.Lock()
+	components := make([]Component, 0, len(net.running))
+	for _, r := range net.running {
+		components = append(components, r.component)
+	}
+	net.mu.Unlock()
+
+	settled = true
+	for _, c := range components {
+		progress += progressOf(c)
+		if stateOf(c) == Running {
+			settled = false
+		}
+		for _, p := range portsOf(c) {
+			if in, ok := p.(interface{ taking() bool }); ok && in.taking() {
+				settled = false
+			}
+		}
+	}
+	return progress, settled
+}
+
+// receiver is implemented by Conn to inspect the receiving end.
+type receiver interface {
+	receiving() bool
+	received() uint32
+}
+
+// gate waits for permission to deliver a packet on conn.
+//
+// The returned exit must be called with whether the packet was delivered.
+// When changed is closed while waiting, errRetry is returned.
+func (net *Network) gate(ctx context.Context, conn Connection, changed <-chan struct{}) (exit func(delivered bool), err error) {
+	if net == nil {
+		return noexit, nil
+	}
+	if err := net.started(ctx, changed); err != nil {
+		return noexit, err
+	}
+	if atomic.LoadInt32(&net.debug.paused) == 0 {
+		return noexit, nil
+	}
+	s := &net.debug
+
+	s.mu.Lock()
+	if atomic.LoadInt32(&s.paused) == 0 {
+		s.mu.Unlock()
+		return noexit, nil
+	}
+	w := &stepWaiter{
+		conn:  conn,
+		grant: make(chan struct{}),
+		done:  make(chan bool, 1),
+	}
+	s.waiters = append(s.waiters, w)
+	resumed := s.resumed
+	close(s.arrived)
+	s.arrived = make(chan struct{})
+	s.mu.Unlock()
+
+	report := func(delivered bool) { w.done <- delivered }
+
+	// cancel removes the waiter, unless Step has already granted it
+	cancel := func() (granted bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if w.granted {
+			return true
+		}
+		for i, x := range s.waiters {
+			if x == w {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				break
+			}
+		}
+		return false
+	}
+
+	select {
+	case <-w.grant:
+		return report, nil
+	case <-resumed:
+		if cancel() {
+			return report, nil
+		}
+		return noexit, nil
+	case <-changed:
+		if cancel() {
+			report(false)
+		}
+		return nil, errRetry
+	case <-ctx.Done():
+		if cancel() {
+			report(false)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func noexit(bool) {}
@@ -0,0 +1,688 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	A Deployer is a component running a subgraph, which can be replaced
+	by a new version of the graph while the network around it keeps
+	running, also known as a blue/green deployment:
+
+		d, err := flow.NewDeployer(v1, registry)
+		net.AddNamed("pipeline", d)
+		...
+		err = d.Deploy(ctx, v2, flow.Rollout{
+			Mirror:  true,
+			Compare: func(port string, old, new any) bool { return old == new },
+			Soak:    time.Minute,
+		})
+
+	Stage starts the new graph alongside the old one. With Mirror every
+	input is sent to both graphs and the outputs of the new graph are
+	compared with the ones of the old graph, the k-th output of a port
+	with the k-th one, and discarded. Otherwise Percent of the inputs are
+	routed to the new graph instead of the old one, and the outputs of
+	both are sent out. Check reports whether the new graph is failing,
+	unhealthy or its outputs differ. Promote switches the ports of the
+	Deployer over to the new graph at once and drains the old one: its
+	inputs are closed and its remaining outputs are sent out until it
+	has returned. Rollback stops the new graph instead.
+
+	The mirrored inputs are the same values in both graphs, hence they
+	must not be modified nor pooled by the graphs. They are queued for
+	the new graph, so that it doesn't slow down the old one; when the
+	queue is full, the input is dropped for the new graph and counted in
+	DeployStatus.Dropped.
+*/
+
+// Rollout configures how the new graph is tried out, see Deployer.Stage.
+type Rollout struct {
+	// Mirror sends every input to both graphs, the outputs of the new
+	// graph are compared and discarded. Once an input has been dropped
+	// for the new graph, its outputs are compared with the wrong ones.
+	Mirror bool
+	// Percent is the percentage of the inputs routed to the new graph
+	// instead of the old one, when not mirroring.
+	Percent float64
+	// Compare reports whether the outputs of the graphs match, when
+	// mirroring. By default the outputs are not compared.
+	Compare func(port string, old, new any) bool
+	// MaxMismatches is the number of mismatched outputs Check allows.
+	MaxMismatches uint64
+	// Soak is how long Deploy runs the graphs side by side.
+	Soak time.Duration
+}
+
+// DeployStatus describes the new graph of a Deployer.
+type DeployStatus struct {
+	Staged bool `json:"staged"`
+	// Routed counts the inputs sent to the new graph.
+	Routed uint64 `json:"routed"`
+	// Compared and Mismatches count the compared outputs.
+	Compared   uint64 `json:"compared"`
+	Mismatches uint64 `json:"mismatches"`
+	// Unpaired counts the outputs, which weren't compared as one graph
+	// was too far ahead of the other.
+	Unpaired uint64 `json:"unpaired,omitempty"`
+	// Dropped counts the mirrored inputs, which weren't sent to the new
+	// graph as it was too far behind.
+	Dropped uint64 `json:"dropped,omitempty"`
+}
+
+const (
+	// deployPending limits the outputs of a graph waiting to be
+	// compared with the outputs of the other one.
+	deployPending = 1024
+	// deployMirror limits the mirrored inputs of a port waiting to be
+	// sent to the new graph.
+	deployMirror = 1024
+)
+
+// Deployer runs a graph, which can be replaced while it's running,
+// see above.
+type Deployer struct {
+	// Registry is used for creating the components of the graphs,
+	// in addition to the registered ones.
+	Registry Registry
+
+	in  map[string]inPort
+	out map[string]outPort
+
+	// mu is held for reading while the inputs are sent to the graphs,
+	// changing the graphs waits for the sends in progress; the mirrored
+	// inputs are only queued while holding it
+	mu        sync.RWMutex
+	ctx       context.Context
+	fail      func(error)
+	active    *deployment
+	candidate *deployment
+	rollout   Rollout
+	// ended contains the input ports that have reached end of stream
+	ended  map[string]bool
+	graphs sync.WaitGroup
+
+	compared sync.Mutex
+	status   DeployStatus
+	pending  map[string]*pairing
+	// inputs counts the inputs while routing, see Rollout.Percent
+	inputs uint64
+}
+
+// deployment is a graph run by a Deployer.
+type deployment struct {
+	graph   *Subgraph
+	feeds   map[string]outPort
+	results map[string]inPort
+	// mirror contains the queued inputs of a mirroring graph by port,
+	// they're sent until stop is closed.
+	mirror   map[string]chan any
+	stop     chan struct{}
+	stopping sync.Once
+	sending  sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// serving is set when the outputs are sent out, otherwise they're
+	// compared; recording is set when the outputs are sent out and
+	// compared.
+	serving   int32
+	recording int32
+	// critical is set once the graph has been serving, then its
+	// failure fails the Deployer.
+	critical int32
+	// done is closed when the graph has returned with err.
+	done chan struct{}
+	err  error
+}
+
+// pairing contains the outputs of a port waiting to be compared.
+type pairing struct {
+	old, new []any
+}
+
+// NewDeployer returns a Deployer running the graph, its ports are the
+// ports exported by the graph, see Subgraph.
+func NewDeployer(w *Wiring, registry Registry) (*Deployer, error) {
+	d := &Deployer{
+		Registry: registry,
+		in:       map[string]inPort{},
+		out:      map[string]outPort{},
+		ended:    map[string]bool{},
+	}
+	graph, err := NewSubgraph(w, registry)
+	if err != nil {
+		return nil, err
+	}
+	for name, p := range graph.ports() {
+		switch p := p.(type) {
+		case inPort:
+			d.in[name] = p.newOut().newIn()
+		case outPort:
+			d.out[name] = p.newIn().newOut()
+		}
+	}
+	if d.active, err = d.deployment(graph); err != nil {
+		return nil, err
+	}
+	atomic.StoreInt32(&d.active.serving, 1)
+	atomic.StoreInt32(&d.active.critical, 1)
+	return d, nil
+}
+
+func (d *Deployer) ports() map[string]port {
+	ports := make(map[string]port, len(d.in)+len(d.out))
+	for name, p := range d.in {
+		ports[name] = p
+	}
+	for name, p := range d.out {
+		ports[name] = p
+	}
+	return ports
+}
+
+// deployment connects the graph, whose ports must match the ports of
+// the Deployer.
+func (d *Deployer) deployment(graph *Subgraph) (*deployment, error) {
+	dep := &deployment{
+		graph:   graph,
+		feeds:   map[string]outPort{},
+		results: map[string]inPort{},
+		done:    make(chan struct{}),
+	}
+	ports := graph.ports()
+	var problems []string
+	for name, p := range ports {
+		switch p := p.(type) {
+		case inPort:
+			if in, ok := d.in[name]; !ok || in.elemType() != p.elemType() {
+				problems = append(problems, fmt.Sprintf("in %s %v", name, p.elemType()))
+				continue
+			}
+			feed := p.newOut()
+			if _, err := feed.connect(p); err != nil {
+				return nil, err
+			}
+			dep.feeds[name] = feed
+		case outPort:
+			if out, ok := d.out[name]; !ok || out.elemType() != p.elemType() {
+				problems = append(problems, fmt.Sprintf("out %s %v", name, p.elemType()))
+				continue
+			}
+			result := p.newIn()
+			if _, err := p.connect(result); err != nil {
+				return nil, err
+			}
+			dep.results[name] = result
+		}
+	}
+	for name := range d.in {
+		if _, ok := dep.feeds[name]; !ok {
+			problems = append(problems, "missing in "+name)
+		}
+	}
+	for name := range d.out {
+		if _, ok := dep.results[name]; !ok {
+			problems = append(problems, "missing out "+name)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("graph ports differ: %s", strings.Join(problems, ", "))
+	}
+	return dep, nil
+}
+
+// Run runs the graph until the inputs have reached end of stream and
+// the graphs have returned.
+func (d *Deployer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var first error
+	d.mu.Lock()
+	d.ctx = ctx
+	d.fail = func(err error) {
+		once.Do(func() {
+			first = err
+			cancel()
+		})
+	}
+	d.start(d.active)
+	d.mu.Unlock()
+
+	var inputs sync.WaitGroup
+	for name, in := range d.in {
+		name, in := name, in
+		inputs.Add(1)
+		go func() {
+			defer inputs.Done()
+			d.forward(ctx, name, in)
+		}()
+	}
+	inputs.Wait()
+	d.graphs.Wait()
+
+	d.mu.Lock()
+	d.ctx = nil
+	d.mu.Unlock()
+	once.Do(func() {})
+	if first != nil {
+		return first
+	}
+	for _, out := range d.out {
+		if err := out.closeAny(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start runs the deployment, d.mu must be held.
+func (d *Deployer) start(dep *deployment) {
+	dep.ctx, dep.cancel = context.WithCancel(d.ctx)
+	for name, feed := range dep.feeds {
+		if d.ended[name] {
+			_ = feed.closeAny(dep.ctx)
+		}
+	}
+
+	d.graphs.Add(1 + len(dep.results) + len(dep.mirror))
+	dep.sending.Add(len(dep.mirror))
+	for name, queue := range dep.mirror {
+		name, queue := name, queue
+		go func() {
+			defer d.graphs.Done()
+			defer dep.sending.Done()
+			dep.send(name, queue)
+		}()
+	}
+	go func() {
+		defer d.graphs.Done()
+		dep.err = dep.graph.Run(dep.ctx)
+		if dep.err != nil && atomic.LoadInt32(&dep.critical) != 0 {
+			d.fail(dep.err)
+		}
+		dep.cancel()
+		close(dep.done)
+	}()
+	for name, result := range dep.results {
+		name, result := name, result
+		go func() {
+			defer d.graphs.Done()
+			d.collect(dep, name, result)
+		}()
+	}
+}
+
+// forward sends the inputs of the port to the graphs.
+func (d *Deployer) forward(ctx context.Context, name string, in inPort) {
+	for {
+		v, err := in.recvAny(ctx)
+		if errors.Is(err, EOS) {
+			d.mu.Lock()
+			d.ended[name] = true
+			for _, dep := range []*deployment{d.active, d.candidate} {
+				switch {
+				case dep == nil:
+				case dep.mirror != nil:
+					// the feed is closed after the queued inputs
+					close(dep.mirror[name])
+				default:
+					_ = dep.feeds[name].closeAny(dep.ctx)
+				}
+			}
+			d.mu.Unlock()
+			return
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				d.fail(err)
+			}
+			return
+		}
+
+		d.mu.RLock()
+		err = d.send(name, v)
+		d.mu.RUnlock()
+		if err != nil {
+			d.fail(err)
+			return
+		}
+	}
+}
+
+// send sends an input to the graphs, d.mu must be held for reading.
+func (d *Deployer) send(name string, v any) error {
+	cand := d.candidate
+	if cand != nil && !d.rollout.Mirror && d.routed() {
+		// a failure of the new graph is reported by Check
+		_ = cand.feeds[name].sendAny(cand.ctx, v)
+		return nil
+	}
+	if err := d.active.feeds[name].sendAny(d.active.ctx, v); err != nil {
+		return err
+	}
+	if cand != nil && d.rollout.Mirror {
+		d.compared.Lock()
+		select {
+		case cand.mirror[name] <- v:
+			d.status.Routed++
+		default:
+			d.status.Dropped++
+		}
+		d.compared.Unlock()
+	}
+	return nil
+}
+
+// send sends the queued inputs of a mirroring graph to the port,
+// closing it after the last one.
+func (dep *deployment) send(name string, queue <-chan any) {
+	feed := dep.feeds[name]
+	for {
+		select {
+		case v, ok := <-queue:
+			if !ok {
+				_ = feed.closeAny(dep.ctx)
+				return
+			}
+			// a failure of the new graph is reported by Check
+			if err := feed.sendAny(dep.ctx, v); err != nil {
+				return
+			}
+		case <-dep.stop:
+			return
+		case <-dep.ctx.Done():
+			return
+		}
+	}
+}
+
+// routed decides whether the next input goes to the new graph, routing
+// evenly Percent of the inputs.
+func (d *Deployer) routed() bool {
+	d.compared.Lock()
+	defer d.compared.Unlock()
+	n := d.inputs
+	d.inputs++
+	if uint64(float64(n+1)*d.rollout.Percent/100) > uint64(float64(n)*d.rollout.Percent/100) {
+		d.status.Routed++
+		return true
+	}
+	return false
+}
+
+// collect sends out or compares the outputs of the port of a graph.
+func (d *Deployer) collect(dep *deployment, name string, result inPort) {
+	for {
+		v, err := result.recvAny(dep.ctx)
+		if err != nil {
+			return
+		}
+		if atomic.LoadInt32(&dep.serving) == 0 {
+			d.record(name, v, false)
+			continue
+		}
+		if atomic.LoadInt32(&dep.recording) != 0 {
+			d.record(name, v, true)
+		}
+		if err := d.out[name].sendAny(d.ctx, v); err != nil {
+			d.fail(err)
+			return
+		}
+	}
+}
+
+// record compares the output of a graph with the corresponding output
+// of the other one.
+func (d *Deployer) record(name string, v any, old bool) {
+	d.compared.Lock()
+	defer d.compared.Unlock()
+	compare := d.rollout.Compare
+	if compare == nil || d.pending == nil {
+		return
+	}
+	p, ok := d.pending[name]
+	if !ok {
+		p = &pairing{}
+		d.pending[name] = p
+	}
+	queue := &p.new
+	if old {
+		queue = &p.old
+	}
+	if len(*queue) >= deployPending {
+		d.status.Unpaired++
+		return
+	}
+	*queue = append(*queue, v)
+
+	for len(p.old) > 0 && len(p.new) > 0 {
+		d.status.Compared++
+		if !compare(name, p.old[0], p.new[0]) {
+			d.status.Mismatches++
+		}
+		p.old[0], p.new[0] = nil, nil
+		p.old, p.new = p.old[1:], p.new[1:]
+	}
+}
+
+// Stage starts the new graph alongside the running one. Its ports must
+// be the same as the ports of the Deployer.
+func (d *Deployer) Stage(w *Wiring, rollout Rollout) error {
+	graph, err := NewSubgraph(w, d.Registry)
+	if err != nil {
+		return fmt.Errorf("stage: %w", err)
+	}
+	dep, err := d.deployment(graph)
+	if err != nil {
+		return fmt.Errorf("stage: %w", err)
+	}
+	if rollout.Mirror {
+		dep.mirror = make(map[string]chan any, len(dep.feeds))
+		for name := range dep.feeds {
+			dep.mirror[name] = make(chan any, deployMirror)
+		}
+		dep.stop = make(chan struct{})
+	} else {
+		atomic.StoreInt32(&dep.serving, 1)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ctx == nil {
+		return errors.New("stage: deployer is not running")
+	}
+	if d.candidate != nil {
+		return errors.New("stage: a graph is already staged")
+	}
+
+	d.compared.Lock()
+	d.rollout = rollout
+	d.status = DeployStatus{Staged: true}
+	d.pending = map[string]*pairing{}
+	d.inputs = 0
+	d.compared.Unlock()
+	if rollout.Mirror && rollout.Compare != nil {
+		atomic.StoreInt32(&d.active.recording, 1)
+	}
+	d.candidate = dep
+	d.start(dep)
+	return nil
+}
+
+// Status returns the status of the staged graph.
+func (d *Deployer) Status() DeployStatus {
+	d.compared.Lock()
+	defer d.compared.Unlock()
+	return d.status
+}
+
+// Check reports whether the staged graph is working as expected, it
+// fails when the graph has returned, is not healthy or the outputs
+// mismatched more than allowed.
+func (d *Deployer) Check(ctx context.Context) error {
+	d.mu.RLock()
+	cand := d.candidate
+	d.mu.RUnlock()
+	if cand == nil {
+		return errors.New("check: no graph is staged")
+	}
+
+	select {
+	case <-cand.done:
+		if cand.err != nil {
+			return fmt.Errorf("check: staged graph failed: %w", cand.err)
+		}
+		return errors.New("check: staged graph has returned")
+	default:
+	}
+	d.compared.Lock()
+	status, allowed := d.status, d.rollout.MaxMismatches
+	d.compared.Unlock()
+	if status.Mismatches > allowed {
+		return fmt.Errorf("check: %d of %d outputs mismatched", status.Mismatches, status.Compared)
+	}
+	health := cand.graph.Network().Health(ctx)
+	if !health.Healthy {
+		var failing []string
+		for _, c := range health.Components {
+			if !c.Healthy {
+				failing = append(failing, string(c.Name)+": "+c.Error)
+			}
+		}
+		return fmt.Errorf("check: staged graph is not healthy: %s", strings.Join(failing, ", "))
+	}
+	return nil
+}
+
+// Promote switches the ports over to the staged graph and waits until
+// the old graph has drained.
+func (d *Deployer) Promote(ctx context.Context) error {
+	d.mu.RLock()
+	cand := d.candidate
+	d.mu.RUnlock()
+	if cand == nil {
+		return errors.New("promote: no graph is staged")
+	}
+	if cand.mirror != nil {
+		// the queued inputs have been sent to the old graph, which
+		// sends out their outputs
+		cand.stopping.Do(func() { close(cand.stop) })
+		if err := waitGroup(ctx, &cand.sending); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	if d.candidate != cand {
+		d.mu.Unlock()
+		return errors.New("promote: no graph is staged")
+	}
+	old := d.active
+	atomic.StoreInt32(&cand.critical, 1)
+	atomic.StoreInt32(&cand.serving, 1)
+	atomic.StoreInt32(&old.recording, 0)
+	d.active, d.candidate = cand, nil
+	for name, feed := range old.feeds {
+		if !d.ended[name] {
+			_ = feed.closeAny(old.ctx)
+		}
+	}
+	if cand.mirror != nil {
+		// the inputs are sent to the feeds from now on
+		cand.mirror = nil
+		for name, feed := range cand.feeds {
+			if d.ended[name] {
+				_ = feed.closeAny(cand.ctx)
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	d.compared.Lock()
+	d.status.Staged = false
+	d.pending = nil
+	d.compared.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-old.done:
+	}
+	if old.err != nil {
+		return fmt.Errorf("promote: old graph: %w", old.err)
+	}
+	return nil
+}
+
+// waitGroup waits for wg until ctx is done.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// Rollback stops the staged graph.
+func (d *Deployer) Rollback(ctx context.Context) error {
+	d.mu.RLock()
+	cand := d.candidate
+	d.mu.RUnlock()
+	if cand == nil {
+		return errors.New("rollback: no graph is staged")
+	}
+	// the sends to the staged graph fail from now on
+	cand.cancel()
+
+	d.mu.Lock()
+	if d.candidate == cand {
+		d.candidate = nil
+	}
+	atomic.StoreInt32(&d.active.recording, 0)
+	d.mu.Unlock()
+
+	d.compared.Lock()
+	d.status.Staged = false
+	d.pending = nil
+	d.compared.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-cand.done:
+	}
+	return nil
+}
+
+// Deploy stages the graph, runs it alongside the old one for the Soak
+// of rollout and promotes it when Check passes, otherwise it rolls the
+// graph back and returns the failed check.
+func (d *Deployer) Deploy(ctx context.Context, w *Wiring, rollout Rollout) error {
+	if err := d.Stage(w, rollout); err != nil {
+		return err
+	}
+	err := Sleep(ctx, rollout.Soak)
+	if err == nil {
+		err = d.Check(ctx)
+	}
+	if err != nil {
+		_ = d.Rollback(withoutCancel{ctx})
+		return fmt.Errorf("deploy: %w", err)
+	}
+	return d.Promote(ctx)
+}
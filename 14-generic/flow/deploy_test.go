@@ -0,0 +1,200 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/std"
+)
+
+// feeder sends the values until they're closed.
+type feeder struct {
+	Out flow.Out[int]
+
+	values chan int
+}
+
+func (f *feeder) Run(ctx context.Context) error {
+	for v := range f.values {
+		if err := f.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+	return f.Out.Close(ctx)
+}
+
+// double sends twice the received values.
+type double struct {
+	In  flow.In[int]
+	Out flow.Out[int]
+}
+
+func (d *double) Run(ctx context.Context) error {
+	for {
+		v, err := d.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return d.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if err := d.Out.Send(ctx, 2*v); err != nil {
+			return err
+		}
+	}
+}
+
+// stuck never receives its inputs.
+type stuck struct {
+	In  flow.In[int]
+	Out flow.Out[int]
+}
+
+func (s *stuck) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+var deployRegistry = flow.Registry{
+	"Relay":  func() flow.Component { return &relay{} },
+	"Double": func() flow.Component { return &double{} },
+	"Stuck":  func() flow.Component { return &stuck{} },
+}
+
+// version returns the graph of a single component of the type.
+func version(t *testing.T, typ string) *flow.Wiring {
+	w, err := flow.ParseWiring(`
+		: c ` + typ + `
+		export c.In as IN
+		export c.Out as OUT
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// deployed runs the Deployer between a feeder and a collector.
+func deployed(t *testing.T, ctx context.Context, d *flow.Deployer) (*feeder, *std.Collect[int], chan error) {
+	src, dst := &feeder{values: make(chan int)}, std.NewCollect[int]()
+	net := flow.Network{Registry: flow.Registry{
+		"Feeder":   func() flow.Component { return src },
+		"Deployer": func() flow.Component { return d },
+		"Collect":  func() flow.Component { return dst },
+	}}
+	if err := net.Setup(`
+		: src Feeder
+		: d Deployer
+		: dst Collect
+		src.Out -> d.IN
+		d.OUT -> dst.In
+	`); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- net.Run(ctx) }()
+	return src, dst, done
+}
+
+// await waits until the collector has received n values.
+func await(t *testing.T, ctx context.Context, dst *std.Collect[int], n int) []int {
+	for {
+		got := dst.Values()
+		if len(got) >= n {
+			return got
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("received %d values, expected %d", len(got), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeployerPromote(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d, err := flow.NewDeployer(version(t, "Relay"), deployRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, dst, done := deployed(t, ctx, d)
+
+	for !d.Status().Staged {
+		err := d.Stage(version(t, "Double"), flow.Rollout{
+			Mirror:  true,
+			Compare: func(port string, old, new any) bool { return 2*old.(int) == new.(int) },
+		})
+		if err != nil && ctx.Err() != nil {
+			// waiting for the Deployer to start
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		src.values <- i
+	}
+	await(t, ctx, dst, 10)
+	for d.Status().Compared < 10 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	if status := d.Status(); status.Compared != 10 || status.Mismatches != 0 {
+		t.Fatalf("compared %d outputs with %d mismatches, expected 10 without any", status.Compared, status.Mismatches)
+	}
+	if err := d.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Promote(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	src.values <- 10
+	close(src.values)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	got := dst.Values()
+	if len(got) != 11 || got[9] != 9 || got[10] != 20 {
+		t.Fatalf("received %v, expected 0..9 from the old graph and 20 from the new one", got)
+	}
+}
+
+func TestDeployerMirrorStuck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d, err := flow.NewDeployer(version(t, "Relay"), deployRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, dst, done := deployed(t, ctx, d)
+
+	for !d.Status().Staged {
+		err := d.Stage(version(t, "Stuck"), flow.Rollout{Mirror: true})
+		if err != nil && ctx.Err() != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the stuck graph doesn't hold up the old one
+	const n = 2000
+	go func() {
+		for i := 0; i < n; i++ {
+			src.values <- i
+		}
+	}()
+	await(t, ctx, dst, n)
+	if status := d.Status(); status.Dropped == 0 || status.Routed+status.Dropped != n {
+		t.Fatalf("mirrored %d and dropped %d inputs, expected drops of %d in total", status.Routed, status.Dropped, n)
+	}
+
+	if err := d.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	close(src.values)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,543 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+	A running network can be migrated to a new version of its graph
+	definition without restarting it. DiffGraphs compares the definitions
+	and returns the edits turning the old one into the new one, which
+	Network.Apply makes to the network:
+
+		diff := flow.DiffGraphs(old, new)
+		fmt.Print(diff)
+		err := net.Apply(diff)
+
+	The nodes are matched by name, a node whose type or Pin changed is
+	removed and added again, along with its wires. The unchanged nodes
+	keep running with their state and their queued packets.
+*/
+
+// EditKind is the kind of an Edit.
+type EditKind byte
+
+const (
+	RemoveWire EditKind = iota
+	RemoveNode
+	AddNode
+	AddWire
+)
+
+func (kind EditKind) String() string {
+	switch kind {
+	case RemoveWire:
+		return "remove wire"
+	case RemoveNode:
+		return "remove node"
+	case AddNode:
+		return "add node"
+	case AddWire:
+		return "add wire"
+	}
+	return "EditKind(" + fmt.Sprint(byte(kind)) + ")"
+}
+
+// Edit is a change of a graph, the nodes are described by Node, Type and
+// Pin and the wires by Wire.
+type Edit struct {
+	Kind EditKind
+	Node Name
+	Type Type
+	Pin  Pin
+	Wire Wire
+}
+
+func (e Edit) String() string {
+	switch e.Kind {
+	case RemoveNode, AddNode:
+		return fmt.Sprintf("%v %s %s%s", e.Kind, e.Node, e.Type, e.Pin)
+	}
+	return fmt.Sprintf("%v %v", e.Kind, e.Wire)
+}
+
+// GraphDiff is an edit script from one graph definition to another,
+// see DiffGraphs.
+type GraphDiff struct {
+	// Edits are ordered by their kind, the wires and the nodes are
+	// removed before the nodes and the wires are added.
+	Edits []Edit
+
+	// to is the new graph, which has the parameters of the IIPs
+	to *Wiring
+}
+
+// Empty reports whether the graphs are the same.
+func (d *GraphDiff) Empty() bool { return len(d.Edits) == 0 }
+
+// String returns the edits, one per line.
+func (d *GraphDiff) String() string {
+	var b strings.Builder
+	for _, e := range d.Edits {
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// DiffGraphs returns the edits turning the graph old into new.
+func DiffGraphs(old, new *Wiring) *GraphDiff {
+	d := &GraphDiff{to: new}
+
+	// replaced contains the nodes removed and added again
+	replaced := map[Name]bool{}
+	for _, name := range sortedNames(old.Decls) {
+		typ, ok := new.Decls[name]
+		if ok && typ == old.Decls[name] && samePin(old.Pins[name], new.Pins[name]) {
+			continue
+		}
+		replaced[name] = ok
+		d.Edits = append(d.Edits, Edit{Kind: RemoveNode, Node: name, Type: old.Decls[name], Pin: old.Pins[name]})
+	}
+	for _, name := range sortedNames(new.Decls) {
+		if _, ok := old.Decls[name]; ok && !replaced[name] {
+			continue
+		}
+		d.Edits = append(d.Edits, Edit{Kind: AddNode, Node: name, Type: new.Decls[name], Pin: new.Pins[name]})
+	}
+
+	touched := func(w Wire) bool {
+		_, from := replaced[w.From]
+		_, to := replaced[w.To]
+		return from || to
+	}
+	oldWires, newWires := wireSet(old.Wires), wireSet(new.Wires)
+	for _, w := range old.Wires {
+		if newWires[wireKey(w)] && !touched(w) {
+			continue
+		}
+		d.Edits = append(d.Edits, Edit{Kind: RemoveWire, Wire: w})
+	}
+	for _, w := range new.Wires {
+		if oldWires[wireKey(w)] && !touched(w) {
+			continue
+		}
+		d.Edits = append(d.Edits, Edit{Kind: AddWire, Wire: w})
+	}
+
+	sort.SliceStable(d.Edits, func(i, k int) bool { return d.Edits[i].Kind < d.Edits[k].Kind })
+	return d
+}
+
+// samePin reports whether the pins require the same, ignoring
+// the positions.
+func samePin(a, b Pin) bool { return a.Version == b.Version && a.Ports == b.Ports }
+
+// wireKey returns the wire without its position.
+func wireKey(w Wire) Wire {
+	w.Pos = Pos{}
+	return w
+}
+
+func wireSet(wires []Wire) map[Wire]bool {
+	set := make(map[Wire]bool, len(wires))
+	for _, w := range wires {
+		set[wireKey(w)] = true
+	}
+	return set
+}
+
+// Apply migrates the network to the new graph of the diff. All the
+// edits are checked before the network is modified, like with WireUp,
+// and the wires are changed as a single change, like with Rewire.
+//
+// While the network is running, the removed nodes are cancelled and
+// shut down after their wires have been disconnected, the packets queued
+// in them are dropped. The added nodes are initialized before the wires
+// are changed and started afterwards. Apply is not supported with
+// RunSequential nor RunSharded.
+func (net *Network) Apply(d *GraphDiff) error {
+	if net.scheduled() {
+		return errors.New("apply: not supported with RunSequential nor RunSharded")
+	}
+	w := d.to
+	if w == nil {
+		w = &Wiring{}
+	}
+
+	// the network as it will be after the edits, for checking the wires
+	removed := map[Name]bool{}
+	added := map[Name]Component{}
+	var errs WiringErrors
+	for _, e := range d.Edits {
+		switch e.Kind {
+		case RemoveNode:
+			if _, ok := net.Node(e.Node); !ok {
+				errs = append(errs, WiringError{Err: fmt.Errorf("node %s does not exist", e.Node)})
+			}
+			removed[e.Node] = true
+		case AddNode:
+			if _, exists := net.Node(e.Node); exists && !removed[e.Node] {
+				errs = append(errs, WiringError{Pos: e.Pin.Pos, Err: fmt.Errorf("node %s already exists", e.Node)})
+				continue
+			}
+			mk, err := net.lookup(e.Type)
+			if err != nil {
+				errs = append(errs, WiringError{Err: fmt.Errorf("cannot create %s: %w", e.Node, err)})
+				continue
+			}
+			c := mk()
+			if e.Pin != (Pin{Pos: e.Pin.Pos}) {
+				if err := checkPin(e.Node, e.Type, c, e.Pin, w.Wires); err != nil {
+					errs = append(errs, WiringError{Pos: e.Pin.Pos, Err: err})
+					continue
+				}
+			}
+			added[e.Node] = c
+		}
+	}
+	node := func(name Name) (Component, bool) {
+		if c, ok := added[name]; ok {
+			return c, true
+		}
+		if removed[name] {
+			return nil, false
+		}
+		return net.Node(name)
+	}
+
+	// obsolete contains the connections of the removed wires and nodes,
+	// feeds the IIPs and the value feeds sending through them
+	obsolete := map[Connection]bool{}
+	var feeds []Name
+	for _, conn := range net.Connections() {
+		s, ok := conn.(splicer)
+		if !ok {
+			continue
+		}
+		from, to := s.ends()
+		src, dst := from.boundTo().component(), to.boundTo().component()
+		if removed[Name(src)] || removed[Name(dst)] {
+			obsolete[conn] = true
+			if strings.HasPrefix(src, "$") {
+				feeds = append(feeds, Name(src))
+			}
+		}
+	}
+	var links []link
+	for _, e := range d.Edits {
+		switch e.Kind {
+		case RemoveWire:
+			if removed[e.Wire.To] || removed[e.Wire.From] {
+				continue
+			}
+			conns, sources := net.wireConns(e.Wire)
+			if len(conns) == 0 && e.Wire.From != IIPNode {
+				errs = append(errs, WiringError{Pos: e.Wire.Pos, Err: fmt.Errorf("%v: connection does not exist", e.Wire)})
+			}
+			for _, conn := range conns {
+				obsolete[conn] = true
+			}
+			feeds = append(feeds, sources...)
+		case AddWire:
+			l, err := net.resolveWire(w, e.Wire, node)
+			if err != nil {
+				errs = append(errs, WiringError{Pos: e.Wire.Pos, Err: err})
+				continue
+			}
+			links = append(links, l)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	ctx := net.withClock(context.Background())
+	net.mu.Lock()
+	running := net.spawn != nil
+	net.mu.Unlock()
+	if running {
+		var inited []Component
+		for _, c := range added {
+			if initer, ok := c.(Initializer); ok {
+				if err := initer.Init(ctx); err != nil {
+					_ = shutdown(ctx, inited)
+					return fmt.Errorf("apply: init %T: %w", c, err)
+				}
+				inited = append(inited, c)
+			}
+		}
+	}
+
+	// the removed nodes are detached before the new ones are added,
+	// which may reuse their names
+	var stopping []Component
+	for _, name := range sortedNodes(removed) {
+		c, _ := net.Node(name)
+		stopping = append(stopping, c)
+	}
+	for _, name := range feeds {
+		if c, ok := net.Node(name); ok {
+			stopping = append(stopping, c)
+		}
+	}
+	_, err := net.Rewire(func(tx *RewireTx) {
+		for conn := range obsolete {
+			tx.Disconnect(conn)
+		}
+		tx.ops = append(tx.ops, func(net *Network) (Connection, error) {
+			for _, c := range stopping {
+				net.detachNode(c)
+			}
+			for _, name := range sortedComponents(added) {
+				net.addNamed(name, added[name])
+			}
+			return nil, nil
+		})
+		for i := range links {
+			l := &links[i]
+			tx.ops = append(tx.ops, func(net *Network) (Connection, error) {
+				return nil, net.link(l)
+			})
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("apply: %w", err)
+	}
+
+	var first error
+	for _, c := range stopping {
+		if err := net.stopNode(ctx, c); err != nil && first == nil {
+			first = fmt.Errorf("apply: %w", err)
+		}
+	}
+	if running {
+		for _, name := range sortedComponents(added) {
+			net.launch(added[name])
+		}
+		// the IIPs and value feeds of the added wires
+		for _, l := range links {
+			if l.feed != nil {
+				net.launch(l.feed)
+			}
+		}
+	}
+	return first
+}
+
+// link is a wire resolved to ports, see Network.resolveWire.
+type link struct {
+	wire Wire
+	src  outPort
+	dst  inPort
+	// feed is the IIP or the value feed created by Network.link
+	feed Component
+}
+
+// resolveWire finds the ports of the wire, node returns the nodes
+// after the edits.
+func (net *Network) resolveWire(w *Wiring, wire Wire, node func(Name) (Component, bool)) (link, error) {
+	to, ok := node(wire.To)
+	if !ok {
+		return link{}, fmt.Errorf("target node %s does not exist", wire.To)
+	}
+	dstport, err := portByName(to, string(wire.Dst))
+	if err != nil {
+		return link{}, fmt.Errorf("target %s.%s: %w", wire.To, wire.Dst, err)
+	}
+	dst, ok := dstport.(inPort)
+	if !ok {
+		return link{}, fmt.Errorf("target %s.%s is not an In", wire.To, wire.Dst)
+	}
+
+	switch wire.From {
+	case ValuesNode:
+		if err := net.checkValue(string(wire.Src), dst); err != nil {
+			return link{}, fmt.Errorf("%v: %w", wire, err)
+		}
+		return link{wire: wire, dst: dst}, nil
+	case IIPNode:
+		literal, err := w.ExpandParams(wire.IIP, net.Params)
+		if err != nil {
+			return link{}, fmt.Errorf("%v: %w", wire, err)
+		}
+		if _, err := ParseLiteral(literal, dst.elemType()); err != nil {
+			return link{}, fmt.Errorf("%v: %w", wire, err)
+		}
+		wire.IIP = literal
+		return link{wire: wire, dst: dst}, nil
+	}
+
+	from, ok := node(wire.From)
+	if !ok {
+		return link{}, fmt.Errorf("source node %s does not exist", wire.From)
+	}
+	srcport, err := portByName(from, string(wire.Src))
+	if err != nil {
+		return link{}, fmt.Errorf("source %s.%s: %w", wire.From, wire.Src, err)
+	}
+	src, ok := srcport.(outPort)
+	if !ok {
+		return link{}, fmt.Errorf("source %s.%s is not an Out", wire.From, wire.Src)
+	}
+	if !connectable(src, dst) {
+		return link{}, fmt.Errorf("%s.%s (%v) -> %s.%s (%v)",
+			wire.From, wire.Src, src.elemType(), wire.To, wire.Dst, dst.elemType())
+	}
+	return link{wire: wire, src: src, dst: dst}, nil
+}
+
+// link connects the ports of the resolved wire, the nodes must have
+// been added to the network.
+func (net *Network) link(l *link) error {
+	wire := l.wire
+	// map ports of existing nodes may have been created during the lookup
+	if l.dst.boundTo().net == nil {
+		l.dst.bind(binding{net: net, name: string(wire.To) + "." + string(wire.Dst)})
+	}
+	before := len(net.components)
+	var err error
+	switch wire.From {
+	case ValuesNode:
+		err = net.wireValue(string(wire.Src), l.dst)
+	case IIPNode:
+		err = net.wireIIP(wire.IIP, l.dst)
+	default:
+		if l.src.boundTo().net == nil {
+			l.src.bind(binding{net: net, name: string(wire.From) + "." + string(wire.Src)})
+		}
+		var opts []ConnOption
+		if wire.Feedback {
+			opts = append(opts, WithFeedback(DefaultFeedbackSize))
+		}
+		_, err = net.connectPorts(l.src, l.dst, opts...)
+	}
+	if err != nil {
+		return WiringError{Pos: wire.Pos, Err: fmt.Errorf("%v: %w", wire, err)}
+	}
+	if len(net.components) > before {
+		l.feed = net.components[len(net.components)-1]
+	}
+	return nil
+}
+
+// wireConns returns the connections of the wire, and the IIPs or the
+// value feeds sending through them.
+func (net *Network) wireConns(wire Wire) (conns []Connection, sources []Name) {
+	dst := string(wire.To) + "." + string(wire.Dst)
+	for _, conn := range net.Connections() {
+		s, ok := conn.(splicer)
+		if !ok {
+			continue
+		}
+		from, to := s.ends()
+		if portName(to.boundTo()) != dst {
+			continue
+		}
+		src := portName(from.boundTo())
+		switch wire.From {
+		case IIPNode, ValuesNode:
+			prefix := string(IIPNode)
+			if wire.From == ValuesNode {
+				prefix = string(ValuesNode) + "." + string(wire.Src)
+			}
+			if strings.HasPrefix(src, prefix) {
+				conns = append(conns, conn)
+				sources = append(sources, Name(src))
+			}
+		default:
+			if src == string(wire.From)+"."+string(wire.Src) {
+				conns = append(conns, conn)
+			}
+		}
+	}
+	return conns, sources
+}
+
+// detachNode removes the component from the network,
+// it keeps running until it's stopped.
+func (net *Network) detachNode(c Component) {
+	name, ok := net.Name(c)
+	if !ok {
+		return
+	}
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	delete(net.nodes, name)
+	delete(net.names, c)
+	delete(net.options, c)
+	for i, other := range net.components {
+		if other == c {
+			net.components = append(net.components[:i:i], net.components[i+1:]...)
+			break
+		}
+	}
+}
+
+// stopNode cancels the removed component, if it's running, and shuts it
+// down once it has returned.
+func (net *Network) stopNode(ctx context.Context, c Component) error {
+	net.mu.Lock()
+	var r *running
+	for _, other := range net.running {
+		if other.component == c {
+			r = other
+		}
+	}
+	if r != nil {
+		r.stopped = true
+		r.cancel()
+	}
+	net.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+
+	<-r.done
+	if down, ok := c.(Shutdowner); ok {
+		if err := down.Shutdown(withoutCancel{ctx}); err != nil {
+			return fmt.Errorf("shutdown %T: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// launch runs the component added to the running network.
+func (net *Network) launch(c Component) bool {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	if net.spawn == nil || net.active == 0 {
+		return false
+	}
+	net.spawn(c)
+	return true
+}
+
+// exited is called when a component started by Run has returned.
+func (net *Network) exited() {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.active--
+}
+
+func sortedNodes(set map[Name]bool) []Name {
+	names := make([]Name, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, k int) bool { return names[i] < names[k] })
+	return names
+}
+
+func sortedComponents(set map[Name]Component) []Name {
+	names := make([]Name, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, k int) bool { return names[i] < names[k] })
+	return names
+}
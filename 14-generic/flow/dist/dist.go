@@ -0,0 +1,187 @@
+// Package dist runs a single graph across multiple processes.
+//
+// Every process parses the same graph definition and is given the same
+// Partition, which assigns the nodes to processes. Each process creates
+// only its own nodes. Connections between nodes of the same process
+// remain channels, connections crossing a process boundary are carried
+// by a Transport.
+//
+//	partition := dist.Partition{"gen": "a", "upper": "b", "print": "b"}
+//	proc := dist.Process{ID: "a", Net: &net, Transport: transport}
+//	err := proc.Setup(def, partition)
+//	...
+//	err = net.Run(ctx)
+//
+// The values crossing the boundary are encoded with Process.Encoding.
+// Wrapping the Transport with Reconnect re-establishes failed links and
+// with Mux carries all the links between two processes over one link.
+package dist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"fbp.example/flow"
+)
+
+// Partition assigns nodes to processes.
+type Partition map[flow.Name]string
+
+// Process is the part of a distributed graph running in this process.
+type Process struct {
+	// ID is the name of this process in the partition.
+	ID string
+	// Net is the network for the local nodes.
+	Net *flow.Network
+	// Transport carries the connections to other processes.
+	Transport Transport
+	// Encoding encodes the values, defaults to flow.JSON.
+	// All the processes must use the same encoding.
+	Encoding flow.Encoding
+}
+
+// Setup parses the graph definition and wires up the local part of it.
+func (proc *Process) Setup(def string, partition Partition) error {
+	wiring, err := flow.ParseWiring(def)
+	if err != nil {
+		return err
+	}
+	return proc.WireUp(wiring, partition)
+}
+
+// WireUp creates the local nodes, connects them and adds components
+// for the connections to the other processes.
+func (proc *Process) WireUp(w *flow.Wiring, partition Partition) error {
+	if proc.Net == nil || proc.Transport == nil {
+		return errors.New("dist: Net and Transport must be specified")
+	}
+
+	local := &flow.Wiring{Decls: make(map[flow.Name]flow.Type), Params: w.Params, Pins: w.Pins}
+	for name, typ := range w.Decls {
+		owner, ok := partition[name]
+		if !ok {
+			return fmt.Errorf("dist: node %s is not partitioned", name)
+		}
+		if owner == proc.ID {
+			local.Decls[name] = typ
+		}
+	}
+
+	var remote []flow.Wire
+	for _, wire := range w.Wires {
+		to := partition[wire.To]
+		from := to
+		if wire.From != flow.ValuesNode && wire.From != flow.IIPNode {
+			from = partition[wire.From]
+		}
+
+		switch {
+		case from == proc.ID && to == proc.ID:
+			local.Wires = append(local.Wires, wire)
+		case from == proc.ID || to == proc.ID:
+			remote = append(remote, wire)
+		}
+	}
+
+	if err := proc.Net.WireUp(local); err != nil {
+		return err
+	}
+
+	enc := proc.Encoding
+	if enc == nil {
+		enc = flow.JSON
+	}
+
+	for _, wire := range remote {
+		link := Link{
+			Name: wire.String(),
+			From: partition[wire.From],
+			To:   partition[wire.To],
+		}
+
+		if link.From == proc.ID {
+			src, err := proc.Net.Source(wire.From, wire.Src)
+			if err != nil {
+				return fmt.Errorf("dist: %s: %w", link.Name, err)
+			}
+			proc.Net.Add(&outbound{src: src, transport: proc.Transport, link: link, enc: enc})
+		} else {
+			sink, err := proc.Net.Sink(wire.To, wire.Dst)
+			if err != nil {
+				return fmt.Errorf("dist: %s: %w", link.Name, err)
+			}
+			proc.Net.Add(&inbound{sink: sink, transport: proc.Transport, link: link, enc: enc})
+		}
+	}
+	return nil
+}
+
+// outbound forwards the values from a local port to a link.
+type outbound struct {
+	src       *flow.Source
+	transport Transport
+	link      Link
+	enc       flow.Encoding
+}
+
+func (o *outbound) Run(ctx context.Context) error {
+	sender, err := o.transport.Send(ctx, o.link)
+	if err != nil {
+		return fmt.Errorf("dist: %s: %w", o.link.Name, err)
+	}
+
+	for {
+		v, err := o.src.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return sender.Close()
+		}
+		if err != nil {
+			return err
+		}
+
+		packet, err := o.enc.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("dist: %s: %w", o.link.Name, err)
+		}
+		if err := sender.Send(ctx, packet); err != nil {
+			return fmt.Errorf("dist: %s: %w", o.link.Name, err)
+		}
+	}
+}
+
+// inbound forwards the values from a link to a local port.
+type inbound struct {
+	sink      *flow.Sink
+	transport Transport
+	link      Link
+	enc       flow.Encoding
+}
+
+func (in *inbound) Run(ctx context.Context) error {
+	receiver, err := in.transport.Recv(ctx, in.link)
+	if err != nil {
+		return fmt.Errorf("dist: %s: %w", in.link.Name, err)
+	}
+	defer func() { _ = receiver.Close() }()
+
+	for {
+		packet, err := receiver.Recv(ctx)
+		if errors.Is(err, io.EOF) {
+			return in.sink.Close(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("dist: %s: %w", in.link.Name, err)
+		}
+
+		v := reflect.New(in.sink.Type())
+		if err := in.enc.Unmarshal(packet, v.Interface()); err != nil {
+			return fmt.Errorf("dist: %s: %w", in.link.Name, err)
+		}
+		if err := in.sink.Send(ctx, v.Elem().Interface()); err != nil {
+			return err
+		}
+	}
+}
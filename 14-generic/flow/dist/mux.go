@@ -0,0 +1,283 @@
+package dist
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+/*
+	Mux frames every packet of the shared link as
+
+		kind byte | stream uvarint | payload
+
+	where the streams are numbered by the sender in the order the links
+	are opened. The first frame of a stream is muxOpen with the name of
+	the link as the payload, followed by muxData frames and a single
+	muxClose frame. The receiver maps the stream numbers to the links by
+	their names, so the two sides may open the links in any order.
+*/
+
+const (
+	muxOpen = byte(iota)
+	muxData
+	muxClose
+)
+
+// Mux is a Transport, which carries all the links between two processes
+// over a single link of Transport, e.g. to avoid a network connection
+// for each of the hundreds of low traffic links.
+//
+// The packets are buffered by Buffer for each link on the receiving
+// side, a link whose buffer is full delays the other links. The shared
+// links stay open until Close.
+type Mux struct {
+	Transport Transport
+	// Buffer is the number of packets buffered for each link,
+	// defaults to 16.
+	Buffer int
+
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	sends  map[string]*muxSender
+	recvs  map[string]*muxReceiver
+}
+
+// shared returns the link carrying the links between the processes.
+func shared(link Link) Link {
+	return Link{Name: "mux " + link.From + " -> " + link.To, From: link.From, To: link.To}
+}
+
+// init initializes the Mux, m.mu must be held.
+func (m *Mux) init() {
+	if m.ctx == nil {
+		m.ctx, m.cancel = context.WithCancel(context.Background())
+		m.sends = make(map[string]*muxSender)
+		m.recvs = make(map[string]*muxReceiver)
+	}
+}
+
+// Send opens the sending side of the link.
+func (m *Mux) Send(ctx context.Context, link Link) (Sender, error) {
+	m.mu.Lock()
+	m.init()
+	key := shared(link)
+	ms, ok := m.sends[key.Name]
+	if !ok {
+		sender, err := m.Transport.Send(ctx, key)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		ms = &muxSender{sender: sender}
+		m.sends[key.Name] = ms
+	}
+	m.mu.Unlock()
+
+	ms.mu.Lock()
+	stream := &muxStream{ms: ms, id: ms.next}
+	ms.next++
+	ms.mu.Unlock()
+
+	if err := ms.write(ctx, muxOpen, stream.id, []byte(link.Name)); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Recv opens the receiving side of the link.
+func (m *Mux) Recv(ctx context.Context, link Link) (Receiver, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+	key := shared(link)
+	mr, ok := m.recvs[key.Name]
+	if !ok {
+		receiver, err := m.Transport.Recv(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		mr = &muxReceiver{
+			receiver: receiver,
+			size:     m.Buffer,
+			streams:  make(map[uint64]*muxQueue),
+			names:    make(map[string]*muxQueue),
+			done:     make(chan struct{}),
+		}
+		if mr.size <= 0 {
+			mr.size = 16
+		}
+		m.recvs[key.Name] = mr
+		go mr.demux(m.ctx)
+	}
+	return mr.queue(link.Name), nil
+}
+
+// Close closes the shared links.
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx == nil {
+		return nil
+	}
+	m.cancel()
+
+	var first error
+	for _, ms := range m.sends {
+		ms.mu.Lock()
+		if err := ms.sender.Close(); err != nil && first == nil {
+			first = err
+		}
+		ms.mu.Unlock()
+	}
+	for _, mr := range m.recvs {
+		if err := mr.receiver.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	m.ctx, m.sends, m.recvs = nil, nil, nil
+	return first
+}
+
+// muxSender is the sending side of a shared link.
+type muxSender struct {
+	mu     sync.Mutex
+	sender Sender
+	next   uint64
+}
+
+func (ms *muxSender) write(ctx context.Context, kind byte, id uint64, payload []byte) error {
+	frame := make([]byte, 1+binary.MaxVarintLen64+len(payload))
+	frame[0] = kind
+	n := 1 + binary.PutUvarint(frame[1:], id)
+	n += copy(frame[n:], payload)
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.sender.Send(ctx, frame[:n])
+}
+
+// muxStream is the sending side of a link.
+type muxStream struct {
+	ms *muxSender
+	id uint64
+}
+
+func (s *muxStream) Send(ctx context.Context, packet []byte) error {
+	return s.ms.write(ctx, muxData, s.id, packet)
+}
+
+func (s *muxStream) Close() error {
+	return s.ms.write(context.Background(), muxClose, s.id, nil)
+}
+
+// muxReceiver is the receiving side of a shared link.
+type muxReceiver struct {
+	receiver Receiver
+	size     int
+
+	mu      sync.Mutex
+	streams map[uint64]*muxQueue
+	names   map[string]*muxQueue
+
+	// done is closed when demux has failed with err
+	done chan struct{}
+	err  error
+}
+
+// queue returns the queue of the named link.
+func (mr *muxReceiver) queue(name string) *muxQueue {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	q, ok := mr.names[name]
+	if !ok {
+		q = &muxQueue{mr: mr, packets: make(chan []byte, mr.size)}
+		mr.names[name] = q
+	}
+	return q
+}
+
+// demux delivers the frames of the shared link to the queues.
+func (mr *muxReceiver) demux(ctx context.Context) {
+	defer close(mr.done)
+	for {
+		frame, err := mr.receiver.Recv(ctx)
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			mr.err = err
+			return
+		}
+
+		if len(frame) < 2 {
+			mr.err = errors.New("mux: invalid frame")
+			return
+		}
+		id, n := binary.Uvarint(frame[1:])
+		if n <= 0 {
+			mr.err = errors.New("mux: invalid frame")
+			return
+		}
+		kind, payload := frame[0], frame[1+n:]
+
+		mr.mu.Lock()
+		q, ok := mr.streams[id]
+		mr.mu.Unlock()
+		if kind == muxOpen {
+			q = mr.queue(string(payload))
+			mr.mu.Lock()
+			mr.streams[id] = q
+			mr.mu.Unlock()
+			continue
+		}
+		if !ok {
+			mr.err = fmt.Errorf("mux: stream %d has not been opened", id)
+			return
+		}
+
+		switch kind {
+		case muxData:
+			select {
+			case q.packets <- payload:
+			case <-ctx.Done():
+				mr.err = ctx.Err()
+				return
+			}
+		case muxClose:
+			close(q.packets)
+			mr.mu.Lock()
+			delete(mr.streams, id)
+			mr.mu.Unlock()
+		default:
+			mr.err = fmt.Errorf("mux: invalid frame kind %d", kind)
+			return
+		}
+	}
+}
+
+// muxQueue is the receiving side of a link.
+type muxQueue struct {
+	mr      *muxReceiver
+	packets chan []byte
+}
+
+func (q *muxQueue) Recv(ctx context.Context) ([]byte, error) {
+	select {
+	case packet, ok := <-q.packets:
+		if !ok {
+			return nil, io.EOF
+		}
+		return packet, nil
+	case <-q.mr.done:
+		return nil, fmt.Errorf("mux: %w", q.mr.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (q *muxQueue) Close() error { return nil }
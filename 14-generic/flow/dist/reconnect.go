@@ -0,0 +1,211 @@
+package dist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// Reconnect is a Transport, which re-establishes the links of Transport
+// when they fail, e.g. when the remote process restarts.
+//
+//	proc := dist.Process{ID: "a", Net: &net, Transport: &dist.Reconnect{Transport: tcp}}
+//
+// The packets are sent from a buffer of Buffer packets, so the sender
+// keeps going while the link is re-established and blocks only once the
+// buffer is full. The packet that failed is sent again on the new link,
+// whether it had reached the receiver depends on Transport.
+type Reconnect struct {
+	Transport Transport
+	// MinBackoff is the wait before the first retry, defaults to 100ms.
+	// The wait is doubled on every failed attempt up to MaxBackoff,
+	// which defaults to 10s.
+	MinBackoff, MaxBackoff time.Duration
+	// Buffer is the number of packets buffered, defaults to 64.
+	Buffer int
+	// MaxAttempts limits the attempts of delivering a packet,
+	// zero means unlimited.
+	MaxAttempts int
+}
+
+// backoff returns the wait after the failed attempt.
+func (rc *Reconnect) backoff(attempt int) time.Duration {
+	min, max := rc.MinBackoff, rc.MaxBackoff
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// retry calls fn until it succeeds, waiting between the attempts.
+func (rc *Reconnect) retry(ctx context.Context, link Link, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || errors.Is(err, io.EOF) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if rc.MaxAttempts > 0 && attempt+1 >= rc.MaxAttempts {
+			return fmt.Errorf("%s: giving up after %d attempts: %w", link.Name, attempt+1, err)
+		}
+		if err := flow.Sleep(ctx, rc.backoff(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// Send opens the sending side of the link, the link is opened on the
+// first packet. The buffer is sent until ctx is cancelled.
+func (rc *Reconnect) Send(ctx context.Context, link Link) (Sender, error) {
+	size := rc.Buffer
+	if size <= 0 {
+		size = 64
+	}
+	s := &reconnectSender{
+		rc:    rc,
+		link:  link,
+		queue: make(chan []byte, size),
+		done:  make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s, nil
+}
+
+// Recv opens the receiving side of the link.
+func (rc *Reconnect) Recv(ctx context.Context, link Link) (Receiver, error) {
+	r := &reconnectReceiver{rc: rc, link: link}
+	err := rc.retry(ctx, link, r.open(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type reconnectSender struct {
+	rc     *Reconnect
+	link   Link
+	sender Sender
+
+	queue  chan []byte
+	closed sync.Once
+	// done is closed when run has returned with err
+	done chan struct{}
+	err  error
+}
+
+func (s *reconnectSender) Send(ctx context.Context, packet []byte) error {
+	select {
+	case <-s.done:
+		if s.err == nil {
+			return io.ErrClosedPipe
+		}
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.queue <- packet:
+		return nil
+	}
+}
+
+// Close waits until the buffered packets have been sent
+// and closes the link.
+func (s *reconnectSender) Close() error {
+	s.closed.Do(func() { close(s.queue) })
+	<-s.done
+	return s.err
+}
+
+// run sends the buffered packets.
+func (s *reconnectSender) run(ctx context.Context) {
+	defer close(s.done)
+	for packet := range s.queue {
+		packet := packet
+		if s.err = s.rc.retry(ctx, s.link, s.attempt(ctx, func(sender Sender) error {
+			return sender.Send(ctx, packet)
+		})); s.err != nil {
+			return
+		}
+	}
+	s.err = s.rc.retry(ctx, s.link, s.attempt(ctx, Sender.Close))
+}
+
+// attempt returns a function, which calls fn with an open link.
+// A failed link is abandoned without closing, as closing it would
+// signal end of stream.
+func (s *reconnectSender) attempt(ctx context.Context, fn func(Sender) error) func() error {
+	return func() error {
+		if s.sender == nil {
+			sender, err := s.rc.Transport.Send(ctx, s.link)
+			if err != nil {
+				return err
+			}
+			s.sender = sender
+		}
+		if err := fn(s.sender); err != nil {
+			s.sender = nil
+			return err
+		}
+		return nil
+	}
+}
+
+type reconnectReceiver struct {
+	rc       *Reconnect
+	link     Link
+	receiver Receiver
+}
+
+// open returns a function, which opens the link.
+func (r *reconnectReceiver) open(ctx context.Context) func() error {
+	return func() error {
+		receiver, err := r.rc.Transport.Recv(ctx, r.link)
+		if err != nil {
+			return err
+		}
+		r.receiver = receiver
+		return nil
+	}
+}
+
+func (r *reconnectReceiver) Recv(ctx context.Context) ([]byte, error) {
+	var packet []byte
+	err := r.rc.retry(ctx, r.link, func() error {
+		if r.receiver == nil {
+			if err := r.open(ctx)(); err != nil {
+				return err
+			}
+		}
+		var err error
+		packet, err = r.receiver.Recv(ctx)
+		if err != nil && !errors.Is(err, io.EOF) && ctx.Err() == nil {
+			_ = r.receiver.Close()
+			r.receiver = nil
+		}
+		return err
+	})
+	return packet, err
+}
+
+func (r *reconnectReceiver) Close() error {
+	if r.receiver == nil {
+		return nil
+	}
+	return r.receiver.Close()
+}
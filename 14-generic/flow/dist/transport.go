@@ -0,0 +1,104 @@
+package dist
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Link is a connection between two processes.
+type Link struct {
+	// Name identifies the link, it's the wire in the graph definition.
+	Name string
+	// From and To are the sending and receiving processes.
+	From, To string
+}
+
+// Transport carries the packets of links between processes.
+//
+// The packets of a link must be delivered in order. Packets sent before
+// the receiving side has opened the link must not be lost.
+type Transport interface {
+	// Send opens the sending side of the link.
+	Send(ctx context.Context, link Link) (Sender, error)
+	// Recv opens the receiving side of the link.
+	Recv(ctx context.Context, link Link) (Receiver, error)
+}
+
+// Sender sends packets over a link.
+type Sender interface {
+	Send(ctx context.Context, packet []byte) error
+	// Close signals end of stream to the receiver.
+	Close() error
+}
+
+// Receiver receives packets from a link.
+type Receiver interface {
+	// Recv returns io.EOF after the sender has closed the link.
+	Recv(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+// Loopback is a Transport for processes in a single address space,
+// it's useful for testing partitioned graphs.
+type Loopback struct {
+	mu    sync.Mutex
+	links map[string]chan []byte
+}
+
+func (lb *Loopback) channel(link Link) chan []byte {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if lb.links == nil {
+		lb.links = make(map[string]chan []byte)
+	}
+	ch, ok := lb.links[link.Name]
+	if !ok {
+		ch = make(chan []byte)
+		lb.links[link.Name] = ch
+	}
+	return ch
+}
+
+func (lb *Loopback) Send(ctx context.Context, link Link) (Sender, error) {
+	return &loopSender{ch: lb.channel(link)}, nil
+}
+
+func (lb *Loopback) Recv(ctx context.Context, link Link) (Receiver, error) {
+	return &loopReceiver{ch: lb.channel(link)}, nil
+}
+
+type loopSender struct {
+	ch     chan []byte
+	closed sync.Once
+}
+
+func (s *loopSender) Send(ctx context.Context, packet []byte) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.ch <- packet:
+		return nil
+	}
+}
+
+func (s *loopSender) Close() error {
+	s.closed.Do(func() { close(s.ch) })
+	return nil
+}
+
+type loopReceiver struct{ ch chan []byte }
+
+func (r *loopReceiver) Recv(ctx context.Context) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case packet, ok := <-r.ch:
+		if !ok {
+			return nil, io.EOF
+		}
+		return packet, nil
+	}
+}
+
+func (r *loopReceiver) Close() error { return nil }
@@ -0,0 +1,90 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Source receives the values sent from an Out port of a node,
+// without knowing its type at compile time.
+type Source struct {
+	in   inPort
+	conn Connection
+}
+
+// Source connects to the Out port of a node.
+func (net *Network) Source(node Name, port PortName) (*Source, error) {
+	p, err := net.endpoint(node, port)
+	if err != nil {
+		return nil, err
+	}
+	out, ok := p.(outPort)
+	if !ok {
+		return nil, fmt.Errorf("%s.%s is not an Out", node, port)
+	}
+
+	in := out.newIn()
+	in.bind(binding{net: net, name: "source(" + string(node) + "." + string(port) + ")"})
+	conn, err := out.connect(in)
+	if err != nil {
+		return nil, err
+	}
+	return &Source{in: in, conn: conn}, nil
+}
+
+// Type returns the type of the values.
+func (src *Source) Type() reflect.Type { return src.in.elemType() }
+
+// Recv waits for the next value, see In.Recv.
+func (src *Source) Recv(ctx context.Context) (any, error) { return src.in.recvAny(ctx) }
+
+// Disconnect disconnects the source from the port.
+func (src *Source) Disconnect() { src.conn.Disconnect() }
+
+// Sink sends values to an In port of a node,
+// without knowing its type at compile time.
+type Sink struct {
+	out  outPort
+	conn Connection
+}
+
+// Sink connects to the In port of a node.
+func (net *Network) Sink(node Name, port PortName) (*Sink, error) {
+	p, err := net.endpoint(node, port)
+	if err != nil {
+		return nil, err
+	}
+	in, ok := p.(inPort)
+	if !ok {
+		return nil, fmt.Errorf("%s.%s is not an In", node, port)
+	}
+
+	out := in.newOut()
+	out.bind(binding{net: net, name: "sink(" + string(node) + "." + string(port) + ")"})
+	conn, err := out.connect(in)
+	if err != nil {
+		return nil, err
+	}
+	return &Sink{out: out, conn: conn}, nil
+}
+
+// Type returns the type of the values.
+func (sink *Sink) Type() reflect.Type { return sink.out.elemType() }
+
+// Send sends v to the port, v must have the type of the port.
+func (sink *Sink) Send(ctx context.Context, v any) error { return sink.out.sendAny(ctx, v) }
+
+// Close signals end of stream, see Out.Close.
+func (sink *Sink) Close(ctx context.Context) error { return sink.out.closeAny(ctx) }
+
+// Disconnect disconnects the sink from the port.
+func (sink *Sink) Disconnect() { sink.conn.Disconnect() }
+
+func (net *Network) endpoint(node Name, name PortName) (port, error) {
+	c, ok := net.nodes[node]
+	if !ok {
+		return nil, fmt.Errorf("node %s does not exist", node)
+	}
+	return net.portOf(node, c, name)
+}
@@ -0,0 +1,65 @@
+package flow
+
+import "sync/atomic"
+
+// ConnState is the state of a connection.
+type ConnState string
+
+const (
+	// Open connections deliver packets.
+	Open = ConnState("open")
+	// Draining connections have been closed by the sender,
+	// but the receiver hasn't received all the packets.
+	Draining = ConnState("draining")
+	// Ended connections have delivered all the packets and end of stream.
+	Ended = ConnState("ended")
+	// Detached connections have been disconnected, see Conn.Disconnect.
+	Detached = ConnState("detached")
+)
+
+// State returns the current state of the connection.
+func (conn *Conn[T]) State() ConnState {
+	switch {
+	case atomic.LoadInt32(&conn.disconnected) != 0:
+		return Detached
+	case atomic.LoadInt32(&conn.ended) == 0:
+		return Open
+	case conn.queued() > 0:
+		return Draining
+	default:
+		return Ended
+	}
+}
+
+// InFlight returns the number of packets sent, but not yet received.
+func (conn *Conn[T]) InFlight() int { return conn.queued() }
+
+// ConnEventKind is the kind of a ConnEvent.
+type ConnEventKind string
+
+const (
+	// Connected is emitted when a connection is created.
+	Connected = ConnEventKind("connected")
+	// Closed is emitted when the sender closes the connection.
+	Closed = ConnEventKind("closed")
+	// Disconnected is emitted when a connection is disconnected.
+	Disconnected = ConnEventKind("disconnected")
+	// Dropped is emitted after Disconnected, when packets were
+	// still queued in the connection.
+	Dropped = ConnEventKind("dropped")
+)
+
+// ConnEvent describes a change of a connection, see Network.OnConnEvent.
+type ConnEvent struct {
+	Kind ConnEventKind
+	Conn Connection
+	// Packets is the number of dropped packets.
+	Packets int
+}
+
+// emit calls OnConnEvent.
+func (net *Network) emit(ev ConnEvent) {
+	if net.OnConnEvent != nil {
+		net.OnConnEvent(ev)
+	}
+}
@@ -0,0 +1,281 @@
+// Package grpcbridge connects ports of networks in different processes
+// over gRPC bidirectional streams.
+//
+// Both sides of the connection use a Bridge component. Values received
+// from Bridge.In are sent to the remote Bridge.Out and vice versa. One side
+// serves the bridge with a Server, the other side dials it by setting
+// Target. The bridges are matched by Name.
+//
+// The wire format is described in packet.proto.
+package grpcbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"fbp.example/flow"
+)
+
+// portHeader is the metadata key for the bridge name.
+const portHeader = "flow-port"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "flow.bridge.Bridge",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Exchange",
+		Handler:       exchangeHandler,
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+	Metadata: "packet.proto",
+}
+
+func exchangeHandler(srv any, stream grpc.ServerStream) error {
+	return srv.(*Server).exchange(stream)
+}
+
+// Server accepts bridge connections for the Bridge components
+// that use it.
+type Server struct {
+	mu      sync.Mutex
+	ports   map[string]chan *exchange
+	changed chan struct{}
+}
+
+// exchange is an incoming stream waiting for a Bridge.
+type exchange struct {
+	stream grpc.ServerStream
+	done   chan error
+}
+
+func NewServer() *Server { return &Server{} }
+
+// Register registers the bridge service with s.
+func (server *Server) Register(s *grpc.Server) {
+	s.RegisterService(&serviceDesc, server)
+}
+
+func (server *Server) exchange(stream grpc.ServerStream) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	names := md.Get(portHeader)
+	if len(names) != 1 {
+		return status.Errorf(codes.InvalidArgument, "%s must be specified once", portHeader)
+	}
+
+	// the remote may connect before the bridge has started,
+	// so the stream waits until the port is served
+	ex := &exchange{stream: stream, done: make(chan error, 1)}
+	for {
+		port, changed := server.lookup(names[0])
+		select {
+		case port <- ex:
+			return <-ex.done
+		case <-changed:
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+// lookup returns the port, which is nil when it's not served, and
+// a channel that is closed when the served ports change.
+func (server *Server) lookup(name string) (chan *exchange, chan struct{}) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.changed == nil {
+		server.changed = make(chan struct{})
+	}
+	return server.ports[name], server.changed
+}
+
+// notify wakes up the streams waiting for a port, server.mu must be held.
+func (server *Server) notify() {
+	if server.changed != nil {
+		close(server.changed)
+		server.changed = nil
+	}
+}
+
+// listen makes the port available for incoming streams.
+func (server *Server) listen(name string) (<-chan *exchange, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if _, exists := server.ports[name]; exists {
+		return nil, fmt.Errorf("grpcbridge: port %q already served", name)
+	}
+	if server.ports == nil {
+		server.ports = make(map[string]chan *exchange)
+	}
+	port := make(chan *exchange)
+	server.ports[name] = port
+	server.notify()
+	return port, nil
+}
+
+func (server *Server) unlisten(name string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	delete(server.ports, name)
+}
+
+// Bridge exchanges values with a Bridge in another network.
+//
+// The bridge completes once both directions have reached end of stream.
+// An unconnected In is treated as an empty stream.
+type Bridge[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	// Name identifies the bridge on the Server.
+	Name string
+
+	// Server accepts a single connection from the remote bridge.
+	Server *Server
+
+	// Target is the address of the remote Server.
+	Target string
+	// DialOptions are used for dialing Target,
+	// defaults to insecure transport credentials.
+	DialOptions []grpc.DialOption
+
+	// Codec encodes the values, defaults to JSON.
+	Codec flow.Codec[T]
+}
+
+// NewServerBridge creates a bridge served by server.
+func NewServerBridge[T any](server *Server, name string) *Bridge[T] {
+	return &Bridge[T]{Server: server, Name: name}
+}
+
+// NewClientBridge creates a bridge that dials target.
+func NewClientBridge[T any](target, name string) *Bridge[T] {
+	return &Bridge[T]{Target: target, Name: name}
+}
+
+func (b *Bridge[T]) Run(ctx context.Context) error {
+	switch {
+	case b.Server != nil && b.Target != "":
+		return errors.New("grpcbridge: both Server and Target specified")
+	case b.Server != nil:
+		return b.serve(ctx)
+	case b.Target != "":
+		return b.dial(ctx)
+	default:
+		return errors.New("grpcbridge: Server or Target must be specified")
+	}
+}
+
+func (b *Bridge[T]) serve(ctx context.Context) error {
+	port, err := b.Server.listen(b.Name)
+	if err != nil {
+		return err
+	}
+	defer b.Server.unlisten(b.Name)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ex := <-port:
+		err := b.pump(ctx, ex.stream, func() error { return nil })
+		ex.done <- err
+		return err
+	}
+}
+
+func (b *Bridge[T]) dial(ctx context.Context) error {
+	opts := b.DialOptions
+	if opts == nil {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.DialContext(ctx, b.Target, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	streamCtx := metadata.AppendToOutgoingContext(ctx, portHeader, b.Name)
+	stream, err := conn.NewStream(streamCtx, &serviceDesc.Streams[0],
+		"/flow.bridge.Bridge/Exchange", grpc.CallContentSubtype(codecName))
+	if err != nil {
+		return err
+	}
+	return b.pump(ctx, stream, stream.CloseSend)
+}
+
+// pump copies values between the ports and the stream,
+// closeSend is called after end of stream has been sent.
+func (b *Bridge[T]) pump(ctx context.Context, stream grpc.Stream, closeSend func() error) error {
+	codec := b.Codec
+	if codec == nil {
+		codec = flow.JSONCodec[T]()
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		if b.In.Connected() {
+			for {
+				v, err := b.In.Recv(ctx)
+				if errors.Is(err, flow.EOS) {
+					break
+				}
+				if err != nil {
+					return err
+				}
+
+				data, err := codec.Marshal(v)
+				if err != nil {
+					return err
+				}
+				if err := stream.SendMsg(&Packet{Data: data}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := stream.SendMsg(&Packet{EOS: true}); err != nil {
+			return err
+		}
+		return closeSend()
+	})
+	g.Go(func() error {
+		for {
+			var p Packet
+			err := stream.RecvMsg(&p)
+			if errors.Is(err, io.EOF) {
+				return errors.New("grpcbridge: stream ended before end of stream")
+			}
+			if err != nil {
+				return err
+			}
+			if p.EOS {
+				return b.Out.Close(ctx)
+			}
+
+			var v T
+			if err := codec.Unmarshal(p.Data, &v); err != nil {
+				return err
+			}
+			if !b.Out.Connected() {
+				continue
+			}
+			if err := b.Out.Send(ctx, v); err != nil {
+				return err
+			}
+		}
+	})
+	return g.Wait()
+}
@@ -0,0 +1,100 @@
+package grpcbridge
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Packet is the Go form of the Packet message in packet.proto.
+//
+// The message is small enough that it's encoded by hand, which avoids
+// depending on generated code.
+type Packet struct {
+	Data []byte
+	EOS  bool
+}
+
+const (
+	fieldData = 1
+	fieldEOS  = 2
+)
+
+// Marshal encodes the packet in protobuf wire format.
+func (p *Packet) Marshal() []byte {
+	var b []byte
+	if len(p.Data) > 0 {
+		b = protowire.AppendTag(b, fieldData, protowire.BytesType)
+		b = protowire.AppendBytes(b, p.Data)
+	}
+	if p.EOS {
+		b = protowire.AppendTag(b, fieldEOS, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	return b
+}
+
+// Unmarshal decodes the packet from protobuf wire format,
+// unknown fields are skipped.
+func (p *Packet) Unmarshal(b []byte) error {
+	*p = Packet{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == fieldData && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			p.Data = append([]byte(nil), v...)
+			b = b[n:]
+		case num == fieldEOS && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			p.EOS = v != 0
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+// codecName is the content-subtype used by the bridge,
+// so the codec doesn't interfere with other services.
+const codecName = "flowbridge"
+
+func init() { encoding.RegisterCodec(codec{}) }
+
+type codec struct{}
+
+func (codec) Name() string { return codecName }
+
+func (codec) Marshal(v any) ([]byte, error) {
+	p, ok := v.(*Packet)
+	if !ok {
+		return nil, fmt.Errorf("grpcbridge: cannot marshal %T", v)
+	}
+	return p.Marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	p, ok := v.(*Packet)
+	if !ok {
+		return errors.New("grpcbridge: cannot unmarshal into a non-packet")
+	}
+	return p.Unmarshal(data)
+}
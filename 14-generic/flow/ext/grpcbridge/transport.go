@@ -0,0 +1,136 @@
+package grpcbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"fbp.example/flow/dist"
+)
+
+// Transport carries the links of a distributed graph over gRPC.
+//
+// Every process serves its incoming links with Server and dials the
+// processes listed in Peers for the outgoing links.
+type Transport struct {
+	Server *Server
+	// Peers contains the addresses of the processes.
+	Peers map[string]string
+	// DialOptions are used for dialing the peers,
+	// defaults to insecure transport credentials.
+	DialOptions []grpc.DialOption
+}
+
+var _ dist.Transport = (*Transport)(nil)
+
+// Send dials the receiving process of the link.
+func (t *Transport) Send(ctx context.Context, link dist.Link) (dist.Sender, error) {
+	target, ok := t.Peers[link.To]
+	if !ok {
+		return nil, fmt.Errorf("grpcbridge: no address for process %q", link.To)
+	}
+
+	opts := t.DialOptions
+	if opts == nil {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the stream must outlive the ctx used for opening it
+	streamCtx, cancel := context.WithCancel(context.Background())
+	streamCtx = metadata.AppendToOutgoingContext(streamCtx, portHeader, link.Name)
+	stream, err := conn.NewStream(streamCtx, &serviceDesc.Streams[0],
+		"/flow.bridge.Bridge/Exchange", grpc.CallContentSubtype(codecName))
+	if err != nil {
+		cancel()
+		_ = conn.Close()
+		return nil, err
+	}
+	return &sender{conn: conn, stream: stream, cancel: cancel}, nil
+}
+
+// Recv waits for the sending process to connect.
+func (t *Transport) Recv(ctx context.Context, link dist.Link) (dist.Receiver, error) {
+	if t.Server == nil {
+		return nil, errors.New("grpcbridge: transport has no server")
+	}
+	port, err := t.Server.listen(link.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Server.unlisten(link.Name)
+		return nil, ctx.Err()
+	case ex := <-port:
+		t.Server.unlisten(link.Name)
+		return &receiver{ex: ex}, nil
+	}
+}
+
+type sender struct {
+	conn   *grpc.ClientConn
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+func (s *sender) Send(ctx context.Context, packet []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.stream.SendMsg(&Packet{Data: packet})
+}
+
+// Close sends end of stream and waits for the receiver to finish.
+func (s *sender) Close() error {
+	defer func() { _ = s.conn.Close() }()
+	defer s.cancel()
+
+	if err := s.stream.SendMsg(&Packet{EOS: true}); err != nil {
+		return err
+	}
+	if err := s.stream.CloseSend(); err != nil {
+		return err
+	}
+	var p Packet
+	if err := s.stream.RecvMsg(&p); !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+type receiver struct {
+	ex *exchange
+}
+
+func (r *receiver) Recv(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var p Packet
+	if err := r.ex.stream.RecvMsg(&p); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("grpcbridge: stream ended before end of stream")
+		}
+		return nil, err
+	}
+	if p.EOS {
+		return nil, io.EOF
+	}
+	return p.Data, nil
+}
+
+// Close finishes the stream.
+func (r *receiver) Close() error {
+	r.ex.done <- nil
+	return nil
+}
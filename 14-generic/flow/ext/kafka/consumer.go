@@ -0,0 +1,194 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"fbp.example/flow"
+)
+
+func init() {
+	flow.Register("KafkaConsumer", func() flow.Component { return &Consumer{} })
+	flow.Register("KafkaProducer", func() flow.Component { return &Producer{} })
+}
+
+// Consumer reads messages from Kafka and sends them to the ports
+// of their topic and partition.
+//
+// Messages are sent to Out["topic.partition"], Out["topic"] or Default,
+// whichever exists first. Messages without a connected port are committed
+// immediately.
+//
+// Offsets are committed once the downstream sends the message back to Acks.
+// Messages may be acknowledged out of order, a partition is committed up
+// to the first unacknowledged message.
+type Consumer struct {
+	Out     map[string]*flow.Out[Message]
+	Default flow.Out[Message]
+	Acks    flow.In[Message]
+
+	// Driver is used for connecting, when nil, DriverName is looked up
+	// from the registered drivers.
+	Driver     Driver
+	DriverName string
+	Config     ReaderConfig
+
+	// AutoCommit commits the messages once they have been delivered,
+	// instead of waiting for Acks. It's implied when Acks is not
+	// connected when Run starts.
+	AutoCommit bool
+}
+
+func NewConsumer(config ReaderConfig) *Consumer {
+	return &Consumer{Config: config}
+}
+
+func (c *Consumer) Run(ctx context.Context) error {
+	driver, err := driverFor(c.Driver, c.DriverName)
+	if err != nil {
+		return err
+	}
+	reader, err := driver.OpenReader(ctx, c.Config)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	offsets := newOffsets(reader)
+
+	autoCommit := c.AutoCommit || !c.Acks.Connected()
+
+	errs := make(chan error, 1)
+	if !autoCommit {
+		go func() {
+			if err := c.acknowledge(ctx, offsets); err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+
+	for {
+		msg, err := reader.Fetch(ctx)
+		if err != nil {
+			select {
+			case err := <-errs:
+				return err
+			default:
+			}
+			return err
+		}
+
+		offsets.track(msg)
+
+		out := c.route(msg)
+		if out == nil {
+			if err := offsets.ack(ctx, msg); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := out.Send(ctx, msg); err != nil {
+			return err
+		}
+		if autoCommit {
+			if err := offsets.ack(ctx, msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// acknowledge commits the messages received from Acks.
+func (c *Consumer) acknowledge(ctx context.Context, offsets *offsets) error {
+	for {
+		msg, err := c.Acks.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := offsets.ack(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// route returns the port for msg or nil when there's no connected port.
+func (c *Consumer) route(msg Message) *flow.Out[Message] {
+	out, ok := c.Out[msg.Topic+"."+strconv.Itoa(int(msg.Partition))]
+	if !ok {
+		out, ok = c.Out[msg.Topic]
+	}
+	if !ok {
+		out = &c.Default
+	}
+	if !out.Connected() {
+		return nil
+	}
+	return out
+}
+
+type partition struct {
+	topic string
+	id    int32
+}
+
+// offsets tracks the delivered messages and commits the acknowledged ones.
+type offsets struct {
+	reader Reader
+
+	mu      sync.Mutex
+	pending map[partition][]int64
+	acked   map[partition]map[int64]bool
+}
+
+func newOffsets(reader Reader) *offsets {
+	return &offsets{
+		reader:  reader,
+		pending: make(map[partition][]int64),
+		acked:   make(map[partition]map[int64]bool),
+	}
+}
+
+// track records msg as delivered.
+func (o *offsets) track(msg Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	p := partition{msg.Topic, msg.Partition}
+	o.pending[p] = append(o.pending[p], msg.Offset)
+}
+
+// ack marks msg as processed and commits the partition
+// when all the preceding messages have been processed.
+func (o *offsets) ack(ctx context.Context, msg Message) error {
+	o.mu.Lock()
+	p := partition{msg.Topic, msg.Partition}
+	if o.acked[p] == nil {
+		o.acked[p] = make(map[int64]bool)
+	}
+	o.acked[p][msg.Offset] = true
+
+	commit := int64(-1)
+	pending := o.pending[p]
+	for len(pending) > 0 && o.acked[p][pending[0]] {
+		delete(o.acked[p], pending[0])
+		commit = pending[0] + 1
+		pending = pending[1:]
+	}
+	o.pending[p] = pending
+	o.mu.Unlock()
+
+	if commit < 0 {
+		return nil
+	}
+	return o.reader.Commit(ctx, p.topic, p.id, commit)
+}
@@ -0,0 +1,123 @@
+// Package kafka contains components for consuming and producing Kafka messages.
+//
+// The package doesn't depend on a Kafka client, instead a client library
+// is adapted to the Driver interface and registered with RegisterDriver,
+// similarly to database/sql drivers.
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Message is a Kafka record.
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+
+	Key     []byte
+	Value   []byte
+	Headers map[string][]byte
+	Time    time.Time
+}
+
+// Driver creates connections to a Kafka cluster.
+type Driver interface {
+	OpenReader(ctx context.Context, config ReaderConfig) (Reader, error)
+	OpenWriter(ctx context.Context, config WriterConfig) (Writer, error)
+}
+
+// ReaderConfig configures a consumer group member.
+type ReaderConfig struct {
+	Brokers []string
+	Group   string
+	Topics  []string
+}
+
+// WriterConfig configures a producer.
+type WriterConfig struct {
+	Brokers []string
+}
+
+// Reader reads messages as part of a consumer group.
+type Reader interface {
+	// Fetch waits for the next message.
+	Fetch(ctx context.Context) (Message, error)
+	// Commit marks the messages before offset in the partition as processed.
+	Commit(ctx context.Context, topic string, partition int32, offset int64) error
+	Close() error
+}
+
+// Writer writes messages.
+type Writer interface {
+	// Write waits until the message has been acknowledged by the cluster
+	// and returns it with the assigned partition and offset.
+	Write(ctx context.Context, msg Message) (Message, error)
+	Close() error
+}
+
+var drivers struct {
+	sync.Mutex
+	byName map[string]Driver
+}
+
+// RegisterDriver makes a driver available by name.
+//
+// RegisterDriver panics when name is already registered.
+func RegisterDriver(name string, driver Driver) {
+	drivers.Lock()
+	defer drivers.Unlock()
+
+	if driver == nil {
+		panic("kafka: RegisterDriver driver is nil for " + name)
+	}
+	if _, dup := drivers.byName[name]; dup {
+		panic("kafka: RegisterDriver called twice for " + name)
+	}
+	if drivers.byName == nil {
+		drivers.byName = make(map[string]Driver)
+	}
+	drivers.byName[name] = driver
+}
+
+// Drivers returns the names of the registered drivers.
+func Drivers() []string {
+	drivers.Lock()
+	defer drivers.Unlock()
+
+	names := make([]string, 0, len(drivers.byName))
+	for name := range drivers.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// driverFor returns driver when it's set and otherwise looks up the
+// registered driver by name. Without a name the only registered
+// driver is used.
+func driverFor(driver Driver, name string) (Driver, error) {
+	if driver != nil {
+		return driver, nil
+	}
+
+	drivers.Lock()
+	defer drivers.Unlock()
+
+	if name == "" {
+		if len(drivers.byName) != 1 {
+			return nil, fmt.Errorf("kafka: driver must be specified, %d registered", len(drivers.byName))
+		}
+		for _, driver := range drivers.byName {
+			return driver, nil
+		}
+	}
+	if driver, ok := drivers.byName[name]; ok {
+		return driver, nil
+	}
+	return nil, fmt.Errorf("kafka: unknown driver %q", name)
+}
@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"fbp.example/flow"
+)
+
+// Producer writes the received messages to Kafka.
+//
+// Messages received from In["topic"] are written to that topic,
+// messages from Default must specify the Topic themselves.
+// Only the inputs connected when Run starts are read.
+// The written messages, with their partition and offset, are sent
+// to Acks when it's connected.
+type Producer struct {
+	In      map[string]*flow.In[Message]
+	Default flow.In[Message]
+	Acks    flow.Out[Message]
+
+	// Driver is used for connecting, when nil, DriverName is looked up
+	// from the registered drivers.
+	Driver     Driver
+	DriverName string
+	Config     WriterConfig
+}
+
+func NewProducer(config WriterConfig) *Producer {
+	return &Producer{Config: config}
+}
+
+func (p *Producer) Run(ctx context.Context) error {
+	driver, err := driverFor(p.Driver, p.DriverName)
+	if err != nil {
+		return err
+	}
+	writer, err := driver.OpenWriter(ctx, p.Config)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = writer.Close() }()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// messages from all the inputs are written by a single goroutine,
+	// so the writer doesn't need to be safe for concurrent use
+	messages := make(chan Message)
+	errs := make(chan error, len(p.In)+1)
+
+	var wg sync.WaitGroup
+	receive := func(topic string, in *flow.In[Message]) {
+		defer wg.Done()
+		for {
+			msg, err := in.Recv(ctx)
+			if errors.Is(err, flow.EOS) {
+				return
+			}
+			if err != nil {
+				errs <- err
+				cancel()
+				return
+			}
+			if topic != "" {
+				msg.Topic = topic
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	// unconnected inputs would never reach end of stream
+	if p.Default.Connected() {
+		wg.Add(1)
+		go receive("", &p.Default)
+	}
+	for topic, in := range p.In {
+		if in.Connected() {
+			wg.Add(1)
+			go receive(topic, in)
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(messages)
+	}()
+
+	for msg := range messages {
+		if msg.Topic == "" {
+			cancel()
+			return errors.New("kafka: message without a topic")
+		}
+
+		written, err := writer.Write(ctx, msg)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("kafka: writing to %s: %w", msg.Topic, err)
+		}
+		if p.Acks.Connected() {
+			if err := p.Acks.Send(ctx, written); err != nil {
+				cancel()
+				return err
+			}
+		}
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.Acks.Close(ctx)
+}
@@ -0,0 +1,17 @@
+module fbp.example/flow/ext/nats
+
+go 1.18
+
+require (
+	fbp.example v0.0.0
+	github.com/nats-io/nats.go v1.16.0
+)
+
+require (
+	github.com/nats-io/nkeys v0.3.0 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	golang.org/x/crypto v0.0.0-20210314154223-e6e6c4f2bb5b // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+)
+
+replace fbp.example => ../../..
@@ -0,0 +1,289 @@
+// Package nats contains components for publishing and subscribing to NATS.
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	gonats "github.com/nats-io/nats.go"
+
+	"fbp.example/flow"
+)
+
+func init() {
+	flow.Register("NATSSubscribe", func() flow.Component { return &Subscribe{} })
+	flow.Register("NATSPublish", func() flow.Component { return &Publish{} })
+}
+
+// Msg is a NATS message.
+type Msg struct {
+	Subject string
+	Reply   string
+	Data    []byte
+	Header  map[string][]string
+
+	// raw is set for received messages.
+	raw *gonats.Msg
+}
+
+func fromNATS(m *gonats.Msg) Msg {
+	return Msg{
+		Subject: m.Subject,
+		Reply:   m.Reply,
+		Data:    m.Data,
+		Header:  m.Header,
+		raw:     m,
+	}
+}
+
+func (m Msg) toNATS() *gonats.Msg {
+	return &gonats.Msg{
+		Subject: m.Subject,
+		Reply:   m.Reply,
+		Data:    m.Data,
+		Header:  m.Header,
+	}
+}
+
+// Connection configures how the components connect to NATS.
+type Connection struct {
+	// Conn is used when set, otherwise URL is dialed with Options.
+	Conn    *gonats.Conn
+	URL     string
+	Options []gonats.Option
+}
+
+// open returns the connection and a func to release it.
+func (c *Connection) open() (*gonats.Conn, func(), error) {
+	if c.Conn != nil {
+		return c.Conn, func() {}, nil
+	}
+	url := c.URL
+	if url == "" {
+		url = gonats.DefaultURL
+	}
+	conn, err := gonats.Connect(url, c.Options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, conn.Close, nil
+}
+
+// Buffer is the number of messages buffered per subscription.
+var Buffer = 64
+
+// Subscribe sends the messages matching Subjects[i] to Out[i].
+//
+// Subjects may contain wildcards. With JetStream, messages are
+// acknowledged when the downstream sends them back to Acks, or when they
+// have been delivered if Acks is not connected.
+type Subscribe struct {
+	Out  []flow.Out[Msg]
+	Acks flow.In[Msg]
+
+	Connection
+	Subjects []string
+	// Queue makes the subscriptions members of a queue group.
+	Queue string
+
+	// JetStream subscribes with JetStream using the Durable consumer name.
+	JetStream bool
+	Durable   string
+}
+
+func NewSubscribe(url string, subjects ...string) *Subscribe {
+	return &Subscribe{
+		Out:        make([]flow.Out[Msg], len(subjects)),
+		Connection: Connection{URL: url},
+		Subjects:   subjects,
+	}
+}
+
+func (s *Subscribe) Run(ctx context.Context) error {
+	if len(s.Subjects) != len(s.Out) {
+		return fmt.Errorf("nats: %d subjects for %d outputs", len(s.Subjects), len(s.Out))
+	}
+
+	conn, release, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var js gonats.JetStreamContext
+	if s.JetStream {
+		js, err = conn.JetStream(gonats.Context(ctx))
+		if err != nil {
+			return err
+		}
+	}
+	ackOnDelivery := s.JetStream && !s.Acks.Connected()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(s.Subjects)+1)
+	fail := func(err error) {
+		errs <- err
+		cancel()
+	}
+
+	for i, subject := range s.Subjects {
+		ch := make(chan *gonats.Msg, Buffer)
+		sub, err := s.subscribe(conn, js, subject, ch)
+		if err != nil {
+			return fmt.Errorf("nats: subscribing to %s: %w", subject, err)
+		}
+		defer func() { _ = sub.Unsubscribe() }()
+
+		out := &s.Out[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case m := <-ch:
+					if err := out.Send(ctx, fromNATS(m)); err != nil {
+						fail(err)
+						return
+					}
+					if ackOnDelivery {
+						if err := m.Ack(); err != nil {
+							fail(err)
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	if s.JetStream && !ackOnDelivery {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.acknowledge(ctx); err != nil {
+				fail(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	return ctx.Err()
+}
+
+func (s *Subscribe) subscribe(conn *gonats.Conn, js gonats.JetStreamContext, subject string, ch chan *gonats.Msg) (*gonats.Subscription, error) {
+	if js == nil {
+		if s.Queue != "" {
+			return conn.ChanQueueSubscribe(subject, s.Queue, ch)
+		}
+		return conn.ChanSubscribe(subject, ch)
+	}
+
+	opts := []gonats.SubOpt{gonats.ManualAck()}
+	if s.Durable != "" {
+		opts = append(opts, gonats.Durable(s.Durable))
+	}
+	if s.Queue != "" {
+		return js.ChanQueueSubscribe(subject, s.Queue, ch, opts...)
+	}
+	return js.ChanSubscribe(subject, ch, opts...)
+}
+
+// acknowledge acks the messages received from Acks.
+func (s *Subscribe) acknowledge(ctx context.Context) error {
+	for {
+		m, err := s.Acks.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if m.raw == nil {
+			return errors.New("nats: acknowledged message was not received from NATS")
+		}
+		if err := m.raw.Ack(gonats.Context(ctx)); err != nil {
+			return err
+		}
+	}
+}
+
+// Publish publishes the received messages to their subject.
+//
+// With JetStream, each publish waits for the acknowledgment from the
+// server. The published messages are sent to Out when it's connected.
+type Publish struct {
+	In  flow.In[Msg]
+	Out flow.Out[Msg]
+
+	Connection
+	// Subject is used for messages that don't specify one.
+	Subject   string
+	JetStream bool
+}
+
+func NewPublish(url string) *Publish {
+	return &Publish{Connection: Connection{URL: url}}
+}
+
+func (p *Publish) Run(ctx context.Context) error {
+	conn, release, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var js gonats.JetStreamContext
+	if p.JetStream {
+		js, err = conn.JetStream()
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		m, err := p.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			if err := conn.FlushWithContext(ctx); err != nil {
+				return err
+			}
+			return p.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if m.Subject == "" {
+			m.Subject = p.Subject
+		}
+		if m.Subject == "" {
+			return errors.New("nats: message without a subject")
+		}
+
+		if js != nil {
+			_, err = js.PublishMsg(m.toNATS(), gonats.Context(ctx))
+		} else {
+			err = conn.PublishMsg(m.toNATS())
+		}
+		if err != nil {
+			return fmt.Errorf("nats: publishing to %s: %w", m.Subject, err)
+		}
+
+		if p.Out.Connected() {
+			if err := p.Out.Send(ctx, m); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,12 @@
+module fbp.example/flow/ext/protocodec
+
+go 1.18
+
+require (
+	fbp.example v0.0.0
+	google.golang.org/protobuf v1.30.0
+)
+
+require golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+
+replace fbp.example => ../../..
@@ -0,0 +1,50 @@
+// Package protocodec encodes protobuf messages for flow connections.
+package protocodec
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+
+	"fbp.example/flow"
+)
+
+// Encoding encodes protobuf messages in wire format.
+//
+// Unmarshal accepts a message or a pointer to a message pointer,
+// in which case a new message is allocated when it's nil.
+var Encoding flow.Encoding = encoding{}
+
+// Codec returns a Codec for protobuf messages of type T, e.g. *pb.Event.
+func Codec[T proto.Message]() flow.Codec[T] { return flow.CodecFor[T](Encoding) }
+
+type encoding struct{}
+
+func (encoding) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protocodec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (encoding) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+
+	// v is a pointer to a message pointer, e.g. **pb.Event
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Ptr {
+		return fmt.Errorf("protocodec: cannot unmarshal into %T", v)
+	}
+	if rv.Elem().IsNil() {
+		rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+	}
+	m, ok := rv.Elem().Interface().(proto.Message)
+	if !ok {
+		return fmt.Errorf("protocodec: cannot unmarshal into %T", v)
+	}
+	return proto.Unmarshal(data, m)
+}
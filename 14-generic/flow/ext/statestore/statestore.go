@@ -0,0 +1,117 @@
+// Package statestore contains flow.StateStore backends for Redis and bbolt.
+//
+// The package doesn't depend on the client libraries, instead the client
+// is adapted to a small interface, e.g. for go-redis:
+//
+//	type redisClient struct{ *redis.Client }
+//
+//	func (c redisClient) Get(ctx context.Context, key string) ([]byte, bool, error) {
+//		data, err := c.Client.Get(ctx, key).Bytes()
+//		if errors.Is(err, redis.Nil) {
+//			return nil, false, nil
+//		}
+//		return data, err == nil, err
+//	}
+//
+//	func (c redisClient) Set(ctx context.Context, key string, value []byte) error {
+//		return c.Client.Set(ctx, key, value, 0).Err()
+//	}
+//
+//	net.StateStore = &statestore.Redis{Client: redisClient{rdb}, Prefix: "pipeline/"}
+package statestore
+
+import (
+	"context"
+	"fmt"
+)
+
+// RedisClient is the subset of a Redis client used by Redis.
+type RedisClient interface {
+	// Get returns the value of key, ok is false when it doesn't exist.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set sets the value of key.
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// Redis keeps the state in Redis, a Redis key for each state key.
+type Redis struct {
+	Client RedisClient
+	// Prefix is prepended to the keys, e.g. to share a database
+	// between networks.
+	Prefix string
+}
+
+func (store *Redis) Load(ctx context.Context, key string) ([]byte, error) {
+	data, ok, err := store.Client.Get(ctx, store.Prefix+key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
+
+func (store *Redis) Store(ctx context.Context, key string, data []byte) error {
+	return store.Client.Set(ctx, store.Prefix+key, data)
+}
+
+// BoltDB is the subset of a bbolt database used by Bolt, for *bbolt.DB:
+//
+//	type boltDB struct{ *bbolt.DB }
+//
+//	func (db boltDB) Get(bucket, key []byte) (value []byte, err error) {
+//		err = db.View(func(tx *bbolt.Tx) error {
+//			if b := tx.Bucket(bucket); b != nil {
+//				value = append([]byte(nil), b.Get(key)...)
+//			}
+//			return nil
+//		})
+//		return value, err
+//	}
+//
+//	func (db boltDB) Put(bucket, key, value []byte) error {
+//		return db.Update(func(tx *bbolt.Tx) error {
+//			b, err := tx.CreateBucketIfNotExists(bucket)
+//			if err != nil {
+//				return err
+//			}
+//			return b.Put(key, value)
+//		})
+//	}
+type BoltDB interface {
+	// Get returns the value of key in bucket, nil when it doesn't exist.
+	Get(bucket, key []byte) ([]byte, error)
+	// Put sets the value of key in bucket, creating the bucket
+	// when needed.
+	Put(bucket, key, value []byte) error
+}
+
+// Bolt keeps the state in a bucket of a bbolt database.
+type Bolt struct {
+	DB BoltDB
+	// Bucket defaults to "flow".
+	Bucket string
+}
+
+func (store *Bolt) bucket() []byte {
+	if store.Bucket == "" {
+		return []byte("flow")
+	}
+	return []byte(store.Bucket)
+}
+
+func (store *Bolt) Load(ctx context.Context, key string) ([]byte, error) {
+	data, err := store.DB.Get(store.bucket(), []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("bolt: %w", err)
+	}
+	return data, nil
+}
+
+func (store *Bolt) Store(ctx context.Context, key string, data []byte) error {
+	if err := store.DB.Put(store.bucket(), []byte(key), data); err != nil {
+		return fmt.Errorf("bolt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+module fbp.example/flow/ext/websocket
+
+go 1.18
+
+require fbp.example v0.0.0
+
+require (
+	github.com/gorilla/websocket v1.5.0
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+)
+
+replace fbp.example => ../../..
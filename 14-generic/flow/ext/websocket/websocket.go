@@ -0,0 +1,299 @@
+// Package websocket bridges flow connections to WebSocket clients.
+//
+// WSIn forwards messages from WebSockets into the network and WSOut
+// forwards values from the network to WebSockets. Values are encoded
+// as JSON text messages.
+//
+// In server mode the components are mounted as http.Handler and serve
+// any number of clients. In client mode, when URL is set, the components
+// dial the server themselves.
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+
+	"fbp.example/flow"
+)
+
+var errStopped = errors.New("websocket: stopped")
+
+// WriteTimeout limits the time spent writing a single message to a client.
+var WriteTimeout = 10 * time.Second
+
+// WSIn sends the messages received from WebSocket clients to Out.
+type WSIn[T any] struct {
+	Out flow.Out[T]
+
+	// URL is the server address for client mode.
+	URL string
+	// Dialer is used in client mode, defaults to gorilla.DefaultDialer.
+	Dialer *gorilla.Dialer
+	// Upgrader is used in server mode.
+	Upgrader gorilla.Upgrader
+
+	once     sync.Once
+	messages chan T
+	stopped  chan struct{}
+	clients  clients
+}
+
+func NewWSIn[T any]() *WSIn[T] { return &WSIn[T]{} }
+
+// NewWSInClient creates a WSIn that connects to url.
+func NewWSInClient[T any](url string) *WSIn[T] { return &WSIn[T]{URL: url} }
+
+func (ws *WSIn[T]) init() {
+	ws.once.Do(func() {
+		ws.messages = make(chan T)
+		ws.stopped = make(chan struct{})
+	})
+}
+
+// ServeHTTP accepts a WebSocket client in server mode.
+func (ws *WSIn[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws.init()
+
+	conn, err := ws.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already responded to the client
+		return
+	}
+	if !ws.clients.add(conn) {
+		return
+	}
+	defer ws.clients.remove(conn)
+
+	_ = readMessages(conn, ws.messages, r.Context().Done(), ws.stopped)
+}
+
+// Run forwards the messages until ctx is cancelled, in client mode
+// until the server closes the connection.
+func (ws *WSIn[T]) Run(ctx context.Context) error {
+	ws.init()
+	defer close(ws.stopped)
+	defer ws.clients.closeAll()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	if ws.URL != "" {
+		conn, err := dial(ctx, ws.Dialer, ws.URL)
+		if err != nil {
+			return err
+		}
+		if !ws.clients.add(conn) {
+			return ctx.Err()
+		}
+		go func() { done <- readMessages(conn, ws.messages, ctx.Done(), nil) }()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+			return ws.Out.Close(ctx)
+		case v := <-ws.messages:
+			if err := ws.Out.Send(ctx, v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WSOut sends the values received from In to WebSocket clients.
+//
+// In server mode every value is sent to all the connected clients,
+// values are dropped when there are none.
+type WSOut[T any] struct {
+	In flow.In[T]
+
+	// URL is the server address for client mode.
+	URL string
+	// Dialer is used in client mode, defaults to gorilla.DefaultDialer.
+	Dialer *gorilla.Dialer
+	// Upgrader is used in server mode.
+	Upgrader gorilla.Upgrader
+
+	clients clients
+}
+
+func NewWSOut[T any]() *WSOut[T] { return &WSOut[T]{} }
+
+// NewWSOutClient creates a WSOut that connects to url.
+func NewWSOutClient[T any](url string) *WSOut[T] { return &WSOut[T]{URL: url} }
+
+// ServeHTTP accepts a WebSocket client in server mode.
+func (ws *WSOut[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := ws.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	if !ws.clients.add(conn) {
+		return
+	}
+	defer ws.clients.remove(conn)
+
+	// reading is required to handle control messages and
+	// to notice when the client goes away
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// Run forwards the values until end of stream and then closes the clients.
+func (ws *WSOut[T]) Run(ctx context.Context) error {
+	defer ws.clients.closeAll()
+
+	if ws.URL != "" {
+		conn, err := dial(ctx, ws.Dialer, ws.URL)
+		if err != nil {
+			return err
+		}
+		if !ws.clients.add(conn) {
+			return ctx.Err()
+		}
+		go func() {
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		v, err := ws.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		for _, conn := range ws.clients.list() {
+			_ = conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+			if err := conn.WriteMessage(gorilla.TextMessage, data); err != nil {
+				ws.clients.remove(conn)
+				if ws.URL != "" {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// readMessages decodes messages from conn until it's closed
+// or either of the stop channels is closed.
+//
+// A normal closure from the peer is not an error.
+func readMessages[T any](conn *gorilla.Conn, messages chan<- T, stop1, stop2 <-chan struct{}) error {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if gorilla.IsCloseError(err, gorilla.CloseNormalClosure, gorilla.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			_ = conn.WriteControl(gorilla.CloseMessage,
+				gorilla.FormatCloseMessage(gorilla.CloseUnsupportedData, err.Error()),
+				time.Now().Add(WriteTimeout))
+			return err
+		}
+
+		select {
+		case messages <- v:
+		case <-stop1:
+			return errStopped
+		case <-stop2:
+			return errStopped
+		}
+	}
+}
+
+func dial(ctx context.Context, dialer *gorilla.Dialer, url string) (*gorilla.Conn, error) {
+	if dialer == nil {
+		dialer = gorilla.DefaultDialer
+	}
+	conn, resp, err := dialer.DialContext(ctx, url, nil)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	return conn, err
+}
+
+// clients tracks the active connections.
+type clients struct {
+	mu     sync.Mutex
+	conns  map[*gorilla.Conn]struct{}
+	closed bool
+}
+
+// add adds conn, when the clients have already been closed
+// it closes conn and returns false.
+func (cs *clients) add(conn *gorilla.Conn) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		_ = conn.Close()
+		return false
+	}
+	if cs.conns == nil {
+		cs.conns = make(map[*gorilla.Conn]struct{})
+	}
+	cs.conns[conn] = struct{}{}
+	return true
+}
+
+func (cs *clients) remove(conn *gorilla.Conn) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.conns, conn)
+	_ = conn.Close()
+}
+
+func (cs *clients) list() []*gorilla.Conn {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	list := make([]*gorilla.Conn, 0, len(cs.conns))
+	for conn := range cs.conns {
+		list = append(list, conn)
+	}
+	return list
+}
+
+// closeAll sends a close message to all clients and disconnects them.
+func (cs *clients) closeAll() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.closed = true
+	for conn := range cs.conns {
+		_ = conn.WriteControl(gorilla.CloseMessage,
+			gorilla.FormatCloseMessage(gorilla.CloseNormalClosure, ""),
+			time.Now().Add(WriteTimeout))
+		_ = conn.Close()
+	}
+	cs.conns = nil
+}
@@ -0,0 +1,261 @@
+package flow
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+/*
+	An external component runs as a subprocess, which exchanges packets
+	with the network over its stdin and stdout. Both directions use
+	the same frames:
+
+		uint32  length of the rest of the frame, big-endian
+		uint8   kind: 0 data, 1 end of stream, 2 error
+		uint8   length of the port name
+		...     port name
+		...     payload
+
+	The payload of a data frame is the packet encoded with the Encoding
+	of the component, JSON by default. An error frame contains the error
+	message and fails the component. Data for the In ports is written
+	to stdin, after all of them have reached end of stream stdin is
+	closed. Data for the Out ports is read from stdout, when stdout is
+	closed all the Out ports are closed. The subprocess should exit
+	after stdin has been closed.
+*/
+
+const (
+	frameData  = 0
+	frameEOS   = 1
+	frameError = 2
+
+	// maxFrame limits the size of frames read from a subprocess.
+	maxFrame = 64 << 20
+)
+
+// ExternalComponent runs a component in another process,
+// e.g. one written in another language.
+type ExternalComponent struct {
+	In  map[string]*InAny
+	Out map[string]*OutAny
+
+	// Path and Args are the command to run, see exec.Command.
+	Path string
+	Args []string
+	// Dir and Env are passed to exec.Cmd.
+	Dir string
+	Env []string
+	// Stderr receives the standard error of the process,
+	// defaults to os.Stderr.
+	Stderr io.Writer
+
+	// Encoding encodes the packets, defaults to JSON.
+	Encoding Encoding
+	// Alloc returns a pointer to a new value, which a packet received
+	// on the Out port is decoded into. By default values are decoded
+	// into an any, which is enough for JSON.
+	Alloc func(port string) any
+}
+
+// NewExternalComponent returns a component that runs the command.
+//
+// The ports are created when they are connected in a graph definition,
+// or by adding them to In and Out.
+func NewExternalComponent(path string, args ...string) *ExternalComponent {
+	return &ExternalComponent{
+		In:   map[string]*InAny{},
+		Out:  map[string]*OutAny{},
+		Path: path,
+		Args: args,
+	}
+}
+
+// Run starts the process and exchanges packets with it until it exits.
+func (x *ExternalComponent) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, x.Path, x.Args...)
+	cmd.Dir, cmd.Env = x.Dir, x.Env
+	cmd.Stderr = x.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("external %s: %w", x.Path, err)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return x.write(gctx, stdin) })
+	g.Go(func() error { return x.read(gctx, stdout) })
+	err = g.Wait()
+	if err != nil {
+		cancel()
+	}
+
+	if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("external %s: %w", x.Path, waitErr)
+	}
+	return err
+}
+
+// write forwards the packets from the In ports to stdin.
+func (x *ExternalComponent) write(ctx context.Context, stdin io.WriteCloser) error {
+	defer stdin.Close()
+
+	enc := x.encoding()
+	w := bufio.NewWriter(stdin)
+	var mu sync.Mutex
+	send := func(kind byte, port string, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := writeFrame(w, kind, port, payload); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for name, in := range x.In {
+		name, in := name, in
+		g.Go(func() error {
+			for {
+				v, err := in.Recv(ctx)
+				if errors.Is(err, EOS) {
+					return send(frameEOS, name, nil)
+				}
+				if err != nil {
+					return err
+				}
+				data, err := enc.Marshal(v)
+				if err != nil {
+					return fmt.Errorf("external %s: %s: %w", x.Path, name, err)
+				}
+				if err := send(frameData, name, data); err != nil {
+					return err
+				}
+			}
+		})
+	}
+	return g.Wait()
+}
+
+// read forwards the packets from stdout to the Out ports.
+func (x *ExternalComponent) read(ctx context.Context, stdout io.Reader) error {
+	enc := x.encoding()
+	r := bufio.NewReader(stdout)
+	for {
+		kind, port, payload, err := readFrame(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("external %s: %w", x.Path, err)
+		}
+		if kind == frameError {
+			return fmt.Errorf("external %s: %s", x.Path, payload)
+		}
+
+		out, ok := x.Out[port]
+		if !ok {
+			return fmt.Errorf("external %s: unknown port %s", x.Path, port)
+		}
+		switch kind {
+		case frameEOS:
+			if err := out.Close(ctx); err != nil {
+				return err
+			}
+		case frameData:
+			v, err := x.decode(enc, port, payload)
+			if err != nil {
+				return fmt.Errorf("external %s: %s: %w", x.Path, port, err)
+			}
+			if err := out.Send(ctx, v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("external %s: invalid frame kind %d", x.Path, kind)
+		}
+	}
+
+	for _, out := range x.Out {
+		if err := out.Close(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *ExternalComponent) encoding() Encoding {
+	if x.Encoding == nil {
+		return JSON
+	}
+	return x.Encoding
+}
+
+func (x *ExternalComponent) decode(enc Encoding, port string, data []byte) (any, error) {
+	if x.Alloc == nil {
+		var v any
+		err := enc.Unmarshal(data, &v)
+		return v, err
+	}
+	p := x.Alloc(port)
+	if err := enc.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(p).Elem().Interface(), nil
+}
+
+func writeFrame(w io.Writer, kind byte, port string, payload []byte) error {
+	if len(port) > 255 {
+		return fmt.Errorf("port name %q too long", port)
+	}
+	header := make([]byte, 6, 6+len(port))
+	binary.BigEndian.PutUint32(header, uint32(2+len(port)+len(payload)))
+	header[4], header[5] = kind, byte(len(port))
+	header = append(header, port...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func readFrame(r io.Reader) (kind byte, port string, payload []byte, err error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return 0, "", nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 2 || n > maxFrame {
+		return 0, "", nil, fmt.Errorf("invalid frame size %d", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return 0, "", nil, io.ErrUnexpectedEOF
+	}
+	kind, namelen := frame[0], int(frame[1])
+	if 2+namelen > len(frame) {
+		return 0, "", nil, errors.New("invalid frame port name")
+	}
+	return kind, string(frame[2 : 2+namelen]), frame[2+namelen:], nil
+}
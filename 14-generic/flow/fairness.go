@@ -0,0 +1,56 @@
+package flow
+
+import "runtime"
+
+// Scheduling controls how the components share the CPU,
+// see Network.Scheduling.
+type Scheduling struct {
+	// YieldEvery makes a port yield to the other components after every
+	// YieldEvery packets it sends or receives. With RunSequential the
+	// component moves to the back of the run queue, with Run it calls
+	// runtime.Gosched when Gosched is set.
+	YieldEvery int
+	// Gosched makes the ports call runtime.Gosched with Run, see
+	// YieldEvery. The Go scheduler preempts the goroutines anyway, hence
+	// it only helps when there are many more busy components than
+	// GOMAXPROCS.
+	Gosched bool
+	// MaxPacketsPerWake limits the packets a component sends and
+	// receives with RunSequential before it moves to the back of the run
+	// queue. By default a component runs until it has to wait for a
+	// packet or for room in a connection, hence a chatty connection can
+	// keep the others waiting.
+	MaxPacketsPerWake int
+}
+
+// yield lets the other components run after the port has transferred
+// n packets with Run, see Scheduling.
+func (b binding) yield(n uint32) {
+	if b.net == nil || !b.net.Scheduling.Gosched {
+		return
+	}
+	if every := uint32(b.net.Scheduling.YieldEvery); every > 0 && n%every == 0 {
+		runtime.Gosched()
+	}
+}
+
+// transferred counts a packet sent or received by the current task and
+// moves it to the back of the run queue according to sched.
+func (s *scheduler) transferred(sched *Scheduling) {
+	t := s.current
+	t.transferred++
+	t.woken++
+	every, max := sched.YieldEvery, sched.MaxPacketsPerWake
+	if (every > 0 && t.transferred%every == 0) || (max > 0 && t.woken >= max) {
+		s.yield()
+	}
+}
+
+// yield suspends the current task, which stays runnable.
+func (s *scheduler) yield() {
+	t := s.current
+	t.state = taskRunnable
+	s.yielded <- t
+	<-t.wake
+	t.woken = 0
+}
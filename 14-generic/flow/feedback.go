@@ -0,0 +1,138 @@
+package flow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultFeedbackSize is the buffer size of the feedback connections
+// in graph definitions.
+const DefaultFeedbackSize = 64
+
+// WithFeedback makes a feedback connection, which leads from downstream
+// back upstream, e.g. to retry the failed packets or to close a control
+// loop. The connection queues up to size packets, so that the components
+// in the cycle don't block each other as soon as they all send at the
+// same time. Multiple goroutines may Send to it, like with WithMPSC.
+//
+// The components in a cycle never see the end of stream of the feedback
+// connection, unless one of them closes it, hence such networks usually
+// finish with RunToCompletion or Shutdown.
+func WithFeedback(size int) ConnOption {
+	if size <= 0 {
+		size = DefaultFeedbackSize
+	}
+	return WithMPSC(size)
+}
+
+// CycleError is returned by Network.Validate for a cycle of unbuffered
+// connections.
+type CycleError struct {
+	// Conns are the connections of the cycle in order, e.g. "a.Out -> b.In".
+	Conns []string
+}
+
+func (err *CycleError) Error() string {
+	return "cycle of unbuffered connections: " + strings.Join(err.Conns, ", ") +
+		", use a feedback connection to break it"
+}
+
+// Validate checks that every cycle in the network contains a buffered
+// connection, such as a feedback connection, see WithFeedback. In a cycle
+// of unbuffered connections the components deadlock as soon as all of
+// them are sending. The first such cycle is reported as a *CycleError.
+//
+// The acknowledged connections are always buffered.
+//
+// Validate also fails when an In has more than one connection, as only
+// one of them would deliver any packets.
+func (net *Network) Validate() error {
+	type edge struct {
+		to   string
+		conn string
+	}
+	edges := make(map[string][]edge)
+	// fed contains the connection of each In
+	fed := make(map[inPort]string)
+	conns := net.Connections()
+	sort.Slice(conns, func(i, k int) bool { return conns[i].String() < conns[k].String() })
+	for _, conn := range conns {
+		s, ok := conn.(splicer)
+		if !ok {
+			continue
+		}
+		from, to := s.ends()
+		if prev, ok := fed[to]; ok {
+			return fmt.Errorf("%s is connected by both %s and %s", portName(to.boundTo()), prev, conn)
+		}
+		fed[to] = conn.String()
+		if c, ok := conn.(interface{ Capacity() int }); ok && c.Capacity() > 0 {
+			continue
+		}
+		src, dst := vertexOf(from.boundTo()), vertexOf(to.boundTo())
+		edges[src] = append(edges[src], edge{to: dst, conn: conn.String()})
+	}
+
+	vertices := make([]string, 0, len(edges))
+	for v := range edges {
+		vertices = append(vertices, v)
+		sort.Slice(edges[v], func(i, k int) bool { return edges[v][i].conn < edges[v][k].conn })
+	}
+	sort.Strings(vertices)
+
+	// depth-first search, a cycle is found when an edge leads
+	// to a vertex on the current path
+	const (
+		unvisited = iota
+		onPath
+		visited
+	)
+	state := make(map[string]int)
+	var path []edge
+	var visit func(v string) *CycleError
+	visit = func(v string) *CycleError {
+		state[v] = onPath
+		for _, e := range edges[v] {
+			path = append(path, e)
+			switch state[e.to] {
+			case onPath:
+				// the cycle starts with the edge leaving e.to
+				start := len(path) - 1
+				for start > 0 && path[start-1].to != e.to {
+					start--
+				}
+				err := &CycleError{}
+				for _, e := range path[start:] {
+					err.Conns = append(err.Conns, e.conn)
+				}
+				return err
+			case unvisited:
+				if err := visit(e.to); err != nil {
+					return err
+				}
+			}
+			path = path[:len(path)-1]
+		}
+		state[v] = visited
+		return nil
+	}
+	for _, v := range vertices {
+		if state[v] != unvisited {
+			continue
+		}
+		if err := visit(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vertexOf returns the node of the port for Validate, the ports outside
+// of the nodes, e.g. of bridges, are identified by their binding.
+func vertexOf(b binding) string {
+	if node, _, ok := b.node(); ok {
+		return string(node)
+	}
+	return portName(b)
+}
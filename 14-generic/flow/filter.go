@@ -0,0 +1,98 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// WithFilter makes the connection deliver only the packets matching
+// pred, the others are dropped and released, see Release. It's a routing
+// guard, which avoids a dedicated filter component. pred is called by
+// the sender, hence it should be cheap.
+//
+// Connect panics when T isn't the type of the connection.
+func WithFilter[T any](pred func(T) bool) ConnOption {
+	return func(c *connConfig) {
+		c.filter = pred
+		c.divert = nil
+	}
+}
+
+// WithDivert is like WithFilter, except that the packets not matching
+// pred are delivered to the In port to, which must not be connected
+// otherwise, Connect returns an error when it is. The diverted packets get end of stream along with the
+// connection.
+func WithDivert[T any](pred func(T) bool, to *In[T]) ConnOption {
+	return func(c *connConfig) {
+		c.filter = pred
+		c.divert = to
+	}
+}
+
+// setFilter configures the filter of a new connection.
+func (conn *Conn[T]) setFilter(config connConfig) error {
+	if config.filter == nil {
+		return nil
+	}
+	pred, ok := config.filter.(func(T) bool)
+	if !ok {
+		panic(fmt.Sprintf("flow: %T cannot filter a connection of %v", config.filter, conn.from.elemType()))
+	}
+	conn.filter = pred
+	if config.divert == nil {
+		return nil
+	}
+	to, ok := config.divert.(*In[T])
+	if !ok {
+		panic(fmt.Sprintf("flow: cannot divert a connection of %v to %T", conn.from.elemType(), config.divert))
+	}
+	// the diverted packets are sent on behalf of the sender
+	out := &Out[T]{}
+	out.bind(conn.from.boundTo())
+	divert, err := Connect(out, to)
+	if err != nil {
+		return err
+	}
+	conn.divert = divert
+	return nil
+}
+
+// Filtered returns the number of packets that didn't match the filter
+// of the connection, see WithFilter.
+func (conn *Conn[T]) Filtered() uint64 {
+	return atomic.LoadUint64(&conn.filtered)
+}
+
+// diverted drops v or sends it to the diverted port.
+func (conn *Conn[T]) diverted(ctx context.Context, v T) error {
+	atomic.AddUint64(&conn.filtered, 1)
+	if conn.divert == nil {
+		Release(v)
+		return nil
+	}
+	out, _ := conn.divert.ports()
+	return out.Send(ctx, v)
+}
+
+// WithMap makes the connection transform every delivered packet with
+// fn, a lightweight alternative to a component doing the same. fn is
+// called by the sender after the filter, see WithFilter, hence the
+// diverted packets aren't transformed. Adapt converts between types.
+//
+// Connect panics when T isn't the type of the connection.
+func WithMap[T any](fn func(T) T) ConnOption {
+	return func(c *connConfig) { c.mapper = fn }
+}
+
+// setMapper configures the transformation of a new connection.
+func (conn *Conn[T]) setMapper(config connConfig) {
+	if config.mapper == nil {
+		return
+	}
+	fn, ok := config.mapper.(func(T) T)
+	if !ok {
+		panic(fmt.Sprintf("flow: %T cannot map a connection of %v", config.mapper, conn.from.elemType()))
+	}
+	conn.mapper = fn
+}
@@ -0,0 +1,537 @@
+// Package flowgen generates Go code from graph definitions.
+//
+// The generated code creates the components and connects their ports
+// with typed Connect calls, so a mismatch between the port types is
+// reported by the compiler and no reflection is used at runtime.
+//
+// The generator needs the Go types of the components, so it's run from
+// a small program that has access to the registry:
+//
+//	//go:build ignore
+//
+//	package main
+//
+//	func main() {
+//		flowgen.Main(flowgen.Config{
+//			PkgPath:  "example.com/pipeline",
+//			Registry: pipeline.Registry,
+//		})
+//	}
+//
+// and invoked from the package using the graph:
+//
+//	//go:generate go run gen.go -o graph_gen.go graph.fbp
+package flowgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"fbp.example/flow"
+)
+
+// Config configures the code generation.
+type Config struct {
+	// Package is the name of the generated package, defaults to "main".
+	Package string
+	// PkgPath is the import path of the generated package,
+	// the types from that package are not qualified.
+	PkgPath string
+	// Name is the name of the generated struct, defaults to "Graph".
+	Name string
+
+	// Registry is used for finding the types of the components,
+	// in addition to the registered ones.
+	Registry flow.Registry
+	// Constructors contains Go expressions creating the components by type,
+	// e.g. "std.NewTicker(time.Second)". Components without a constructor
+	// are created as pointers to zero values.
+	Constructors map[flow.Type]string
+	// Imports contains the packages used by Constructors.
+	Imports []string
+
+	// Params contains the values of the graph parameters,
+	// which are resolved during the generation.
+	Params map[string]string
+	// Source is the name of the graph definition mentioned in the output.
+	Source string
+}
+
+const flowPath = "fbp.example/flow"
+
+// Generate returns the formatted Go code for the graph.
+func Generate(w *flow.Wiring, cfg Config) ([]byte, error) {
+	if cfg.Package == "" {
+		cfg.Package = "main"
+	}
+	if cfg.Name == "" {
+		cfg.Name = "Graph"
+	}
+
+	g := &generator{cfg: cfg, w: w, imports: map[string]string{}, aliases: map[string]bool{}}
+	g.importAs(flowPath)
+	for _, imp := range cfg.Imports {
+		g.importAs(imp)
+	}
+	if err := g.nodes(); err != nil {
+		return nil, err
+	}
+	if err := g.wires(); err != nil {
+		return nil, err
+	}
+	return g.output()
+}
+
+type generator struct {
+	cfg Config
+	w   *flow.Wiring
+
+	imports map[string]string // path -> alias
+	aliases map[string]bool
+
+	names  []flow.Name
+	fields map[flow.Name]string
+	comps  map[flow.Name]flow.Component
+	types  map[flow.Name]string
+
+	// mapPorts creates the map ports before the components are added,
+	// so that the ports are bound to the network
+	mapPorts []string
+	body     bytes.Buffer
+}
+
+// importAs adds the package to the imports and returns its alias.
+func (g *generator) importAs(pkg string) string {
+	if alias, ok := g.imports[pkg]; ok {
+		return alias
+	}
+	base := identifier(path.Base(pkg), false)
+	alias := base
+	for i := 2; g.aliases[alias]; i++ {
+		alias = base + strconv.Itoa(i)
+	}
+	g.imports[pkg] = alias
+	g.aliases[alias] = true
+	return alias
+}
+
+var rxQualified = regexp.MustCompile(`([\w./-]+)\.(\w+)`)
+
+// typeExpr returns the Go expression for t.
+func (g *generator) typeExpr(t reflect.Type) (string, error) {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name(), nil
+		}
+		// the type arguments of generic types are qualified with
+		// the package paths, e.g. Map[string,example.com/x.Item]
+		name := t.Name()
+		if open := strings.IndexByte(name, '['); open >= 0 {
+			args := rxQualified.ReplaceAllStringFunc(name[open:], func(s string) string {
+				xs := rxQualified.FindStringSubmatch(s)
+				return g.qualifier(xs[1]) + xs[2]
+			})
+			name = name[:open] + args
+		}
+		return g.qualifier(t.PkgPath()) + name, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		elem, err := g.typeExpr(t.Elem())
+		if t.Kind() == reflect.Ptr {
+			return "*" + elem, err
+		}
+		return "[]" + elem, err
+	case reflect.Array:
+		elem, err := g.typeExpr(t.Elem())
+		return "[" + strconv.Itoa(t.Len()) + "]" + elem, err
+	case reflect.Map:
+		key, err := g.typeExpr(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := g.typeExpr(t.Elem())
+		return "map[" + key + "]" + elem, err
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "any", nil
+		}
+	}
+	return "", fmt.Errorf("type %v cannot be generated", t)
+}
+
+func (g *generator) qualifier(pkg string) string {
+	if pkg == g.cfg.PkgPath || (pkg == "main" && g.cfg.Package == "main") {
+		return ""
+	}
+	return g.importAs(pkg) + "."
+}
+
+// nodes creates the components to find their types.
+func (g *generator) nodes() error {
+	g.fields = make(map[flow.Name]string)
+	g.comps = make(map[flow.Name]flow.Component)
+	g.types = make(map[flow.Name]string)
+
+	for name := range g.w.Decls {
+		g.names = append(g.names, name)
+	}
+	sort.Slice(g.names, func(i, k int) bool { return g.names[i] < g.names[k] })
+
+	used := map[string]bool{"Net": true}
+	for _, name := range g.names {
+		typ := g.w.Decls[name]
+		mk, ok := g.cfg.Registry[typ]
+		if !ok {
+			mk, ok = flow.Registered()[typ]
+		}
+		if !ok {
+			return fmt.Errorf("node %s: type %s does not exist", name, typ)
+		}
+		c := mk()
+
+		t := reflect.TypeOf(c)
+		if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("node %s: %v is not a pointer to a struct", name, t)
+		}
+		expr, err := g.typeExpr(t)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", name, err)
+		}
+
+		field := identifier(string(name), true)
+		for i := 2; used[field]; i++ {
+			field = identifier(string(name), true) + strconv.Itoa(i)
+		}
+		used[field] = true
+
+		g.fields[name] = field
+		g.comps[name] = c
+		g.types[name] = expr
+	}
+	return nil
+}
+
+func contains(xs []string, s string) bool {
+	for _, x := range xs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// identifier converts name to a Go identifier.
+func identifier(name string, exported bool) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	s := b.String()
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "X" + s
+	}
+	if exported {
+		s = strings.ToUpper(s[:1]) + s[1:]
+	}
+	return s
+}
+
+// port returns the expression of the port and its description.
+func (g *generator) port(node flow.Name, name flow.PortName) (string, flow.PortInfo, error) {
+	c, ok := g.comps[node]
+	if !ok {
+		return "", flow.PortInfo{}, fmt.Errorf("node %s does not exist", node)
+	}
+	info, err := flow.PortOf(c, name)
+	if err != nil {
+		return "", info, fmt.Errorf("%s.%s: %w", node, name, err)
+	}
+
+	fieldName, key := string(name), ""
+	open := strings.IndexByte(fieldName, '[')
+	if open >= 0 {
+		fieldName, key = fieldName[:open], fieldName[open+1:len(fieldName)-1]
+	}
+	st := reflect.TypeOf(c).Elem()
+	field, ok := st.FieldByName(fieldName)
+	if !ok {
+		field, _ = st.FieldByNameFunc(func(s string) bool { return strings.EqualFold(s, fieldName) })
+	}
+
+	expr := "g." + g.fields[node] + "." + field.Name
+	switch {
+	case open < 0 && info.Config:
+		return "&" + expr + ".In", info, nil
+	case open < 0:
+		return "&" + expr, info, nil
+	case field.Type.Kind() == reflect.Map:
+		call := g.qualifier(flowPath) + "MapPort(&" + expr + ", " + strconv.Quote(key) + ")"
+		if !contains(g.mapPorts, call) {
+			g.mapPorts = append(g.mapPorts, call)
+		}
+		return call, info, nil
+	default:
+		return "&" + expr + "[" + key + "]", info, nil
+	}
+}
+
+func (g *generator) wires() error {
+	flowq := g.qualifier(flowPath)
+	for _, wire := range g.w.Wires {
+		fail := func(err error) error {
+			if wire.Pos.Line == 0 {
+				return err
+			}
+			return fmt.Errorf("%v: %w", wire.Pos, err)
+		}
+
+		dst, dstInfo, err := g.port(wire.To, wire.Dst)
+		if err != nil {
+			return fail(err)
+		}
+
+		switch wire.From {
+		case flow.ValuesNode:
+			return fail(fmt.Errorf("%v: network values are not supported", wire))
+		case flow.IIPNode:
+			if dstInfo.Ack {
+				return fail(fmt.Errorf("%v: IIPs cannot be sent to acknowledged ports", wire))
+			}
+			literal, err := g.w.ExpandParams(wire.IIP, g.cfg.Params)
+			if err != nil {
+				return fail(fmt.Errorf("%v: %w", wire, err))
+			}
+			v, err := flow.ParseLiteral(literal, dstInfo.Elem)
+			if err != nil {
+				return fail(fmt.Errorf("%v: %w", wire, err))
+			}
+			lit, err := g.literal(v)
+			if err != nil {
+				return fail(fmt.Errorf("%v: %w", wire, err))
+			}
+			fmt.Fprintf(&g.body, "\t%sAddIIP(&g.Net, %s, %s)\n", flowq, dst, lit)
+			continue
+		}
+
+		src, srcInfo, err := g.port(wire.From, wire.Src)
+		if err != nil {
+			return fail(err)
+		}
+		if srcInfo.In || !dstInfo.In {
+			return fail(fmt.Errorf("%v: must connect an Out to an In", wire))
+		}
+		if srcInfo.Elem != dstInfo.Elem || srcInfo.Ack != dstInfo.Ack {
+			return fail(fmt.Errorf("%s.%s (%v) -> %s.%s (%v)",
+				wire.From, wire.Src, srcInfo.Elem, wire.To, wire.Dst, dstInfo.Elem))
+		}
+
+		connect := "Connect"
+		if srcInfo.Ack {
+			connect = "ConnectAck"
+		}
+		// the acknowledged connections are always buffered
+		if wire.Feedback && !srcInfo.Ack {
+			dst += ", " + flowq + "WithFeedback(" + flowq + "DefaultFeedbackSize)"
+		}
+		fmt.Fprintf(&g.body, "\t%s%s(%s, %s)\n", flowq, connect, src, dst)
+	}
+	return nil
+}
+
+// literal returns the Go expression for an IIP value.
+func (g *generator) literal(v reflect.Value) (string, error) {
+	var lit string
+	switch v.Kind() {
+	case reflect.String:
+		lit = strconv.Quote(v.String())
+	case reflect.Bool:
+		lit = strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		lit = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		lit = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		lit = strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Interface:
+		if v.IsNil() {
+			return "nil", nil
+		}
+		return g.literal(v.Elem())
+	default:
+		return "", fmt.Errorf("IIP of type %v cannot be generated", v.Type())
+	}
+
+	if v.Type().PkgPath() != "" {
+		typ, err := g.typeExpr(v.Type())
+		if err != nil {
+			return "", err
+		}
+		lit = typ + "(" + lit + ")"
+	}
+	return lit, nil
+}
+
+func (g *generator) output() ([]byte, error) {
+	var out bytes.Buffer
+	source := ""
+	if g.cfg.Source != "" {
+		source = " from " + g.cfg.Source
+	}
+	fmt.Fprintf(&out, "// Code generated by flowgen%s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&out, "package %s\n\n", g.cfg.Package)
+
+	paths := make([]string, 0, len(g.imports))
+	for p := range g.imports {
+		paths = append(paths, p)
+	}
+	out.WriteString(importDecl(paths, g.imports))
+	out.WriteString("\n\n")
+
+	flowq := g.qualifier(flowPath)
+	fmt.Fprintf(&out, "// %s is the network defined in the graph.\n", g.cfg.Name)
+	fmt.Fprintf(&out, "type %s struct {\n\tNet %sNetwork\n\n", g.cfg.Name, flowq)
+	for _, name := range g.names {
+		fmt.Fprintf(&out, "\t%s %s\n", g.fields[name], g.types[name])
+	}
+	out.WriteString("}\n\n")
+
+	fmt.Fprintf(&out, "// New%s creates the components and connects them.\n", g.cfg.Name)
+	fmt.Fprintf(&out, "func New%s() (*%s, error) {\n", g.cfg.Name, g.cfg.Name)
+	fmt.Fprintf(&out, "\tg := &%s{\n", g.cfg.Name)
+	for _, name := range g.names {
+		ctor, ok := g.cfg.Constructors[g.w.Decls[name]]
+		if !ok {
+			ctor = "&" + strings.TrimPrefix(g.types[name], "*") + "{}"
+		}
+		fmt.Fprintf(&out, "\t\t%s: %s,\n", g.fields[name], ctor)
+	}
+	out.WriteString("\t}\n\n")
+	for _, call := range g.mapPorts {
+		fmt.Fprintf(&out, "\t%s\n", call)
+	}
+	if len(g.mapPorts) > 0 {
+		out.WriteString("\n")
+	}
+	for _, name := range g.names {
+		fmt.Fprintf(&out, "\tif err := g.Net.AddNamed(%q, g.%s); err != nil {\n\t\treturn nil, err\n\t}\n", name, g.fields[name])
+	}
+	out.WriteString("\n")
+	out.Write(g.body.Bytes())
+	out.WriteString("\treturn g, nil\n}\n")
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return out.Bytes(), fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+// importDecl formats the import declaration with the standard library
+// packages in a separate group.
+func importDecl(paths []string, aliases map[string]string) string {
+	sort.Strings(paths)
+	var std, other []string
+	for _, p := range paths {
+		spec := strconv.Quote(p)
+		if alias, ok := aliases[p]; ok && alias != path.Base(p) {
+			spec = alias + " " + spec
+		}
+		if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+			other = append(other, "\t"+spec+"\n")
+		} else {
+			std = append(std, "\t"+spec+"\n")
+		}
+	}
+
+	decl := "import (\n" + strings.Join(std, "")
+	if len(std) > 0 && len(other) > 0 {
+		decl += "\n"
+	}
+	return decl + strings.Join(other, "") + ")"
+}
+
+// Main is the entry point of a generator program, it parses the command
+// line flags and writes the code generated for the graph definition.
+//
+//	gen [-o output.go] [-name Graph] [-pkg main] [-param NAME=value ...] graph.fbp
+//
+// Graph definitions ending with .json are decoded as flow.Wiring.
+func Main(cfg Config) {
+	log.SetFlags(0)
+	log.SetPrefix("flowgen: ")
+
+	output := flag.String("o", "", "output file, defaults to stdout")
+	flag.StringVar(&cfg.Name, "name", cfg.Name, "name of the generated struct")
+	flag.StringVar(&cfg.Package, "pkg", cfg.Package, "name of the generated package")
+	flag.Func("param", "graph parameter as NAME=value", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected NAME=value")
+		}
+		if cfg.Params == nil {
+			cfg.Params = make(map[string]string)
+		}
+		cfg.Params[name] = value
+		return nil
+	})
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file := flag.Arg(0)
+	w, err := load(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Source == "" {
+		cfg.Source = filepath.Base(file)
+	}
+
+	src, err := Generate(w, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*output, src, 0o644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// load reads a graph definition in the DSL or JSON format.
+func load(file string) (*flow.Wiring, error) {
+	if !strings.EqualFold(filepath.Ext(file), ".json") {
+		return flow.ParseWiringFile(file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var w flow.Wiring
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &w, nil
+}
@@ -0,0 +1,259 @@
+package flowgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Component describes the component generated by Scaffold.
+type Component struct {
+	// Package is the name of the package, defaults to "main".
+	Package string
+	// Name is the name of the component type.
+	Name string
+	// In and Out are the ports of the component, in order.
+	In, Out []Port
+	// Imports contains the packages used by the port types.
+	Imports []string
+}
+
+// Port is a port of a scaffolded component.
+type Port struct {
+	Name string
+	// Type is the Go type of the values, e.g. "string" or "time.Time".
+	Type string
+}
+
+// ParsePort parses a port spec written as "Name:Type".
+func ParsePort(spec string) (Port, error) {
+	name, typ, ok := strings.Cut(spec, ":")
+	if !ok || !token.IsIdentifier(name) || !token.IsExported(name) || typ == "" {
+		return Port{}, fmt.Errorf("invalid port %q, expected Name:Type", spec)
+	}
+	return Port{Name: name, Type: typ}, nil
+}
+
+// Scaffold returns the source of the component and a table-driven
+// test for it.
+//
+// The component receives from the first In port, until end of stream,
+// after which it closes all the Out ports. A component without In ports
+// is scaffolded as a source.
+func Scaffold(c Component) (src, test []byte, err error) {
+	if c.Package == "" {
+		c.Package = "main"
+	}
+	if !token.IsIdentifier(c.Name) {
+		return nil, nil, fmt.Errorf("invalid component name %q", c.Name)
+	}
+	seen := map[string]bool{}
+	for _, p := range append(append([]Port{}, c.In...), c.Out...) {
+		if seen[p.Name] {
+			return nil, nil, fmt.Errorf("port %s specified twice", p.Name)
+		}
+		seen[p.Name] = true
+	}
+
+	data := scaffoldData{Component: c, Receiver: strings.ToLower(c.Name[:1])}
+	if len(c.In) > 0 {
+		data.First = &c.In[0]
+	}
+	if len(c.Out) > 0 {
+		data.Result = &c.Out[0]
+	}
+
+	pkgs := []string{"context", flowPath}
+	if data.First != nil {
+		pkgs = append(pkgs, "errors")
+	}
+	data.ImportDecl = importDecl(imports(c.Imports, pkgs...), nil)
+	if src, err = execute(componentTemplate, data); err != nil {
+		return nil, nil, err
+	}
+
+	pkgs = []string{"context", "testing", "time", flowPath}
+	if data.Result != nil {
+		pkgs = append(pkgs, "errors", "reflect")
+	}
+	data.ImportDecl = importDecl(imports(c.Imports, pkgs...), nil)
+	if test, err = execute(testTemplate, data); err != nil {
+		return nil, nil, err
+	}
+	return src, test, nil
+}
+
+type scaffoldData struct {
+	Component
+	Receiver   string
+	ImportDecl string
+	// First is the In port the component receives from.
+	First *Port
+	// Result is the Out port checked by the test.
+	Result *Port
+}
+
+func imports(extra []string, pkgs ...string) []string {
+	all := append(append([]string{}, pkgs...), extra...)
+	sort.Strings(all)
+	unique := all[:0]
+	for i, p := range all {
+		if i == 0 || all[i-1] != p {
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+func execute(t *template.Template, data scaffoldData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return buf.Bytes(), fmt.Errorf("formatting scaffold: %w", err)
+	}
+	return src, nil
+}
+
+var componentTemplate = template.Must(template.New("component").Parse(`package {{.Package}}
+
+{{.ImportDecl}}
+
+// {{.Name}} is a component.
+type {{.Name}} struct {
+{{- range .In}}
+	{{.Name}} flow.In[{{.Type}}]
+{{- end}}
+{{- range .Out}}
+	{{.Name}} flow.Out[{{.Type}}]
+{{- end}}
+}
+
+// New{{.Name}} returns a new {{.Name}}.
+func New{{.Name}}() *{{.Name}} {
+	return &{{.Name}}{}
+}
+
+// Run runs the component until end of stream.
+func ({{.Receiver}} *{{.Name}}) Run(ctx context.Context) error {
+{{- if .First}}
+	for {
+		v, err := {{.Receiver}}.{{.First.Name}}.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return {{.Receiver}}.close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		// TODO: process v
+{{- if and .Result (eq .First.Type .Result.Type)}}
+		if err := {{.Receiver}}.{{.Result.Name}}.Send(ctx, v); err != nil {
+			return err
+		}
+{{- else}}
+		_ = v
+{{- end}}
+	}
+{{- else}}
+	// TODO: produce the values
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return {{.Receiver}}.close(ctx)
+{{- end}}
+}
+
+// close signals end of stream on all the outputs.
+func ({{.Receiver}} *{{.Name}}) close(ctx context.Context) error {
+{{- range .Out}}
+	if err := {{$.Receiver}}.{{.Name}}.Close(ctx); err != nil {
+		return err
+	}
+{{- end}}
+	return nil
+}
+`))
+
+var testTemplate = template.Must(template.New("test").Parse(`package {{.Package}}
+
+{{.ImportDecl}}
+
+func Test{{.Name}}(t *testing.T) {
+	tests := []struct {
+		name string
+{{- if .First}}
+		in   []{{.First.Type}}
+{{- end}}
+{{- if .Result}}
+		want []{{.Result.Type}}
+{{- end}}
+	}{
+		{name: "empty"},
+		// TODO: add test cases
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c := New{{.Name}}()
+{{- if .First}}
+			in := &flow.Out[{{.First.Type}}]{}
+			if _, err := flow.Connect(in, &c.{{.First.Name}}); err != nil {
+				t.Fatal(err)
+			}
+{{- end}}
+{{- if .Result}}
+			out := &flow.In[{{.Result.Type}}]{}
+			if _, err := flow.Connect(&c.{{.Result.Name}}, out); err != nil {
+				t.Fatal(err)
+			}
+{{- end}}
+
+			errc := make(chan error, 1)
+			go func() { errc <- c.Run(ctx) }()
+{{- if .First}}
+			go func() {
+				for _, v := range tt.in {
+					if err := in.Send(ctx, v); err != nil {
+						return
+					}
+				}
+				_ = in.Close(ctx)
+			}()
+{{- end}}
+{{if .Result}}
+			var got []{{.Result.Type}}
+			for {
+				v, err := out.Recv(ctx)
+				if errors.Is(err, flow.EOS) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, v)
+			}
+{{- end}}
+
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+{{- if .Result}}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+{{- end}}
+		})
+	}
+}
+`))
@@ -0,0 +1,190 @@
+package flowtest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// Clock is a flow.Clock, whose time only changes when the test
+// advances it. Timers and tickers fire during Advance and Set.
+//
+//	clock := flowtest.NewClock(time.Time{})
+//	net.Clock = clock
+//	...
+//	clock.BlockUntil(ctx, 1) // the component has started a timer
+//	clock.Advance(time.Second)
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*clockTimer
+	// changed is closed when waiters changes.
+	changed chan struct{}
+}
+
+var _ flow.Clock = (*Clock)(nil)
+
+// NewClock returns a clock set to start, a zero start
+// is replaced with 2000-01-01 UTC.
+func NewClock(start time.Time) *Clock {
+	if start.IsZero() {
+		start = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return &Clock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (clock *Clock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+// NewTimer creates a timer that fires once the clock has advanced by d.
+func (clock *Clock) NewTimer(d time.Duration) flow.Timer {
+	t := &clockTimer{clock: clock, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker creates a ticker that fires every d.
+func (clock *Clock) NewTicker(d time.Duration) flow.Ticker {
+	if d <= 0 {
+		panic("flowtest: non-positive interval for NewTicker")
+	}
+	t := &clockTimer{clock: clock, c: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return clockTicker{t}
+}
+
+// Advance moves the clock forward by d.
+func (clock *Clock) Advance(d time.Duration) {
+	clock.Set(clock.Now().Add(d))
+}
+
+// Set moves the clock to t, firing the timers due in order.
+// Moving the clock backwards doesn't fire anything.
+func (clock *Clock) Set(t time.Time) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	for len(clock.waiters) > 0 && !clock.waiters[0].due.After(t) {
+		w := clock.waiters[0]
+		clock.now = w.due
+		clock.remove(w)
+		select {
+		case w.c <- w.due:
+		default:
+			// like time.Ticker, drop the tick for slow receivers
+		}
+		if w.period > 0 {
+			w.due = w.due.Add(w.period)
+			clock.add(w)
+		}
+	}
+	if t.After(clock.now) || len(clock.waiters) == 0 {
+		clock.now = t
+	}
+}
+
+// Timers returns the number of active timers and tickers.
+func (clock *Clock) Timers() int {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return len(clock.waiters)
+}
+
+// BlockUntil waits until there are at least n active timers and tickers,
+// which means that the components have started waiting for the clock.
+func (clock *Clock) BlockUntil(ctx context.Context, n int) error {
+	for {
+		clock.mu.Lock()
+		if len(clock.waiters) >= n {
+			clock.mu.Unlock()
+			return nil
+		}
+		if clock.changed == nil {
+			clock.changed = make(chan struct{})
+		}
+		changed := clock.changed
+		clock.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// add inserts the timer in order of the due time, clock.mu must be held.
+func (clock *Clock) add(t *clockTimer) {
+	i := sort.Search(len(clock.waiters), func(i int) bool {
+		return clock.waiters[i].due.After(t.due)
+	})
+	clock.waiters = append(clock.waiters, nil)
+	copy(clock.waiters[i+1:], clock.waiters[i:])
+	clock.waiters[i] = t
+	clock.notify()
+}
+
+// remove removes the timer, clock.mu must be held.
+func (clock *Clock) remove(t *clockTimer) bool {
+	for i, w := range clock.waiters {
+		if w == t {
+			clock.waiters = append(clock.waiters[:i], clock.waiters[i+1:]...)
+			clock.notify()
+			return true
+		}
+	}
+	return false
+}
+
+func (clock *Clock) notify() {
+	if clock.changed != nil {
+		close(clock.changed)
+		clock.changed = nil
+	}
+}
+
+// clockTimer is a timer or a ticker of Clock.
+type clockTimer struct {
+	clock  *Clock
+	c      chan time.Time
+	due    time.Time
+	period time.Duration
+}
+
+// clockTicker hides the result of Stop.
+type clockTicker struct{ *clockTimer }
+
+func (t clockTicker) Stop() { t.clockTimer.Stop() }
+
+func (t *clockTimer) C() <-chan time.Time { return t.c }
+
+func (t *clockTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *clockTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.clock.remove(t)
+	t.due = t.clock.now.Add(d)
+	if d <= 0 && t.period == 0 {
+		// fire immediately, like time.Timer
+		select {
+		case t.c <- t.clock.now:
+		default:
+		}
+		return active
+	}
+	t.clock.add(t)
+	return active
+}
@@ -0,0 +1,410 @@
+// Package flowtest contains helpers for testing components.
+//
+// A Harness runs a single component in isolation, the test feeds values
+// to its In ports and checks the values sent to its Out ports:
+//
+//	c := &Upper{}
+//	h := flowtest.New(t, c)
+//	flowtest.Feed(h, &c.In, "a", "b")
+//	flowtest.Collect(h, &c.Out).Expect("A", "B").ExpectEOS()
+//
+// Map ports must be created before calling New, so that they are named.
+//
+// Every wait is limited by Harness.Timeout. When it expires the test
+// fails with a description of what the ports of the component were
+// doing, which usually points to where the component is stuck.
+//
+// Whole graphs are tested with RunGraph against golden files and
+// CheckShutdown checks that a network stops cleanly when cancelled.
+// CheckGraphs stress tests the runtime and the components with random
+// graphs.
+package flowtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// DefaultTimeout is the default time to wait for a component.
+const DefaultTimeout = 5 * time.Second
+
+// Harness runs a component in isolation.
+type Harness struct {
+	// Timeout limits each wait, defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	t    testing.TB
+	c    flow.Component
+	name flow.Name
+	net  *flow.Network
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	start   sync.Once
+	done    chan struct{}
+	err     error
+	feeding sync.WaitGroup
+}
+
+// New creates a harness for the component. The component is started
+// by the first Send, Recv or Wait and it's cancelled when the test ends.
+func New(t testing.TB, c flow.Component) *Harness {
+	t.Helper()
+	h := &Harness{
+		Timeout: DefaultTimeout,
+		t:       t,
+		c:       c,
+		net:     &flow.Network{},
+		done:    make(chan struct{}),
+	}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	h.net.Add(c)
+	h.name, _ = h.net.Name(c)
+
+	t.Cleanup(func() {
+		h.cancel()
+		h.feeding.Wait()
+		h.start.Do(func() { close(h.done) })
+
+		timer := time.NewTimer(h.timeout())
+		defer timer.Stop()
+		select {
+		case <-h.done:
+		case <-timer.C:
+			t.Errorf("%s did not return within %v after cancellation\n%s", h.name, h.timeout(), h.Diagnose())
+		}
+	})
+	return h
+}
+
+// Context returns the context the component runs with.
+func (h *Harness) Context() context.Context { return h.ctx }
+
+// Start starts the component, when it hasn't been started yet.
+func (h *Harness) Start() {
+	h.start.Do(func() {
+		go func() {
+			defer close(h.done)
+			h.err = h.c.Run(h.ctx)
+		}()
+	})
+}
+
+// Wait waits for the component to return and returns its error.
+func (h *Harness) Wait() error {
+	h.t.Helper()
+	h.Start()
+
+	timer := time.NewTimer(h.timeout())
+	defer timer.Stop()
+	select {
+	case <-h.done:
+		return h.err
+	case <-timer.C:
+		h.t.Fatalf("%s did not return within %v\n%s", h.name, h.timeout(), h.Diagnose())
+		return nil
+	}
+}
+
+// Cancel cancels the context of the component.
+func (h *Harness) Cancel() { h.cancel() }
+
+// Diagnose describes the state of the component and its ports.
+func (h *Harness) Diagnose() string {
+	status := h.net.Status()
+
+	var b strings.Builder
+	select {
+	case <-h.done:
+		if h.err != nil {
+			fmt.Fprintf(&b, "\t%s returned: %v\n", h.name, h.err)
+		} else {
+			fmt.Fprintf(&b, "\t%s returned\n", h.name)
+		}
+	default:
+		// the feeds and collectors are not interesting
+		for _, c := range status.Components {
+			if c.Name == h.name {
+				fmt.Fprintf(&b, "\t%s is %s\n", c.Name, c.State)
+			}
+		}
+	}
+	for _, conn := range status.Connections {
+		fmt.Fprintf(&b, "\t%s: %d packets", conn.Name, conn.Packets)
+		if conn.Queued > 0 {
+			fmt.Fprintf(&b, ", %d queued", conn.Queued)
+		}
+		if conn.Unacked > 0 {
+			fmt.Fprintf(&b, ", %d unacknowledged", conn.Unacked)
+		}
+		b.WriteString("\n")
+	}
+	if ports := h.net.Unconnected(); len(ports) > 0 {
+		fmt.Fprintf(&b, "\tunconnected: %s\n", strings.Join(ports, ", "))
+	}
+	return b.String()
+}
+
+func (h *Harness) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return h.Timeout
+}
+
+// wait runs fn with a context limited by the timeout.
+func (h *Harness) wait(fn func(ctx context.Context) error) error {
+	h.Start()
+	ctx, cancel := context.WithTimeout(h.ctx, h.timeout())
+	defer cancel()
+	return fn(ctx)
+}
+
+// Input sends values to an In port of the component.
+type Input[T any] struct {
+	h    *Harness
+	name string
+	feed *feed[T]
+}
+
+type feed[T any] struct{ Out flow.Out[T] }
+
+func (*feed[T]) Run(context.Context) error { return nil }
+
+// NewInput connects to an In port of the component.
+func NewInput[T any](h *Harness, port *flow.In[T]) *Input[T] {
+	h.t.Helper()
+	name := h.portName(port)
+	in := &Input[T]{h: h, name: name, feed: &feed[T]{}}
+	if err := h.net.AddNamed(flow.Name("feed("+name+")"), in.feed); err != nil {
+		h.t.Fatal(err)
+	}
+	if _, err := flow.Connect(&in.feed.Out, port); err != nil {
+		h.t.Fatal(err)
+	}
+	return in
+}
+
+// Feed sends the values to the port in the background and closes it.
+func Feed[T any](h *Harness, port *flow.In[T], values ...T) *Input[T] {
+	h.t.Helper()
+	in := NewInput(h, port)
+	h.feeding.Add(1)
+	go func() {
+		defer h.feeding.Done()
+		for i, v := range values {
+			if err := h.wait(func(ctx context.Context) error { return in.feed.Out.Send(ctx, v) }); err != nil {
+				if h.ctx.Err() != nil {
+					// the test has finished
+					return
+				}
+				h.t.Errorf("feeding %s: value %d (%v) was not received: %v\n%s", in.name, i, v, err, h.Diagnose())
+				return
+			}
+		}
+		in.close()
+	}()
+	return in
+}
+
+// Send waits until each of the values has been received by the component.
+func (in *Input[T]) Send(values ...T) *Input[T] {
+	in.h.t.Helper()
+	for _, v := range values {
+		if err := in.h.wait(func(ctx context.Context) error { return in.feed.Out.Send(ctx, v) }); err != nil {
+			in.h.t.Fatalf("sending %v to %s: %v\n%s", v, in.name, err, in.h.Diagnose())
+		}
+	}
+	return in
+}
+
+// Close signals end of stream to the port.
+func (in *Input[T]) Close() {
+	in.h.t.Helper()
+	in.close()
+}
+
+func (in *Input[T]) close() {
+	_ = in.feed.Out.Close(context.Background())
+}
+
+// Output receives values from an Out port of the component.
+type Output[T any] struct {
+	h       *Harness
+	name    string
+	collect *collect[T]
+}
+
+type collect[T any] struct{ In flow.In[T] }
+
+func (*collect[T]) Run(context.Context) error { return nil }
+
+// Collect connects to an Out port of the component.
+func Collect[T any](h *Harness, port *flow.Out[T]) *Output[T] {
+	h.t.Helper()
+	name := h.portName(port)
+	out := &Output[T]{h: h, name: name, collect: &collect[T]{}}
+	if err := h.net.AddNamed(flow.Name("collect("+name+")"), out.collect); err != nil {
+		h.t.Fatal(err)
+	}
+	if _, err := flow.Connect(port, &out.collect.In); err != nil {
+		h.t.Fatal(err)
+	}
+	return out
+}
+
+// Recv waits for the next value.
+func (out *Output[T]) Recv() T {
+	out.h.t.Helper()
+	v, err := out.recv()
+	if errors.Is(err, flow.EOS) {
+		out.h.t.Fatalf("%s: unexpected end of stream\n%s", out.name, out.h.Diagnose())
+	} else if err != nil {
+		out.h.t.Fatalf("%s: no value within %v\n%s", out.name, out.h.timeout(), out.h.Diagnose())
+	}
+	return v
+}
+
+func (out *Output[T]) recv() (v T, err error) {
+	err = out.h.wait(func(ctx context.Context) error {
+		v, err = out.collect.In.Recv(ctx)
+		return err
+	})
+	return v, err
+}
+
+// Expect checks that the next values are want, in order.
+func (out *Output[T]) Expect(want ...T) *Output[T] {
+	out.h.t.Helper()
+	for i, w := range want {
+		got, err := out.recv()
+		if err != nil {
+			out.h.t.Fatalf("%s: expected %v at %d, got %v\n%s", out.name, w, i, describe(err), out.h.Diagnose())
+		}
+		if !reflect.DeepEqual(got, w) {
+			out.h.t.Fatalf("%s: expected %v at %d, got %v", out.name, w, i, got)
+		}
+	}
+	return out
+}
+
+// ExpectUnordered checks that the next len(want) values are want,
+// in any order.
+func (out *Output[T]) ExpectUnordered(want ...T) *Output[T] {
+	out.h.t.Helper()
+	missing := append([]T(nil), want...)
+	for range want {
+		got, err := out.recv()
+		if err != nil {
+			out.h.t.Fatalf("%s: still expecting %v, got %v\n%s", out.name, missing, describe(err), out.h.Diagnose())
+		}
+		found := false
+		for i, w := range missing {
+			if reflect.DeepEqual(got, w) {
+				missing = append(missing[:i], missing[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			out.h.t.Fatalf("%s: unexpected %v, expecting %v", out.name, got, missing)
+		}
+	}
+	return out
+}
+
+// ExpectEOS checks that the port has been closed without further values.
+func (out *Output[T]) ExpectEOS() {
+	out.h.t.Helper()
+	v, err := out.recv()
+	switch {
+	case err == nil:
+		out.h.t.Fatalf("%s: expected end of stream, got %v", out.name, v)
+	case !errors.Is(err, flow.EOS):
+		out.h.t.Fatalf("%s: expected end of stream, got %v\n%s", out.name, describe(err), out.h.Diagnose())
+	}
+}
+
+// All receives the values until end of stream.
+func (out *Output[T]) All() []T {
+	out.h.t.Helper()
+	var all []T
+	for {
+		v, err := out.recv()
+		if errors.Is(err, flow.EOS) {
+			return all
+		}
+		if err != nil {
+			out.h.t.Fatalf("%s: no end of stream within %v after %d values\n%s", out.name, out.h.timeout(), len(all), out.h.Diagnose())
+		}
+		all = append(all, v)
+	}
+}
+
+func describe(err error) string {
+	switch {
+	case errors.Is(err, flow.EOS):
+		return "end of stream"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "nothing"
+	}
+	return err.Error()
+}
+
+// portName finds the name of the port among the fields of the component.
+func (h *Harness) portName(port any) string {
+	h.t.Helper()
+	ptr := reflect.ValueOf(port).Pointer()
+
+	rv := reflect.ValueOf(h.c)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		for i := 0; i < rv.NumField(); i++ {
+			field, name := rv.Field(i), rv.Type().Field(i).Name
+			switch field.Kind() {
+			case reflect.Struct:
+				if field.CanAddr() && field.Addr().Pointer() == ptr {
+					return string(h.name) + "." + name
+				}
+			case reflect.Slice, reflect.Array:
+				for k := 0; k < field.Len(); k++ {
+					if elem := field.Index(k); elem.CanAddr() && elem.Addr().Pointer() == ptr {
+						return string(h.name) + "." + name + "[" + strconv.Itoa(k) + "]"
+					}
+				}
+			case reflect.Map:
+				iter := field.MapRange()
+				for iter.Next() {
+					if v := iter.Value(); v.Kind() == reflect.Ptr && v.Pointer() == ptr {
+						return fmt.Sprintf("%s.%s[%v]", h.name, name, iter.Key())
+					}
+				}
+			}
+		}
+	}
+	h.t.Fatalf("port %T is not a port of %s", port, h.name)
+	return ""
+}
+
+// Connect connects the ports of a network built by the test,
+// the test fails when they cannot be connected.
+func Connect[T any](t testing.TB, from *flow.Out[T], to *flow.In[T], opts ...flow.ConnOption) *flow.Conn[T] {
+	t.Helper()
+	conn, err := flow.Connect(from, to, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
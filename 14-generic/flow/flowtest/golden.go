@@ -0,0 +1,201 @@
+package flowtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"fbp.example/flow"
+)
+
+var update = flag.Bool("flowtest.update", false, "update the golden files of flowtest.RunGraph")
+
+// Inputs contains the values sent to the In ports of a graph,
+// keyed by port name, e.g. "split.In".
+type Inputs map[string][]any
+
+// RunGraph runs the network to completion and compares the values
+// sent to its unconnected Out ports with the golden file
+// testdata/<test name>.golden.
+//
+// The values of each input are sent to the port in order, after which
+// the port is closed. The golden file contains the outputs grouped by
+// port, each value is formatted as JSON on its own line:
+//
+//	upper.Out: "A"
+//	upper.Out: "B"
+//
+// Running the tests with -flowtest.update writes the golden files
+// instead of comparing them. RunGraph returns the outputs.
+func RunGraph(t testing.TB, net *flow.Network, inputs Inputs) map[string][]any {
+	t.Helper()
+
+	var wiring flow.Wiring
+	for i, name := range sortedInputs(inputs) {
+		node, port := splitPort(name)
+		feed := &graphFeed{values: inputs[name]}
+		feedName := flow.Name("$input" + strconv.Itoa(i))
+		if err := net.AddNamed(feedName, feed); err != nil {
+			t.Fatal(err)
+		}
+		wiring.Wires = append(wiring.Wires, flow.Wire{From: feedName, Src: "Out", To: node, Dst: port})
+	}
+	if err := net.WireUp(&wiring); err != nil {
+		t.Fatalf("connecting inputs: %v", err)
+	}
+
+	wiring = flow.Wiring{}
+	outputs := map[string]*graphCollect{}
+	for i, name := range net.Unconnected() {
+		node, port := splitPort(name)
+		c, _ := net.Node(node)
+		if info, err := flow.PortOf(c, port); err != nil || info.In {
+			continue
+		}
+		collect := &graphCollect{}
+		collectName := flow.Name("$output" + strconv.Itoa(i))
+		if err := net.AddNamed(collectName, collect); err != nil {
+			t.Fatal(err)
+		}
+		outputs[name] = collect
+		wiring.Wires = append(wiring.Wires, flow.Wire{From: node, Src: port, To: collectName, Dst: "In"})
+	}
+	if err := net.WireUp(&wiring); err != nil {
+		t.Fatalf("connecting outputs: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	if err := net.RunToCompletion(ctx); err != nil {
+		t.Fatalf("running graph: %v", err)
+	}
+
+	result := make(map[string][]any, len(outputs))
+	var got bytes.Buffer
+	for _, name := range sortedKeys(outputs) {
+		values := outputs[name].values()
+		result[name] = values
+		for _, v := range values {
+			data, err := json.Marshal(v)
+			if err != nil {
+				data = []byte(fmt.Sprintf("%#v", v))
+			}
+			fmt.Fprintf(&got, "%s: %s\n", name, data)
+		}
+	}
+
+	golden := filepath.Join("testdata", strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	want, err := os.ReadFile(golden)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("%s does not exist, run the test with -flowtest.update to create it", golden)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if diff := firstDiff(string(want), got.String()); diff != "" {
+		t.Errorf("output differs from %s, run the test with -flowtest.update to update it\n%s", golden, diff)
+	}
+	return result
+}
+
+// splitPort splits "node.Port" into the node and the port.
+func splitPort(name string) (flow.Name, flow.PortName) {
+	node, port, _ := strings.Cut(name, ".")
+	return flow.Name(node), flow.PortName(port)
+}
+
+func sortedKeys(outputs map[string]*graphCollect) []string {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// firstDiff describes the first line that differs.
+func firstDiff(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; ; i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n\twant: %s\n\tgot:  %s", i+1, w, g)
+		}
+	}
+}
+
+// graphFeed sends the values of an input and closes it.
+type graphFeed struct {
+	Out    flow.OutAny
+	values []any
+	// sent counts the values sent
+	sent int
+}
+
+func (feed *graphFeed) Run(ctx context.Context) error {
+	for _, v := range feed.values {
+		if err := feed.Out.Send(ctx, v); err != nil {
+			return err
+		}
+		feed.sent++
+	}
+	return feed.Out.Close(ctx)
+}
+
+// graphCollect collects the values of an output.
+type graphCollect struct {
+	In flow.InAny
+
+	mu  sync.Mutex
+	got []any
+}
+
+func (collect *graphCollect) Run(ctx context.Context) error {
+	for {
+		v, err := collect.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		collect.mu.Lock()
+		collect.got = append(collect.got, v)
+		collect.mu.Unlock()
+	}
+}
+
+func (collect *graphCollect) values() []any {
+	collect.mu.Lock()
+	defer collect.mu.Unlock()
+	return append([]any(nil), collect.got...)
+}
@@ -0,0 +1,304 @@
+package flowtest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// GraphConfig bounds the random graphs of CheckGraphs.
+type GraphConfig struct {
+	// Registry contains the component types used in the graphs,
+	// defaults to flow.Registered. The components must terminate
+	// once their inputs have been closed.
+	Registry flow.Registry
+	// MaxNodes limits the number of nodes, defaults to 6.
+	MaxNodes int
+	// MaxValues limits the number of values sent to each unconnected
+	// In port, defaults to 10.
+	MaxValues int
+	// Value generates a value of typ for an unconnected In port,
+	// defaults to testing/quick.Value.
+	Value func(rng *rand.Rand, typ reflect.Type) (any, bool)
+
+	// Graphs is the number of graphs CheckGraphs tries, defaults to 100.
+	Graphs int
+	// Seed is the seed of the first graph, the following graphs use
+	// the next seeds. Zero picks a random seed.
+	Seed int64
+	// Timeout limits the run of each graph, defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+func (cfg *GraphConfig) defaults() {
+	if cfg.Registry == nil {
+		cfg.Registry = flow.Registered()
+	}
+	if cfg.MaxNodes <= 0 {
+		cfg.MaxNodes = 6
+	}
+	if cfg.MaxValues <= 0 {
+		cfg.MaxValues = 10
+	}
+	if cfg.Value == nil {
+		cfg.Value = func(rng *rand.Rand, typ reflect.Type) (any, bool) {
+			v, ok := quick.Value(typ, rng)
+			if !ok {
+				return nil, false
+			}
+			return v.Interface(), true
+		}
+	}
+	if cfg.Graphs <= 0 {
+		cfg.Graphs = 100
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+}
+
+// Graph is a random graph made by RandomGraph.
+type Graph struct {
+	Wiring *flow.Wiring
+	// Inputs contains the values sent to the unconnected In ports.
+	Inputs Inputs
+}
+
+// String formats the graph as a graph definition, followed by
+// the inputs as comments.
+func (g *Graph) String() string {
+	var b strings.Builder
+	names := make([]string, 0, len(g.Wiring.Decls))
+	for name := range g.Wiring.Decls {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, ": %s %s\n", name, g.Wiring.Decls[flow.Name(name)])
+	}
+	for _, wire := range g.Wiring.Wires {
+		fmt.Fprintf(&b, "%v\n", wire)
+	}
+	ports := make([]string, 0, len(g.Inputs))
+	for port := range g.Inputs {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		fmt.Fprintf(&b, "# %s <- %v\n", port, g.Inputs[port])
+	}
+	return b.String()
+}
+
+// RandomGraph generates a valid graph of at most cfg.MaxNodes nodes.
+//
+// The nodes are connected only forward, in the order they are declared,
+// hence the graphs are acyclic and terminate on finite inputs. Each Out
+// is connected to a random In of the same type and each unconnected In
+// is given up to cfg.MaxValues random values.
+func RandomGraph(rng *rand.Rand, cfg GraphConfig) (*Graph, error) {
+	cfg.defaults()
+	types := make([]flow.Type, 0, len(cfg.Registry))
+	for typ := range cfg.Registry {
+		types = append(types, typ)
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no component types")
+	}
+	sort.Slice(types, func(i, k int) bool { return types[i] < types[k] })
+
+	g := &Graph{
+		Wiring: &flow.Wiring{Decls: map[flow.Name]flow.Type{}},
+		Inputs: Inputs{},
+	}
+
+	// the ports of each node, by the order of the nodes
+	type graphPort struct {
+		node flow.Name
+		name flow.PortName
+		info flow.PortInfo
+	}
+	var nodes [][]graphPort
+	n := 1 + rng.Intn(cfg.MaxNodes)
+	var net flow.Network
+	for i := 0; i < n; i++ {
+		typ := types[rng.Intn(len(types))]
+		name := flow.Name("n" + strconv.Itoa(i))
+		c := cfg.Registry[typ]()
+		if err := net.AddNamed(name, c); err != nil {
+			return nil, err
+		}
+		g.Wiring.Decls[name] = typ
+
+		var ports []graphPort
+		for _, full := range net.Unconnected() {
+			node, port := splitPort(full)
+			if node != name {
+				continue
+			}
+			info, err := flow.PortOf(c, port)
+			if err != nil {
+				return nil, err
+			}
+			ports = append(ports, graphPort{node: name, name: port, info: info})
+		}
+		nodes = append(nodes, ports)
+	}
+
+	connected := map[graphPort]bool{}
+	for i, ports := range nodes {
+		for _, out := range ports {
+			if out.info.In {
+				continue
+			}
+			var candidates []graphPort
+			for _, later := range nodes[i+1:] {
+				for _, in := range later {
+					if in.info.In && !connected[in] && in.info.Elem == out.info.Elem && in.info.Ack == out.info.Ack {
+						candidates = append(candidates, in)
+					}
+				}
+			}
+			// leave some of the outputs unconnected
+			if len(candidates) == 0 || rng.Intn(4) == 0 {
+				continue
+			}
+			in := candidates[rng.Intn(len(candidates))]
+			connected[in] = true
+			g.Wiring.Wires = append(g.Wiring.Wires, flow.Wire{From: out.node, Src: out.name, To: in.node, Dst: in.name})
+		}
+	}
+
+	for _, ports := range nodes {
+		for _, in := range ports {
+			if !in.info.In || connected[in] || in.info.Ack {
+				continue
+			}
+			var values []any
+			for k := rng.Intn(cfg.MaxValues + 1); k > 0; k-- {
+				v, ok := cfg.Value(rng, in.info.Elem)
+				if !ok {
+					return nil, fmt.Errorf("cannot generate %v for %s.%s", in.info.Elem, in.node, in.name)
+				}
+				values = append(values, v)
+			}
+			g.Inputs[string(in.node)+"."+string(in.name)] = values
+		}
+	}
+	return g, nil
+}
+
+// CheckGraphs runs cfg.Graphs random graphs made by RandomGraph and
+// checks with CheckGraph that each of them terminates without losing
+// packets. A failure is reported with the seed and the graph, the seed
+// reproduces it with cfg.Graphs = 1.
+//
+// It's meant for stress testing the runtime and the components,
+// preferably with go test -race.
+func CheckGraphs(t *testing.T, cfg GraphConfig) {
+	t.Helper()
+	cfg.defaults()
+	for i := 0; i < cfg.Graphs; i++ {
+		seed := cfg.Seed + int64(i)
+		g, err := RandomGraph(rand.New(rand.NewSource(seed)), cfg)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if err := CheckGraph(g, cfg); err != nil {
+			t.Fatalf("seed %d: %v\n%v", seed, err, g)
+		}
+	}
+}
+
+// CheckGraph runs the graph to completion and checks that:
+//
+//   - it terminates within cfg.Timeout without an error,
+//   - every input value has been sent,
+//   - no packets are left queued in the connections.
+func CheckGraph(g *Graph, cfg GraphConfig) error {
+	cfg.defaults()
+	net := &flow.Network{Registry: cfg.Registry}
+	if err := net.WireUp(g.Wiring); err != nil {
+		return err
+	}
+
+	var wiring flow.Wiring
+	feeds := map[string]*graphFeed{}
+	for i, name := range sortedInputs(g.Inputs) {
+		node, port := splitPort(name)
+		feed := &graphFeed{values: g.Inputs[name]}
+		feedName := flow.Name("$input" + strconv.Itoa(i))
+		if err := net.AddNamed(feedName, feed); err != nil {
+			return err
+		}
+		feeds[name] = feed
+		wiring.Wires = append(wiring.Wires, flow.Wire{From: feedName, Src: "Out", To: node, Dst: port})
+	}
+	if err := net.WireUp(&wiring); err != nil {
+		return err
+	}
+
+	wiring = flow.Wiring{}
+	for i, name := range net.Unconnected() {
+		node, port := splitPort(name)
+		c, _ := net.Node(node)
+		if info, err := flow.PortOf(c, port); err != nil || info.In {
+			continue
+		}
+		collectName := flow.Name("$output" + strconv.Itoa(i))
+		if err := net.AddNamed(collectName, &graphCollect{}); err != nil {
+			return err
+		}
+		wiring.Wires = append(wiring.Wires, flow.Wire{From: node, Src: port, To: collectName, Dst: "In"})
+	}
+	if err := net.WireUp(&wiring); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	err := net.RunToCompletion(ctx)
+	if ctx.Err() != nil {
+		var b strings.Builder
+		for _, c := range net.Status().Components {
+			b.WriteString("\n\t" + string(c.Name) + " is " + string(c.State))
+		}
+		return fmt.Errorf("did not terminate within %v:%s", cfg.Timeout, b.String())
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, name := range sortedInputs(g.Inputs) {
+		if sent := feeds[name].sent; sent != len(g.Inputs[name]) {
+			return fmt.Errorf("%s: sent %d of %d inputs", name, sent, len(g.Inputs[name]))
+		}
+	}
+	for _, conn := range net.Status().Connections {
+		if conn.Queued > 0 {
+			return fmt.Errorf("%s: %d packets left queued", conn.Name, conn.Queued)
+		}
+	}
+	return nil
+}
+
+func sortedInputs(inputs Inputs) []string {
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
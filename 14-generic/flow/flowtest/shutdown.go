@@ -0,0 +1,127 @@
+package flowtest
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// settleTime is how long CheckShutdown lets the network run,
+// unless all the components are blocked sooner.
+const settleTime = 100 * time.Millisecond
+
+// CheckShutdown runs the network, cancels it and checks that it shuts
+// down cleanly:
+//
+//   - Run returns within DefaultTimeout,
+//   - no goroutine started while running the network is left behind,
+//   - no packets are left queued or unacknowledged in the connections.
+//
+// The network is cancelled once all the components are blocked or after
+// a short while. Leaked goroutines are reported with their stacks.
+func CheckShutdown(t testing.TB, net *flow.Network) {
+	t.Helper()
+	before := goroutines()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- net.Run(ctx) }()
+
+	settled := time.Now().Add(settleTime)
+	for time.Now().Before(settled) && !blocked(net) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	timer := time.NewTimer(DefaultTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil && ctx.Err() == nil {
+			t.Logf("network returned before cancellation: %v", err)
+		}
+	case <-timer.C:
+		var b strings.Builder
+		for _, c := range net.Status().Components {
+			b.WriteString("\t" + string(c.Name) + " is " + string(c.State) + "\n")
+		}
+		t.Fatalf("network did not return within %v after cancellation\n%s", DefaultTimeout, b.String())
+	}
+
+	for _, conn := range net.Status().Connections {
+		if conn.Queued > 0 {
+			t.Errorf("%s: %d packets left queued", conn.Name, conn.Queued)
+		}
+		if conn.Unacked > 0 {
+			t.Errorf("%s: %d packets left unacknowledged", conn.Name, conn.Unacked)
+		}
+	}
+
+	// goroutines may take a moment to exit after their parent returns
+	var leaked []string
+	deadline := time.Now().Add(DefaultTimeout)
+	for {
+		leaked = leaked[:0]
+		for id, stack := range goroutines() {
+			if _, ok := before[id]; !ok {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(leaked) > 0 {
+		t.Errorf("%d goroutines leaked after shutdown:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
+
+// blocked reports whether all the components are blocked on their ports.
+func blocked(net *flow.Network) bool {
+	for _, c := range net.Status().Components {
+		if c.State == flow.Running {
+			return false
+		}
+	}
+	return true
+}
+
+// goroutines returns the stacks of the other goroutines by their ID.
+func goroutines() map[int]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := map[int]string{}
+	// the first one is the current goroutine
+	for i, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if i == 0 {
+			continue
+		}
+		header := strings.TrimPrefix(string(stack), "goroutine ")
+		end := strings.IndexByte(header, ' ')
+		if end < 0 {
+			continue
+		}
+		id, err := strconv.Atoi(header[:end])
+		if err != nil {
+			continue
+		}
+		stacks[id] = string(stack)
+	}
+	return stacks
+}
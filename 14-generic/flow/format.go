@@ -0,0 +1,103 @@
+package flow
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// FormatWiring formats a graph definition in the canonical style.
+//
+// Every statement is written on its own line without indentation and
+// with single spaces between the tokens, connections use the node.Port
+// form and consecutive empty lines are collapsed. Comments are kept.
+// Includes are not followed, so the definition may be a fragment.
+func FormatWiring(src []byte) ([]byte, error) {
+	var out bytes.Buffer
+	blank := false
+	lineno := 0
+	line := bufio.NewScanner(bytes.NewReader(src))
+	for line.Scan() {
+		lineno++
+		text := line.Text()
+		code := stripComment(text)
+		comment := strings.TrimSpace(text[len(code):])
+		stmt := strings.TrimSpace(code)
+
+		if stmt == "" && comment == "" {
+			blank = out.Len() > 0
+			continue
+		}
+		if blank {
+			out.WriteByte('\n')
+			blank = false
+		}
+
+		if stmt != "" {
+			pos := Pos{Line: lineno, Col: strings.Index(code, stmt) + 1}
+			formatted, err := formatStatement(stmt, pos)
+			if err != nil {
+				return nil, err
+			}
+			out.WriteString(formatted)
+			if comment != "" {
+				out.WriteByte(' ')
+			}
+		}
+		out.WriteString(comment)
+		out.WriteByte('\n')
+	}
+	if err := line.Err(); err != nil {
+		return nil, WiringError{Pos: Pos{Line: lineno + 1, Col: 1}, Err: err}
+	}
+	return out.Bytes(), nil
+}
+
+// formatStatement formats a single statement without a comment.
+func formatStatement(stmt string, pos Pos) (string, error) {
+	invalid := WiringError{Pos: pos, Err: errors.New("invalid line: " + stmt)}
+
+	switch {
+	case stmt[0] == ':':
+		xs := rxDecl.FindStringSubmatch(stmt)
+		if xs == nil {
+			return "", invalid
+		}
+		return ": " + xs[1] + " " + xs[2] + Pin{Version: xs[3], Ports: xs[4]}.String(), nil
+
+	case isKeyword(stmt, "include"):
+		xs := rxInclude.FindStringSubmatch(stmt)
+		if xs == nil {
+			return "", invalid
+		}
+		return `include "` + xs[1] + `"`, nil
+
+	case isKeyword(stmt, "export"):
+		xs := rxExport.FindStringSubmatch(stmt)
+		if xs == nil {
+			return "", invalid
+		}
+		return "export " + xs[1] + "." + xs[2] + " as " + xs[3], nil
+
+	case isKeyword(stmt, "param"):
+		xs := rxParam.FindStringSubmatch(stmt)
+		if xs == nil {
+			return "", invalid
+		}
+		if xs[2] == "" {
+			return "param " + xs[1], nil
+		}
+		return "param " + xs[1] + " = " + strings.TrimSpace(xs[2]), nil
+	}
+
+	wires, err := parseChain(stmt, pos)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(wires))
+	for i, wire := range wires {
+		parts[i] = wire.String()
+	}
+	return strings.Join(parts, " "), nil
+}
@@ -0,0 +1,280 @@
+package flow
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValuesNode is the node name used to reference Network.Values in graph definitions.
+const ValuesNode = Name("$values")
+
+// IIPNode is the source node of wires carrying initial information packets.
+const IIPNode = Name("$iip")
+
+type Registry map[Type]MakeFn
+type MakeFn func() Component
+
+type Name string
+type Type string
+type PortName string
+
+type Wiring struct {
+	Decls map[Name]Type
+	Wires []Wire
+	// Params contains the declared parameters by name.
+	Params map[string]Param
+	// Exports contains the ports exposed by a subgraph.
+	Exports []Export
+	// Pins contains the versions required of the nodes, see Pin.
+	Pins map[Name]Pin
+}
+
+// Export exposes a port of a node as a port of the subgraph:
+//
+//	export s.In as IN
+type Export struct {
+	Node Name
+	Port PortName
+	As   PortName
+	Pos  Pos
+}
+
+type Wire struct {
+	From Name
+	Src  PortName
+	To   Name
+	Dst  PortName
+
+	// IIP is the literal sent to the target, when From is IIPNode.
+	IIP string
+	// Feedback is set for a connection leading back upstream, written
+	// with ~> instead of ->. It's buffered, see WithFeedback.
+	Feedback bool
+
+	// Pos is the position of the wire in the definition,
+	// zero when the wire wasn't parsed.
+	Pos Pos
+}
+
+// Pos is a position in a graph definition.
+type Pos struct {
+	// File is the included file, empty for the main definition.
+	File      string
+	Line, Col int
+}
+
+func (pos Pos) String() string {
+	s := strconv.Itoa(pos.Line) + ":" + strconv.Itoa(pos.Col)
+	if pos.File != "" {
+		s = pos.File + ":" + s
+	}
+	return s
+}
+
+// WiringError is an error in a graph definition.
+type WiringError struct {
+	Pos Pos
+	Err error
+}
+
+func (err WiringError) Error() string {
+	if err.Pos.Line == 0 {
+		return err.Err.Error()
+	}
+	return err.Pos.String() + ": " + err.Err.Error()
+}
+
+func (err WiringError) Unwrap() error { return err.Err }
+
+// WiringErrors contains all the errors found in a graph definition.
+type WiringErrors []WiringError
+
+func (errs WiringErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w Wire) String() string {
+	if w.From == IIPNode {
+		return quoteIIP(w.IIP) + " -> " + string(w.To) + "." + string(w.Dst)
+	}
+	arrow := " -> "
+	if w.Feedback {
+		arrow = " ~> "
+	}
+	return string(w.From) + "." + string(w.Src) + arrow + string(w.To) + "." + string(w.Dst)
+}
+
+// Setup is convenience for parsing the wiring and wiring up the network.
+func (net *Network) Setup(def string) error {
+	wiring, err := ParseWiring(def)
+	if err != nil {
+		return err
+	}
+	return net.WireUp(wiring)
+}
+
+// SetupFile parses the graph definition from a file and wires up the network.
+func (net *Network) SetupFile(path string) error {
+	wiring, err := ParseWiringFile(path)
+	if err != nil {
+		return err
+	}
+	return net.WireUp(wiring)
+}
+
+// WireUp creates the declared components using Registry and connects them.
+//
+// All the nodes and wires are checked before the network is modified,
+// unknown component types, mismatches between the port types, multiple
+// wires into the same port and the components not matching their Pin
+// are reported as WiringErrors.
+func (net *Network) WireUp(w *Wiring) error {
+	created := make(map[Name]Component, len(w.Decls))
+	// failed contains the nodes of unknown types, their wires are not checked
+	failed := map[Name]bool{}
+	var errs WiringErrors
+	for _, name := range sortedNames(w.Decls) {
+		if _, exists := net.nodes[name]; exists {
+			return fmt.Errorf("node %s already exists", name)
+		}
+		mk, err := net.lookup(w.Decls[name])
+		if err != nil {
+			errs = append(errs, WiringError{Err: fmt.Errorf("cannot create %s: %w", name, err)})
+			failed[name] = true
+			continue
+		}
+		created[name] = mk()
+		if pin, ok := w.Pins[name]; ok {
+			if err := checkPin(name, w.Decls[name], created[name], pin, w.Wires); err != nil {
+				errs = append(errs, WiringError{Pos: pin.Pos, Err: err})
+				failed[name] = true
+			}
+		}
+	}
+
+	node := func(name Name) (Component, bool) {
+		if c, ok := created[name]; ok {
+			return c, true
+		}
+		c, ok := net.nodes[name]
+		return c, ok
+	}
+
+	var links []link
+	// wired contains the wire of each target port, an In has at most
+	// one upstream connection
+	wired := map[inPort]Wire{}
+	for _, wire := range w.Wires {
+		if failed[wire.From] || failed[wire.To] {
+			continue
+		}
+		l, err := net.resolveWire(w, wire, node)
+		if err != nil {
+			errs = append(errs, WiringError{Pos: wire.Pos, Err: err})
+			continue
+		}
+		if prev, ok := wired[l.dst]; ok {
+			errs = append(errs, WiringError{Pos: wire.Pos, Err: fmt.Errorf("%s.%s is already connected by %v", wire.To, wire.Dst, prev)})
+			continue
+		}
+		if isConnected(l.dst) {
+			errs = append(errs, WiringError{Pos: wire.Pos, Err: fmt.Errorf("%s.%s is already connected", wire.To, wire.Dst)})
+			continue
+		}
+		wired[l.dst] = wire
+		links = append(links, l)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for name, c := range created {
+		net.addNamed(name, c)
+	}
+	for i := range links {
+		if err := net.link(&links[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedNames returns the declared nodes in order.
+func sortedNames(decls map[Name]Type) []Name {
+	names := make([]Name, 0, len(decls))
+	for name := range decls {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, k int) bool { return names[i] < names[k] })
+	return names
+}
+
+// connectable reports whether the ports can be connected by connectPorts.
+func connectable(src outPort, dst inPort) bool {
+	from, to := src.elemType(), dst.elemType()
+	if from != to {
+		conversions.Lock()
+		_, ok := conversions.adapt[[2]reflect.Type{from, to}]
+		conversions.Unlock()
+		if ok {
+			return true
+		}
+		bridged, err := needsBridge(from, to)
+		return err == nil && bridged
+	}
+	// plain and acknowledged ports cannot be mixed
+	return reflect.TypeOf(src.newIn()) == reflect.TypeOf(dst)
+}
+
+// portOf finds the port of a node and binds it to the network,
+// when it was created during the lookup.
+func (net *Network) portOf(name Name, node Component, portName PortName) (port, error) {
+	p, err := portByName(node, string(portName))
+	if err != nil {
+		return nil, err
+	}
+	if p.boundTo().net == nil {
+		p.bind(binding{net: net, name: string(name) + "." + string(portName)})
+	}
+	return p, nil
+}
+
+// checkValue checks whether the named value can be sent to dst.
+func (net *Network) checkValue(name string, dst inPort) error {
+	v, ok := net.Values.Get(name)
+	if !ok {
+		return fmt.Errorf("value %s does not exist", name)
+	}
+	if typ := reflect.TypeOf(v); !typ.AssignableTo(dst.elemType()) {
+		return fmt.Errorf("value %s has type %v, port expects %v", name, typ, dst.elemType())
+	}
+	return nil
+}
+
+// wireValue adds a component that feeds the named value to dst.
+func (net *Network) wireValue(name string, dst inPort) error {
+	if err := net.checkValue(name, dst); err != nil {
+		return err
+	}
+
+	out := dst.newOut()
+	feedName := net.uniqueName(string(ValuesNode) + "." + name)
+	out.bind(binding{net: net, name: string(feedName)})
+	if _, err := out.connect(dst); err != nil {
+		return err
+	}
+	net.addNamed(feedName, &valueFeed{
+		net:    net,
+		values: &net.Values,
+		name:   name,
+		out:    out,
+	})
+	return nil
+}
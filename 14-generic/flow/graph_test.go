@@ -0,0 +1,33 @@
+package flow_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"fbp.example/flow"
+)
+
+func TestWireUpConnectedIn(t *testing.T) {
+	net := flow.Network{Registry: flow.Registry{
+		"Numbers": func() flow.Component { return &numbers{} },
+		"Drain":   func() flow.Component { return &drain{} },
+	}}
+	err := net.Setup(`
+		: a Numbers
+		: b Numbers
+		: c Drain
+		a.Out -> c.In
+		b.Out -> c.In
+	`)
+	var errs flow.WiringErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected a single wiring error, got %v", err)
+	}
+	if errs[0].Pos.Line != 6 || !strings.Contains(errs[0].Error(), "c.In is already connected") {
+		t.Fatalf("unexpected error %v", errs[0])
+	}
+	if len(net.Connections()) != 0 {
+		t.Fatal("network modified despite the wiring error")
+	}
+}
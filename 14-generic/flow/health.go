@@ -0,0 +1,101 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthChecker can be implemented by a component to report whether
+// it's able to do its work, e.g. whether its database is reachable.
+type HealthChecker interface {
+	// Healthy returns nil when the component is healthy.
+	Healthy(ctx context.Context) error
+}
+
+// DefaultHealthTimeout is how long the health checks may take by default,
+// see Network.HealthTimeout.
+const DefaultHealthTimeout = 5 * time.Second
+
+// Health is the result of the health checks of a network.
+type Health struct {
+	Time time.Time `json:"time"`
+	// Healthy is set when all the components are healthy.
+	Healthy    bool              `json:"healthy"`
+	Components []ComponentHealth `json:"components"`
+}
+
+// ComponentHealth is the result of the health check of a component.
+type ComponentHealth struct {
+	Name    Name          `json:"name"`
+	Healthy bool          `json:"healthy"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency"`
+}
+
+// Health checks the health of the components implementing HealthChecker
+// concurrently. A check that doesn't return within HealthTimeout fails.
+func (net *Network) Health(ctx context.Context) Health {
+	timeout := net.HealthTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	net.mu.Lock()
+	components := append([]Component(nil), net.components...)
+	net.mu.Unlock()
+
+	health := Health{Time: time.Now(), Healthy: true, Components: []ComponentHealth{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range components {
+		checker, ok := c.(HealthChecker)
+		if !ok {
+			checker, ok = unwrap(c).(HealthChecker)
+		}
+		if !ok {
+			continue
+		}
+		name, _ := net.Name(c)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := ComponentHealth{Name: name}
+			start := time.Now()
+			err := check(ctx, checker)
+			result.Latency = time.Since(start)
+			result.Healthy = err == nil
+			if err != nil {
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			health.Healthy = health.Healthy && result.Healthy
+			health.Components = append(health.Components, result)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(health.Components, func(i, k int) bool {
+		return health.Components[i].Name < health.Components[k].Name
+	})
+	return health
+}
+
+// check runs the health check, giving up once ctx is done.
+func check(ctx context.Context, checker HealthChecker) error {
+	result := make(chan error, 1)
+	go func() { result <- checker.Healthy(ctx) }()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health check: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,141 @@
+package flow
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Initial information packets (IIPs) are constants sent to a port once
+	when the network starts, after which the port is closed:
+
+		'10'      -> COUNT hello
+		'Hello'   -> greet.Prefix
+		'{"a":1}' -> conf.In
+
+	The literal is converted to the type of the port: strings are used
+	as is, durations are parsed with time.ParseDuration, numbers and
+	booleans with strconv, types implementing encoding.TextUnmarshaler
+	are given the text and everything else is decoded as JSON. Within
+	the quotes \' and \\ are the only escapes.
+*/
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// ParseLiteral converts the literal of an IIP to a value of type typ.
+func ParseLiteral(text string, typ reflect.Type) (reflect.Value, error) {
+	v := reflect.New(typ)
+	if typ.Kind() != reflect.Interface && v.Type().Implements(textUnmarshalerType) {
+		err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+		return v.Elem(), err
+	}
+
+	if typ == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return v.Elem(), fmt.Errorf("cannot convert %q to %v: %w", text, typ, err)
+		}
+		v.Elem().SetInt(int64(d))
+		return v.Elem(), nil
+	}
+
+	var err error
+	switch typ.Kind() {
+	case reflect.String:
+		v.Elem().SetString(text)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(text)
+		v.Elem().SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(text, 0, typ.Bits())
+		v.Elem().SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		n, err = strconv.ParseUint(text, 0, typ.Bits())
+		v.Elem().SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(text, typ.Bits())
+		v.Elem().SetFloat(f)
+	case reflect.Interface:
+		if typ.NumMethod() != 0 {
+			return v.Elem(), fmt.Errorf("cannot convert literal to %v", typ)
+		}
+		v.Elem().Set(reflect.ValueOf(text))
+	default:
+		err = json.Unmarshal([]byte(text), v.Interface())
+	}
+	if err != nil {
+		return v.Elem(), fmt.Errorf("cannot convert %q to %v: %w", text, typ, err)
+	}
+	return v.Elem(), nil
+}
+
+// unescapeIIP removes the escapes from the literal between the quotes.
+func unescapeIIP(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// quoteIIP formats the literal as it's written in a graph definition.
+func quoteIIP(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, `'`, `\'`) + "'"
+}
+
+// wireIIP adds a component that sends the literal to dst once.
+func (net *Network) wireIIP(literal string, dst inPort) error {
+	v, err := ParseLiteral(literal, dst.elemType())
+	if err != nil {
+		return err
+	}
+
+	out := dst.newOut()
+	name := net.uniqueName(string(IIPNode))
+	out.bind(binding{net: net, name: string(name)})
+	if _, err := out.connect(dst); err != nil {
+		return err
+	}
+	net.addNamed(name, &iip{value: v.Interface(), out: out})
+	return nil
+}
+
+// AddIIP adds a component to the network, which sends v to the port
+// once and closes it.
+func AddIIP[T any](net *Network, to *In[T], v T) {
+	out := &Out[T]{}
+	name := net.uniqueName(string(IIPNode))
+	out.bind(binding{net: net, name: string(name)})
+	Connect(out, to)
+	net.addNamed(name, &iip{value: v, out: out})
+}
+
+// iip sends a single value and closes the port.
+type iip struct {
+	value any
+	out   outPort
+}
+
+func (p *iip) Run(ctx context.Context) error {
+	if err := p.out.sendAny(ctx, p.value); err != nil {
+		return err
+	}
+	return p.out.closeAny(ctx)
+}
@@ -0,0 +1,204 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Initializer can be implemented by a component to acquire resources
+// before the network starts running.
+type Initializer interface {
+	Init(ctx context.Context) error
+}
+
+// Shutdowner can be implemented by a component to release resources
+// after its Run has returned.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// initialize calls Init on all components in the order they were added.
+// When one fails, the already initialized components are shut down.
+func (net *Network) initialize(ctx context.Context) error {
+	for i, c := range net.components {
+		initer, ok := c.(Initializer)
+		if !ok {
+			continue
+		}
+		if err := initer.Init(ctx); err != nil {
+			_ = shutdown(ctx, net.components[:i])
+			return fmt.Errorf("init %T: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// shutdown calls Shutdown on components in the reverse order.
+//
+// The shutdown is not affected by the cancellation of ctx, since it's
+// usually already cancelled by the time the network stops.
+func shutdown(ctx context.Context, components []Component) error {
+	ctx = withoutCancel{ctx}
+
+	var first error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		down, ok := c.(Shutdowner)
+		if !ok {
+			continue
+		}
+		if err := down.Shutdown(ctx); err != nil && first == nil {
+			first = fmt.Errorf("shutdown %T: %w", c, err)
+		}
+	}
+	return first
+}
+
+// withoutCancel keeps the values of the parent, but not its cancellation.
+type withoutCancel struct{ parent context.Context }
+
+func (withoutCancel) Deadline() (deadline time.Time, ok bool) { return }
+func (withoutCancel) Done() <-chan struct{}                   { return nil }
+func (withoutCancel) Err() error                              { return nil }
+func (c withoutCancel) Value(key any) any                     { return c.parent.Value(key) }
+
+// Shutdown stops the running network gracefully, without dropping the
+// packets that are in flight.
+//
+// First the sources, components without connected In ports, are
+// cancelled. The Out ports of every component that returns are closed,
+// so the rest of the network drains in topological order as the end of
+// stream reaches it. Components cancelled by Shutdown aren't reported as
+// failed when they return context.Canceled, hence Run returns nil after
+// a successful Shutdown.
+//
+// When ctx is done before every component has returned, Shutdown returns
+// a *ShutdownError describing the components that failed to stop and
+// cancels them. Components in a cycle never see the end of stream, hence
+// they are always cancelled at the deadline.
+func (net *Network) Shutdown(ctx context.Context) error {
+	net.mu.Lock()
+	net.draining = true
+	all := make([]*running, 0, len(net.running))
+	for _, r := range net.running {
+		all = append(all, r)
+		if isSource(r.component) {
+			r.stopped = true
+		}
+	}
+	net.mu.Unlock()
+
+	defer func() {
+		net.mu.Lock()
+		net.draining = false
+		net.mu.Unlock()
+	}()
+
+	for _, r := range all {
+		if r.stopped {
+			r.cancel()
+		}
+	}
+
+	for _, r := range all {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			err := &ShutdownError{Err: ctx.Err()}
+			net.mu.Lock()
+			for _, r := range all {
+				select {
+				case <-r.done:
+					continue
+				default:
+				}
+				err.Stuck = append(err.Stuck, stuckOf(net.names[r.component], r.component))
+				r.stopped = true
+				r.cancel()
+			}
+			net.mu.Unlock()
+			sort.Slice(err.Stuck, func(i, k int) bool { return err.Stuck[i].Name < err.Stuck[k].Name })
+			return err
+		}
+	}
+	return nil
+}
+
+// ShutdownError is returned by Shutdown, when the network didn't drain
+// before the deadline. The stuck components have been cancelled.
+type ShutdownError struct {
+	// Err is the error of the Shutdown context.
+	Err error
+	// Stuck are the components that were still running, sorted by name.
+	Stuck []StuckComponent
+}
+
+// StuckComponent describes a component that failed to stop.
+type StuckComponent struct {
+	Name  Name
+	State State
+	// Ports are the ports the component was blocked on, e.g. "b.In".
+	Ports []string
+}
+
+func (err *ShutdownError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "shutdown: %v, cancelled", err.Err)
+	for i, c := range err.Stuck {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, " %s (%s", c.Name, c.State)
+		if len(c.Ports) > 0 {
+			fmt.Fprintf(&b, " on %s", strings.Join(c.Ports, ", "))
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+func (err *ShutdownError) Unwrap() error { return err.Err }
+
+// stuckOf describes what the component is blocked on.
+func stuckOf(name Name, c Component) StuckComponent {
+	stuck := StuckComponent{Name: name, State: stateOf(c)}
+	for _, p := range portsOf(c) {
+		blocked := false
+		switch p := p.(type) {
+		case outPort:
+			blocked = p.sending()
+		case inPort:
+			blocked, _ = p.activity()
+		}
+		if blocked {
+			stuck.Ports = append(stuck.Ports, portName(p.boundTo()))
+		}
+	}
+	sort.Strings(stuck.Ports)
+	return stuck
+}
+
+// isSource reports whether none of the In ports of c are connected.
+func isSource(c Component) bool {
+	for _, p := range portsOf(c) {
+		if _, ok := p.(inPort); !ok {
+			continue
+		}
+		if in, ok := p.(interface{ Connected() bool }); ok && in.Connected() {
+			return false
+		}
+	}
+	return true
+}
+
+// closeOutputs closes the Out ports of a component that has returned.
+func closeOutputs(c Component) {
+	for _, p := range portsOf(c) {
+		if out, ok := p.(outPort); ok {
+			_ = out.closeAny(context.Background())
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package flow
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+/*
+	With Network.TrackLineage every packet carries a header, which lists
+	the components the packet passed through. The header travels next to
+	the value in the connection, so the values themselves don't change.
+
+	A packet sent by a component derives from the packet the component
+	received last, hence its lineage continues from that packet. A packet
+	sent before the component received anything starts a new lineage.
+	Components that receive on several goroutines, or that combine many
+	packets into one, get only an approximate lineage.
+
+	The lineage of the value received last can be queried with
+	In.Lineage, e.g. by the sink that got a bad output.
+
+	Only the values sent over In and Out carry a header, the Ack ports
+	don't. The headers also carry the context values selected by
+	Network.ContextKeys.
+*/
+
+// Hop is a component a packet passed through, see Network.TrackLineage.
+type Hop struct {
+	Node Name `json:"node"`
+	// Port is the In the packet was received on, or the Out it was
+	// sent from by the component it originates from.
+	Port PortName `json:"port"`
+	// Time is when the packet was received or sent,
+	// according to the clock of the network.
+	Time time.Time `json:"time"`
+}
+
+// header travels with a packet, see Network.TrackLineage.
+type header struct {
+	// traced is set when the packet records its lineage
+	traced bool
+	// lineage is shared between the derived packets, it's never modified
+	lineage []Hop
+	// metadata contains the context values, see Network.ContextKeys
+	metadata
+}
+
+// through returns the header extended by the hop.
+func (h *header) through(hop Hop) *header {
+	var lineage []Hop
+	next := &header{traced: true}
+	if h != nil {
+		lineage = h.lineage
+		next.metadata = h.metadata
+	}
+	next.lineage = append(lineage[:len(lineage):len(lineage)], hop)
+	return next
+}
+
+// packet is a value in a connection with its header.
+type packet[T any] struct {
+	value  T
+	header *header
+	// priority orders the packets, see WithPriority
+	priority int
+}
+
+// headers reports whether the packets sent and received by the port
+// carry headers.
+func (b binding) headers() bool {
+	return b.net != nil && (b.net.TrackLineage || b.net.Profiler != nil || b.net.propagates())
+}
+
+// node returns the node and the port the binding belongs to,
+// ok is false for the ports outside of the nodes, e.g. bridges.
+func (b binding) node() (node Name, port PortName, ok bool) {
+	name, field, found := strings.Cut(portName(b), ".")
+	if !found || b.net == nil {
+		return "", "", false
+	}
+	_, ok = b.net.Node(Name(name))
+	return Name(name), PortName(field), ok
+}
+
+// outgoing returns the header for a packet sent from the port.
+func (b binding) outgoing(ctx context.Context) *header {
+	if h, ok := b.net.lineage.Load(b.component()); ok {
+		return h.(*header)
+	}
+	// the packet starts a new lineage
+	meta := b.net.metadataOf(ctx)
+	if !b.net.TrackLineage && !b.net.Profiler.sample() {
+		if meta.empty() {
+			return nil
+		}
+		return &header{metadata: meta}
+	}
+	h := &header{traced: true, metadata: meta}
+	if node, port, ok := b.node(); ok {
+		h = h.through(Hop{Node: node, Port: port, Time: ClockFrom(ctx).Now()})
+	}
+	return h
+}
+
+// incoming records the packet received by the port with the header h,
+// which the packets sent next by the component derive from.
+func (b binding) incoming(ctx context.Context, h *header) *header {
+	if h != nil && h.traced {
+		if node, port, ok := b.node(); ok {
+			hop := Hop{Node: node, Port: port, Time: ClockFrom(ctx).Now()}
+			b.net.Profiler.observe(h, hop)
+			h = h.through(hop)
+		}
+	}
+	b.net.lineage.Store(b.component(), h)
+	return h
+}
+
+// Lineage returns the components the value received last by in passed
+// through, oldest first. It's nil unless the network tracks lineage,
+// see Network.TrackLineage, or the value was sampled by its Profiler.
+func (in *In[T]) Lineage() []Hop {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.header == nil {
+		return nil
+	}
+	return append([]Hop(nil), in.header.lineage...)
+}
+
+// receivedHeader records the header of the value received by in. It
+// reports false for a cancelled packet, which is dropped instead, see
+// Network.ContextCancel.
+func (in *In[T]) receivedHeader(ctx context.Context, h *header) bool {
+	if h.cancelled() {
+		return false
+	}
+	h = in.bound.incoming(ctx, h)
+	in.mu.Lock()
+	in.header = h
+	in.mu.Unlock()
+	return true
+}
@@ -0,0 +1,140 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	A packet sent from outside of the components, e.g. with Sink or
+	Network.Send, reaches them without the context of the sender. With
+	Network.ContextKeys a packet that doesn't derive from a received one
+	carries the selected values of the context of its Send, e.g. the
+	request ID or the authenticated user, and the packets derived from
+	it carry them on, like the lineage. With Network.ContextDeadline
+	they carry the deadline of the context as well.
+
+	With Network.ContextCancel the packets are cancelled along with the
+	context of the Send they derive from, e.g. when the client of an
+	HTTP request has gone away. The connections drop the cancelled
+	packets instead of delivering them, hence the work derived from the
+	request stops, while the components keep running for the others.
+
+	A component restores them into its context with In.Context, e.g. to
+	pass them on to the handlers it calls for every packet.
+*/
+
+// metadata contains the context values of a packet.
+type metadata struct {
+	values   []contextValue
+	deadline time.Time
+	// done is closed once the packet is cancelled
+	done <-chan struct{}
+}
+
+// contextValue is a value of a context by key.
+type contextValue struct {
+	key, value any
+}
+
+func (m metadata) empty() bool {
+	return len(m.values) == 0 && m.deadline.IsZero() && m.done == nil
+}
+
+// propagates reports whether the packets carry context values.
+func (net *Network) propagates() bool {
+	return len(net.ContextKeys) > 0 || net.ContextDeadline || net.ContextCancel
+}
+
+// metadataOf returns the context values of ctx carried by the packets.
+func (net *Network) metadataOf(ctx context.Context) metadata {
+	var m metadata
+	for _, key := range net.ContextKeys {
+		if v := ctx.Value(key); v != nil {
+			m.values = append(m.values, contextValue{key: key, value: v})
+		}
+	}
+	if net.ContextDeadline {
+		m.deadline, _ = ctx.Deadline()
+	}
+	if net.ContextCancel {
+		m.done = ctx.Done()
+	}
+	return m
+}
+
+// Context returns ctx with the context values and the deadline of the
+// value received last by in, see Network.ContextKeys. It's cancelled
+// along with the value, see Network.ContextCancel. The returned cancel
+// releases its resources.
+func (in *In[T]) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	in.mu.Lock()
+	h := in.header
+	in.mu.Unlock()
+	if h == nil {
+		return ctx, func() {}
+	}
+	for _, v := range h.values {
+		ctx = context.WithValue(ctx, v.key, v.value)
+	}
+	cancel := context.CancelFunc(func() {})
+	if !h.deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, h.deadline)
+	}
+	if h.done != nil {
+		var stop context.CancelFunc
+		ctx, stop = context.WithCancel(ctx)
+		done := h.done
+		go func() {
+			select {
+			case <-done:
+				stop()
+			case <-ctx.Done():
+			}
+		}()
+		deadline := cancel
+		cancel = func() { stop(); deadline() }
+	}
+	return ctx, cancel
+}
+
+// errCancelled is returned for a cancelled packet, which is dropped.
+var errCancelled = errors.New("packet cancelled")
+
+// cancelled reports whether the packet with the header h is cancelled.
+func (h *header) cancelled() bool {
+	if h == nil || h.done == nil {
+		return false
+	}
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cancelled returns the number of cancelled packets dropped by the
+// connection, see Network.ContextCancel.
+func (conn *Conn[T]) Cancelled() uint64 {
+	return atomic.LoadUint64(&conn.cancelled)
+}
+
+// dropCancelled drops the cancelled packet v received by in.
+func (in *In[T]) dropCancelled(v T) {
+	Release(v)
+	if conn, _ := in.current(); conn != nil {
+		atomic.AddUint64(&conn.cancelled, 1)
+	}
+}
+
+// dropCancelled drops the cancelled packet v instead of sending it.
+func (out *Out[T]) dropCancelled(v T) error {
+	Release(v)
+	if conn, _, _ := out.current(); conn != nil {
+		atomic.AddUint64(&conn.cancelled, 1)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package flow
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// NetworkPool reuses the networks instantiated from a Template, which
+// avoids creating and connecting the components for every request.
+//
+// A finished network is reused as a whole when all of its components
+// implement Resetter, its connections are reopened and the components
+// are reset. Otherwise only its resettable components are reused, see
+// Template.Release.
+type NetworkPool struct {
+	Template *Template
+
+	pool sync.Pool
+}
+
+// Get returns a network ready to run, either a reused one or a new
+// instance of the Template.
+func (p *NetworkPool) Get() (*Network, error) {
+	if net, ok := p.pool.Get().(*Network); ok {
+		return net, nil
+	}
+	return p.Template.Instance()
+}
+
+// Put returns a network from Get for reuse. The network must have
+// finished and must not be used afterwards.
+func (p *NetworkPool) Put(net *Network) {
+	if !net.reset() {
+		p.Template.Release(net)
+		return
+	}
+	p.pool.Put(net)
+}
+
+// reopener is implemented by the connections and ports, which can be
+// used again once the network has finished.
+type reopener interface {
+	reopen()
+}
+
+// reset prepares a finished network for running again. It reports false
+// without modifying the network when some of its components or
+// connections can't be reused.
+func (net *Network) reset() bool {
+	net.mu.Lock()
+	conns := make([]Connection, 0, len(net.conns))
+	for conn := range net.conns {
+		conns = append(conns, conn)
+	}
+	net.mu.Unlock()
+
+	for _, c := range net.components {
+		if !reusable(c) {
+			return false
+		}
+		for _, p := range portsOf(c) {
+			if _, ok := p.(reopener); !ok {
+				return false
+			}
+		}
+	}
+	for _, conn := range conns {
+		if _, ok := conn.(reopener); !ok {
+			return false
+		}
+	}
+
+	for _, conn := range conns {
+		conn.(reopener).reopen()
+	}
+	for _, c := range net.components {
+		for _, p := range portsOf(c) {
+			p.(reopener).reopen()
+		}
+		if r, ok := c.(Resetter); ok {
+			r.Reset()
+		}
+	}
+
+	net.mu.Lock()
+	net.draining = false
+	net.memoryState = nil
+	net.mu.Unlock()
+	net.lineage = sync.Map{}
+	return true
+}
+
+// reusable reports whether c can be reset, the components added by the
+// network for IIPs, values and bridges don't have any state.
+func reusable(c Component) bool {
+	switch c.(type) {
+	case Resetter, *iip, *valueFeed, *bridge:
+		return true
+	}
+	return false
+}
+
+func (conn *Conn[T]) reopen() {
+	var zero packet[T]
+	if conn.ring != nil {
+		for {
+			if _, ok := conn.ring.pop(); !ok {
+				break
+			}
+		}
+	}
+	for i := range conn.queue {
+		conn.queue[i] = zero
+	}
+	conn.queue = conn.queue[:0]
+	conn.traces = nil
+	conn.sender, conn.receiver = nil, nil
+	conn.data = make(chan packet[T])
+	conn.closed = sync.Once{}
+	conn.eos = false
+	atomic.StoreInt32(&conn.ended, 0)
+	atomic.StoreUint64(&conn.delivered, 0)
+	atomic.StoreUint64(&conn.filtered, 0)
+	atomic.StoreUint64(&conn.cancelled, 0)
+
+	// the ports outside of the components, e.g. of IIPs
+	from, to := conn.ports()
+	from.reopen()
+	to.reopen()
+}
+
+func (out *Out[T]) reopen() {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.closed = false
+	out.notify()
+	atomic.StoreUint32(&out.sent, 0)
+}
+
+func (in *In[T]) reopen() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.header = nil
+	in.notify()
+	atomic.StoreUint32(&in.received, 0)
+}
@@ -2,158 +2,302 @@ package flow
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
 type Network struct {
+	// Registry contains constructors for components created by Setup,
+	// in addition to the globally registered ones.
+	Registry Registry
+	// Values contains values that can be referenced as $values.Name.
+	Values Values
+	// Params contains the values of the parameters declared in graph
+	// definitions, see Param.
+	Params map[string]string
+	// Clock is given to the components through the context,
+	// see ClockFrom. By default the components use RealClock.
+	Clock Clock
+	// TrackOwnership enables checking that the components send only
+	// the packets they own, see OwnershipError. It's meant for
+	// debugging, as it slows down every Send and Recv of packets.
+	TrackOwnership bool
+	// TrackLineage makes the packets record the components they pass
+	// through, see In.Lineage. Like TrackOwnership, it's meant for
+	// debugging and must be set before the network is run.
+	TrackLineage bool
+	// Profiler traces a sample of the packets to measure the latencies
+	// between the components, see Profiler. It must be set before the
+	// network is run.
+	Profiler *Profiler
+	// Chaos randomly drops, duplicates and delays the packets sent by
+	// the components, see Chaos. It must be set before the network is
+	// run.
+	Chaos *Chaos
+	// ContextKeys selects the context values, e.g. the request ID, which
+	// the packets sent from outside of the components carry to the
+	// components, see In.Context. It must be set before the network is
+	// run, the keys must be comparable.
+	ContextKeys []any
+	// ContextDeadline makes the packets carry the deadline of the
+	// context they were sent with, like ContextKeys.
+	ContextDeadline bool
+	// ContextCancel makes the connections drop the packets, once the
+	// context they were sent with, or the one of the packet they derive
+	// from, is cancelled. See ContextKeys.
+	ContextCancel bool
+	// OnConnEvent is called when a connection is connected, closed or
+	// disconnected, e.g. to react to a source finishing. It's called
+	// synchronously by the goroutine making the change, hence it must
+	// not block nor use the ports of the connection.
+	OnConnEvent func(ConnEvent)
+	// OnStall is called when a component stalls, see WithStallTimeout.
+	OnStall func(StallEvent)
+	// StateStore keeps the state of the components, see LoadState.
+	// By default the state is kept in memory.
+	StateStore StateStore
+	// HealthTimeout limits the duration of the health checks,
+	// defaults to DefaultHealthTimeout, see Health.
+	HealthTimeout time.Duration
+	// ReadyTimeout limits the wait for the components implementing
+	// Readier, defaults to DefaultReadyTimeout.
+	ReadyTimeout time.Duration
+	// Scheduling controls how the components share the CPU,
+	// e.g. to keep a chatty connection from starving the others.
+	Scheduling Scheduling
+
 	components []Component
+	nodes      map[Name]Component
+	names      map[Component]Name
+
+	mu    sync.Mutex
+	conns map[Connection]struct{}
+	// running contains the running components by name.
+	running map[Name]*running
+	// replacing contains the components replacing the running ones.
+	replacing map[Component]*replacement
+	// draining is set while Shutdown waits for the components.
+	draining bool
+	// spawn starts a component while Run is running, active is the
+	// number of the components it's running, see Apply.
+	spawn  func(Component)
+	active int
+	// memoryState is the default StateStore.
+	memoryState *MemoryStateStore
+	// start holds the deliveries until the components are ready.
+	start startGate
+	// options contains the options of the components, see Configure.
+	options map[Component]*componentConfig
+	// lineage contains the header of the packet received last by each
+	// component, see Network.TrackLineage.
+	lineage sync.Map
+
+	debug stepper
+	seq   *scheduler
+	// shards contains the schedulers of the components by name,
+	// see RunSharded
+	shards map[string]*scheduler
 }
 
+// Add adds components to the network.
+//
+// The components are named after their type, e.g. the second *Upper
+// is named "Upper2".
 func (net *Network) Add(components ...Component) {
-	net.components = append(net.components, components...)
-}
-
-func (net *Network) Run(ctx context.Context) error {
-	var g errgroup.Group
-	for _, c := range net.components {
-		c := c
-		g.Go(func() error {
-			return c.Run(ctx)
-		})
+	for _, c := range components {
+		net.addNamed(net.uniqueName(typeName(c)), c)
 	}
-	return g.Wait()
 }
 
-type Component interface {
-	Run(ctx context.Context) error
+// Name returns the name of the component in the network.
+func (net *Network) Name(c Component) (Name, bool) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	name, ok := net.names[c]
+	return name, ok
 }
 
-type Conn[T any] struct {
-	from *Out[T]
-	to   *In[T]
+// Node returns the component with the specified name.
+func (net *Network) Node(name Name) (Component, bool) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	c, ok := net.nodes[name]
+	return c, ok
 }
 
-func Connect[T any](from *Out[T], to *In[T]) *Conn[T] {
-	conn := Conn[T]{}
-	conn.from = from
-	conn.to = to
-
-	data := make(chan T)
-	conn.from.swap(data)
-	conn.to.swap(data)
+// Connections returns all the active connections between the components.
+func (net *Network) Connections() []Connection {
+	net.mu.Lock()
+	defer net.mu.Unlock()
 
-	return &conn
+	conns := make([]Connection, 0, len(net.conns))
+	for conn := range net.conns {
+		conns = append(conns, conn)
+	}
+	return conns
 }
 
-func (conn *Conn[T]) Disconnect() {
-	conn.from.swap(nil)
-	conn.to.swap(nil)
+// ConnStats contains the statistics of a connection.
+type ConnStats struct {
+	// Name is the name of the connection, e.g. "a.Out -> b.In".
+	Name string
+	// Packets is the number of packets delivered to the receiver,
+	// for acknowledged connections the number of acknowledged packets.
+	Packets uint64
 }
 
-type In[T any] struct {
-	// TODO: support multiple inbound channels
-
-	mu   sync.Mutex
-	data chan T
-	ping chan struct{}
-
-	create sync.Once
+// counter is implemented by connections that count delivered packets.
+type counter interface {
+	packets() uint64
 }
 
-func (in *In[T]) init() { in.create.Do(func() { in.ping = make(chan struct{}) })}
-
-func (in *In[T]) swap(data chan T) {
-	in.init()
-
-	in.mu.Lock()
-	in.data = data
-	in.mu.Unlock()
+// Stats returns the statistics of the active connections sorted by name.
+func (net *Network) Stats() []ConnStats {
+	var stats []ConnStats
+	for _, conn := range net.Connections() {
+		c, ok := conn.(counter)
+		if !ok {
+			continue
+		}
+		stats = append(stats, ConnStats{Name: conn.String(), Packets: c.packets()})
+	}
+	sort.Slice(stats, func(i, k int) bool { return stats[i].Name < stats[k].Name })
+	return stats
+}
 
-	select{
-	case in.ping<-struct{}{}:
-	default:
+// Unconnected returns the sorted names of the ports of the components,
+// which are not connected.
+func (net *Network) Unconnected() []string {
+	var names []string
+	for _, c := range net.components {
+		for _, p := range portsOf(c) {
+			if conn, ok := p.(interface{ Connected() bool }); ok && !conn.Connected() {
+				names = append(names, portName(p.boundTo()))
+			}
+		}
 	}
+	sort.Strings(names)
+	return names
 }
 
-func (in *In[T]) current() chan T {
-	in.mu.Lock()
-	defer in.mu.Unlock()
-	return in.data
+// AddNamed adds a component with the specified name to the network.
+func (net *Network) AddNamed(name Name, c Component) error {
+	if _, exists := net.nodes[name]; exists {
+		return fmt.Errorf("node %s already exists", name)
+	}
+	net.addNamed(name, c)
+	return nil
 }
 
-func (in *In[T]) Recv(ctx context.Context) (T, error) {
-	var zero T
-	if err := ctx.Err(); err != nil {
-		return zero, err
+func (net *Network) addNamed(name Name, c Component) {
+	if net.nodes == nil {
+		net.nodes = make(map[Name]Component)
+		net.names = make(map[Component]Name)
 	}
-	in.init()
+	net.nodes[name] = c
+	net.names[c] = name
+	net.components = append(net.components, c)
 
-	for {
-		select {
-		case <-in.ping:
-		default:
-		}
+	for field, p := range portsOf(c) {
+		p.bind(binding{net: net, name: string(name) + "." + field})
+	}
+}
 
-		select {
-		case <-ctx.Done():
-			return zero, ctx.Err()
-		case v := <-in.current():
-			return v, nil
-		case <-in.ping:
+func (net *Network) uniqueName(base string) Name {
+	name := Name(base)
+	for i := 2; ; i++ {
+		if _, exists := net.nodes[name]; !exists {
+			return name
 		}
+		name = Name(base + strconv.Itoa(i))
 	}
 }
 
-type Out[T any] struct {
-	mu   sync.Mutex
-	data chan T
-	ping chan struct{}
-
-	create sync.Once
+func (net *Network) register(conn Connection) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	if net.conns == nil {
+		net.conns = make(map[Connection]struct{})
+	}
+	net.conns[conn] = struct{}{}
 }
 
-func (out *Out[T]) init() { out.create.Do(func() { out.ping = make(chan struct{}) })}
-
-func (out *Out[T]) swap(data chan T) {
-	out.init()
-
-	out.mu.Lock()
-	out.data = data
-	out.mu.Unlock()
-
-	select{
-	case out.ping<-struct{}{}:
-	default:
-	}
+func (net *Network) unregister(conn Connection) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	delete(net.conns, conn)
 }
 
-func (out *Out[T]) current() chan T {
-	out.mu.Lock()
-	defer out.mu.Unlock()
-	return out.data
+// typeName returns the name of the type without the package and pointers.
+func typeName(c Component) string {
+	t := reflect.TypeOf(unwrap(c))
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return "component"
+	}
+	return t.Name()
 }
 
-func (out *Out[T]) Send(ctx context.Context, v T) error {
-	if err := ctx.Err(); err != nil {
+// Run runs all the components until they return.
+//
+// Components implementing Initializer are initialized before any of them
+// starts and components implementing Shutdowner are shut down after all
+// of them have stopped. No packets are delivered until the components
+// implementing Readier are ready, the network is stopped when they
+// aren't ready within ReadyTimeout.
+func (net *Network) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(net.withClock(ctx))
+	defer cancel()
+	if err := net.initialize(ctx); err != nil {
 		return err
 	}
 
-	out.init()
-
-	for {
-		select {
-		case <-out.ping:
-		default:
+	await := net.hold()
+	var g errgroup.Group
+	net.mu.Lock()
+	net.spawn = func(c Component) {
+		net.active++
+		g.Go(func() error {
+			defer net.exited()
+			return net.run(ctx, c, nil)
+		})
+	}
+	for _, c := range net.components {
+		net.spawn(c)
+	}
+	net.mu.Unlock()
+	var readyErr error
+	g.Go(func() error {
+		if readyErr = await(ctx); readyErr != nil {
+			cancel()
 		}
+		return nil
+	})
+	err := g.Wait()
+	net.mu.Lock()
+	net.spawn = nil
+	net.mu.Unlock()
+	if readyErr != nil {
+		err = readyErr
+	}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case out.current() <- v:
-			return nil
-		case <-out.ping:
-		}
+	if downErr := shutdown(ctx, net.components); err == nil {
+		err = downErr
 	}
+	return err
+}
+
+// Component is a process in the network.
+//
+// Optionally it can implement Initializer and Shutdowner.
+type Component interface {
+	Run(ctx context.Context) error
 }
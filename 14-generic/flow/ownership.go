@@ -0,0 +1,124 @@
+package flow
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// OwnershipError reports a component sending a packet it doesn't own,
+// see Network.TrackOwnership.
+type OwnershipError struct {
+	// Component is the component that sent the packet.
+	Component string
+	// Owner is the component owning the packet,
+	// empty when the packet has been released.
+	Owner string
+	// InTransit is set when Owner has sent the packet,
+	// which hasn't been received yet.
+	InTransit bool
+}
+
+func (err *OwnershipError) Error() string {
+	switch {
+	case err.Owner == "":
+		return err.Component + " sent a released packet"
+	case err.InTransit:
+		return err.Component + " sent a packet already sent by " + err.Owner
+	default:
+		return err.Component + " sent a packet owned by " + err.Owner + ", use after send"
+	}
+}
+
+// ownership tracks the owner of a packet.
+type ownership struct {
+	mu sync.Mutex
+	// owner is the component owning the packet,
+	// empty until the packet is sent for the first time.
+	owner     string
+	inTransit bool
+	released  bool
+}
+
+// tracked is implemented by packets with an owner.
+type tracked interface {
+	ownership() *ownership
+}
+
+// reset starts tracking a packet from a pool.
+func (own *ownership) reset() {
+	own.mu.Lock()
+	own.owner, own.inTransit, own.released = "", false, false
+	own.mu.Unlock()
+}
+
+func (own *ownership) release() {
+	own.mu.Lock()
+	own.owner, own.inTransit, own.released = "", false, true
+	own.mu.Unlock()
+}
+
+// send checks that the sender owns the packet and marks it in transit.
+func (own *ownership) send(sender string) error {
+	own.mu.Lock()
+	defer own.mu.Unlock()
+	switch {
+	case own.released:
+		return &OwnershipError{Component: sender}
+	case own.owner != "" && (own.owner != sender || own.inTransit):
+		return &OwnershipError{Component: sender, Owner: own.owner, InTransit: own.inTransit}
+	}
+	own.owner, own.inTransit = sender, true
+	return nil
+}
+
+// unsent returns the packet to the sender after a failed Send.
+func (own *ownership) unsent(sender string) {
+	own.mu.Lock()
+	if own.owner == sender {
+		own.inTransit = false
+	}
+	own.mu.Unlock()
+}
+
+// receive transfers the packet to the receiver.
+func (own *ownership) receive(receiver string) {
+	own.mu.Lock()
+	own.owner, own.inTransit = receiver, false
+	own.mu.Unlock()
+}
+
+// tracking reports whether the network of the port tracks ownership.
+func (b binding) tracking() bool { return b.net != nil && b.net.TrackOwnership }
+
+// component returns the name of the component from the port name.
+func (b binding) component() string {
+	name, _, _ := strings.Cut(portName(b), ".")
+	return name
+}
+
+func (out *Out[T]) sendTracked(ctx context.Context, v T, priority int) error {
+	p, ok := any(v).(tracked)
+	if !ok {
+		return out.send(ctx, v, priority)
+	}
+	sender := out.bound.component()
+	if err := p.ownership().send(sender); err != nil {
+		return err
+	}
+	err := out.send(ctx, v, priority)
+	if err != nil {
+		p.ownership().unsent(sender)
+	}
+	return err
+}
+
+func (in *In[T]) recvTracked(ctx context.Context) (T, error) {
+	v, err := in.recv(ctx)
+	if err == nil {
+		if p, ok := any(v).(tracked); ok {
+			p.ownership().receive(in.bound.component())
+		}
+	}
+	return v, err
+}
@@ -0,0 +1,57 @@
+package flow
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Param is a parameter declared in a graph definition:
+//
+//	param COUNT = 10
+//	param TOPIC
+//
+// Parameters are referenced in IIPs as ${COUNT}. The value is taken from
+// Network.Params, then from the environment variable with the same name
+// and finally from the default. A parameter without a default must be
+// given a value.
+type Param struct {
+	Name     string
+	Default  string
+	Required bool
+	Pos      Pos
+}
+
+var rxParamRef = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// Param returns the value of a declared parameter, values take
+// precedence over the environment.
+func (w *Wiring) Param(name string, values map[string]string) (string, error) {
+	decl, ok := w.Params[name]
+	if !ok {
+		return "", fmt.Errorf("param %s is not declared", name)
+	}
+	if v, ok := values[name]; ok {
+		return v, nil
+	}
+	if v, ok := os.LookupEnv(name); ok {
+		return v, nil
+	}
+	if decl.Required {
+		return "", fmt.Errorf("param %s requires a value", name)
+	}
+	return decl.Default, nil
+}
+
+// ExpandParams replaces the parameter references in s.
+func (w *Wiring) ExpandParams(s string, values map[string]string) (string, error) {
+	var err error
+	expanded := rxParamRef.ReplaceAllStringFunc(s, func(ref string) string {
+		v, perr := w.Param(rxParamRef.FindStringSubmatch(ref)[1], values)
+		if perr != nil && err == nil {
+			err = perr
+		}
+		return v
+	})
+	return expanded, err
+}
@@ -0,0 +1,284 @@
+package flow
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*
+	A graph definition consists of declarations, connections and
+	includes, one statement per line:
+
+		# comments start with a hash
+		include "common.fbp"
+		param COUNT = 10
+
+		: gen Generator
+		: upper Upper@1.2
+		: print Printer
+
+		gen.Out -> upper.In upper.Out -> print.In
+		'${COUNT}' -> COUNT gen
+
+		export print.Done as DONE
+
+	A line may chain several connections, each of them starts from the
+	node port following the previous target. Included files are resolved
+	relative to the including file and may declare the same node with
+	the same type more than once. Exports are used by subgraphs,
+	see NewSubgraph.
+
+	A declaration may pin the version of the component type and its
+	ports, see Pin.
+
+	A feedback connection, which leads from downstream back upstream,
+	is written with ~> and buffered, see WithFeedback. Network.Validate
+	reports the cycles without one.
+*/
+
+var (
+	rxDecl     = regexp.MustCompile(`^:\s+([$\w]+)\s+([\w]+)(?:@(v?\d+(?:\.\d+){0,2}))?(?:\s+ports=([0-9a-f]+))?$`)
+	rxInclude  = regexp.MustCompile(`^include\s+"([^"]+)"$`)
+	rxExport   = regexp.MustCompile(`^export\s+([$\w]+)\.(\w+(?:\[[\w.-]+\])?)\s+as\s+(\w+)$`)
+	rxParam    = regexp.MustCompile(`^param\s+(\w+)(?:\s*=\s*(.*))?$`)
+	rxEndpoint = regexp.MustCompile(`^([$\w]+)\.(\w+(?:\[[\w.-]+\])?)$`)
+	rxIIPStart = regexp.MustCompile(`^'((?:[^'\\]|\\.)*)'\s*`)
+	rxClassic  = regexp.MustCompile(`^(\w+(?:\[[\w.-]+\])?)\s+([$\w]+)$`)
+	rxToken    = regexp.MustCompile(`->|(?:[^\s-]|-[^\s>])+`)
+)
+
+// ParseWiring parses a graph definition.
+// Includes are resolved relative to the working directory.
+//
+// Any input is safe to parse: a malformed definition results in a
+// WiringError with the position of the offending statement.
+func ParseWiring(def string) (*Wiring, error) {
+	p := newParser()
+	if err := p.parse(def, "", ""); err != nil {
+		return nil, err
+	}
+	return p.wiring, nil
+}
+
+// ParseWiringFile parses a graph definition from a file.
+func ParseWiringFile(path string) (*Wiring, error) {
+	p := newParser()
+	if err := p.include(path, Pos{}); err != nil {
+		return nil, err
+	}
+	return p.wiring, nil
+}
+
+type parser struct {
+	wiring *Wiring
+	// including contains the files being parsed to detect cycles.
+	including []string
+}
+
+func newParser() *parser {
+	return &parser{wiring: &Wiring{
+		Decls:  make(map[Name]Type),
+		Params: make(map[string]Param),
+		Pins:   make(map[Name]Pin),
+	}}
+}
+
+func (p *parser) include(path string, at Pos) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return WiringError{Pos: at, Err: err}
+	}
+	for _, file := range p.including {
+		if file == abs {
+			return WiringError{Pos: at, Err: fmt.Errorf("include cycle with %s", path)}
+		}
+	}
+
+	// devices and pipes could block or never end
+	if info, err := os.Stat(path); err != nil {
+		return WiringError{Pos: at, Err: err}
+	} else if !info.Mode().IsRegular() {
+		return WiringError{Pos: at, Err: fmt.Errorf("include %s: not a regular file", path)}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return WiringError{Pos: at, Err: err}
+	}
+
+	p.including = append(p.including, abs)
+	defer func() { p.including = p.including[:len(p.including)-1] }()
+	return p.parse(string(data), path, filepath.Dir(path))
+}
+
+// parse parses the definition from file, dir is used for resolving includes.
+func (p *parser) parse(def, file, dir string) error {
+	lineno := 0
+	line := bufio.NewScanner(strings.NewReader(def))
+	for line.Scan() {
+		lineno++
+		text := stripComment(line.Text())
+		stmt := strings.TrimSpace(text)
+		if len(stmt) == 0 {
+			continue
+		}
+		pos := Pos{File: file, Line: lineno, Col: strings.Index(text, stmt) + 1}
+
+		switch {
+		case stmt[0] == ':':
+			xs := rxDecl.FindStringSubmatch(stmt)
+			if xs == nil {
+				return WiringError{Pos: pos, Err: errors.New("invalid line: " + stmt)}
+			}
+			name, typ := Name(xs[1]), Type(xs[2])
+			if prev, ok := p.wiring.Decls[name]; ok && prev != typ {
+				return WiringError{Pos: pos, Err: fmt.Errorf("node %s already declared as %s", name, prev)}
+			}
+			p.wiring.Decls[name] = typ
+			if pin := (Pin{Version: xs[3], Ports: xs[4], Pos: pos}); pin != (Pin{Pos: pos}) {
+				if prev, ok := p.wiring.Pins[name]; ok && prev.String() != pin.String() {
+					return WiringError{Pos: pos, Err: fmt.Errorf("node %s already pinned to %s%s", name, typ, prev)}
+				}
+				p.wiring.Pins[name] = pin
+			}
+
+		case isKeyword(stmt, "include"):
+			xs := rxInclude.FindStringSubmatch(stmt)
+			if xs == nil {
+				return WiringError{Pos: pos, Err: errors.New("invalid line: " + stmt)}
+			}
+			path := xs[1]
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			if err := p.include(path, pos); err != nil {
+				return err
+			}
+
+		case isKeyword(stmt, "export"):
+			xs := rxExport.FindStringSubmatch(stmt)
+			if xs == nil {
+				return WiringError{Pos: pos, Err: errors.New("invalid line: " + stmt)}
+			}
+			p.wiring.Exports = append(p.wiring.Exports, Export{
+				Node: Name(xs[1]),
+				Port: PortName(xs[2]),
+				As:   PortName(xs[3]),
+				Pos:  pos,
+			})
+
+		case isKeyword(stmt, "param"):
+			xs := rxParam.FindStringSubmatch(stmt)
+			if xs == nil {
+				return WiringError{Pos: pos, Err: errors.New("invalid line: " + stmt)}
+			}
+			param := Param{Name: xs[1], Default: strings.TrimSpace(xs[2]), Required: xs[2] == "", Pos: pos}
+			if prev, ok := p.wiring.Params[param.Name]; ok && prev.Default != param.Default {
+				return WiringError{Pos: pos, Err: fmt.Errorf("param %s already declared at %v", param.Name, prev.Pos)}
+			}
+			p.wiring.Params[param.Name] = param
+
+		default:
+			wires, err := parseChain(stmt, pos)
+			if err != nil {
+				return err
+			}
+			p.wiring.Wires = append(p.wiring.Wires, wires...)
+		}
+	}
+	if err := line.Err(); err != nil {
+		return WiringError{Pos: Pos{File: file, Line: lineno + 1, Col: 1}, Err: err}
+	}
+	return nil
+}
+
+// isKeyword reports whether the statement starts with the keyword.
+func isKeyword(stmt, keyword string) bool {
+	rest := strings.TrimPrefix(stmt, keyword)
+	return len(rest) < len(stmt) && rest != "" && (rest[0] == ' ' || rest[0] == '\t')
+}
+
+// parseChain parses one or more chained connections.
+func parseChain(stmt string, pos Pos) ([]Wire, error) {
+	invalid := WiringError{Pos: pos, Err: errors.New("invalid line: " + stmt)}
+
+	var wires []Wire
+	rest, offset := stmt, 0
+	if xs := rxIIPStart.FindStringSubmatchIndex(stmt); xs != nil {
+		rest, offset = stmt[xs[1]:], xs[1]
+		if !strings.HasPrefix(rest, "->") {
+			return nil, invalid
+		}
+		rest, offset = rest[2:], offset+2
+
+		wire := Wire{From: IIPNode, IIP: unescapeIIP(stmt[xs[2]:xs[3]]), Pos: pos}
+		// the classic form can't be chained
+		if ys := rxClassic.FindStringSubmatch(strings.TrimSpace(rest)); ys != nil {
+			wire.To, wire.Dst = Name(ys[2]), PortName(ys[1])
+			return append(wires, wire), nil
+		}
+
+		tokens := rxToken.FindAllStringIndex(rest, -1)
+		if len(tokens) == 0 {
+			return nil, invalid
+		}
+		ys := rxEndpoint.FindStringSubmatch(rest[tokens[0][0]:tokens[0][1]])
+		if ys == nil {
+			return nil, invalid
+		}
+		wire.To, wire.Dst = Name(ys[1]), PortName(ys[2])
+		wires = append(wires, wire)
+		rest, offset = rest[tokens[0][1]:], offset+tokens[0][1]
+	}
+
+	// the remaining tokens are triples of source, arrow and target
+	tokens := rxToken.FindAllStringIndex(rest, -1)
+	if len(tokens)%3 != 0 || (len(tokens) == 0 && len(wires) == 0) {
+		return nil, invalid
+	}
+	for i := 0; i < len(tokens); i += 3 {
+		src := rxEndpoint.FindStringSubmatch(rest[tokens[i][0]:tokens[i][1]])
+		arrow := rest[tokens[i+1][0]:tokens[i+1][1]]
+		dst := rxEndpoint.FindStringSubmatch(rest[tokens[i+2][0]:tokens[i+2][1]])
+		if src == nil || (arrow != "->" && arrow != "~>") || dst == nil {
+			return nil, invalid
+		}
+
+		at := pos
+		at.Col += offset + tokens[i][0]
+		wires = append(wires, Wire{
+			From: Name(src[1]),
+			Src:  PortName(src[2]),
+			To:   Name(dst[1]),
+			Dst:  PortName(dst[2]),
+			Pos:  at,
+
+			Feedback: arrow == "~>",
+		})
+	}
+	return wires, nil
+}
+
+// stripComment removes the comment outside of IIP literals from the line.
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '\'':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
@@ -0,0 +1,97 @@
+package flow_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"fbp.example/flow"
+)
+
+// exampleGraphs are the graph definitions from the documentation.
+var exampleGraphs = []string{
+	`# comments start with a hash
+param COUNT = 10
+
+: gen Generator
+: upper Upper@1.2
+: print Printer
+
+gen.Out -> upper.In upper.Out -> print.In
+'${COUNT}' -> COUNT gen
+
+export print.Done as DONE
+`,
+	`: s Split
+: u Upper
+s.Left -> u.In
+
+export s.In as IN
+export u.Out as OUT
+`,
+	`param COUNT = 10
+param TOPIC
+: gen Generator@1.2 ports=5d0e8a3c
+'${TOPIC}' -> gen.Topic
+$values.Name -> gen.Prefix
+`,
+	`: a Retry
+: b Worker
+a.Out -> b.In
+b.Failed ~> a.Retry
+'{"a":1}' -> a.Config
+'it\'s \\' -> b.Prefix
+`,
+	`include "common.fbp"`,
+	"   : a X@1.2\n",
+}
+
+// FuzzParse checks that parsing never panics, that every error is
+// a WiringError and that formatting a definition doesn't change its
+// meaning.
+func FuzzParse(f *testing.F) {
+	for _, def := range exampleGraphs {
+		f.Add(def)
+	}
+	f.Fuzz(func(t *testing.T, def string) {
+		wiring, err := flow.ParseWiring(def)
+		formatted, ferr := flow.FormatWiring([]byte(def))
+		if err != nil {
+			var werr flow.WiringError
+			if !errors.As(err, &werr) {
+				t.Fatalf("parse error is %T: %v", err, err)
+			}
+			return
+		}
+		if ferr != nil {
+			t.Fatalf("format failed on a valid definition: %v", ferr)
+		}
+
+		reparsed, err := flow.ParseWiring(string(formatted))
+		if err != nil {
+			t.Fatalf("formatted definition is invalid: %v\n%s", err, formatted)
+		}
+		if !reflect.DeepEqual(withoutPos(wiring), withoutPos(reparsed)) {
+			t.Fatalf("formatting changed the definition:\n%s\n%s", def, formatted)
+		}
+	})
+}
+
+// withoutPos clears the positions, which change with formatting.
+func withoutPos(w *flow.Wiring) *flow.Wiring {
+	for i := range w.Wires {
+		w.Wires[i].Pos = flow.Pos{}
+	}
+	for i := range w.Exports {
+		w.Exports[i].Pos = flow.Pos{}
+	}
+	for name, param := range w.Params {
+		param.Pos = flow.Pos{}
+		w.Params[name] = param
+	}
+	for name, pin := range w.Pins {
+		pin.Pos = flow.Pos{}
+		w.Pins[name] = pin
+	}
+	return w
+}
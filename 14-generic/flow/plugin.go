@@ -0,0 +1,79 @@
+package flow
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"sync"
+)
+
+var plugins struct {
+	sync.Mutex
+	loaded map[string]bool
+}
+
+// LoadPlugin loads components from a Go plugin built with
+// go build -buildmode=plugin.
+//
+// The plugin registers its components with Register in init, the same
+// way integrations do. Alternatively it can export a registry:
+//
+//	var Components = flow.Registry{
+//		"Upper": func() flow.Component { return &Upper{} },
+//	}
+//
+// The plugin must be built with the same Go version and the same version
+// of this module as the binary loading it. Loading the same plugin again
+// does nothing. Go plugins are supported only on some platforms, see
+// package plugin.
+func LoadPlugin(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	plugins.Lock()
+	defer plugins.Unlock()
+	if plugins.loaded[abs] {
+		return nil
+	}
+
+	p, err := plugin.Open(abs)
+	if err != nil {
+		return err
+	}
+	if plugins.loaded == nil {
+		plugins.loaded = make(map[string]bool)
+	}
+	plugins.loaded[abs] = true
+
+	sym, err := p.Lookup("Components")
+	if err != nil {
+		// the plugin registered the components itself
+		return nil
+	}
+	var components Registry
+	switch sym := sym.(type) {
+	case *Registry:
+		components = *sym
+	case Registry:
+		components = sym
+	default:
+		return fmt.Errorf("plugin %s: Components is %T, expected flow.Registry", path, sym)
+	}
+
+	registered.Lock()
+	defer registered.Unlock()
+	for typ := range components {
+		if _, dup := registered.registry[typ]; dup {
+			return fmt.Errorf("plugin %s: type %s already registered", path, typ)
+		}
+	}
+	if registered.registry == nil {
+		registered.registry = make(Registry)
+	}
+	for typ, mk := range components {
+		registered.registry[typ] = mk
+	}
+	return nil
+}
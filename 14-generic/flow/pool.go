@@ -0,0 +1,92 @@
+package flow
+
+import "sync"
+
+/*
+	Packets from a PacketPool follow the FBP ownership rules: a packet
+	is owned by exactly one component at a time.
+
+	The component that calls Get owns the packet. A successful Send
+	transfers the ownership to the receiver, after which the sender
+	must not use the packet anymore. When Send fails, the sender still
+	owns the packet.
+
+	The owner either sends the packet on or calls Release, once it's
+	done with it. Release returns the packet to the pool, where the next
+	Get may hand it to any other component. A packet that is dropped
+	without Release is collected by the GC as usual, it just isn't
+	reused.
+
+	Components that don't know the type of their values, such as
+	filters, should call the package-level Release on the values they
+	drop.
+
+	The rules can be checked with Network.TrackOwnership, which makes
+	Send fail with an OwnershipError when a component sends a packet it
+	has already sent or released.
+*/
+
+// Packet is a value from a PacketPool, see Get.
+type Packet[T any] struct {
+	Value T
+
+	pool *PacketPool[T]
+	own  ownership
+	// pooled is set once the packet has come from a pool
+	pooled bool
+}
+
+func (p *Packet[T]) ownership() *ownership { return &p.own }
+
+// Release returns the packet to its pool, it does nothing for a packet
+// that isn't from a pool. The packet must not be used after Release,
+// releasing a packet twice panics.
+func (p *Packet[T]) Release() {
+	pool := p.pool
+	if pool == nil {
+		if !p.pooled {
+			return
+		}
+		panic("flow: packet released twice")
+	}
+	p.pool = nil
+	p.own.release()
+	if pool.Reset != nil {
+		pool.Reset(&p.Value)
+	} else {
+		var zero T
+		p.Value = zero
+	}
+	pool.pool.Put(p)
+}
+
+// PacketPool reuses packets, so that high-throughput graphs sending
+// large structs don't allocate a new one for every value.
+//
+// The zero value is ready to use.
+type PacketPool[T any] struct {
+	// Reset prepares the value of a released packet for reuse,
+	// by default the value is zeroed. It can be used to keep the
+	// capacity of slices and maps in the value.
+	Reset func(v *T)
+
+	pool sync.Pool
+}
+
+// Get returns a packet owned by the caller.
+func (pool *PacketPool[T]) Get() *Packet[T] {
+	p, ok := pool.pool.Get().(*Packet[T])
+	if !ok {
+		p = &Packet[T]{}
+	}
+	p.pool, p.pooled = pool, true
+	p.own.reset()
+	return p
+}
+
+// Release releases v when it can be released, such as a pooled packet.
+func Release(v any) {
+	if p, ok := v.(interface{ Release() }); ok {
+		p.Release()
+	}
+}
@@ -0,0 +1,441 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// EOS is returned by In.Recv when the upstream connection has been
+// closed and every value has been received.
+var EOS = errors.New("end of stream")
+
+// ErrClosed is returned when sending to a closed Out.
+var ErrClosed = errors.New("send on closed port")
+
+// binding associates a port with the network it was added to.
+type binding struct {
+	net   *Network
+	name  string
+	limit *limiter
+}
+
+// In is an input port of a component.
+//
+// An In has at most one upstream connection, several streams are
+// combined with a component such as std.Merge.
+type In[T any] struct {
+	mu      sync.Mutex
+	conn    *Conn[T]
+	changed chan struct{}
+	bound   binding
+	// header is the header of the value received last,
+	// see Network.TrackLineage.
+	header *header
+
+	// waiting is the number of goroutines blocked in Recv.
+	waiting int32
+	// received counts completed Recv calls.
+	received uint32
+}
+
+func (in *In[T]) attach(conn *Conn[T]) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	in.conn = conn
+	in.notify()
+}
+
+// attachFirst attaches conn, unless the In is already connected.
+func (in *In[T]) attachFirst(conn *Conn[T]) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.conn != nil {
+		return false
+	}
+	in.conn = conn
+	in.notify()
+	return true
+}
+
+func (in *In[T]) detach(conn *Conn[T]) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.conn == conn {
+		in.conn = nil
+		in.notify()
+	}
+}
+
+// notify wakes up everyone waiting on the current connection.
+func (in *In[T]) notify() {
+	if in.changed != nil {
+		close(in.changed)
+		in.changed = nil
+	}
+}
+
+// current returns the active connection and a channel that is closed
+// when the connection is replaced.
+func (in *In[T]) current() (*Conn[T], chan struct{}) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.changed == nil {
+		in.changed = make(chan struct{})
+	}
+	return in.conn, in.changed
+}
+
+// Connected reports whether the In is currently connected to an Out.
+func (in *In[T]) Connected() bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.conn != nil
+}
+
+// Recv waits for the next value.
+//
+// Once the upstream has been closed and drained Recv returns EOS.
+func (in *In[T]) Recv(ctx context.Context) (T, error) {
+	if in.bound.tracking() {
+		return in.recvTracked(ctx)
+	}
+	return in.recv(ctx)
+}
+
+func (in *In[T]) recv(ctx context.Context) (T, error) {
+	for {
+		v, err := in.recvOnce(ctx)
+		if err != errCancelled {
+			return v, err
+		}
+		in.dropCancelled(v)
+	}
+}
+
+func (in *In[T]) recvOnce(ctx context.Context) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	if conn, _ := in.current(); conn != nil {
+		if p, ok := conn.takeRestored(); ok {
+			in.bound.yield(atomic.AddUint32(&in.received, 1))
+			return p.value, nil
+		}
+	}
+
+	if s := in.bound.sequential(); s != nil {
+		conn, _ := in.current()
+		if conn == nil {
+			// nothing will ever arrive
+			return zero, s.park()
+		}
+		if !conn.local(s) {
+			// the sender runs in another shard
+			if conn.recvBlocks() {
+				defer s.enter(s.leave())
+			}
+			return in.recvConcurrent(ctx)
+		}
+		p, err := conn.recvSequential(s)
+		if err != nil {
+			return p.value, err
+		}
+		if in.bound.headers() && !in.receivedHeader(ctx, p.header) {
+			return p.value, errCancelled
+		}
+		s.transferred(&in.bound.net.Scheduling)
+		return p.value, nil
+	}
+	return in.recvConcurrent(ctx)
+}
+
+// recvConcurrent receives a value when the components run concurrently.
+func (in *In[T]) recvConcurrent(ctx context.Context) (T, error) {
+	var zero T
+	limit := in.bound.limit
+	if limit != nil {
+		limit.release()
+	}
+
+	atomic.AddInt32(&in.waiting, 1)
+	for {
+		conn, changed := in.current()
+		if conn != nil && conn.ring != nil {
+			p, ok, err := conn.pop(ctx, changed)
+			if !ok && err == nil {
+				continue
+			}
+			atomic.AddInt32(&in.waiting, -1)
+			if err != nil && err != EOS {
+				return zero, err
+			}
+			in.bound.yield(atomic.AddUint32(&in.received, 1))
+			if err == EOS {
+				return zero, EOS
+			}
+			dropped := in.bound.headers() && !in.receivedHeader(ctx, p.header)
+			if limit != nil {
+				if err := limit.acquire(ctx); err != nil {
+					return zero, err
+				}
+			}
+			if dropped {
+				return p.value, errCancelled
+			}
+			return p.value, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			atomic.AddInt32(&in.waiting, -1)
+			return zero, ctx.Err()
+		case p, ok := <-conn.channel():
+			// waiting must be updated before received,
+			// see Network.Step for details
+			atomic.AddInt32(&in.waiting, -1)
+			in.bound.yield(atomic.AddUint32(&in.received, 1))
+			if !ok {
+				return zero, EOS
+			}
+			dropped := in.bound.headers() && !in.receivedHeader(ctx, p.header)
+			if limit != nil {
+				if err := limit.acquire(ctx); err != nil {
+					return zero, err
+				}
+			}
+			if dropped {
+				return p.value, errCancelled
+			}
+			return p.value, nil
+		case <-changed:
+		}
+	}
+}
+
+type Out[T any] struct {
+	mu      sync.Mutex
+	conn    *Conn[T]
+	changed chan struct{}
+	closed  bool
+	bound   binding
+
+	// waiting is the number of goroutines blocked in Send.
+	waiting int32
+	// sent counts completed Send calls.
+	sent uint32
+}
+
+func (out *Out[T]) attach(conn *Conn[T]) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	// a closed output immediately ends any new connection
+	if out.closed {
+		conn.close()
+	}
+
+	out.conn = conn
+	out.notify()
+}
+
+func (out *Out[T]) detach(conn *Conn[T]) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if out.conn == conn {
+		out.conn = nil
+		out.notify()
+	}
+}
+
+// notify wakes up everyone waiting on the current connection.
+func (out *Out[T]) notify() {
+	if out.changed != nil {
+		close(out.changed)
+		out.changed = nil
+	}
+}
+
+// current returns the active connection and a channel that is closed
+// when the connection is replaced.
+func (out *Out[T]) current() (*Conn[T], chan struct{}, bool) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if out.changed == nil {
+		out.changed = make(chan struct{})
+	}
+	return out.conn, out.changed, out.closed
+}
+
+// Connected reports whether the Out is currently connected to an In.
+func (out *Out[T]) Connected() bool {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return out.conn != nil
+}
+
+// Queued returns the number of values waiting in the connection to be
+// received, zero when the Out is not connected.
+func (out *Out[T]) Queued() int {
+	out.mu.Lock()
+	conn := out.conn
+	out.mu.Unlock()
+	if conn == nil {
+		return 0
+	}
+	return conn.queued()
+}
+
+// Send waits until v is delivered to the connected In,
+// or queued when the connection uses a ring buffer.
+func (out *Out[T]) Send(ctx context.Context, v T) error {
+	return out.SendPriority(ctx, v, 0)
+}
+
+// sendChecked sends v, checking its ownership when it's tracked.
+func (out *Out[T]) sendChecked(ctx context.Context, v T, priority int) error {
+	if out.bound.tracking() {
+		return out.sendTracked(ctx, v, priority)
+	}
+	return out.send(ctx, v, priority)
+}
+
+func (out *Out[T]) send(ctx context.Context, v T, priority int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if conn, _, _ := out.current(); conn != nil {
+		if conn.filter != nil && !conn.filter(v) {
+			return conn.diverted(ctx, v)
+		}
+		if conn.mapper != nil {
+			v = conn.mapper(v)
+		}
+	}
+	p := packet[T]{value: v, priority: priority}
+	if out.bound.headers() {
+		p.header = out.bound.outgoing(ctx)
+		if p.header.cancelled() {
+			return out.dropCancelled(v)
+		}
+	}
+
+	if s := out.bound.sequential(); s != nil {
+		conn, _, closed := out.current()
+		if closed {
+			return ErrClosed
+		}
+		if conn == nil {
+			// nothing will ever receive it
+			return s.park()
+		}
+		if !conn.local(s) {
+			// the receiver runs in another shard
+			if conn.sendBlocks() {
+				defer s.enter(s.leave())
+			}
+			return out.sendConcurrent(ctx, p)
+		}
+		if conn.rate != nil {
+			if err := conn.rate.take(ctx); err != nil {
+				return err
+			}
+		}
+		if err := conn.sendSequential(s, p); err != nil {
+			return err
+		}
+		atomic.AddUint32(&out.sent, 1)
+		s.transferred(&out.bound.net.Scheduling)
+		return nil
+	}
+	return out.sendConcurrent(ctx, p)
+}
+
+// sendConcurrent sends p when the components run concurrently.
+func (out *Out[T]) sendConcurrent(ctx context.Context, p packet[T]) error {
+	atomic.AddInt32(&out.waiting, 1)
+	defer atomic.AddInt32(&out.waiting, -1)
+	var throttled *Conn[T]
+	for {
+		conn, changed, closed := out.current()
+		if closed {
+			return ErrClosed
+		}
+
+		exit := noexit
+		if conn != nil {
+			var err error
+			exit, err = out.bound.net.gate(ctx, conn, changed)
+			if err == errRetry {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if conn != nil && conn.rate != nil && throttled != conn {
+			if err := conn.rate.take(ctx); err != nil {
+				exit(false)
+				return err
+			}
+			throttled = conn
+		}
+
+		if conn != nil && conn.ring != nil {
+			delivered, err := conn.push(ctx, p, changed)
+			exit(delivered)
+			if delivered {
+				out.bound.yield(atomic.AddUint32(&out.sent, 1))
+			}
+			if delivered || err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			exit(false)
+			return ctx.Err()
+		case conn.channel() <- p:
+			atomic.AddUint64(&conn.delivered, 1)
+			sent := atomic.AddUint32(&out.sent, 1)
+			exit(true)
+			out.bound.yield(sent)
+			return nil
+		case <-changed:
+			exit(false)
+		}
+	}
+}
+
+// Close signals end of stream to the connected In.
+//
+// Close must not be called concurrently with Send.
+func (out *Out[T]) Close(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if out.closed {
+		return nil
+	}
+	out.closed = true
+	if out.conn != nil {
+		out.conn.close()
+		if s := out.bound.sequential(); s != nil {
+			s.ready(out.conn.receiver)
+			out.conn.receiver = nil
+		}
+	}
+	return nil
+}
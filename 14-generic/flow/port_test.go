@@ -0,0 +1,105 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+)
+
+type numbers struct {
+	Out flow.Out[int]
+}
+
+func (n *numbers) Run(ctx context.Context) error {
+	for i := 0; i < 3; i++ {
+		if err := n.Out.Send(ctx, i); err != nil {
+			return err
+		}
+	}
+	return n.Out.Close(ctx)
+}
+
+type drain struct {
+	In flow.In[int]
+}
+
+func (d *drain) Run(ctx context.Context) error {
+	for {
+		_, err := d.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestConnectConnectedIn(t *testing.T) {
+	var a, b numbers
+	var c drain
+	flowtest.Connect(t, &a.Out, &c.In)
+
+	if _, err := flow.Connect(&b.Out, &c.In); err == nil {
+		t.Fatal("expected an error for connecting an already connected In")
+	}
+	if b.Out.Connected() {
+		t.Fatal("rejected connection attached the Out")
+	}
+
+	// the first connection still delivers until end of stream
+	ctx := context.Background()
+	go func() { _ = a.Run(ctx) }()
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectDivertConnectedIn(t *testing.T) {
+	var a, b numbers
+	var c, d drain
+	flowtest.Connect(t, &a.Out, &c.In)
+
+	odd := func(v int) bool { return v%2 == 1 }
+	if _, err := flow.Connect(&b.Out, &d.In, flow.WithDivert(odd, &c.In)); err == nil {
+		t.Fatal("expected an error for diverting to an already connected In")
+	}
+	if b.Out.Connected() || d.In.Connected() {
+		t.Fatal("rejected connection attached the ports")
+	}
+}
+
+func TestRewireConnectedIn(t *testing.T) {
+	var net flow.Network
+	var a, b numbers
+	var c drain
+	net.Add(&a, &b, &c)
+	first := flowtest.Connect(t, &a.Out, &c.In)
+
+	_, err := net.Rewire(func(tx *flow.RewireTx) {
+		tx.Connect(&b.Out, &c.In)
+	})
+	if err == nil {
+		t.Fatal("expected an error for connecting an already connected In")
+	}
+
+	conns := net.Connections()
+	if len(conns) != 1 || conns[0] != first {
+		t.Fatalf("connections changed: %v", conns)
+	}
+}
+
+func TestEOS(t *testing.T) {
+	var net flow.Network
+	var a numbers
+	var c drain
+	net.Add(&a, &c)
+	flowtest.Connect(t, &a.Out, &c.In)
+
+	if err := net.RunToCompletion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,161 @@
+package flow
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// WithPriority makes the connection use a priority queue of size values,
+// Recv returns the pending value with the highest priority given to
+// SendPriority, and the values of the same priority in the order they
+// were sent. Send uses priority zero. Multiple goroutines may Send
+// concurrently.
+//
+// This lets e.g. control messages overtake the queued data. The queue
+// is bounded, hence a sender blocks on a full queue regardless of the
+// priority of its value.
+func WithPriority(size int) ConnOption {
+	if size < 1 {
+		size = 1
+	}
+	return func(c *connConfig) {
+		c.ring = priorityRing
+		c.size = size
+	}
+}
+
+// SendPriority is like Send, except that the value overtakes the queued
+// values of a lower priority when the connection uses WithPriority. The
+// other connections ignore the priority.
+func (out *Out[T]) SendPriority(ctx context.Context, v T, priority int) error {
+	if c := out.bound.chaotic(); c != nil {
+		return out.sendChaos(ctx, c, v, priority)
+	}
+	return out.sendChecked(ctx, v, priority)
+}
+
+// newPacketRing returns the ring buffer of the connection, if any.
+func newPacketRing[T any](config connConfig) ring[packet[T]] {
+	if config.ring == priorityRing {
+		return newPriority[T](config.size)
+	}
+	return newRing[packet[T]](config)
+}
+
+// prioritized is a binary max-heap of packets ordered by priority,
+// and by the order of arrival within the same priority.
+type prioritized[T any] struct {
+	mu    sync.Mutex
+	heap  []prioritizedPacket[T]
+	seq   uint64
+	limit int
+}
+
+type prioritizedPacket[T any] struct {
+	packet packet[T]
+	seq    uint64
+}
+
+func newPriority[T any](size int) *prioritized[T] {
+	return &prioritized[T]{heap: make([]prioritizedPacket[T], 0, size), limit: size}
+}
+
+// before reports whether a is received before b.
+func (a *prioritizedPacket[T]) before(b *prioritizedPacket[T]) bool {
+	if a.packet.priority != b.packet.priority {
+		return a.packet.priority > b.packet.priority
+	}
+	return a.seq < b.seq
+}
+
+func (q *prioritized[T]) push(p packet[T]) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.heap) >= q.limit {
+		return false
+	}
+	q.heap = append(q.heap, prioritizedPacket[T]{packet: p, seq: q.seq})
+	q.seq++
+
+	i := len(q.heap) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !q.heap[i].before(&q.heap[parent]) {
+			break
+		}
+		q.heap[i], q.heap[parent] = q.heap[parent], q.heap[i]
+		i = parent
+	}
+	return true
+}
+
+func (q *prioritized[T]) pop() (p packet[T], ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.heap) - 1
+	if n < 0 {
+		return p, false
+	}
+	p = q.heap[0].packet
+	q.heap[0] = q.heap[n]
+	q.heap[n] = prioritizedPacket[T]{}
+	q.heap = q.heap[:n]
+
+	i := 0
+	for {
+		first := i
+		if l := 2*i + 1; l < n && q.heap[l].before(&q.heap[first]) {
+			first = l
+		}
+		if r := 2*i + 2; r < n && q.heap[r].before(&q.heap[first]) {
+			first = r
+		}
+		if first == i {
+			break
+		}
+		q.heap[i], q.heap[first] = q.heap[first], q.heap[i]
+		i = first
+	}
+	return p, true
+}
+
+func (q *prioritized[T]) values() []packet[T] {
+	q.mu.Lock()
+	heap := append([]prioritizedPacket[T](nil), q.heap...)
+	q.mu.Unlock()
+
+	sort.Slice(heap, func(i, k int) bool { return heap[i].before(&heap[k]) })
+	ps := make([]packet[T], len(heap))
+	for i := range heap {
+		ps[i] = heap[i].packet
+	}
+	return ps
+}
+
+func (q *prioritized[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.heap)
+}
+
+func (q *prioritized[T]) cap() int { return q.limit }
+
+// enqueue adds p to the queue of RunSequential, after the packets of the
+// same or a higher priority when the connection uses WithPriority.
+func (conn *Conn[T]) enqueue(p packet[T], trace int, traced bool) {
+	i := len(conn.queue)
+	if conn.prioritized {
+		for i > 0 && conn.queue[i-1].priority < p.priority {
+			i--
+		}
+	}
+	conn.queue = append(conn.queue, packet[T]{})
+	copy(conn.queue[i+1:], conn.queue[i:])
+	conn.queue[i] = p
+	if traced {
+		conn.traces = append(conn.traces, 0)
+		copy(conn.traces[i+1:], conn.traces[i:])
+		conn.traces[i] = trace
+	}
+}
@@ -0,0 +1,185 @@
+package flow
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSampleEvery is how often the packets are sampled by default,
+// see Profiler.Every.
+const DefaultSampleEvery = 100
+
+// DefaultProfileSamples is how many latencies are kept per edge by
+// default, see Profiler.Samples.
+const DefaultProfileSamples = 1024
+
+// Profiler traces a sample of the packets end-to-end and aggregates the
+// latencies between the components they pass through, to show where the
+// time is spent in the graph. The sampled packets carry their lineage
+// like with Network.TrackLineage, the other packets don't carry any.
+//
+// The latency of an edge is the time from a component receiving a packet
+// to the next component receiving the packet derived from it, i.e. it
+// includes the processing by the former and the queueing in between.
+// For the component a packet originates from, it's measured from Send.
+type Profiler struct {
+	// seen counts the packets starting a lineage,
+	// it's first to keep it 64-bit aligned.
+	seen uint64
+
+	// Every is how often the packets are sampled, 1 in Every packets
+	// starting a lineage is traced. Defaults to DefaultSampleEvery.
+	Every int
+	// Samples limits the latencies kept per edge, the newest are kept.
+	// Defaults to DefaultProfileSamples.
+	Samples int
+
+	mu      sync.Mutex
+	sampled uint64
+	edges   map[edge]*edgeSamples
+}
+
+// edge is a hop between the components.
+type edge struct {
+	from Name
+	to   Name
+	port PortName
+}
+
+// edgeSamples holds the latest latencies of an edge.
+type edgeSamples struct {
+	count     uint64
+	latencies []time.Duration
+	next      int
+}
+
+// Profile is the result of a Profiler.
+type Profile struct {
+	Time time.Time `json:"time"`
+	// Sampled is the number of packets traced.
+	Sampled uint64        `json:"sampled"`
+	Edges   []EdgeProfile `json:"edges"`
+}
+
+// EdgeProfile contains the latencies of the packets sent from a
+// component to the port of another.
+type EdgeProfile struct {
+	From Name     `json:"from"`
+	To   Name     `json:"to"`
+	Port PortName `json:"port"`
+	// Samples is the number of latencies observed, the percentiles
+	// are computed from the latest Profiler.Samples of them.
+	Samples uint64        `json:"samples"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+}
+
+// sample decides whether to trace a packet starting a lineage.
+// nil p samples nothing.
+func (p *Profiler) sample() bool {
+	if p == nil {
+		return false
+	}
+	every := uint64(p.Every)
+	if every == 0 {
+		every = DefaultSampleEvery
+	}
+	if (atomic.AddUint64(&p.seen, 1)-1)%every != 0 {
+		return false
+	}
+	p.mu.Lock()
+	p.sampled++
+	p.mu.Unlock()
+	return true
+}
+
+// observe records the latency of the hop of a packet with the header h.
+// nil p observes nothing.
+func (p *Profiler) observe(h *header, hop Hop) {
+	if p == nil || len(h.lineage) == 0 {
+		return
+	}
+	last := h.lineage[len(h.lineage)-1]
+	e := edge{from: last.Node, to: hop.Node, port: hop.Port}
+	latency := hop.Time.Sub(last.Time)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.edges == nil {
+		p.edges = make(map[edge]*edgeSamples)
+	}
+	samples, ok := p.edges[e]
+	if !ok {
+		samples = &edgeSamples{}
+		p.edges[e] = samples
+	}
+	size := p.Samples
+	if size <= 0 {
+		size = DefaultProfileSamples
+	}
+	samples.count++
+	if len(samples.latencies) < size {
+		samples.latencies = append(samples.latencies, latency)
+		return
+	}
+	samples.latencies[samples.next%len(samples.latencies)] = latency
+	samples.next++
+}
+
+// Profile returns the latencies observed so far, by edge.
+func (p *Profiler) Profile() Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	profile := Profile{
+		Time:    time.Now(),
+		Sampled: p.sampled,
+		Edges:   make([]EdgeProfile, 0, len(p.edges)),
+	}
+	for e, samples := range p.edges {
+		sorted := append([]time.Duration(nil), samples.latencies...)
+		sort.Slice(sorted, func(i, k int) bool { return sorted[i] < sorted[k] })
+		profile.Edges = append(profile.Edges, EdgeProfile{
+			From:    e.from,
+			To:      e.to,
+			Port:    e.port,
+			Samples: samples.count,
+			P50:     percentile(sorted, 50),
+			P90:     percentile(sorted, 90),
+			P99:     percentile(sorted, 99),
+			Max:     sorted[len(sorted)-1],
+		})
+	}
+	sort.Slice(profile.Edges, func(i, k int) bool {
+		a, b := profile.Edges[i], profile.Edges[k]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Port < b.Port
+	})
+	return profile
+}
+
+// Reset discards the latencies observed so far.
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sampled = 0
+	p.edges = nil
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies.
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	rank := (len(sorted)*pct + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,94 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Readier can be implemented by a component, which isn't able to handle
+// packets right after starting, e.g. because it subscribes to a broker
+// or opens a listener in Run.
+//
+// The networks hold the packet deliveries until every Readier is ready,
+// the same way as Pause does. Ready must not depend on packets, as none
+// are delivered until it returns. RunSequential doesn't wait for Ready.
+type Readier interface {
+	// Ready waits until the component is ready to handle packets.
+	Ready(ctx context.Context) error
+}
+
+// DefaultReadyTimeout is how long the components may take to become
+// ready by default, see Network.ReadyTimeout.
+const DefaultReadyTimeout = 10 * time.Second
+
+// startGate holds the deliveries until the components are ready.
+type startGate struct {
+	holding int32
+	// open is closed when the deliveries are released
+	open chan struct{}
+}
+
+// hold stops the deliveries when some of the components implement
+// Readier. The returned function waits until they are ready and
+// releases the deliveries.
+func (net *Network) hold() (await func(ctx context.Context) error) {
+	var readiers []Component
+	for _, c := range net.components {
+		if _, ok := c.(Readier); ok {
+			readiers = append(readiers, c)
+		}
+	}
+	if len(readiers) == 0 {
+		return func(context.Context) error { return nil }
+	}
+
+	net.mu.Lock()
+	open := make(chan struct{})
+	net.start.open = open
+	atomic.StoreInt32(&net.start.holding, 1)
+	net.mu.Unlock()
+
+	return func(ctx context.Context) error {
+		defer func() {
+			atomic.StoreInt32(&net.start.holding, 0)
+			close(open)
+		}()
+
+		timeout := net.ReadyTimeout
+		if timeout <= 0 {
+			timeout = DefaultReadyTimeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		for _, c := range readiers {
+			if err := c.(Readier).Ready(ctx); err != nil {
+				name, _ := net.Name(c)
+				return fmt.Errorf("ready %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// started waits until the deliveries have been released.
+// When changed is closed while waiting, errRetry is returned.
+func (net *Network) started(ctx context.Context, changed <-chan struct{}) error {
+	if atomic.LoadInt32(&net.start.holding) == 0 {
+		return nil
+	}
+	net.mu.Lock()
+	open := net.start.open
+	net.mu.Unlock()
+
+	select {
+	case <-open:
+		return nil
+	case <-changed:
+		return errRetry
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,320 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a single entry in a recording made by Recorder.
+//
+// The first entry of each connection declares it with Name and Type,
+// the following ones contain the packets or the end of stream.
+type Record struct {
+	// Time is when the packet crossed the connection.
+	Time time.Time `json:"time"`
+	// Conn is the ID of the connection within the recording.
+	Conn int `json:"conn"`
+
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+
+	// Data is the packet encoded with the recorder's Encoding.
+	Data []byte `json:"data,omitempty"`
+	EOS  bool   `json:"eos,omitempty"`
+}
+
+// Recorder writes the packets crossing connections as JSON lines of Record.
+type Recorder struct {
+	// Encoding encodes the packets, defaults to JSON.
+	Encoding Encoding
+
+	mu   sync.Mutex
+	out  *json.Encoder
+	next int
+}
+
+// NewRecorder returns a recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	out := json.NewEncoder(w)
+	out.SetEscapeHTML(false)
+	return &Recorder{out: out}
+}
+
+func (rec *Recorder) write(r Record) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.out.Encode(r)
+}
+
+// declare assigns an ID to a connection.
+func (rec *Recorder) declare(name string, typ reflect.Type) (int, error) {
+	rec.mu.Lock()
+	rec.next++
+	id := rec.next
+	rec.mu.Unlock()
+
+	return id, rec.write(Record{Time: time.Now(), Conn: id, Name: name, Type: typ.String()})
+}
+
+func (rec *Recorder) encoding() Encoding {
+	if rec.Encoding == nil {
+		return JSON
+	}
+	return rec.Encoding
+}
+
+// splicer is implemented by connections that can be split in two.
+type splicer interface {
+	ends() (outPort, inPort)
+}
+
+func (conn *Conn[T]) ends() (outPort, inPort) {
+	from, to := conn.ports()
+	return from, to
+}
+
+// Record starts recording the named connections, the names are the
+// ones returned by Connection.String, e.g. "gen.Out -> upper.In".
+// Without names every connection is recorded.
+//
+// Each recorded connection is split in two, with a component in the
+// middle that writes the packets to rec. Record must be called after
+// the network has been wired up, but before it's started. Acknowledged
+// connections cannot be recorded.
+func (net *Network) Record(rec *Recorder, names ...string) error {
+	conns := net.Connections()
+	byName := make(map[string]Connection, len(conns))
+	for _, conn := range conns {
+		byName[conn.String()] = conn
+	}
+
+	if len(names) == 0 {
+		for name := range byName {
+			names = append(names, name)
+		}
+		sortStrings(names)
+	}
+
+	for _, name := range names {
+		conn, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("record: connection %q does not exist", name)
+		}
+		s, ok := conn.(splicer)
+		if !ok {
+			return fmt.Errorf("record: cannot record %q", name)
+		}
+
+		from, to := s.ends()
+		id, err := rec.declare(name, from.elemType())
+		if err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+		conn.Disconnect()
+
+		in := from.newIn()
+		in.bind(binding{net: net, name: "record(" + name + ")"})
+		if _, err := from.connect(in); err != nil {
+			return err
+		}
+		out := to.newOut()
+		out.bind(binding{net: net, name: "record(" + name + ")"})
+		if _, err := out.connect(to); err != nil {
+			return err
+		}
+		net.Add(&tap{rec: rec, id: id, in: in, out: out})
+	}
+	return nil
+}
+
+func sortStrings(xs []string) {
+	for i := 1; i < len(xs); i++ {
+		for k := i; k > 0 && xs[k] < xs[k-1]; k-- {
+			xs[k], xs[k-1] = xs[k-1], xs[k]
+		}
+	}
+}
+
+// tap records and forwards the packets of a single connection.
+type tap struct {
+	rec *Recorder
+	id  int
+	in  inPort
+	out outPort
+}
+
+// idle lets RunToCompletion finish while the tap waits for packets.
+func (t *tap) idle() bool {
+	blocked, _ := t.in.activity()
+	return blocked
+}
+
+func (t *tap) Run(ctx context.Context) error {
+	enc := t.rec.encoding()
+	for {
+		v, err := t.in.recvAny(ctx)
+		if errors.Is(err, EOS) {
+			if err := t.rec.write(Record{Time: time.Now(), Conn: t.id, EOS: true}); err != nil {
+				return fmt.Errorf("record: %w", err)
+			}
+			return t.out.closeAny(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		data, err := enc.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+		if err := t.rec.write(Record{Time: time.Now(), Conn: t.id, Data: data}); err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+		if err := t.out.sendAny(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// Replayer sends recorded packets to the In ports of a network.
+type Replayer struct {
+	// Speed multiplies the pace of the recording, e.g. 2 replays twice
+	// as fast. Zero means the original pace and math.Inf(1) replays
+	// without any delays.
+	Speed float64
+	// Encoding decodes the packets, defaults to JSON.
+	Encoding Encoding
+
+	records []Record
+	sinks   map[int]*Sink
+}
+
+// Replay reads a recording and connects to the receiving ports of the
+// recorded connections. The sending nodes don't need to exist.
+//
+// The returned Replayer is added to the network and starts sending when
+// the network runs. Replay must be called before the network is started.
+func (net *Network) Replay(r io.Reader) (*Replayer, error) {
+	replay := &Replayer{sinks: make(map[int]*Sink)}
+
+	dec := json.NewDecoder(r)
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("replay: %w", err)
+		}
+
+		if rec.Name == "" {
+			if _, ok := replay.sinks[rec.Conn]; !ok {
+				return nil, fmt.Errorf("replay: connection %d is not declared", rec.Conn)
+			}
+			replay.records = append(replay.records, rec)
+			continue
+		}
+
+		node, port, err := receiverOf(rec.Name)
+		if err != nil {
+			return nil, fmt.Errorf("replay: %w", err)
+		}
+		sink, err := net.Sink(node, port)
+		if err != nil {
+			return nil, fmt.Errorf("replay: %s: %w", rec.Name, err)
+		}
+		if typ := sink.Type().String(); typ != rec.Type {
+			return nil, fmt.Errorf("replay: %s: recorded %s, port expects %s", rec.Name, rec.Type, typ)
+		}
+		replay.sinks[rec.Conn] = sink
+	}
+
+	net.Add(replay)
+	return replay, nil
+}
+
+// receiverOf returns the receiving port of a connection name.
+func receiverOf(name string) (Name, PortName, error) {
+	i := strings.Index(name, " -> ")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid connection %q", name)
+	}
+	node, port, ok := strings.Cut(name[i+len(" -> "):], ".")
+	if !ok {
+		return "", "", fmt.Errorf("invalid connection %q", name)
+	}
+	return Name(node), PortName(port), nil
+}
+
+// Run sends the recorded packets, keeping the recorded intervals between
+// them. The ports that haven't been closed in the recording are closed
+// at the end.
+func (replay *Replayer) Run(ctx context.Context) error {
+	enc := replay.Encoding
+	if enc == nil {
+		enc = JSON
+	}
+	speed := replay.Speed
+	if speed == 0 {
+		speed = 1
+	}
+
+	var start, first time.Time
+	for _, rec := range replay.records {
+		if start.IsZero() {
+			start, first = time.Now(), rec.Time
+		} else if !math.IsInf(speed, 1) {
+			at := start.Add(time.Duration(float64(rec.Time.Sub(first)) / speed))
+			if err := sleepUntil(ctx, at); err != nil {
+				return err
+			}
+		}
+
+		sink := replay.sinks[rec.Conn]
+		if rec.EOS {
+			if err := sink.Close(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+
+		v := reflect.New(sink.Type())
+		if err := enc.Unmarshal(rec.Data, v.Interface()); err != nil {
+			return fmt.Errorf("replay: connection %d: %w", rec.Conn, err)
+		}
+		if err := sink.Send(ctx, v.Elem().Interface()); err != nil {
+			return err
+		}
+	}
+
+	for _, sink := range replay.sinks {
+		if err := sink.Close(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,349 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Connection is the untyped view of a Conn.
+type Connection interface {
+	Disconnect()
+	String() string
+}
+
+// port is implemented by In and Out to allow wiring them by reflection.
+type port interface {
+	elemType() reflect.Type
+	bind(b binding)
+	boundTo() binding
+}
+
+type inPort interface {
+	port
+	// newOut creates an unconnected Out with the same element type.
+	newOut() outPort
+	// activity reports whether a goroutine is blocked in Recv with nothing
+	// pending and how many values have been received so far.
+	activity() (blocked bool, received uint32)
+	// empty reports whether no values are waiting to be received.
+	empty() bool
+	recvAny(ctx context.Context) (any, error)
+}
+
+type outPort interface {
+	port
+	connect(to inPort, opts ...ConnOption) (Connection, error)
+	sendAny(ctx context.Context, v any) error
+	closeAny(ctx context.Context) error
+	// sending reports whether a sender is blocked in Send.
+	sending() bool
+	// newIn creates an unconnected In with the same element type.
+	newIn() inPort
+}
+
+// portSet is implemented by components whose ports are not struct fields.
+type portSet interface {
+	ports() map[string]port
+}
+
+// wrapper is implemented by components that run another component,
+// the ports and the name are taken from the wrapped component.
+type wrapper interface {
+	unwrap() Component
+}
+
+// unwrap returns the innermost wrapped component.
+func unwrap(c any) any {
+	for {
+		w, ok := c.(wrapper)
+		if !ok {
+			return c
+		}
+		c = w.unwrap()
+	}
+}
+
+func (in *In[T]) elemType() reflect.Type   { return reflect.TypeOf((*T)(nil)).Elem() }
+func (out *Out[T]) elemType() reflect.Type { return reflect.TypeOf((*T)(nil)).Elem() }
+
+func (in *In[T]) bind(b binding)   { in.mu.Lock(); in.bound = b; in.mu.Unlock() }
+func (out *Out[T]) bind(b binding) { out.mu.Lock(); out.bound = b; out.mu.Unlock() }
+
+func (in *In[T]) boundTo() binding   { in.mu.Lock(); defer in.mu.Unlock(); return in.bound }
+func (out *Out[T]) boundTo() binding { out.mu.Lock(); defer out.mu.Unlock(); return out.bound }
+
+func (in *In[T]) newOut() outPort { return &Out[T]{} }
+func (out *Out[T]) newIn() inPort { return &In[T]{} }
+
+func (in *In[T]) recvAny(ctx context.Context) (any, error) { return in.Recv(ctx) }
+
+func (in *In[T]) activity() (blocked bool, received uint32) {
+	conn, _ := in.current()
+	blocked = atomic.LoadInt32(&in.waiting) > 0 && (conn == nil || conn.queued() == 0)
+	return blocked, atomic.LoadUint32(&in.received)
+}
+
+func (in *In[T]) empty() bool {
+	conn, _ := in.current()
+	return conn == nil || conn.queued() == 0
+}
+
+func (out *Out[T]) sending() bool { return atomic.LoadInt32(&out.waiting) > 0 }
+
+func (out *Out[T]) connect(to inPort, opts ...ConnOption) (Connection, error) {
+	in, ok := to.(*In[T])
+	if !ok {
+		return nil, fmt.Errorf("cannot connect %v to %v", out.elemType(), to.elemType())
+	}
+	conn, err := Connect(out, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (out *Out[T]) sendAny(ctx context.Context, v any) error {
+	tv, ok := v.(T)
+	if !ok {
+		return fmt.Errorf("cannot send %T to %v", v, out.elemType())
+	}
+	return out.Send(ctx, tv)
+}
+
+func (out *Out[T]) closeAny(ctx context.Context) error { return out.Close(ctx) }
+
+// portByName finds an In or Out field called name from component.
+//
+// Elements of slice and array ports are referenced as "Name[index]".
+// Elements of map ports are referenced as "Name[key]", missing elements
+// are created. A Config is replaced with its In.
+func portByName(component any, name string) (port, error) {
+	p, err := declaredPort(component, name)
+	if c, ok := p.(configPort); ok {
+		p = c.configIn()
+	}
+	return p, err
+}
+
+// declaredPort finds the port like portByName, without replacing
+// a Config with its In.
+func declaredPort(component any, name string) (port, error) {
+	component = unwrap(component)
+	if set, ok := component.(portSet); ok {
+		p, ok := set.ports()[name]
+		if !ok {
+			return nil, fmt.Errorf("%T does not have port %s", component, name)
+		}
+		return p, nil
+	}
+	rv := reflect.ValueOf(component)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T is not a struct", component)
+	}
+
+	fieldName, key := name, ""
+	open := strings.IndexByte(name, '[')
+	if open >= 0 && strings.HasSuffix(name, "]") {
+		fieldName, key = name[:open], name[open+1:len(name)-1]
+	}
+
+	field := rv.FieldByName(fieldName)
+	if !field.IsValid() {
+		// classic graph definitions use upper-case port names
+		field = rv.FieldByNameFunc(func(s string) bool { return strings.EqualFold(s, fieldName) })
+	}
+	if !field.IsValid() || !field.CanAddr() || !field.CanInterface() {
+		return nil, fmt.Errorf("%T does not have port %s", component, name)
+	}
+
+	if open >= 0 {
+		switch {
+		case isPortList(field.Type()):
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("%T port %s has invalid index", component, name)
+			}
+			if index >= field.Len() {
+				return nil, fmt.Errorf("%T port %s index out of range [0, %d)", component, name, field.Len())
+			}
+			field = field.Index(index)
+		case isPortMap(field.Type()):
+			return mapPort(field, key)
+		default:
+			return nil, fmt.Errorf("%T field %s is not a list of ports", component, fieldName)
+		}
+	}
+
+	p, ok := field.Addr().Interface().(port)
+	if !ok {
+		return nil, fmt.Errorf("%T field %s is not a port", component, name)
+	}
+	return p, nil
+}
+
+// PortInfo describes a port of a component.
+type PortInfo struct {
+	// Elem is the type of the values.
+	Elem reflect.Type
+	// In is set for receiving ports.
+	In bool
+	// Ack is set for acknowledged ports.
+	Ack bool
+	// Config is set for Config ports, which are wired by their In.
+	Config bool
+}
+
+// PortOf describes the named port of a component,
+// see Network.Setup for the port names.
+func PortOf(c Component, name PortName) (PortInfo, error) {
+	p, err := declaredPort(c, string(name))
+	if err != nil {
+		return PortInfo{}, err
+	}
+	info := PortInfo{Elem: p.elemType()}
+	_, info.Config = p.(configPort)
+	_, info.In = p.(inPort)
+	_, info.Ack = p.(ackPort)
+	return info, nil
+}
+
+// MapPort returns the port with the key from a map of ports,
+// creating it when it doesn't exist.
+func MapPort[K ~string, P any](ports *map[K]*P, key K) *P {
+	if *ports == nil {
+		*ports = make(map[K]*P)
+	}
+	p, ok := (*ports)[key]
+	if !ok {
+		p = new(P)
+		(*ports)[key] = p
+	}
+	return p
+}
+
+// mapPort finds or creates the port with the key in a map of ports.
+func mapPort(field reflect.Value, key string) (port, error) {
+	if field.IsNil() {
+		if !field.CanSet() {
+			return nil, fmt.Errorf("port map is nil")
+		}
+		field.Set(reflect.MakeMap(field.Type()))
+	}
+
+	rkey := reflect.ValueOf(key).Convert(field.Type().Key())
+	elem := field.MapIndex(rkey)
+	if !elem.IsValid() || elem.IsNil() {
+		elem = reflect.New(field.Type().Elem().Elem())
+		field.SetMapIndex(rkey, elem)
+	}
+	return elem.Interface().(port), nil
+}
+
+// inputsOf returns the In ports of component, see portsOf.
+func inputsOf(component any) []inPort {
+	var inputs []inPort
+	for _, p := range portsOf(component) {
+		if in, ok := p.(inPort); ok {
+			inputs = append(inputs, in)
+		}
+	}
+	return inputs
+}
+
+// portsOf returns all the In and Out fields of component,
+// including the elements of slice, array and map ports.
+func portsOf(component any) map[string]port {
+	if set, ok := unwrap(component).(portSet); ok {
+		return set.ports()
+	}
+	rv := reflect.ValueOf(unwrap(component))
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || !rv.CanAddr() {
+		return nil
+	}
+
+	ports := map[string]port{}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Field(i)
+		if !field.CanInterface() {
+			continue
+		}
+		name := rv.Type().Field(i).Name
+		if p, ok := field.Addr().Interface().(port); ok {
+			if c, ok := p.(configPort); ok {
+				p = c.configIn()
+			}
+			ports[name] = p
+			continue
+		}
+		switch {
+		case isPortList(field.Type()):
+			for k := 0; k < field.Len(); k++ {
+				ports[name+"["+strconv.Itoa(k)+"]"] = field.Index(k).Addr().Interface().(port)
+			}
+		case isPortMap(field.Type()):
+			iter := field.MapRange()
+			for iter.Next() {
+				if iter.Value().IsNil() {
+					continue
+				}
+				key := fmt.Sprint(iter.Key().Interface())
+				ports[name+"["+key+"]"] = iter.Value().Interface().(port)
+			}
+		}
+	}
+	return ports
+}
+
+var portType = reflect.TypeOf((*port)(nil)).Elem()
+
+// isPortList returns whether typ is a slice or an array of ports.
+func isPortList(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array {
+		return false
+	}
+	return reflect.PtrTo(typ.Elem()).Implements(portType)
+}
+
+// isPortMap returns whether typ is a map from strings to port pointers.
+func isPortMap(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Map || typ.Key().Kind() != reflect.String {
+		return false
+	}
+	elem := typ.Elem()
+	return elem.Kind() == reflect.Ptr && elem.Implements(portType)
+}
+
+// resetPorts replaces the ports of a copied struct with unconnected ones.
+func resetPorts(rv reflect.Value) {
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch {
+		case reflect.PtrTo(field.Type()).Implements(portType):
+			field.Set(reflect.Zero(field.Type()))
+		case isPortList(field.Type()) && field.Kind() == reflect.Slice:
+			field.Set(reflect.MakeSlice(field.Type(), field.Len(), field.Len()))
+		case isPortList(field.Type()):
+			field.Set(reflect.Zero(field.Type()))
+		case isPortMap(field.Type()) && !field.IsNil():
+			fresh := reflect.MakeMap(field.Type())
+			iter := field.MapRange()
+			for iter.Next() {
+				fresh.SetMapIndex(iter.Key(), reflect.New(field.Type().Elem().Elem()))
+			}
+			field.Set(fresh)
+		}
+	}
+}
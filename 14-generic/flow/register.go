@@ -0,0 +1,84 @@
+package flow
+
+import (
+	"fmt"
+	"sync"
+)
+
+/*
+	The core flow package only depends on the standard library and
+	golang.org/x/sync. Integrations with heavier dependencies (Kafka, NATS,
+	SQL, web UI) live in their own packages under fbp.example/flow/ext.
+	An integration that needs third-party modules gets its own go.mod,
+	so the dependencies are only pulled in when it is actually used.
+
+	Integrations make their components available by registering them
+	in init, similarly to database/sql drivers:
+
+		func init() {
+			flow.Register("KafkaConsumer", NewConsumer)
+		}
+
+	A binary opts in by importing the integration for side-effects,
+	usually from a file guarded by a build tag:
+
+		//go:build kafka
+
+		package main
+
+		import _ "fbp.example/flow/ext/kafka"
+
+	This way `go build` produces a minimal binary and `go build -tags kafka`
+	includes the integration.
+*/
+
+var registered struct {
+	sync.Mutex
+	registry Registry
+}
+
+// Register makes a component type available to every Network.
+//
+// Network.Setup looks up types from Network.Registry first and then
+// from the registered types. Register panics when typ is already registered.
+func Register(typ Type, mk MakeFn) {
+	registered.Lock()
+	defer registered.Unlock()
+
+	if mk == nil {
+		panic("flow: Register constructor is nil for " + string(typ))
+	}
+	if _, dup := registered.registry[typ]; dup {
+		panic("flow: Register called twice for " + string(typ))
+	}
+	if registered.registry == nil {
+		registered.registry = make(Registry)
+	}
+	registered.registry[typ] = mk
+}
+
+// Registered returns a copy of all the registered component types.
+func Registered() Registry {
+	registered.Lock()
+	defer registered.Unlock()
+
+	r := make(Registry, len(registered.registry))
+	for typ, mk := range registered.registry {
+		r[typ] = mk
+	}
+	return r
+}
+
+// lookup finds the constructor for typ.
+func (net *Network) lookup(typ Type) (MakeFn, error) {
+	if mk, ok := net.Registry[typ]; ok {
+		return mk, nil
+	}
+
+	registered.Lock()
+	defer registered.Unlock()
+	if mk, ok := registered.registry[typ]; ok {
+		return mk, nil
+	}
+	return nil, fmt.Errorf("type %s does not exist", typ)
+}
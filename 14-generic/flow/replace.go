@@ -0,0 +1,327 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Replace replaces the component old with new, keeping its name and
+// connections. It allows upgrading the processing logic of a running
+// network without restarting it.
+//
+// The connections of old are transferred to the ports of new with the
+// same names and types, keeping the queued packets. While the network is
+// running, the inputs are transferred first, which pauses the deliveries
+// to old. Once old has processed the packets it received and is waiting
+// in Recv, it's cancelled and new is started in its place with the
+// outputs transferred as well. Hence old must not close its Out ports
+// when cancelled, as a closed connection cannot be reopened. When ctx is
+// done before old becomes idle, the inputs are transferred back to old
+// and the error of ctx is returned.
+//
+// When old is running, Init of new is called before old is cancelled and
+// Shutdown of old after it has returned. The packets old didn't
+// acknowledge on its AckIn ports are redelivered to new. Replace doesn't
+// work with RunSequential.
+func (net *Network) Replace(ctx context.Context, old, new Component) error {
+	name, ok := net.Name(old)
+	if !ok {
+		return fmt.Errorf("replace: %T is not in the network", old)
+	}
+	if _, exists := net.Name(new); exists {
+		return fmt.Errorf("replace %s: %T is already in the network", name, new)
+	}
+	if net.scheduled() {
+		return fmt.Errorf("replace %s: not supported with RunSequential nor RunSharded", name)
+	}
+
+	moves, err := net.transfers(old, new)
+	if err != nil {
+		return fmt.Errorf("replace %s: %w", name, err)
+	}
+
+	ctx = net.withClock(ctx)
+
+	net.mu.Lock()
+	_, running := net.running[name]
+	draining := net.draining
+	net.mu.Unlock()
+	if draining {
+		return fmt.Errorf("replace %s: network is shutting down", name)
+	}
+	initialized := false
+	if initer, ok := new.(Initializer); ok && running {
+		if err := initer.Init(ctx); err != nil {
+			return fmt.Errorf("replace %s: init %T: %w", name, new, err)
+		}
+		initialized = true
+	}
+
+	net.mu.Lock()
+	r, running := net.running[name]
+	var rep *replacement
+	if running {
+		rep = &replacement{
+			component: new,
+			stopped:   make(chan error, 1),
+			ready:     make(chan struct{}),
+		}
+		if net.replacing == nil {
+			net.replacing = make(map[Component]*replacement)
+		}
+		net.replacing[old] = rep
+	}
+	net.mu.Unlock()
+
+	if rep != nil {
+		// the packets old has received are processed before it's stopped
+		for _, move := range moves {
+			if move.input {
+				if err := move.conn.retarget(move.from, move.to); err != nil {
+					return fmt.Errorf("replace %s: %w", name, err)
+				}
+			}
+		}
+		if err := awaitIdle(ctx, old, r.done); err != nil {
+			net.mu.Lock()
+			_, waiting := net.replacing[old]
+			delete(net.replacing, old)
+			net.mu.Unlock()
+			// unless old has returned meanwhile, it continues in place of new
+			if waiting {
+				return net.abortReplace(name, new, initialized, moves, err)
+			}
+		}
+
+		net.mu.Lock()
+		r.stopped = true
+		net.mu.Unlock()
+		r.cancel()
+		if err := <-rep.stopped; err != nil {
+			return fmt.Errorf("replace %s: %w", name, err)
+		}
+		// the packets old didn't acknowledge are delivered to new
+		for _, move := range moves {
+			if r, ok := move.conn.(interface{ Redeliver() }); ok && move.input {
+				r.Redeliver()
+			}
+		}
+		defer close(rep.ready)
+	}
+
+	for _, move := range moves {
+		if move.input && rep != nil {
+			continue
+		}
+		if err := move.conn.retarget(move.from, move.to); err != nil {
+			return fmt.Errorf("replace %s: %w", name, err)
+		}
+	}
+
+	net.mu.Lock()
+	net.nodes[name] = new
+	delete(net.names, old)
+	net.names[new] = name
+	for i, c := range net.components {
+		if c == old {
+			net.components[i] = new
+		}
+	}
+	net.mu.Unlock()
+	for field, p := range portsOf(new) {
+		p.bind(binding{net: net, name: string(name) + "." + field})
+	}
+
+	if down, ok := old.(Shutdowner); ok && rep != nil {
+		if err := down.Shutdown(ctx); err != nil {
+			return fmt.Errorf("replace %s: shutdown %T: %w", name, old, err)
+		}
+	}
+	return nil
+}
+
+// abortReplace transfers the inputs back to the replaced component
+// after it didn't become idle, new is shut down when it was initialized.
+func (net *Network) abortReplace(name Name, new Component, initialized bool, moves []transfer, cause error) error {
+	for _, move := range moves {
+		if move.input {
+			if err := move.conn.retarget(move.oldFrom, move.oldTo); err != nil {
+				return fmt.Errorf("replace %s: %v: %w", name, cause, err)
+			}
+		}
+	}
+	if down, ok := new.(Shutdowner); ok && initialized {
+		// ctx is done, so the shutdown doesn't use it
+		if err := down.Shutdown(net.withClock(context.Background())); err != nil {
+			return fmt.Errorf("replace %s: %v: shutdown %T: %w", name, cause, new, err)
+		}
+	}
+	return fmt.Errorf("replace %s: %w", name, cause)
+}
+
+// replacePoll is how often Replace checks whether the replaced component
+// has processed its packets.
+const replacePoll = time.Millisecond
+
+// awaitIdle waits until c is waiting for packets or done is closed,
+// it returns the error of ctx when it's done first.
+func awaitIdle(ctx context.Context, c Component, done <-chan struct{}) error {
+	poll := time.NewTicker(replacePoll)
+	defer poll.Stop()
+
+	for !waiting(c) {
+		select {
+		case <-poll.C:
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// waiting reports whether the component is waiting for packets.
+func waiting(c Component) bool {
+	if idler, ok := c.(idler); ok {
+		return idler.idle()
+	}
+	for _, p := range portsOf(c) {
+		if out, ok := p.(outPort); ok && out.sending() {
+			return false
+		}
+	}
+	inputs := inputsOf(c)
+	if len(inputs) == 0 {
+		return true
+	}
+	blocked, _ := receiving(inputs)
+	return blocked
+}
+
+// replacement is a component waiting to take over a running one.
+type replacement struct {
+	component Component
+	// stopped receives the result of the replaced component.
+	stopped chan error
+	// ready is closed once the connections have been transferred.
+	ready chan struct{}
+}
+
+// run runs the component until it returns, followed by the components
+// replacing it. started is called before each of them starts.
+func (net *Network) run(ctx context.Context, c Component, started func(Component)) error {
+	for {
+		if started != nil {
+			started(c)
+		}
+		cctx, done := net.scope(ctx, c)
+		stop := net.watchStalls(cctx, c)
+		err := done(c.Run(cctx))
+		if stop() && err == nil && ctx.Err() == nil {
+			// the packets the stalled run didn't acknowledge
+			requeueAcks(c)
+			continue
+		}
+
+		net.mu.Lock()
+		rep, ok := net.replacing[c]
+		delete(net.replacing, c)
+		net.mu.Unlock()
+		if !ok {
+			return err
+		}
+
+		rep.stopped <- err
+		if err != nil {
+			return err
+		}
+		<-rep.ready
+		c = rep.component
+	}
+}
+
+// retargeter is implemented by connections that can be moved to other ports.
+type retargeter interface {
+	retarget(from outPort, to inPort) error
+}
+
+// transfer moves a connection to other ports.
+type transfer struct {
+	conn retargeter
+	from outPort
+	to   inPort
+	// oldFrom and oldTo are the ports the connection is moved from.
+	oldFrom outPort
+	oldTo   inPort
+	// input is set when the connection delivers to the replaced component.
+	input bool
+}
+
+// transfers finds the connections of old and the ports of new they
+// are moved to.
+func (net *Network) transfers(old, new Component) ([]transfer, error) {
+	oldPorts, newPorts := portsOf(old), portsOf(new)
+	fields := make(map[port]string, len(oldPorts))
+	for field, p := range oldPorts {
+		fields[p] = field
+	}
+
+	// counterpart returns the port of new replacing p
+	counterpart := func(p port) (port, bool, error) {
+		field, ok := fields[p]
+		if !ok {
+			return p, false, nil
+		}
+		q, ok := newPorts[field]
+		if !ok {
+			return nil, false, fmt.Errorf("%T has no port %s", new, field)
+		}
+		if reflect.TypeOf(q) != reflect.TypeOf(p) {
+			return nil, false, fmt.Errorf("port %s of %T is %v, expected %v", field, new, reflect.TypeOf(q), reflect.TypeOf(p))
+		}
+		return q, true, nil
+	}
+
+	moved := make(map[port]bool)
+	var moves []transfer
+	for _, conn := range net.Connections() {
+		s, ok := conn.(splicer)
+		if !ok {
+			continue
+		}
+		r, ok := conn.(retargeter)
+		if !ok {
+			continue
+		}
+		from, to := s.ends()
+
+		newFrom, fromMoved, err := counterpart(from)
+		if err != nil {
+			return nil, err
+		}
+		newTo, toMoved, err := counterpart(to)
+		if err != nil {
+			return nil, err
+		}
+		if !fromMoved && !toMoved {
+			continue
+		}
+		moved[from], moved[to] = true, true
+		moves = append(moves, transfer{
+			conn: r,
+			from: newFrom.(outPort), to: newTo.(inPort),
+			oldFrom: from, oldTo: to,
+			input: toMoved,
+		})
+	}
+
+	for _, p := range oldPorts {
+		if c, ok := p.(interface{ Connected() bool }); ok && c.Connected() && !moved[p] {
+			return nil, fmt.Errorf("connection of %s cannot be transferred", portName(p.boundTo()))
+		}
+	}
+	return moves, nil
+}
@@ -0,0 +1,115 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+// gate forwards the packets, the first one only after release is closed.
+type gate struct {
+	In  flow.In[int]
+	Out flow.Out[int]
+
+	received chan struct{}
+	release  chan struct{}
+}
+
+func newGate() *gate {
+	return &gate{received: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (g *gate) Run(ctx context.Context) error {
+	for first := true; ; first = false {
+		v, err := g.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return g.Out.Close(ctx)
+		}
+		if ctx.Err() != nil {
+			// cancelled for the replacement
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			close(g.received)
+			<-g.release
+		}
+		if err := g.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// replaced builds a network with old between a source and a collector
+// and runs it until old holds the first packet.
+func replaced(t *testing.T, ctx context.Context) (*flow.Network, *gate, *std.Collect[int], chan error) {
+	net := &flow.Network{}
+	src, old, dst := &sequence{N: 3}, newGate(), std.NewCollect[int]()
+	net.AddNamed("src", src)
+	net.AddNamed("old", old)
+	net.AddNamed("dst", dst)
+	flowtest.Connect(t, &src.Out, &old.In)
+	flowtest.Connect(t, &old.Out, &dst.In)
+
+	done := make(chan error, 1)
+	go func() { done <- net.Run(ctx) }()
+	<-old.received
+	return net, old, dst, done
+}
+
+func TestReplaceWaitsForIdle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	net, old, dst, done := replaced(t, ctx)
+	replacing := make(chan error, 1)
+	go func() { replacing <- net.Replace(ctx, old, &relay{}) }()
+
+	select {
+	case err := <-replacing:
+		t.Fatalf("replaced while old held a packet: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(old.release)
+	if err := <-replacing; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.Values(); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Fatalf("received %v, expected [0 1 2]", got)
+	}
+}
+
+func TestReplaceCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	net, old, dst, done := replaced(t, ctx)
+	replaceCtx, stop := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer stop()
+	if err := net.Replace(replaceCtx, old, &relay{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	// old continues with its inputs
+	close(old.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.Values(); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Fatalf("received %v, expected [0 1 2]", got)
+	}
+	if c, _ := net.Node("old"); c != old {
+		t.Fatalf("old was replaced by %T", c)
+	}
+}
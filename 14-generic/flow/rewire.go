@@ -0,0 +1,89 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RewireTx collects the changes of Network.Rewire.
+type RewireTx struct {
+	ops []func(net *Network) (Connection, error)
+	// err is the first invalid change
+	err error
+}
+
+func (tx *RewireTx) fail(err error) {
+	if tx.err == nil {
+		tx.err = err
+	}
+}
+
+// Connect connects the ports, such as &a.Out and &b.In, with the same
+// conversions and bridges as graph definitions.
+func (tx *RewireTx) Connect(from, to any) {
+	src, ok := from.(outPort)
+	if !ok {
+		tx.fail(fmt.Errorf("connect: %T is not an output port", from))
+		return
+	}
+	dst, ok := to.(inPort)
+	if !ok {
+		tx.fail(fmt.Errorf("connect: %T is not an input port", to))
+		return
+	}
+	if !connectable(src, dst) {
+		tx.fail(fmt.Errorf("connect %s -> %s: cannot connect %v to %v",
+			portName(src.boundTo()), portName(dst.boundTo()), src.elemType(), dst.elemType()))
+		return
+	}
+
+	tx.ops = append(tx.ops, func(net *Network) (Connection, error) {
+		return net.connectPorts(src, dst)
+	})
+}
+
+// Disconnect disconnects the connection.
+func (tx *RewireTx) Disconnect(conn Connection) {
+	tx.ops = append(tx.ops, func(*Network) (Connection, error) {
+		conn.Disconnect()
+		return nil, nil
+	})
+}
+
+// Rewire applies the connects and disconnects made by fn as a single
+// change, so that no packet passes through a partially rewired network.
+//
+// The packet deliveries are paused while the changes are applied, the
+// deliveries in progress are retried on the new connections. When any
+// of the changes is invalid, nothing is applied. Rewire returns the
+// created connections in the order of the Connect calls.
+//
+// Connections must not be modified while RunSequential is running.
+func (net *Network) Rewire(fn func(tx *RewireTx)) ([]Connection, error) {
+	if net.scheduled() {
+		return nil, errors.New("rewire: not supported with RunSequential nor RunSharded")
+	}
+
+	var tx RewireTx
+	fn(&tx)
+	if tx.err != nil {
+		return nil, fmt.Errorf("rewire: %w", tx.err)
+	}
+
+	if !net.Paused() {
+		net.Pause()
+		defer net.Resume()
+	}
+
+	var conns []Connection
+	for _, op := range tx.ops {
+		conn, err := op(net)
+		if err != nil {
+			return conns, fmt.Errorf("rewire: %w", err)
+		}
+		if conn != nil {
+			conns = append(conns, conn)
+		}
+	}
+	return conns, nil
+}
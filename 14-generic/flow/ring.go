@@ -0,0 +1,345 @@
+package flow
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// ConnOption configures a connection created by Connect.
+type ConnOption func(*connConfig)
+
+type connConfig struct {
+	ring ringKind
+	size int
+	// max is the maximum capacity of adaptiveRing.
+	max int
+	// rate and burst limit the deliveries, see WithRateLimit.
+	rate  float64
+	burst int
+	// filter and divert route the packets, see WithFilter.
+	filter any
+	divert any
+	// mapper transforms the packets, see WithMap.
+	mapper any
+}
+
+type ringKind byte
+
+const (
+	noRing ringKind = iota
+	spscRing
+	mpscRing
+	adaptiveRing
+	priorityRing
+)
+
+/*
+	By default a connection is an unbuffered channel, Send returns once
+	the receiver has taken the value. The ring buffer transports queue
+	the values instead, Send returns as soon as the value is queued and
+	blocks only when the queue is full.
+
+	The ring buffers avoid the locking done by channels: an uncontended
+	Send and Recv are a couple of atomic operations each. The goroutines
+	sleep on a signal channel only when the queue is full or empty, the
+	waiting side announces itself with a flag, which the other side
+	checks after modifying the queue.
+
+	WithAdaptive resizes the queue instead of using a fixed size, and
+	WithPriority orders it by the priority given to SendPriority.
+
+	Values still queued when the connection is disconnected are dropped.
+	RunSequential uses its own queue regardless of the transport.
+*/
+
+// WithSPSC makes the connection use a lock-free ring buffer of the size
+// rounded up to a power of two. Only a single goroutine may Send to the
+// connection and a single goroutine may Recv from it at a time.
+func WithSPSC(size int) ConnOption {
+	return func(c *connConfig) {
+		c.ring = spscRing
+		c.size = size
+	}
+}
+
+// WithMPSC is like WithSPSC, except that multiple goroutines may Send
+// concurrently, e.g. the workers of an unordered merge.
+func WithMPSC(size int) ConnOption {
+	return func(c *connConfig) {
+		c.ring = mpscRing
+		c.size = size
+	}
+}
+
+// ring is a bounded queue with a single consumer.
+type ring[T any] interface {
+	// push adds v unless the queue is full.
+	push(v T) bool
+	// pop removes the oldest value unless the queue is empty.
+	pop() (T, bool)
+	// values returns the queued values in the order they are popped,
+	// it must not be called concurrently with pop.
+	values() []T
+	len() int
+	cap() int
+}
+
+func newRing[T any](config connConfig) ring[T] {
+	switch config.ring {
+	case spscRing:
+		return newSPSC[T](config.size)
+	case mpscRing:
+		return newMPSC[T](config.size)
+	case adaptiveRing:
+		return newAdaptive[T](config.size, config.max)
+	}
+	return nil
+}
+
+// ringSize rounds size up to a power of two.
+func ringSize(size int) uint64 {
+	n := uint64(1)
+	for n < uint64(size) {
+		n <<= 1
+	}
+	return n
+}
+
+// cacheLinePad separates fields written by different goroutines.
+type cacheLinePad [64]byte
+
+// spsc is a ring buffer for a single producer and a single consumer.
+type spsc[T any] struct {
+	_ cacheLinePad
+	// head is the next slot to read, written by the consumer.
+	head uint64
+	_    cacheLinePad
+	// tail is the next slot to write, written by the producer.
+	tail uint64
+	_    cacheLinePad
+
+	mask  uint64
+	slots []T
+}
+
+func newSPSC[T any](size int) *spsc[T] {
+	n := ringSize(size)
+	return &spsc[T]{mask: n - 1, slots: make([]T, n)}
+}
+
+func (q *spsc[T]) push(v T) bool {
+	tail := atomic.LoadUint64(&q.tail)
+	if tail-atomic.LoadUint64(&q.head) > q.mask {
+		return false
+	}
+	q.slots[tail&q.mask] = v
+	atomic.StoreUint64(&q.tail, tail+1)
+	return true
+}
+
+func (q *spsc[T]) pop() (v T, ok bool) {
+	head := atomic.LoadUint64(&q.head)
+	if head == atomic.LoadUint64(&q.tail) {
+		return v, false
+	}
+	slot := &q.slots[head&q.mask]
+	v = *slot
+	*slot = *new(T)
+	atomic.StoreUint64(&q.head, head+1)
+	return v, true
+}
+
+func (q *spsc[T]) len() int {
+	return int(atomic.LoadUint64(&q.tail) - atomic.LoadUint64(&q.head))
+}
+
+func (q *spsc[T]) cap() int { return len(q.slots) }
+
+func (q *spsc[T]) values() []T {
+	head, tail := atomic.LoadUint64(&q.head), atomic.LoadUint64(&q.tail)
+	vs := make([]T, 0, tail-head)
+	for i := head; i != tail; i++ {
+		vs = append(vs, q.slots[i&q.mask])
+	}
+	return vs
+}
+
+// mpsc is a ring buffer for multiple producers and a single consumer.
+//
+// Each slot has a sequence number, which tells whose turn it is: a slot
+// is free for the producer at position p when seq == p, and contains
+// a value for the consumer when seq == p+1.
+type mpsc[T any] struct {
+	_    cacheLinePad
+	head uint64
+	_    cacheLinePad
+	tail uint64
+	_    cacheLinePad
+
+	mask  uint64
+	slots []mpscSlot[T]
+}
+
+type mpscSlot[T any] struct {
+	seq uint64
+	v   T
+}
+
+func newMPSC[T any](size int) *mpsc[T] {
+	// with a single slot the free and full sequences are the same
+	if size < 2 {
+		size = 2
+	}
+	n := ringSize(size)
+	q := &mpsc[T]{mask: n - 1, slots: make([]mpscSlot[T], n)}
+	for i := range q.slots {
+		q.slots[i].seq = uint64(i)
+	}
+	return q
+}
+
+func (q *mpsc[T]) push(v T) bool {
+	for {
+		tail := atomic.LoadUint64(&q.tail)
+		slot := &q.slots[tail&q.mask]
+		seq := atomic.LoadUint64(&slot.seq)
+		switch {
+		case seq == tail:
+			if atomic.CompareAndSwapUint64(&q.tail, tail, tail+1) {
+				slot.v = v
+				atomic.StoreUint64(&slot.seq, tail+1)
+				return true
+			}
+		case seq < tail:
+			// the consumer hasn't freed the slot yet
+			return false
+		}
+		// another producer took the slot
+	}
+}
+
+func (q *mpsc[T]) pop() (v T, ok bool) {
+	head := atomic.LoadUint64(&q.head)
+	slot := &q.slots[head&q.mask]
+	if atomic.LoadUint64(&slot.seq) != head+1 {
+		return v, false
+	}
+	v = slot.v
+	slot.v = *new(T)
+	atomic.StoreUint64(&slot.seq, head+q.mask+1)
+	atomic.StoreUint64(&q.head, head+1)
+	return v, true
+}
+
+func (q *mpsc[T]) len() int {
+	// producers may have claimed slots without filling them yet
+	n := int(atomic.LoadUint64(&q.tail) - atomic.LoadUint64(&q.head))
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+func (q *mpsc[T]) cap() int { return len(q.slots) }
+
+func (q *mpsc[T]) values() []T {
+	var vs []T
+	head := atomic.LoadUint64(&q.head)
+	for i := head; i-head < uint64(len(q.slots)); i++ {
+		slot := &q.slots[i&q.mask]
+		// the slots claimed, but not yet filled, end the queue
+		if atomic.LoadUint64(&slot.seq) != i+1 {
+			break
+		}
+		vs = append(vs, slot.v)
+	}
+	return vs
+}
+
+// signal wakes up a goroutine sleeping on c.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// push queues v, waiting while the queue is full.
+// It returns false when the connection changed.
+func (conn *Conn[T]) push(ctx context.Context, v packet[T], changed <-chan struct{}) (bool, error) {
+	for {
+		if conn.ring.push(v) {
+			break
+		}
+		atomic.AddInt32(&conn.sleepingSenders, 1)
+		if conn.ring.push(v) {
+			atomic.AddInt32(&conn.sleepingSenders, -1)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			atomic.AddInt32(&conn.sleepingSenders, -1)
+			return false, ctx.Err()
+		case <-changed:
+			atomic.AddInt32(&conn.sleepingSenders, -1)
+			return false, nil
+		case <-conn.notFull:
+			atomic.AddInt32(&conn.sleepingSenders, -1)
+		}
+	}
+
+	atomic.AddUint64(&conn.delivered, 1)
+	if atomic.LoadInt32(&conn.sleepingReceiver) != 0 {
+		signal(conn.notEmpty)
+	}
+	// the receiver wakes up a single sender, pass it on
+	if atomic.LoadInt32(&conn.sleepingSenders) > 0 {
+		signal(conn.notFull)
+	}
+	return true, nil
+}
+
+// pop dequeues a value, waiting while the queue is empty.
+// It returns false when the connection changed.
+func (conn *Conn[T]) pop(ctx context.Context, changed <-chan struct{}) (v packet[T], ok bool, err error) {
+	for {
+		if v, ok := conn.ring.pop(); ok {
+			conn.popped()
+			return v, true, nil
+		}
+
+		atomic.StoreInt32(&conn.sleepingReceiver, 1)
+		if v, ok := conn.ring.pop(); ok {
+			atomic.StoreInt32(&conn.sleepingReceiver, 0)
+			conn.popped()
+			return v, true, nil
+		}
+		// Close happens after the last Send, the value may have arrived
+		// after the previous pop
+		if atomic.LoadInt32(&conn.ended) != 0 {
+			atomic.StoreInt32(&conn.sleepingReceiver, 0)
+			if v, ok := conn.ring.pop(); ok {
+				conn.popped()
+				return v, true, nil
+			}
+			return v, true, EOS
+		}
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&conn.sleepingReceiver, 0)
+			return v, false, ctx.Err()
+		case <-changed:
+			atomic.StoreInt32(&conn.sleepingReceiver, 0)
+			return v, false, nil
+		case <-conn.notEmpty:
+			atomic.StoreInt32(&conn.sleepingReceiver, 0)
+		}
+	}
+}
+
+// popped wakes up a sender waiting for space.
+func (conn *Conn[T]) popped() {
+	if atomic.LoadInt32(&conn.sleepingSenders) > 0 {
+		signal(conn.notFull)
+	}
+}
@@ -0,0 +1,260 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var ringTransports = []struct {
+	name string
+	opt  func(size int) ConnOption
+}{
+	{"SPSC", WithSPSC},
+	{"MPSC", WithMPSC},
+}
+
+func mustConnect[T any](t *testing.T, from *Out[T], to *In[T], opts ...ConnOption) *Conn[T] {
+	t.Helper()
+	conn, err := Connect(from, to, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestRingFullEmpty(t *testing.T) {
+	rings := map[string]ring[int]{
+		"SPSC": newSPSC[int](4),
+		"MPSC": newMPSC[int](4),
+	}
+	for name, q := range rings {
+		if _, ok := q.pop(); ok {
+			t.Errorf("%s: pop from an empty ring succeeded", name)
+		}
+		for i := 0; i < q.cap(); i++ {
+			if !q.push(i) {
+				t.Fatalf("%s: push %d failed below capacity %d", name, i, q.cap())
+			}
+		}
+		if q.push(-1) {
+			t.Errorf("%s: push to a full ring succeeded", name)
+		}
+		if q.len() != q.cap() {
+			t.Errorf("%s: len %d, expected %d", name, q.len(), q.cap())
+		}
+		for i := 0; i < q.cap(); i++ {
+			if v, ok := q.pop(); !ok || v != i {
+				t.Fatalf("%s: pop = %d, %v, expected %d", name, v, ok, i)
+			}
+		}
+		if _, ok := q.pop(); ok {
+			t.Errorf("%s: pop from a drained ring succeeded", name)
+		}
+	}
+}
+
+func TestRingOrder(t *testing.T) {
+	const n = 10000
+	for _, transport := range ringTransports {
+		t.Run(transport.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var out Out[int]
+			var in In[int]
+			mustConnect(t, &out, &in, transport.opt(8))
+
+			go func() {
+				for i := 0; i < n; i++ {
+					if err := out.Send(ctx, i); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+				_ = out.Close(ctx)
+			}()
+
+			for i := 0; i < n; i++ {
+				v, err := in.Recv(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if v != i {
+					t.Fatalf("received %d, expected %d", v, i)
+				}
+			}
+			if _, err := in.Recv(ctx); !errors.Is(err, EOS) {
+				t.Fatalf("expected EOS, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMPSCProducerOrder(t *testing.T) {
+	const producers, n = 4, 5000
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	type item struct{ producer, seq int }
+	var out Out[item]
+	var in In[item]
+	mustConnect(t, &out, &in, WithMPSC(8))
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if err := out.Send(ctx, item{p, i}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+	go func() {
+		wg.Wait()
+		_ = out.Close(ctx)
+	}()
+
+	next := make([]int, producers)
+	for {
+		v, err := in.Recv(ctx)
+		if errors.Is(err, EOS) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.seq != next[v.producer] {
+			t.Fatalf("producer %d: received %d, expected %d", v.producer, v.seq, next[v.producer])
+		}
+		next[v.producer]++
+	}
+	for p, got := range next {
+		if got != n {
+			t.Errorf("producer %d: received %d values, expected %d", p, got, n)
+		}
+	}
+}
+
+func TestRingWakeup(t *testing.T) {
+	for _, transport := range ringTransports {
+		t.Run(transport.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var out Out[int]
+			var in In[int]
+			conn := mustConnect(t, &out, &in, transport.opt(2))
+
+			// the receiver sleeps on an empty ring until the sender pushes
+			received := make(chan int)
+			go func() {
+				v, err := in.Recv(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				received <- v
+			}()
+			time.Sleep(10 * time.Millisecond)
+			if err := out.Send(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			if v := <-received; v != 1 {
+				t.Fatalf("received %d, expected 1", v)
+			}
+
+			// the sender sleeps on a full ring until the receiver pops
+			for i := 0; i < conn.Capacity(); i++ {
+				if err := out.Send(ctx, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sent := make(chan error)
+			go func() { sent <- out.Send(ctx, -1) }()
+			select {
+			case err := <-sent:
+				t.Fatalf("send to a full ring returned %v", err)
+			case <-time.After(10 * time.Millisecond):
+			}
+			if _, err := in.Recv(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-sent; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRingCloseDrains(t *testing.T) {
+	for _, transport := range ringTransports {
+		t.Run(transport.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var out Out[int]
+			var in In[int]
+			conn := mustConnect(t, &out, &in, transport.opt(4))
+			for i := 0; i < 3; i++ {
+				if err := out.Send(ctx, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := out.Close(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := out.Send(ctx, 3); !errors.Is(err, ErrClosed) {
+				t.Fatalf("send after Close returned %v, expected ErrClosed", err)
+			}
+
+			for i := 0; i < 3; i++ {
+				v, err := in.Recv(ctx)
+				if err != nil || v != i {
+					t.Fatalf("received %d, %v, expected %d", v, err, i)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := in.Recv(ctx); !errors.Is(err, EOS) {
+					t.Fatalf("expected EOS, got %v", err)
+				}
+			}
+			if conn.queued() != 0 || conn.packets() != 3 {
+				t.Fatalf("queued %d, delivered %d, expected 0 and 3", conn.queued(), conn.packets())
+			}
+		})
+	}
+}
+
+// TestRingCloseWhileReceiving closes the connection while the receiver
+// sleeps on the empty ring.
+func TestRingCloseWhileReceiving(t *testing.T) {
+	for _, transport := range ringTransports {
+		t.Run(transport.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var out Out[int]
+			var in In[int]
+			mustConnect(t, &out, &in, transport.opt(4))
+
+			done := make(chan error)
+			go func() {
+				_, err := in.Recv(ctx)
+				done <- err
+			}()
+			time.Sleep(10 * time.Millisecond)
+			if err := out.Close(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-done; !errors.Is(err, EOS) {
+				t.Fatalf("expected EOS, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Scale runs n instances of a stateless component, or of a component
+// keeping state per key with PartitionBy.
+//
+// The connections are made to the ports of the component as usual,
+// however the component itself isn't run. Instead n copies of it are
+// created, the packets from each In are distributed round-robin between
+// the copies, or by key with PartitionBy, and the packets from the copies
+// are merged into the Out.
+// An Out is closed after all the copies have closed it.
+//
+// The returned component should be added to the network instead of
+// component. component must be a pointer to a struct and it's not
+// supported by RunSequential.
+func Scale[C Component](component C, n int, opts ...ScaleOption) Component {
+	if n < 1 {
+		n = 1
+	}
+	var config scaleConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	rv := reflect.ValueOf(component)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("flow: Scale requires a pointer to a struct, got %T", component))
+	}
+
+	s := &scaled{template: component}
+	ports := portsOf(component)
+
+	for i := 0; i < n; i++ {
+		clone := reflect.New(rv.Elem().Type())
+		clone.Elem().Set(rv.Elem())
+		resetPorts(clone.Elem())
+		s.copies = append(s.copies, clone.Interface().(Component))
+	}
+
+	for name, p := range ports {
+		switch p := p.(type) {
+		case inPort:
+			d := &dispatch{from: p, partition: config.partition}
+			for _, instance := range s.copies {
+				to := portsOf(instance)[name].(inPort)
+				out := to.newOut()
+				if _, err := out.connect(to); err != nil {
+					panic(err)
+				}
+				d.to = append(d.to, out)
+			}
+			s.dispatch = append(s.dispatch, d)
+		case outPort:
+			m := &merge{to: p, open: int32(n)}
+			for _, instance := range s.copies {
+				from := portsOf(instance)[name].(outPort)
+				in := from.newIn()
+				if _, err := from.connect(in); err != nil {
+					panic(err)
+				}
+				m.from = append(m.from, in)
+			}
+			s.merge = append(s.merge, m)
+		}
+	}
+
+	return s
+}
+
+// ScaleOption configures Scale.
+type ScaleOption func(*scaleConfig)
+
+type scaleConfig struct {
+	// partition returns the hash of the key of v,
+	// false when v isn't partitioned.
+	partition func(v any) (uint64, bool)
+}
+
+// PartitionBy makes Scale send all the packets with the same key to the
+// same instance, which preserves their order, e.g. for stateful
+// processing per user. The other packets, such as packets of a different
+// type than T, are distributed round-robin.
+//
+// The instance is chosen by the hash of the key, hence the keys are
+// distributed evenly only when there are many more keys than instances.
+// The instances are shallow copies of the component, so the state, such
+// as maps, must be created in Init or Run.
+func PartitionBy[T any, K comparable](key func(T) K) ScaleOption {
+	return func(c *scaleConfig) {
+		c.partition = func(v any) (uint64, bool) {
+			tv, ok := v.(T)
+			if !ok {
+				return 0, false
+			}
+			return hashKey(key(tv)), true
+		}
+	}
+}
+
+// hashKey hashes a comparable value.
+func hashKey(k any) uint64 {
+	rv := reflect.ValueOf(k)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(rv.Int()) * 0x9E3779B97F4A7C15
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() * 0x9E3779B97F4A7C15
+	case reflect.String:
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(rv.String()))
+		return h.Sum64()
+	default:
+		h := fnv.New64a()
+		_, _ = fmt.Fprintf(h, "%#v", k)
+		return h.Sum64()
+	}
+}
+
+// scaled runs multiple instances of a component.
+type scaled struct {
+	template Component
+	copies   []Component
+
+	dispatch []*dispatch
+	merge    []*merge
+}
+
+// dispatch distributes packets from an In to the instances.
+type dispatch struct {
+	from      inPort
+	to        []outPort
+	partition func(v any) (uint64, bool)
+}
+
+// merge collects packets from the instances to an Out.
+type merge struct {
+	from []inPort
+	to   outPort
+	open int32
+}
+
+func (s *scaled) unwrap() Component      { return s.template }
+func (s *scaled) instances() []Component { return s.copies }
+
+func (s *scaled) Init(ctx context.Context) error {
+	for i, instance := range s.copies {
+		if initer, ok := instance.(Initializer); ok {
+			if err := initer.Init(ctx); err != nil {
+				_ = shutdown(ctx, s.copies[:i])
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *scaled) Shutdown(ctx context.Context) error {
+	return shutdown(ctx, s.copies)
+}
+
+func (s *scaled) Run(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	for _, instance := range s.copies {
+		instance := instance
+		g.Go(func() error {
+			err := instance.Run(ctx)
+			if errors.Is(err, EOS) {
+				return nil
+			}
+			return err
+		})
+	}
+
+	for _, d := range s.dispatch {
+		d := d
+		g.Go(func() error { return d.run(ctx) })
+	}
+
+	for _, m := range s.merge {
+		m := m
+		for _, from := range m.from {
+			from := from
+			g.Go(func() error { return m.run(ctx, from) })
+		}
+	}
+
+	return g.Wait()
+}
+
+func (d *dispatch) run(ctx context.Context) error {
+	for next := 0; ; next = (next + 1) % len(d.to) {
+		v, err := d.from.recvAny(ctx)
+		if errors.Is(err, EOS) {
+			for _, out := range d.to {
+				if err := out.closeAny(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		i := next
+		if d.partition != nil {
+			if hash, ok := d.partition(v); ok {
+				i = int(hash % uint64(len(d.to)))
+			}
+		}
+		if err := d.to[i].sendAny(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *merge) run(ctx context.Context, from inPort) error {
+	for {
+		v, err := from.recvAny(ctx)
+		if errors.Is(err, EOS) {
+			if atomic.AddInt32(&m.open, -1) == 0 {
+				return m.to.closeAny(ctx)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := m.to.sendAny(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// idle reports whether all the instances and the internal goroutines
+// are waiting for packets.
+func (s *scaled) idle() bool {
+	blocked := func(in inPort) bool {
+		b, _ := in.activity()
+		return b
+	}
+
+	for _, instance := range s.copies {
+		if waiting, _ := receiving(inputsOf(instance)); !waiting {
+			return false
+		}
+	}
+	for _, d := range s.dispatch {
+		if !blocked(d.from) {
+			return false
+		}
+	}
+	for _, m := range s.merge {
+		for _, in := range m.from {
+			if !blocked(in) && atomic.LoadInt32(&m.open) > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type componentKey struct{}
+
+// ComponentFromContext returns the name of the component the context
+// was given to. Components inside a Subgraph get their inner name.
+func ComponentFromContext(ctx context.Context) (Name, bool) {
+	name, ok := ctx.Value(componentKey{}).(Name)
+	return name, ok
+}
+
+// CancelComponent cancels the context of a running component,
+// while the rest of the network keeps running. The component is
+// expected to return, closing its Out ports.
+//
+// With RunSequential the component notices the cancellation
+// the next time it's scheduled.
+func (net *Network) CancelComponent(name Name) error {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	r, ok := net.running[name]
+	if !ok {
+		return fmt.Errorf("component %s is not running", name)
+	}
+	r.cancel()
+	return nil
+}
+
+// running is a component running in the network.
+type running struct {
+	component Component
+	cancel    context.CancelFunc
+	// stopped is set when Shutdown or Replace cancelled the component.
+	stopped bool
+	// done is closed when the component returns.
+	done chan struct{}
+}
+
+// scope returns the context of the component, done must be called with
+// the result of Run and returns the error to report.
+func (net *Network) scope(ctx context.Context, c Component) (context.Context, func(error) error) {
+	net.mu.Lock()
+	name := net.names[c]
+	net.mu.Unlock()
+	ctx = net.withState(ctx, name)
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, componentKey{}, name))
+
+	net.mu.Lock()
+	r := &running{component: c, cancel: cancel, done: make(chan struct{})}
+	if net.running == nil {
+		net.running = make(map[Name]*running)
+	}
+	net.running[name] = r
+	net.mu.Unlock()
+
+	return ctx, func(err error) error {
+		net.mu.Lock()
+		delete(net.running, name)
+		draining, stopped := net.draining, r.stopped
+		net.mu.Unlock()
+
+		if draining {
+			closeOutputs(c)
+		}
+		if stopped && errors.Is(err, context.Canceled) {
+			err = nil
+		}
+		cancel()
+		close(r.done)
+		return err
+	}
+}
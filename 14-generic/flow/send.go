@@ -0,0 +1,75 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Send delivers value to an input port of the named component, e.g. to
+// reconfigure it while the network is running:
+//
+//	err := net.Send(ctx, "hello", "Config", 250*time.Millisecond)
+//
+// The port is named as in graph definitions. A string is converted to
+// the type of the port like an IIP, other values must be assignable.
+//
+// A Config port takes the value immediately, whether the component is
+// running or not. Other ports must not be connected, Send connects to
+// the port and waits until the component has received the value.
+func (net *Network) Send(ctx context.Context, node Name, port PortName, value any) error {
+	c, ok := net.Node(node)
+	if !ok {
+		return fmt.Errorf("send %s.%s: node does not exist", node, port)
+	}
+	p, err := declaredPort(c, string(port))
+	if err != nil {
+		return fmt.Errorf("send %s.%s: %w", node, port, err)
+	}
+	v, err := convertValue(value, p.elemType())
+	if err != nil {
+		return fmt.Errorf("send %s.%s: %w", node, port, err)
+	}
+
+	if config, ok := p.(configPort); ok {
+		config.setAny(v.Interface())
+		return nil
+	}
+
+	in, ok := p.(inPort)
+	if _, ack := p.(ackPort); !ok || ack {
+		return fmt.Errorf("send %s.%s: not an input port", node, port)
+	}
+	if net.scheduled() {
+		return fmt.Errorf("send %s.%s: not supported with RunSequential nor RunSharded", node, port)
+	}
+	if c, ok := in.(interface{ Connected() bool }); ok && c.Connected() {
+		return fmt.Errorf("send %s.%s: port is connected", node, port)
+	}
+
+	out := in.newOut()
+	out.bind(binding{net: net, name: "send"})
+	conn, err := out.connect(in)
+	if err != nil {
+		return fmt.Errorf("send %s.%s: %w", node, port, err)
+	}
+	defer conn.Disconnect()
+	if err := out.sendAny(ctx, v.Interface()); err != nil {
+		return fmt.Errorf("send %s.%s: %w", node, port, err)
+	}
+	return nil
+}
+
+// convertValue converts value to typ, strings are parsed as literals.
+func convertValue(value any, typ reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if v.IsValid() && v.Type().AssignableTo(typ) {
+		converted := reflect.New(typ).Elem()
+		converted.Set(v)
+		return converted, nil
+	}
+	if text, ok := value.(string); ok {
+		return ParseLiteral(text, typ)
+	}
+	return reflect.Value{}, fmt.Errorf("cannot send %T to %v", value, typ)
+}
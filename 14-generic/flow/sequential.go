@@ -0,0 +1,294 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// sequentialCapacity is the number of packets a connection can hold
+// before the sender is suspended in RunSequential.
+const sequentialCapacity = 16
+
+// RunSequential runs the network cooperatively, one component at a time.
+//
+// Every component still runs in its own goroutine, however only one of
+// them is allowed to make progress at a time. Components are switched
+// only inside Send, Recv and Close, in a deterministic order. This avoids
+// most of the synchronization overhead and makes runs reproducible, as
+// long as the components use their ports only from the Run goroutine and
+// don't block on anything else.
+//
+// RunSequential returns when every component has returned or is waiting
+// for a packet that can never arrive. Connections must not be modified
+// while RunSequential is running.
+func (net *Network) RunSequential(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(net.withClock(ctx))
+	defer cancel()
+
+	if err := net.initialize(ctx); err != nil {
+		return err
+	}
+
+	s := &scheduler{
+		ctx:     ctx,
+		yielded: make(chan *task),
+	}
+	for _, c := range net.components {
+		t := s.add(c.Run)
+		t.ctx, t.done = net.scope(ctx, c)
+	}
+
+	net.setScheduler(s, nil)
+	first := net.schedule(s, cancel)
+	net.setScheduler(nil, nil)
+	if err := shutdown(ctx, net.components); first == nil {
+		first = err
+	}
+	return first
+}
+
+// schedule runs the tasks of s until they have returned or are waiting
+// for packets that cannot arrive, cancel is called in the latter case.
+// It returns the first error of the tasks.
+func (net *Network) schedule(s *scheduler, cancel context.CancelFunc) error {
+	for _, t := range s.runq {
+		go t.run(s)
+	}
+
+	alive := len(s.runq)
+	// outside counts the tasks transferring packets to other shards
+	outside := 0
+	quiescent := false
+	var first error
+	for alive > 0 {
+		if len(s.runq) == 0 && outside > 0 {
+			t := <-s.returning
+			outside--
+			t.state = taskRunnable
+			s.runq = append(s.runq, t)
+			continue
+		}
+		if len(s.runq) == 0 {
+			// everyone is waiting for a packet that cannot arrive,
+			// hence the network has finished
+			quiescent = true
+			cancel()
+			s.runq, s.parked = s.parked, nil
+			for _, t := range s.runq {
+				t.state = taskRunnable
+			}
+			continue
+		}
+
+		t := s.runq[0]
+		s.runq = s.runq[1:]
+		s.current = t
+		t.wake <- struct{}{}
+		<-s.yielded
+		s.current = nil
+
+		switch t.state {
+		case taskDone:
+			alive--
+			err := t.err
+			if errors.Is(err, EOS) || (quiescent && errors.Is(err, context.Canceled)) {
+				err = nil
+			}
+			if err != nil && first == nil {
+				first = err
+			}
+		case taskParked:
+			s.parked = append(s.parked, t)
+		case taskRunnable:
+			s.runq = append(s.runq, t)
+		case taskOutside:
+			outside++
+		}
+		for polling := outside > 0; polling; {
+			select {
+			case t := <-s.returning:
+				outside--
+				t.state = taskRunnable
+				s.runq = append(s.runq, t)
+				polling = outside > 0
+			default:
+				polling = false
+			}
+		}
+
+		// cancellation needs to wake up everyone
+		if s.ctx.Err() != nil && len(s.parked) > 0 {
+			for _, t := range s.parked {
+				t.state = taskRunnable
+			}
+			s.runq = append(s.runq, s.parked...)
+			s.parked = nil
+		}
+	}
+	return first
+}
+
+// scheduler hands control to one task at a time.
+//
+// The fields are only modified by the task that is currently running
+// or by the RunSequential loop while no task is running.
+type scheduler struct {
+	ctx     context.Context
+	current *task
+	runq    []*task
+	parked  []*task
+	yielded chan *task
+	// returning receives the tasks returning from other shards,
+	// see RunSharded
+	returning chan *task
+
+	// trace records the packets in Network.Simulate
+	trace *tracer
+}
+
+type taskState byte
+
+const (
+	taskRunnable = taskState(iota)
+	taskParked
+	taskDone
+	// taskOutside is transferring a packet to another shard
+	taskOutside
+)
+
+// task is a component running under the scheduler.
+type task struct {
+	body  func(ctx context.Context) error
+	ctx   context.Context
+	done  func(error) error
+	wake  chan struct{}
+	state taskState
+	err   error
+
+	// cause is the packet the task received last and input is the
+	// simulated input it's sending, -1 when none, see tracer
+	cause int
+	input int
+
+	// transferred counts the packets sent and received by the task and
+	// woken the ones since it was woken up, see Scheduling
+	transferred int
+	woken       int
+}
+
+// add adds a runnable task, which runs body with the context
+// of the scheduler.
+func (s *scheduler) add(body func(ctx context.Context) error) *task {
+	t := &task{
+		body:  body,
+		ctx:   s.ctx,
+		done:  func(err error) error { return err },
+		wake:  make(chan struct{}),
+		cause: -1,
+		input: -1,
+	}
+	s.runq = append(s.runq, t)
+	return t
+}
+
+func (t *task) run(s *scheduler) {
+	<-t.wake
+	t.err = t.done(t.body(t.ctx))
+	t.state = taskDone
+	s.yielded <- t
+}
+
+// park suspends the current task until it is made ready.
+func (s *scheduler) park() error {
+	t := s.current
+	t.state = taskParked
+	s.yielded <- t
+	<-t.wake
+	t.woken = 0
+	return t.ctx.Err()
+}
+
+// ready makes a parked task runnable again.
+func (s *scheduler) ready(t *task) {
+	if t == nil || t.state != taskParked {
+		return
+	}
+	for i, p := range s.parked {
+		if p == t {
+			s.parked = append(s.parked[:i], s.parked[i+1:]...)
+			break
+		}
+	}
+	t.state = taskRunnable
+	s.runq = append(s.runq, t)
+}
+
+// setScheduler sets the schedulers of RunSequential and RunSharded.
+func (net *Network) setScheduler(seq *scheduler, shards map[string]*scheduler) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.seq, net.shards = seq, shards
+}
+
+// scheduled reports whether the network is running sequentially or sharded.
+func (net *Network) scheduled() bool {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return net.seq != nil || net.shards != nil
+}
+
+// sequential returns the scheduler when the network is running sequentially.
+func (b binding) sequential() *scheduler {
+	if b.net == nil {
+		return nil
+	}
+	if b.net.shards != nil {
+		return b.net.shards[b.component()]
+	}
+	return b.net.seq
+}
+
+// sendSequential enqueues v into the connection, suspending when it's full.
+func (conn *Conn[T]) sendSequential(s *scheduler, v packet[T]) error {
+	for len(conn.queue) >= sequentialCapacity {
+		conn.sender = s.current
+		if err := s.park(); err != nil {
+			return err
+		}
+	}
+	var trace int
+	if s.trace != nil {
+		trace = s.trace.sent(s.current, conn, v.value)
+	}
+	conn.enqueue(v, trace, s.trace != nil)
+	atomic.AddUint64(&conn.delivered, 1)
+	s.ready(conn.receiver)
+	conn.receiver = nil
+	return nil
+}
+
+// recvSequential dequeues a value, suspending when there's nothing to receive.
+func (conn *Conn[T]) recvSequential(s *scheduler) (packet[T], error) {
+	var zero packet[T]
+	for len(conn.queue) == 0 {
+		if conn.eos {
+			return zero, EOS
+		}
+		conn.receiver = s.current
+		if err := s.park(); err != nil {
+			return zero, err
+		}
+	}
+
+	v := conn.queue[0]
+	conn.queue[0] = zero
+	conn.queue = conn.queue[1:]
+	if s.trace != nil {
+		s.current.cause = conn.traces[0]
+		conn.traces = conn.traces[1:]
+	}
+	s.ready(conn.sender)
+	conn.sender = nil
+	return v, nil
+}
@@ -0,0 +1,80 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+// logger appends the received values to a log shared with others.
+type logger struct {
+	In flow.In[int]
+
+	name string
+	log  *[]string
+}
+
+func (l *logger) Run(ctx context.Context) error {
+	for {
+		v, err := l.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*l.log = append(*l.log, fmt.Sprintf("%s%d", l.name, v))
+	}
+}
+
+func TestRunSequentialDeterministic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the interleaving of the pipelines is the same on every run
+	run := func() []string {
+		var net flow.Network
+		var log []string
+		for _, name := range []string{"a", "b", "c"} {
+			src, dst := &sequence{N: 20}, &logger{name: name, log: &log}
+			net.Add(src, dst)
+			flowtest.Connect(t, &src.Out, &dst.In)
+		}
+		if err := net.RunSequential(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return log
+	}
+
+	first := run()
+	if len(first) != 60 {
+		t.Fatalf("logged %d values, expected 60", len(first))
+	}
+	for i := 0; i < 5; i++ {
+		if got := run(); !reflect.DeepEqual(got, first) {
+			t.Fatalf("runs differ:\n%v\n%v", first, got)
+		}
+	}
+}
+
+func TestRunSequentialStuck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// dst waits for a packet that can never arrive
+	var net flow.Network
+	src, dst := &silent{}, std.NewCollect[int]()
+	net.Add(src, dst)
+	flowtest.Connect(t, &src.Out, &dst.In)
+	err := net.RunSequential(ctx)
+	if ctx.Err() != nil {
+		t.Fatalf("RunSequential didn't return for a stuck network: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	RunSharded is in between Run and RunSequential. The components are
+	partitioned into shards, within a shard they run one at a time like
+	with RunSequential, while the shards run in parallel. The connections
+	within a shard use the queues of RunSequential, which don't need any
+	synchronization, only the connections between the shards use ring
+	buffers like with Run. The unbuffered connections between the shards
+	get a ring buffer of DefaultShardBuffer packets for the run, as
+	handing over every packet separately between the shards would be
+	slower than running the network sequentially. The ring buffer is
+	removed afterwards, the packets left in it are received first by a
+	later run.
+
+	A component blocked on a connection to another shard lets the other
+	components of its shard run meanwhile, and rejoins the run queue of
+	its shard once the packet has been transferred. Unlike RunSequential,
+	a component waiting for a packet from another shard keeps the network
+	running, like with Run.
+
+	A shard finishes once its components have returned or are waiting for
+	packets that can't arrive from within the shard.
+
+	The shards aren't pinned to OS threads with runtime.LockOSThread. The
+	components of a shard run in their own goroutines taking turns, so
+	a locked thread would only hold the goroutine scheduling the shard,
+	while the turns would hand over to goroutines on other threads.
+*/
+
+// DefaultShardBuffer is the size of the ring buffers RunSharded adds to
+// the unbuffered connections between the shards.
+const DefaultShardBuffer = 256
+
+// WithShard assigns the component to the shard i of RunSharded, modulo
+// the number of shards. The components without a shard are assigned
+// automatically.
+func WithShard(i int) ComponentOption {
+	return func(c *componentConfig) { c.shard = &i }
+}
+
+// RunSharded runs the network partitioned into n shards, see above. It's
+// meant for networks with many lightweight components, where the cost of
+// the synchronization between them dominates.
+//
+// The components without a shard, see WithShard, are assigned in the
+// order of the packets flowing through the graph, so that the pipelines
+// are split into contiguous runs of components. The adapters and bridges
+// run outside of the shards, like with Run.
+//
+// Like with RunSequential, the components must use their ports only
+// from the Run goroutine and must not block on anything else, and the
+// connections must not be modified while RunSharded is running.
+func (net *Network) RunSharded(ctx context.Context, n int) error {
+	if n <= 0 {
+		return errors.New("number of shards must be positive")
+	}
+	ctx, cancel := context.WithCancel(net.withClock(ctx))
+	defer cancel()
+
+	if err := net.initialize(ctx); err != nil {
+		return err
+	}
+
+	shards := make([]*scheduler, n)
+	cancels := make([]context.CancelFunc, n)
+	for i := range shards {
+		var shardCtx context.Context
+		shardCtx, cancels[i] = context.WithCancel(ctx)
+		shards[i] = &scheduler{
+			ctx:       shardCtx,
+			yielded:   make(chan *task),
+			returning: make(chan *task),
+		}
+	}
+
+	assigned := net.partition(n)
+	var free []Component
+	scheduled := make(map[string]*scheduler)
+	for _, c := range net.components {
+		i, ok := assigned[c]
+		if !ok {
+			free = append(free, c)
+			continue
+		}
+		s := shards[i]
+		t := s.add(c.Run)
+		t.ctx, t.done = net.scope(s.ctx, c)
+		name, _ := net.Name(c)
+		scheduled[string(name)] = s
+	}
+	net.setScheduler(nil, scheduled)
+	defer net.setScheduler(nil, nil)
+	for _, conn := range net.Connections() {
+		s, ok := conn.(splicer)
+		b, ok2 := conn.(buffered)
+		if !ok || !ok2 {
+			continue
+		}
+		from, to := s.ends()
+		if from.boundTo().sequential() != to.boundTo().sequential() && b.buffer(DefaultShardBuffer) {
+			defer b.unbuffer()
+		}
+	}
+
+	var mu sync.Mutex
+	var first error
+	failed := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, s := range shards {
+		if len(s.runq) == 0 {
+			continue
+		}
+		i, s := i, s
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			failed(net.schedule(s, cancels[i]))
+		}()
+	}
+	for _, c := range free {
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			failed(net.run(ctx, c, nil))
+		}()
+	}
+	wg.Wait()
+	for _, cancel := range cancels {
+		cancel()
+	}
+
+	if err := shutdown(ctx, net.components); first == nil {
+		first = err
+	}
+	return first
+}
+
+// partition assigns the components to n shards. The components using
+// ports outside of their own, e.g. adapters, are left out.
+func (net *Network) partition(n int) map[Component]int {
+	// order the components by a depth-first traversal from the ones
+	// that don't receive anything
+	next := make(map[string][]string)
+	receives := make(map[string]bool)
+	for _, conn := range net.Connections() {
+		s, ok := conn.(splicer)
+		if !ok {
+			continue
+		}
+		from, to := s.ends()
+		src, dst := from.boundTo().component(), to.boundTo().component()
+		next[src] = append(next[src], dst)
+		receives[dst] = true
+	}
+
+	var order []Component
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		if c, ok := net.Node(Name(name)); ok && net.shardable(c) {
+			order = append(order, c)
+		}
+		for _, dst := range next[name] {
+			visit(dst)
+		}
+	}
+	for _, c := range net.components {
+		if name, _ := net.Name(c); !receives[string(name)] {
+			visit(string(name))
+		}
+	}
+	// the components in cycles
+	for _, c := range net.components {
+		name, _ := net.Name(c)
+		visit(string(name))
+	}
+
+	assigned := make(map[Component]int, len(order))
+	automatic := make([]Component, 0, len(order))
+	for _, c := range order {
+		if config := net.configOf(c); config != nil && config.shard != nil {
+			assigned[c] = (*config.shard%n + n) % n
+			continue
+		}
+		automatic = append(automatic, c)
+	}
+	for i, c := range automatic {
+		assigned[c] = i * n / len(automatic)
+	}
+	return assigned
+}
+
+// shardable reports whether c uses only its own ports,
+// which RunSharded identifies by the name of the component.
+func (net *Network) shardable(c Component) bool {
+	name, _ := net.Name(c)
+	for _, p := range portsOf(c) {
+		if p.boundTo().component() != string(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// local reports whether both ends of the connection run in the shard s,
+// or both run sequentially.
+func (conn *Conn[T]) local(s *scheduler) bool {
+	from, to := conn.ports()
+	return from.bound.sequential() == s && to.bound.sequential() == s
+}
+
+// buffered is implemented by the connections that can be buffered.
+type buffered interface {
+	// buffer adds a ring buffer of size to an unbuffered connection,
+	// which must not be in use, and reports whether it was added.
+	buffer(size int) bool
+	// unbuffer removes the ring buffer added by buffer, the connection
+	// must not be in use.
+	unbuffer()
+}
+
+func (conn *Conn[T]) buffer(size int) bool {
+	if conn.ring != nil {
+		return false
+	}
+	conn.ring = newSPSC[packet[T]](size)
+	conn.notEmpty = make(chan struct{}, 1)
+	conn.notFull = make(chan struct{}, 1)
+	return true
+}
+
+func (conn *Conn[T]) unbuffer() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	// the packets left are received first, like the restored ones
+	conn.restored = append(conn.restored, conn.ring.values()...)
+	atomic.StoreInt32(&conn.unrestored, int32(len(conn.restored)))
+	conn.ring, conn.notEmpty, conn.notFull = nil, nil, nil
+}
+
+// sendBlocks reports whether a Send to another shard may block.
+func (conn *Conn[T]) sendBlocks() bool {
+	return conn.ring == nil || conn.ring.len() >= conn.ring.cap()
+}
+
+// recvBlocks reports whether a Recv from another shard may block.
+func (conn *Conn[T]) recvBlocks() bool {
+	return conn.ring == nil || (conn.ring.len() == 0 && atomic.LoadInt32(&conn.ended) == 0)
+}
+
+// leave lets the other tasks of the shard run, while the current task
+// is transferring a packet to another shard.
+func (s *scheduler) leave() *task {
+	t := s.current
+	t.state = taskOutside
+	s.yielded <- t
+	return t
+}
+
+// enter waits until the task returning from another shard may run again.
+func (s *scheduler) enter(t *task) {
+	s.returning <- t
+	<-t.wake
+	t.woken = 0
+}
@@ -0,0 +1,93 @@
+package flow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+func TestRunSharded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const n = 1000
+	var net flow.Network
+	src, dst := &sequence{N: n}, std.NewCollect[int]()
+	stages := []*relay{{}, {}, {}}
+	net.Add(src, dst)
+	for _, r := range stages {
+		net.Add(r)
+	}
+	conns := []*flow.Conn[int]{flowtest.Connect(t, &src.Out, &stages[0].In)}
+	for i := 1; i < len(stages); i++ {
+		conns = append(conns, flowtest.Connect(t, &stages[i-1].Out, &stages[i].In))
+	}
+	conns = append(conns, flowtest.Connect(t, &stages[len(stages)-1].Out, &dst.In))
+
+	if err := net.RunSharded(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	got := dst.Values()
+	if len(got) != n {
+		t.Fatalf("received %d values, expected %d", len(got), n)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("received %d at %d", v, i)
+		}
+	}
+	for _, conn := range conns {
+		if conn.Capacity() != 0 {
+			t.Fatalf("%v has capacity %d after the run, expected it unbuffered", conn, conn.Capacity())
+		}
+	}
+}
+
+// taker receives N values.
+type taker struct {
+	In flow.In[int]
+	N  int
+}
+
+func (t *taker) Run(ctx context.Context) error {
+	for i := 0; i < t.N; i++ {
+		if _, err := t.In.Recv(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRunShardedLeftovers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var net flow.Network
+	src, dst := &sequence{N: 5}, &taker{N: 2}
+	net.Add(src, dst)
+	conn := flowtest.Connect(t, &src.Out, &dst.In)
+	if err := net.Configure(src, flow.WithShard(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.Configure(dst, flow.WithShard(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := net.RunSharded(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if conn.Capacity() != 0 || conn.InFlight() != 3 {
+		t.Fatalf("capacity %d with %d values in flight, expected 0 with 3", conn.Capacity(), conn.InFlight())
+	}
+	// the values left in the ring buffer are received afterwards
+	for expected := 2; expected < 5; expected++ {
+		v, err := dst.In.Recv(ctx)
+		if err != nil || v != expected {
+			t.Fatalf("received %v, %v, expected %d", v, err, expected)
+		}
+	}
+}
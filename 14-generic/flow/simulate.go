@@ -0,0 +1,380 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Simulator can be implemented by a component to take part in
+// Network.Simulate, e.g. to route the packets by the same rules as Run,
+// but without its side effects.
+type Simulator interface {
+	// Simulate is called instead of Run on a copy of the component.
+	Simulate(ctx context.Context) error
+}
+
+// SimInput is a synthetic packet for Network.Simulate.
+//
+// Port is either an unconnected In of the node, which receives Value, or
+// an Out of the node, which sends Value before the node is simulated.
+// Value is converted to the type of the port like in Network.Send.
+type SimInput struct {
+	Node  Name
+	Port  PortName
+	Value any
+}
+
+// SimHop is a packet crossing a connection in a simulation.
+type SimHop struct {
+	// Packet is the index of the hop in Simulation.Hops.
+	Packet int `json:"packet"`
+	// Parent is the packet the sender received last, -1 when none.
+	Parent int `json:"parent"`
+	// Input is the index of the SimInput the packet derives from,
+	// -1 when it derives from none, e.g. it comes from an IIP.
+	Input int    `json:"input"`
+	Conn  string `json:"conn"`
+	Value any    `json:"value"`
+}
+
+// Simulation is the result of Network.Simulate.
+type Simulation struct {
+	// Hops are the packets in the order they were sent.
+	Hops []SimHop `json:"hops"`
+}
+
+// Path returns the connections crossed by the packets derived from the
+// input, in the order they were crossed.
+func (sim *Simulation) Path(input int) []string {
+	var path []string
+	for _, hop := range sim.Hops {
+		if hop.Input == input {
+			path = append(path, hop.Conn)
+		}
+	}
+	return path
+}
+
+// Simulate is a dry run of the network, which shows the paths the
+// packets take. The inputs are sent through a copy of the network run
+// by the scheduler of RunSequential, hence the simulation is
+// deterministic and doesn't affect the network.
+//
+// The bodies of the components aren't run, nor are the lifecycle hooks
+// called. Instead the components implementing Simulator are simulated by
+// it and the other components forward every received packet to all their
+// connected Out ports, replaced by the zero value of the port when the
+// types differ. Such components drain their In ports one after another
+// and don't forward the configuration received by Config ports.
+//
+// A packet sent by a component derives from the packet it received last.
+// Only connections created with Connect can be simulated.
+func (net *Network) Simulate(ctx context.Context, inputs []SimInput) (*Simulation, error) {
+	sim, err := net.simulationCopy()
+	if err != nil {
+		return nil, fmt.Errorf("simulate: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(sim.withClock(ctx))
+	defer cancel()
+	s := &scheduler{
+		ctx:     ctx,
+		yielded: make(chan *task),
+		trace:   &tracer{},
+	}
+
+	// sends contains the values sent from the Out ports of each node
+	sends := make(map[Component][]simSend)
+	// feeds contains the values received by unconnected In ports
+	feeds := make(map[inPort][]simSend)
+	var fed []inPort
+	for i, input := range inputs {
+		c, ok := sim.Node(input.Node)
+		if !ok {
+			return nil, fmt.Errorf("simulate: input %d: node %s does not exist", i, input.Node)
+		}
+		p, err := portByName(c, string(input.Port))
+		if err != nil {
+			return nil, fmt.Errorf("simulate: input %d: %w", i, err)
+		}
+		v, err := convertValue(input.Value, p.elemType())
+		if err != nil {
+			return nil, fmt.Errorf("simulate: input %d: %s.%s: %w", i, input.Node, input.Port, err)
+		}
+
+		send := simSend{input: i, value: v.Interface()}
+		connected := isConnected(p)
+		switch p := p.(type) {
+		case outPort:
+			if !connected {
+				return nil, fmt.Errorf("simulate: input %d: %s.%s is not connected", i, input.Node, input.Port)
+			}
+			send.out = p
+			sends[c] = append(sends[c], send)
+		case inPort:
+			if _, ok := feeds[p]; !ok {
+				if connected {
+					return nil, fmt.Errorf("simulate: input %d: %s.%s is connected", i, input.Node, input.Port)
+				}
+				fed = append(fed, p)
+			}
+			feeds[p] = append(feeds[p], send)
+		}
+	}
+
+	for _, in := range fed {
+		out := in.newOut()
+		out.bind(binding{net: sim, name: "input"})
+		if _, err := out.connect(in); err != nil {
+			return nil, fmt.Errorf("simulate: %w", err)
+		}
+		for i := range feeds[in] {
+			feeds[in][i].out = out
+		}
+		values := feeds[in]
+		s.add(func(ctx context.Context) error {
+			if err := s.inject(ctx, values); err != nil {
+				return err
+			}
+			return out.closeAny(ctx)
+		})
+	}
+	for _, c := range sim.components {
+		c := c
+		values := sends[c]
+		body := func(ctx context.Context) error {
+			if err := s.inject(ctx, values); err != nil {
+				return err
+			}
+			if simulator, ok := c.(Simulator); ok {
+				return simulator.Simulate(ctx)
+			}
+			return forward(ctx, c)
+		}
+		if _, ok := c.(*iip); ok {
+			body = c.Run
+		}
+		t := s.add(body)
+		t.ctx, t.done = sim.scope(ctx, c)
+	}
+
+	sim.setScheduler(s, nil)
+	err = sim.schedule(s, cancel)
+	sim.setScheduler(nil, nil)
+	return &Simulation{Hops: s.trace.hops}, err
+}
+
+// simSend is a value sent by Simulate.
+type simSend struct {
+	input int
+	out   outPort
+	value any
+}
+
+// inject sends the values on behalf of the current task.
+func (s *scheduler) inject(ctx context.Context, values []simSend) error {
+	t := s.current
+	defer func() { t.input = -1 }()
+	for _, v := range values {
+		t.input = v.input
+		if err := v.out.sendAny(ctx, v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tracer records the packets sent in Simulate.
+type tracer struct {
+	hops []SimHop
+}
+
+// sent records v sent by t over conn and returns the packet.
+func (tr *tracer) sent(t *task, conn Connection, v any) int {
+	hop := SimHop{
+		Packet: len(tr.hops),
+		Parent: -1,
+		Input:  t.input,
+		Conn:   conn.String(),
+		Value:  v,
+	}
+	// injected values don't derive from the received packets
+	if t.input < 0 && t.cause >= 0 {
+		hop.Parent = t.cause
+		hop.Input = tr.hops[t.cause].Input
+	}
+	tr.hops = append(tr.hops, hop)
+	return hop.Packet
+}
+
+// forward sends the packets received by c to all its Out ports.
+func forward(ctx context.Context, c Component) error {
+	ports := portsOf(c)
+	names := make([]string, 0, len(ports))
+	for name := range ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ins []inPort
+	var outs []outPort
+	for _, name := range names {
+		p := ports[name]
+		if !isConnected(p) {
+			continue
+		}
+		if declared, _ := declaredPort(c, name); declared != nil {
+			if _, ok := declared.(configPort); ok {
+				continue
+			}
+		}
+		switch p := p.(type) {
+		case outPort:
+			outs = append(outs, p)
+		case inPort:
+			ins = append(ins, p)
+		}
+	}
+
+	for _, in := range ins {
+		for {
+			v, err := in.recvAny(ctx)
+			if errors.Is(err, EOS) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			for _, out := range outs {
+				w, ok := simValue(v, out.elemType())
+				if !ok {
+					continue
+				}
+				if err := out.sendAny(ctx, w); err != nil && !errors.Is(err, ErrClosed) {
+					return err
+				}
+			}
+		}
+	}
+	for _, out := range outs {
+		if err := out.closeAny(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// simValue returns v when it's assignable to typ and the zero value of
+// typ otherwise. There's no value for interfaces that v doesn't implement.
+func simValue(v any, typ reflect.Type) (any, bool) {
+	if rv := reflect.ValueOf(v); rv.IsValid() && rv.Type().AssignableTo(typ) {
+		return v, true
+	}
+	if typ.Kind() == reflect.Interface {
+		return nil, false
+	}
+	return reflect.Zero(typ).Interface(), true
+}
+
+// isConnected reports whether the port has a connection.
+func isConnected(p port) bool {
+	c, ok := p.(interface{ Connected() bool })
+	return ok && c.Connected()
+}
+
+// simulationCopy copies the components and the connections of the
+// network into a new network.
+func (net *Network) simulationCopy() (*Network, error) {
+	net.mu.Lock()
+	components := append([]Component(nil), net.components...)
+	names := make(map[Component]Name, len(net.names))
+	for c, name := range net.names {
+		names[c] = name
+	}
+	net.mu.Unlock()
+	conns := net.Connections()
+
+	// copies maps the ports of the network to the copied ones
+	copies := make(map[port]port)
+	clones := make(map[Component]Component, len(components))
+	for _, c := range components {
+		if _, ok := c.(*iip); ok {
+			continue
+		}
+		rv := reflect.ValueOf(c)
+		_, hasPorts := c.(portSet)
+		_, wraps := c.(wrapper)
+		if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct || hasPorts || wraps {
+			return nil, fmt.Errorf("%s: cannot copy %T", names[c], c)
+		}
+		clone := reflect.New(rv.Elem().Type())
+		clone.Elem().Set(rv.Elem())
+		resetPorts(clone.Elem())
+		clones[c] = clone.Interface().(Component)
+
+		cloned := portsOf(clones[c])
+		for field, p := range portsOf(c) {
+			copies[p] = cloned[field]
+		}
+	}
+
+	type link struct {
+		from outPort
+		to   inPort
+		conn Connection
+	}
+	links := make([]link, 0, len(conns))
+	for _, conn := range conns {
+		s, ok := conn.(splicer)
+		if !ok {
+			return nil, fmt.Errorf("cannot copy connection %s", conn)
+		}
+		from, to := s.ends()
+		links = append(links, link{from: from, to: to, conn: conn})
+	}
+	sort.Slice(links, func(i, k int) bool { return links[i].conn.String() < links[k].conn.String() })
+
+	sim := &Network{Params: net.Params, Clock: net.Clock}
+	for _, c := range components {
+		p, ok := c.(*iip)
+		if !ok {
+			sim.addNamed(names[c], clones[c])
+			continue
+		}
+		for _, l := range links {
+			if l.from != p.out {
+				continue
+			}
+			dst, ok := copies[l.to].(inPort)
+			if !ok {
+				return nil, fmt.Errorf("cannot copy connection %s", l.conn)
+			}
+			out := dst.newOut()
+			out.bind(binding{net: sim, name: string(names[c])})
+			if _, err := out.connect(dst); err != nil {
+				return nil, err
+			}
+			sim.addNamed(names[c], &iip{value: p.value, out: out})
+		}
+	}
+
+	for _, l := range links {
+		src, ok := copies[l.from].(outPort)
+		if !ok {
+			// IIPs are connected above, the other senders
+			// outside of the network are left out
+			continue
+		}
+		dst, ok := copies[l.to].(inPort)
+		if !ok {
+			return nil, fmt.Errorf("cannot copy connection %s", l.conn)
+		}
+		if _, err := sim.connectPorts(src, dst); err != nil {
+			return nil, fmt.Errorf("copy connection %s: %w", l.conn, err)
+		}
+	}
+	return sim, nil
+}
@@ -0,0 +1,122 @@
+package flow_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+// parity routes the even values to Even and the odd ones to Odd.
+type parity struct {
+	In        flow.In[int]
+	Even, Odd flow.Out[int]
+
+	// routed counts the values routed by Run
+	routed int
+}
+
+func (p *parity) Run(ctx context.Context) error {
+	return p.route(ctx, func() { p.routed++ })
+}
+
+// Simulate routes like Run, without counting.
+func (p *parity) Simulate(ctx context.Context) error {
+	return p.route(ctx, func() {})
+}
+
+func (p *parity) route(ctx context.Context, routed func()) error {
+	for {
+		v, err := p.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			if err := p.Even.Close(ctx); err != nil {
+				return err
+			}
+			return p.Odd.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		routed()
+		out := &p.Even
+		if v%2 != 0 {
+			out = &p.Odd
+		}
+		if err := out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var net flow.Network
+	route, even, odd := &parity{}, std.NewCollect[int](), std.NewCollect[int]()
+	net.AddNamed("route", route)
+	net.AddNamed("even", even)
+	net.AddNamed("odd", odd)
+	flowtest.Connect(t, &route.Even, &even.In)
+	flowtest.Connect(t, &route.Odd, &odd.In)
+
+	inputs := []flow.SimInput{
+		{Node: "route", Port: "In", Value: 1},
+		{Node: "route", Port: "In", Value: 2},
+	}
+	sim, err := net.Simulate(ctx, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := sim.Path(0); !reflect.DeepEqual(path, []string{"input -> route.In", "route.Odd -> odd.In"}) {
+		t.Fatalf("path of 1: %v", path)
+	}
+	if path := sim.Path(1); !reflect.DeepEqual(path, []string{"input -> route.In", "route.Even -> even.In"}) {
+		t.Fatalf("path of 2: %v", path)
+	}
+
+	// the bodies of the components didn't run
+	if route.routed != 0 || len(even.Values()) != 0 || len(odd.Values()) != 0 {
+		t.Fatal("the simulation ran the components")
+	}
+
+	// the simulation is deterministic
+	again, err := net.Simulate(ctx, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sim.Hops, again.Hops) {
+		t.Fatalf("simulations differ:\n%v\n%v", sim.Hops, again.Hops)
+	}
+}
+
+func TestSimulateForward(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// components without Simulate forward to every output
+	var net flow.Network
+	split, a, b := std.NewSplit(2, func(v int) int { return 0 }), std.NewCollect[int](), std.NewCollect[int]()
+	net.AddNamed("split", split)
+	net.AddNamed("a", a)
+	net.AddNamed("b", b)
+	flowtest.Connect(t, &split.Out[0], &a.In)
+	flowtest.Connect(t, &split.Out[1], &b.In)
+
+	sim, err := net.Simulate(ctx, []flow.SimInput{{Node: "split", Port: "In", Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := sim.Path(0); len(path) != 3 {
+		t.Fatalf("expected the value to reach both outputs, got %v", path)
+	}
+
+	if _, err := net.Simulate(ctx, []flow.SimInput{{Node: "missing", Port: "In", Value: 1}}); err == nil {
+		t.Fatal("expected an error for a missing node")
+	}
+}
@@ -0,0 +1,244 @@
+// Package slo contains components for monitoring service level objectives
+// of a running network.
+package slo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// Mark records when a packet with the specified ID was seen.
+type Mark struct {
+	ID   string
+	Time time.Time
+}
+
+// Alert is emitted when a packet exceeds the latency objective.
+type Alert struct {
+	ID      string
+	Latency time.Duration
+	// Incomplete is set when the packet hasn't reached the sink yet.
+	Incomplete bool
+	// Stats contains the statistics at the time of the alert.
+	Stats Stats
+}
+
+func (alert Alert) String() string {
+	if alert.Incomplete {
+		return fmt.Sprintf("%s: incomplete after %v", alert.ID, alert.Latency)
+	}
+	return fmt.Sprintf("%s: took %v", alert.ID, alert.Latency)
+}
+
+// Stats contains latency statistics.
+type Stats struct {
+	Completed  int
+	Violations int
+	Pending    int
+	Max        time.Duration
+	Total      time.Duration
+}
+
+// Mean returns the mean latency of completed packets.
+func (stats Stats) Mean() time.Duration {
+	if stats.Completed == 0 {
+		return 0
+	}
+	return stats.Total / time.Duration(stats.Completed)
+}
+
+// Latency monitors end-to-end latency between the source and sink marks.
+//
+// Sources send a Mark when a packet enters the pipeline and sinks send
+// a Mark with the same ID when it's done. Whenever a packet takes longer
+// than Objective an Alert is emitted.
+//
+// The ports are received concurrently, hence a sink mark may arrive before
+// its source mark, it's kept for up to Objective until the source mark
+// arrives. The pending packets are checked according to the clock of the
+// network, see flow.ClockFrom.
+type Latency struct {
+	Objective time.Duration
+
+	Source flow.In[Mark]
+	Sink   flow.In[Mark]
+	Alerts flow.Out[Alert]
+
+	mu      sync.Mutex
+	stats   Stats
+	pending map[string]time.Time
+	alerted map[string]bool
+	// early contains the sink marks, which arrived before their source
+	// marks, with the time they arrived
+	early map[string]earlyMark
+}
+
+type earlyMark struct {
+	mark    Mark
+	arrived time.Time
+}
+
+// NewLatency creates a latency monitor with the specified objective.
+func NewLatency(objective time.Duration) *Latency {
+	return &Latency{Objective: objective}
+}
+
+// Stats returns the current statistics.
+func (mon *Latency) Stats() Stats {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	return mon.statsLocked()
+}
+
+type event struct {
+	sink bool
+	mark Mark
+}
+
+func (mon *Latency) Run(ctx context.Context) error {
+	if mon.Objective <= 0 {
+		return errors.New("slo: objective must be positive")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mon.mu.Lock()
+	mon.pending = map[string]time.Time{}
+	mon.alerted = map[string]bool{}
+	mon.early = map[string]earlyMark{}
+	mon.mu.Unlock()
+
+	events := make(chan event)
+	errs := make(chan error, 2)
+	forward := func(in *flow.In[Mark], sink bool) {
+		for {
+			mark, err := in.Recv(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case events <- event{sink: sink, mark: mark}:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}
+	go forward(&mon.Source, false)
+	go forward(&mon.Sink, true)
+
+	clock := flow.ClockFrom(ctx)
+	ticker := clock.NewTicker(mon.Objective / 2)
+	defer ticker.Stop()
+
+	open := 2
+	for open > 0 {
+		var alerts []Alert
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			if !errors.Is(err, flow.EOS) {
+				return err
+			}
+			open--
+		case ev := <-events:
+			alerts = mon.observe(ev, clock.Now())
+		case now := <-ticker.C():
+			alerts = mon.overdue(now)
+		}
+
+		for _, alert := range alerts {
+			if err := mon.Alerts.Send(ctx, alert); err != nil {
+				return err
+			}
+		}
+	}
+
+	return mon.Alerts.Close(ctx)
+}
+
+// observe records a mark arriving at now and returns alerts for violations.
+func (mon *Latency) observe(ev event, now time.Time) []Alert {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+
+	if !ev.sink {
+		e, ok := mon.early[ev.mark.ID]
+		if !ok {
+			mon.pending[ev.mark.ID] = ev.mark.Time
+			return nil
+		}
+		delete(mon.early, ev.mark.ID)
+		return mon.completeLocked(ev.mark.Time, e.mark)
+	}
+
+	start, ok := mon.pending[ev.mark.ID]
+	if !ok {
+		mon.early[ev.mark.ID] = earlyMark{mark: ev.mark, arrived: now}
+		return nil
+	}
+	delete(mon.pending, ev.mark.ID)
+	return mon.completeLocked(start, ev.mark)
+}
+
+// completeLocked records the latency of a packet, which started at start
+// and ended with the sink mark end.
+func (mon *Latency) completeLocked(start time.Time, end Mark) []Alert {
+	latency := end.Time.Sub(start)
+	mon.stats.Completed++
+	mon.stats.Total += latency
+	if latency > mon.stats.Max {
+		mon.stats.Max = latency
+	}
+
+	alerted := mon.alerted[end.ID]
+	delete(mon.alerted, end.ID)
+	if latency <= mon.Objective || alerted {
+		return nil
+	}
+
+	mon.stats.Violations++
+	return []Alert{{ID: end.ID, Latency: latency, Stats: mon.statsLocked()}}
+}
+
+// overdue returns alerts for pending packets that have exceeded the objective.
+func (mon *Latency) overdue(now time.Time) []Alert {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+
+	// the source marks of these never arrived
+	for id, e := range mon.early {
+		if now.Sub(e.arrived) > mon.Objective {
+			delete(mon.early, id)
+		}
+	}
+
+	var alerts []Alert
+	for id, start := range mon.pending {
+		latency := now.Sub(start)
+		if latency <= mon.Objective || mon.alerted[id] {
+			continue
+		}
+		mon.alerted[id] = true
+		mon.stats.Violations++
+		alerts = append(alerts, Alert{ID: id, Latency: latency, Incomplete: true})
+	}
+	for i := range alerts {
+		alerts[i].Stats = mon.statsLocked()
+	}
+	return alerts
+}
+
+func (mon *Latency) statsLocked() Stats {
+	stats := mon.stats
+	stats.Pending = len(mon.pending)
+	return stats
+}
@@ -0,0 +1,110 @@
+package slo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/slo"
+)
+
+type monitor struct {
+	*slo.Latency
+	source, sink flow.Out[slo.Mark]
+	alerts       flow.In[slo.Alert]
+	clock        *flowtest.Clock
+	ctx          context.Context
+}
+
+func startMonitor(t *testing.T, objective time.Duration) *monitor {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	m := &monitor{Latency: slo.NewLatency(objective), clock: flowtest.NewClock(time.Time{})}
+	m.ctx = flow.WithClock(ctx, m.clock)
+	flowtest.Connect(t, &m.source, &m.Source)
+	flowtest.Connect(t, &m.sink, &m.Sink)
+	flowtest.Connect(t, &m.Alerts, &m.alerts)
+
+	done := make(chan error, 1)
+	go func() { done <- m.Run(m.ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	if err := m.clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func (m *monitor) send(t *testing.T, port *flow.Out[slo.Mark], id string, at time.Duration) {
+	t.Helper()
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := port.Send(m.ctx, slo.Mark{ID: id, Time: start.Add(at)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLatencySinkBeforeSource(t *testing.T) {
+	m := startMonitor(t, time.Second)
+
+	// the sink mark overtakes the source mark
+	m.send(t, &m.sink, "a", 100*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	m.send(t, &m.source, "a", 0)
+	m.send(t, &m.source, "b", 0)
+	m.send(t, &m.sink, "b", 2*time.Second)
+
+	for m.Stats().Completed < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	alert, err := m.alerts.Recv(m.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.ID != "b" || alert.Incomplete || alert.Latency != 2*time.Second {
+		t.Fatalf("unexpected alert %v", alert)
+	}
+
+	// nothing is left pending for an incomplete alert
+	m.clock.Advance(5 * time.Second)
+
+	_ = m.source.Close(m.ctx)
+	_ = m.sink.Close(m.ctx)
+	if alert, err := m.alerts.Recv(m.ctx); !errors.Is(err, flow.EOS) {
+		t.Fatalf("expected EOS, got %v, %v", alert, err)
+	}
+	if stats := m.Stats(); stats.Completed != 2 || stats.Violations != 1 || stats.Pending != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLatencyIncomplete(t *testing.T) {
+	m := startMonitor(t, time.Second)
+	m.send(t, &m.source, "a", 0)
+
+	// the mark may be observed after the first tick
+	alerts := make(chan slo.Alert, 1)
+	go func() {
+		alert, err := m.alerts.Recv(m.ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		alerts <- alert
+	}()
+	for {
+		m.clock.Advance(time.Second)
+		select {
+		case alert := <-alerts:
+			if alert.ID != "a" || !alert.Incomplete {
+				t.Fatalf("unexpected alert %v", alert)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
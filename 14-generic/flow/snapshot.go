@@ -0,0 +1,267 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshotter can be implemented by a component to include its state
+// in Network.Snapshot.
+//
+// Snapshot may be called while the component is running, so it must
+// synchronize with Run. Restore is called before the network is started.
+type Snapshotter interface {
+	Snapshot(ctx context.Context) ([]byte, error)
+	Restore(ctx context.Context, state []byte) error
+}
+
+// Snapshot is the state of a network captured by Network.Snapshot.
+type Snapshot struct {
+	Time time.Time `json:"time"`
+	// State contains the state of the Snapshotter components by node name.
+	State map[Name][]byte `json:"state,omitempty"`
+	// Pending contains the undelivered and unacknowledged packets
+	// by connection name.
+	Pending map[string][]PendingPacket `json:"pending,omitempty"`
+}
+
+// PendingPacket is a packet held by a connection.
+type PendingPacket struct {
+	ID   string `json:"id,omitempty"`
+	Data []byte `json:"data"`
+	// Priority is the priority given to SendPriority.
+	Priority int `json:"priority,omitempty"`
+}
+
+// persistent is implemented by connections that hold packets.
+type persistent interface {
+	snapshot(enc Encoding) ([]PendingPacket, error)
+	restore(enc Encoding, packets []PendingPacket) error
+}
+
+// Snapshot captures the packets held by the connections, i.e. the
+// queued and the unacknowledged ones, and the state of the components
+// implementing Snapshotter. The packets are encoded with enc, nil means
+// JSON.
+//
+// While the network is running, it must be paused, see Pause. Snapshot
+// waits until the components have settled, i.e. they wait either in
+// Recv or in Send, so that the queues don't change while they are
+// captured. The packets held by the components waiting in Send are not
+// part of the snapshot. RunSequential and RunSharded cannot be paused.
+func (net *Network) Snapshot(ctx context.Context, enc Encoding) (*Snapshot, error) {
+	if enc == nil {
+		enc = JSON
+	}
+
+	net.mu.Lock()
+	running := len(net.running) > 0
+	sequential := net.seq != nil || net.shards != nil
+	components := append([]Component(nil), net.components...)
+	net.mu.Unlock()
+	if running {
+		if sequential {
+			return nil, errors.New("snapshot: network is running sequentially")
+		}
+		if !net.Paused() {
+			return nil, errors.New("snapshot: network is running and not paused")
+		}
+		if err := net.settle(ctx); err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+	}
+
+	snap := &Snapshot{
+		Time:    time.Now(),
+		State:   make(map[Name][]byte),
+		Pending: make(map[string][]PendingPacket),
+	}
+
+	for _, conn := range net.Connections() {
+		p, ok := conn.(persistent)
+		if !ok {
+			continue
+		}
+		packets, err := p.snapshot(enc)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", conn, err)
+		}
+		if len(packets) > 0 {
+			snap.Pending[conn.String()] = packets
+		}
+	}
+
+	for _, c := range components {
+		s, ok := c.(Snapshotter)
+		if !ok {
+			continue
+		}
+		name, _ := net.Name(c)
+		state, err := s.Snapshot(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", name, err)
+		}
+		snap.State[name] = state
+	}
+	return snap, nil
+}
+
+// Restore loads a snapshot into a network that has been wired up the
+// same way as the one where the snapshot was taken. It must be called
+// before the network is started.
+//
+// The pending packets are delivered before any newly sent ones.
+func (net *Network) Restore(ctx context.Context, snap *Snapshot, enc Encoding) error {
+	if enc == nil {
+		enc = JSON
+	}
+
+	conns := make(map[string]Connection)
+	for _, conn := range net.Connections() {
+		conns[conn.String()] = conn
+	}
+	for name, packets := range snap.Pending {
+		conn, ok := conns[name]
+		if !ok {
+			return fmt.Errorf("restore: connection %q does not exist", name)
+		}
+		p, ok := conn.(persistent)
+		if !ok {
+			return fmt.Errorf("restore: connection %q cannot hold packets", name)
+		}
+		if err := p.restore(enc, packets); err != nil {
+			return fmt.Errorf("restore %s: %w", name, err)
+		}
+	}
+
+	for name, state := range snap.State {
+		c, ok := net.nodes[name]
+		if !ok {
+			return fmt.Errorf("restore: node %s does not exist", name)
+		}
+		s, ok := c.(Snapshotter)
+		if !ok {
+			return fmt.Errorf("restore: %s does not implement Snapshotter", name)
+		}
+		if err := s.Restore(ctx, state); err != nil {
+			return fmt.Errorf("restore %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// snapshot encodes the inflight and queued packets in the order they were sent.
+func (conn *AckConn[T]) snapshot(enc Encoding) ([]PendingPacket, error) {
+	conn.mu.Lock()
+	items := make([]*ackItem[T], 0, len(conn.inflight)+len(conn.queue))
+	for _, item := range conn.inflight {
+		items = append(items, item)
+	}
+	items = append(items, conn.queue...)
+	conn.mu.Unlock()
+
+	sortItems(items)
+	packets := make([]PendingPacket, 0, len(items))
+	for _, item := range items {
+		data, err := enc.Marshal(item.value)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, PendingPacket{ID: item.key, Data: data})
+	}
+	return packets, nil
+}
+
+// restore queues the packets in front of the already queued ones.
+func (conn *AckConn[T]) restore(enc Encoding, packets []PendingPacket) error {
+	items := make([]*ackItem[T], 0, len(packets))
+	for _, p := range packets {
+		var v T
+		if err := enc.Unmarshal(p.Data, &v); err != nil {
+			return err
+		}
+		items = append(items, &ackItem[T]{key: p.ID, value: v})
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	for _, item := range items {
+		conn.nextID++
+		item.id = conn.nextID
+	}
+	// renumber the existing packets so that they stay after the restored ones
+	for _, item := range conn.queue {
+		conn.nextID++
+		item.id = conn.nextID
+	}
+	conn.queue = append(items, conn.queue...)
+	notify(&conn.changed)
+	return nil
+}
+
+// snapshot encodes the queued packets in the order they are received.
+// The packets queued by RunSequential are included, once it has returned.
+func (conn *Conn[T]) snapshot(enc Encoding) ([]PendingPacket, error) {
+	conn.mu.Lock()
+	queued := append([]packet[T](nil), conn.restored...)
+	conn.mu.Unlock()
+	if conn.ring != nil {
+		queued = append(queued, conn.ring.values()...)
+	}
+	queued = append(queued, conn.queue...)
+
+	packets := make([]PendingPacket, 0, len(queued))
+	for _, p := range queued {
+		data, err := enc.Marshal(p.value)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, PendingPacket{Data: data, Priority: p.priority})
+	}
+	return packets, nil
+}
+
+// restore queues the packets to be received before the ones sent later.
+func (conn *Conn[T]) restore(enc Encoding, packets []PendingPacket) error {
+	restored := make([]packet[T], 0, len(packets))
+	for _, p := range packets {
+		var v T
+		if err := enc.Unmarshal(p.Data, &v); err != nil {
+			return err
+		}
+		restored = append(restored, packet[T]{value: v, priority: p.Priority})
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.restored = append(conn.restored, restored...)
+	atomic.StoreInt32(&conn.unrestored, int32(len(conn.restored)))
+	return nil
+}
+
+// takeRestored removes the next restored packet.
+func (conn *Conn[T]) takeRestored() (p packet[T], ok bool) {
+	if atomic.LoadInt32(&conn.unrestored) == 0 {
+		return p, false
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if len(conn.restored) == 0 {
+		return p, false
+	}
+	p = conn.restored[0]
+	conn.restored[0] = packet[T]{}
+	conn.restored = conn.restored[1:]
+	atomic.StoreInt32(&conn.unrestored, int32(len(conn.restored)))
+	return p, true
+}
+
+// taking reports whether a receiver waits in Recv while packets are
+// queued, i.e. it's about to take one.
+func (in *In[T]) taking() bool {
+	conn, _ := in.current()
+	return atomic.LoadInt32(&in.waiting) > 0 && conn != nil && conn.queued() > 0
+}
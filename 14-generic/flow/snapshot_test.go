@@ -0,0 +1,210 @@
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+var snapshotTransports = []struct {
+	name string
+	opt  flow.ConnOption
+}{
+	{"SPSC", flow.WithSPSC(8)},
+	{"MPSC", flow.WithMPSC(8)},
+	{"Adaptive", flow.WithAdaptive(8, 16)},
+	{"Priority", flow.WithPriority(8)},
+}
+
+// pipe builds a network from a source to a collector.
+func pipe(t *testing.T, n int, opt flow.ConnOption) (*flow.Network, *sequence, *std.Collect[int]) {
+	net := &flow.Network{}
+	src := &sequence{N: n}
+	dst := std.NewCollect[int]()
+	if err := net.AddNamed("src", src); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.AddNamed("dst", dst); err != nil {
+		t.Fatal(err)
+	}
+	flowtest.Connect(t, &src.Out, &dst.In, opt)
+	return net, src, dst
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	for _, transport := range snapshotTransports {
+		t.Run(transport.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			net, src, _ := pipe(t, 0, transport.opt)
+			for i := 0; i < 3; i++ {
+				if err := src.Out.Send(ctx, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			snap, err := net.Snapshot(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(snap.Pending["src.Out -> dst.In"]); n != 3 {
+				t.Fatalf("snapshot has %d pending packets, expected 3: %v", n, snap.Pending)
+			}
+
+			// the snapshot survives a round trip through storage
+			data, err := json.Marshal(snap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded flow.Snapshot
+			if err := json.Unmarshal(data, &loaded); err != nil {
+				t.Fatal(err)
+			}
+
+			restored, _, dst := pipe(t, 0, transport.opt)
+			if err := restored.Restore(ctx, &loaded, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := restored.RunToCompletion(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if got := dst.Values(); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+				t.Fatalf("received %v, expected [0 1 2]", got)
+			}
+		})
+	}
+}
+
+func TestSnapshotPriority(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	net, src, _ := pipe(t, 0, flow.WithPriority(8))
+	for i, priority := range []int{0, 2, 1} {
+		if err := src.Out.SendPriority(ctx, i, priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := net.Snapshot(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _, dst := pipe(t, 0, flow.WithPriority(8))
+	if err := restored.Restore(ctx, snap, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.RunToCompletion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.Values(); !reflect.DeepEqual(got, []int{1, 2, 0}) {
+		t.Fatalf("received %v, expected [1 2 0]", got)
+	}
+}
+
+// counter sends increasing numbers until it's cancelled.
+type counter struct {
+	Out flow.Out[int]
+}
+
+func (c *counter) Run(ctx context.Context) error {
+	for i := 0; ; i++ {
+		if err := c.Out.Send(ctx, i); err != nil {
+			return err
+		}
+	}
+}
+
+// relay forwards the packets, each after the delay.
+type relay struct {
+	In  flow.In[int]
+	Out flow.Out[int]
+
+	Delay time.Duration
+}
+
+func (r *relay) Run(ctx context.Context) error {
+	for {
+		v, err := r.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return r.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		time.Sleep(r.Delay)
+		if err := r.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+func TestSnapshotRunning(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var net flow.Network
+	// the slow mid keeps the queue in front of it full
+	src, mid, dst := &counter{}, &relay{Delay: 100 * time.Microsecond}, std.NewCollect[int]()
+	net.AddNamed("src", src)
+	net.AddNamed("mid", mid)
+	net.AddNamed("dst", dst)
+	flowtest.Connect(t, &src.Out, &mid.In, flow.WithSPSC(4))
+	flowtest.Connect(t, &mid.Out, &dst.In, flow.WithSPSC(4))
+
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- net.Run(runCtx) }()
+
+	for len(dst.Values()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := net.Snapshot(ctx, nil); err == nil {
+		t.Fatal("expected an error for a snapshot of a running network")
+	}
+
+	net.Pause()
+	snap, err := net.Snapshot(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := snap.Pending["mid.Out -> dst.In"]; len(pending) != 0 {
+		t.Fatalf("the receiving dst left %d packets queued", len(pending))
+	}
+
+	// mid waits in Send with the packet after the received ones,
+	// the queue in front of it continues from there
+	received := len(dst.Values())
+	pending := snap.Pending["src.Out -> mid.In"]
+	if len(pending) == 0 {
+		t.Fatal("expected the queue in front of mid to be captured")
+	}
+	for i, p := range pending {
+		var v int
+		if err := json.Unmarshal(p.Data, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v != received+1+i {
+			t.Fatalf("pending packet %d is %d, expected %d", i, v, received+1+i)
+		}
+	}
+	if got := len(dst.Values()); got != received {
+		t.Fatalf("received %d values while paused, expected %d", got, received)
+	}
+
+	net.Resume()
+	for len(dst.Values()) <= received+len(pending) {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
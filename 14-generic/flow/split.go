@@ -0,0 +1,29 @@
+package flow
+
+import "sync/atomic"
+
+// WithSplit makes the connection deliver percent of the packets to the
+// In port to instead, e.g. 5 for sending 5% of the traffic to a canary
+// of a new component version. The packets are split evenly, every
+// 100/percent-th packet goes to to. Like with WithDivert, to must not be
+// connected otherwise and Filtered counts the packets delivered to it.
+func WithSplit[T any](percent float64, to *In[T]) ConnOption {
+	var n uint64
+	return WithDivert(func(T) bool {
+		i := atomic.AddUint64(&n, 1) - 1
+		return uint64(float64(i+1)*percent/100) == uint64(float64(i)*percent/100)
+	}, to)
+}
+
+// WithStickySplit is like WithSplit, except that the packets with the
+// same key are delivered to the same port, e.g. all the requests of a
+// user. The keys are split by their hash, hence percent is met only
+// when there are many keys. Increasing percent moves keys only to to.
+func WithStickySplit[T any, K comparable](percent float64, to *In[T], key func(T) K) ConnOption {
+	threshold := uint64(percent * 100)
+	return WithDivert(func(v T) bool {
+		// the low bits of the integer hashes depend only on the low
+		// bits of the keys, hence sequential keys need the high ones
+		return (hashKey(key(v))>>32)%10000 >= threshold
+	}, to)
+}
@@ -0,0 +1,78 @@
+package flow_test
+
+import (
+	"context"
+	"testing"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+type keys struct {
+	Out flow.Out[int]
+
+	n, repeat int
+}
+
+func (k *keys) Run(ctx context.Context) error {
+	for r := 0; r < k.repeat; r++ {
+		for i := 0; i < k.n; i++ {
+			if err := k.Out.Send(ctx, i); err != nil {
+				return err
+			}
+		}
+	}
+	return k.Out.Close(ctx)
+}
+
+// runSplit sends the keys through a connection with opt, which splits
+// them to the second returned collect.
+func runSplit(t *testing.T, src *keys, opt func(canary *flow.In[int]) flow.ConnOption) (main, canary []int) {
+	t.Helper()
+	var net flow.Network
+	stable, next := std.NewCollect[int](), std.NewCollect[int]()
+	net.Add(src, stable, next)
+	flowtest.Connect(t, &src.Out, &stable.In, opt(&next.In))
+	if err := net.RunToCompletion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return stable.Values(), next.Values()
+}
+
+func TestSplit(t *testing.T) {
+	main, canary := runSplit(t, &keys{n: 1000, repeat: 1}, func(canary *flow.In[int]) flow.ConnOption {
+		return flow.WithSplit(5, canary)
+	})
+	if len(main) != 950 || len(canary) != 50 {
+		t.Fatalf("split %d/%d, expected 950/50", len(main), len(canary))
+	}
+}
+
+func TestStickySplit(t *testing.T) {
+	const users = 10000
+	main, canary := runSplit(t, &keys{n: users, repeat: 2}, func(canary *flow.In[int]) flow.ConnOption {
+		return flow.WithStickySplit(5, canary, func(user int) int { return user })
+	})
+
+	// sequential user IDs must spread evenly as well
+	share := float64(len(canary)) / float64(2*users) * 100
+	if share < 4 || share > 6 {
+		t.Errorf("canary got %.2f%% of the traffic, expected about 5%%", share)
+	}
+
+	side := map[int]string{}
+	check := func(name string, values []int) {
+		for _, user := range values {
+			if prev, ok := side[user]; ok && prev != name {
+				t.Fatalf("user %d was sent to both sides", user)
+			}
+			side[user] = name
+		}
+	}
+	check("main", main)
+	check("canary", canary)
+	if len(side) != users {
+		t.Fatalf("%d users arrived, expected %d", len(side), users)
+	}
+}
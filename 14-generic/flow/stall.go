@@ -0,0 +1,194 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ComponentOption configures how the network runs a component,
+// see Network.Configure.
+type ComponentOption func(*componentConfig)
+
+type componentConfig struct {
+	// stalls counts the detected stalls,
+	// it's first to keep it 64-bit aligned.
+	stalls uint64
+
+	stallTimeout time.Duration
+	restart      bool
+
+	// restarting is set while a stalled component is being restarted
+	restarting int32
+
+	// shard is the shard of RunSharded, see WithShard
+	shard *int
+}
+
+// WithStallTimeout flags the component as stalled, when it's running,
+// but neither sends nor receives a packet for d. It catches logic bugs,
+// such as a component waiting forever for an upstream that forgot to
+// close its Out. Components that are legitimately idle for longer, e.g.
+// because their input is sparse, need a longer d.
+//
+// A stall is reported to Network.OnStall and counted in the Stalls of
+// the ComponentStatus. RunSequential doesn't detect stalls.
+func WithStallTimeout(d time.Duration) ComponentOption {
+	return func(c *componentConfig) { c.stallTimeout = d }
+}
+
+// WithRestartOnStall restarts the component once it stalls, see
+// WithStallTimeout. The context of its Run is cancelled and once Run
+// returns, it's called again with the same ports and connections.
+// Hence the component must not close its Out ports when cancelled.
+// The packets it didn't acknowledge on its AckIn ports are redelivered.
+func WithRestartOnStall() ComponentOption {
+	return func(c *componentConfig) { c.restart = true }
+}
+
+// StallEvent describes a stalled component, see WithStallTimeout.
+type StallEvent struct {
+	Name  Name
+	State State
+	// Ports are the ports the component is blocked on, e.g. "b.In".
+	Ports []string
+	// Idle is how long the component hasn't sent nor received a packet.
+	Idle time.Duration
+	// Restart is set when the component is restarted,
+	// see WithRestartOnStall.
+	Restart bool
+}
+
+// Configure sets the options of component c, it must be called before
+// the network is started.
+func (net *Network) Configure(c Component, opts ...ComponentOption) error {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	if _, ok := net.names[c]; !ok {
+		return errors.New("component is not part of the network")
+	}
+	if net.options == nil {
+		net.options = make(map[Component]*componentConfig)
+	}
+	config, ok := net.options[c]
+	if !ok {
+		config = &componentConfig{}
+		net.options[c] = config
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return nil
+}
+
+// configOf returns the options of c, nil when it has none.
+func (net *Network) configOf(c Component) *componentConfig {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return net.options[c]
+}
+
+// progresser is implemented by the ports counting the packets
+// they have transferred.
+type progresser interface {
+	progress() uint32
+}
+
+func (in *In[T]) progress() uint32      { return atomic.LoadUint32(&in.received) }
+func (out *Out[T]) progress() uint32    { return atomic.LoadUint32(&out.sent) }
+func (in *AckIn[T]) progress() uint32   { _, received := in.activity(); return received }
+func (out *AckOut[T]) progress() uint32 { return atomic.LoadUint32(&out.sent) }
+
+// progressOf sums the packets transferred by the ports of c.
+func progressOf(c Component) uint64 {
+	var total uint64
+	for _, p := range portsOf(c) {
+		if p, ok := p.(progresser); ok {
+			total += uint64(p.progress())
+		}
+	}
+	return total
+}
+
+// watchStalls detects the stalls of the component running with ctx,
+// until the returned stop is called. It reports whether the component
+// was cancelled to be restarted.
+func (net *Network) watchStalls(ctx context.Context, c Component) (stop func() (restart bool)) {
+	config := net.configOf(c)
+	if config == nil || config.stallTimeout <= 0 {
+		return func() bool { return false }
+	}
+	name, _ := net.Name(c)
+
+	interval := config.stallTimeout / 4
+	if interval <= 0 {
+		interval = config.stallTimeout
+	}
+	clock := ClockFrom(ctx)
+	ticker := clock.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+
+		last, since := progressOf(c), clock.Now()
+		flagged := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+
+			now := clock.Now()
+			if total := progressOf(c); total != last {
+				last, since, flagged = total, now, false
+				continue
+			}
+			if flagged || now.Sub(since) < config.stallTimeout {
+				continue
+			}
+			flagged = true
+			atomic.AddUint64(&config.stalls, 1)
+
+			stuck := stuckOf(name, c)
+			if net.OnStall != nil {
+				net.OnStall(StallEvent{
+					Name:    name,
+					State:   stuck.State,
+					Ports:   stuck.Ports,
+					Idle:    now.Sub(since),
+					Restart: config.restart,
+				})
+			}
+			if config.restart {
+				net.mu.Lock()
+				if r, ok := net.running[name]; ok {
+					atomic.StoreInt32(&config.restarting, 1)
+					r.stopped = true
+					r.cancel()
+				}
+				net.mu.Unlock()
+				return
+			}
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		<-stopped
+		return atomic.SwapInt32(&config.restarting, 0) != 0
+	}
+}
+
+// stallsOf returns the number of stalls of c.
+func (net *Network) stallsOf(c Component) uint64 {
+	if config := net.configOf(c); config != nil {
+		return atomic.LoadUint64(&config.stalls)
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StateStore persists the state of components, see LoadState.
+type StateStore interface {
+	// Load returns the data stored under key, nil when there is none.
+	Load(ctx context.Context, key string) ([]byte, error)
+	// Store replaces the data stored under key.
+	Store(ctx context.Context, key string, data []byte) error
+}
+
+// StateVar is a value of a component kept in a StateStore.
+//
+// A StateVar must not be used concurrently.
+type StateVar[T any] struct {
+	store StateStore
+	key   string
+	value T
+}
+
+// LoadState loads the value named key of the component, init creates
+// the value when it hasn't been stored before. ctx must be the context
+// given to Run, which determines the component and the store, see
+// Network.StateStore.
+//
+// The keys are scoped by the name of the component, so a component
+// replaced with Network.Replace continues with the same state. The
+// instances created by Scale share the keys.
+//
+// The values are stored as JSON.
+func LoadState[T any](ctx context.Context, key string, init func() T) (*StateVar[T], error) {
+	scope, ok := ctx.Value(stateKey{}).(stateScope)
+	if !ok {
+		return nil, fmt.Errorf("load state %s: not called from a component", key)
+	}
+
+	v := &StateVar[T]{store: scope.store, key: scope.prefix + key}
+	data, err := v.store.Load(ctx, v.key)
+	if err != nil {
+		return nil, fmt.Errorf("load state %s: %w", v.key, err)
+	}
+	if data == nil {
+		if init != nil {
+			v.value = init()
+		}
+		return v, nil
+	}
+	if err := json.Unmarshal(data, &v.value); err != nil {
+		return nil, fmt.Errorf("load state %s: %w", v.key, err)
+	}
+	return v, nil
+}
+
+// Get returns the current value.
+func (v *StateVar[T]) Get() T { return v.value }
+
+// Set replaces the value and stores it.
+func (v *StateVar[T]) Set(ctx context.Context, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("store state %s: %w", v.key, err)
+	}
+	if err := v.store.Store(ctx, v.key, data); err != nil {
+		return fmt.Errorf("store state %s: %w", v.key, err)
+	}
+	v.value = value
+	return nil
+}
+
+type stateKey struct{}
+
+// stateScope is the state of a component in the context.
+type stateScope struct {
+	store  StateStore
+	prefix string
+}
+
+// withState adds the state scope of the component to ctx. The components
+// of a Subgraph use the store of the enclosing network, unless the
+// Subgraph has its own.
+func (net *Network) withState(ctx context.Context, name Name) context.Context {
+	parent, _ := ctx.Value(stateKey{}).(stateScope)
+	store := net.StateStore
+	if store == nil {
+		store = parent.store
+	}
+	if store == nil {
+		net.mu.Lock()
+		if net.memoryState == nil {
+			net.memoryState = &MemoryStateStore{}
+		}
+		store = net.memoryState
+		net.mu.Unlock()
+	}
+	return context.WithValue(ctx, stateKey{}, stateScope{
+		store:  store,
+		prefix: parent.prefix + string(name) + "/",
+	})
+}
+
+// MemoryStateStore keeps the state in memory, it's the default store,
+// which keeps the state between the runs of a network.
+//
+// The zero value is ready to use.
+type MemoryStateStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (store *MemoryStateStore) Load(ctx context.Context, key string) ([]byte, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.data[key], nil
+}
+
+func (store *MemoryStateStore) Store(ctx context.Context, key string, data []byte) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.data == nil {
+		store.data = make(map[string][]byte)
+	}
+	store.data[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// DirStateStore keeps the state in a directory, a file for each key.
+//
+// The files are replaced atomically, so a crash while storing
+// keeps the previous value.
+type DirStateStore struct {
+	Dir string
+}
+
+func (store DirStateStore) path(key string) string {
+	return filepath.Join(store.Dir, url.PathEscape(key)+".json")
+}
+
+func (store DirStateStore) Load(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(store.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (store DirStateStore) Store(ctx context.Context, key string, data []byte) error {
+	if err := os.MkdirAll(store.Dir, 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(store.path(key), data)
+}
@@ -0,0 +1,118 @@
+package flow_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// runs counts its runs in its state.
+type runs struct {
+	count int
+}
+
+func (r *runs) Run(ctx context.Context) error {
+	v, err := flow.LoadState(ctx, "runs", func() int { return 0 })
+	if err != nil {
+		return err
+	}
+	r.count = v.Get() + 1
+	return v.Set(ctx, r.count)
+}
+
+func TestLoadState(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stores := map[string]flow.StateStore{
+		"Default": nil,
+		"Memory":  &flow.MemoryStateStore{},
+		"Dir":     flow.DirStateStore{Dir: t.TempDir()},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			net := flow.Network{StateStore: store}
+			c := &runs{}
+			if err := net.AddNamed("c", c); err != nil {
+				t.Fatal(err)
+			}
+			for expected := 1; expected <= 2; expected++ {
+				if err := net.Run(ctx); err != nil {
+					t.Fatal(err)
+				}
+				if c.count != expected {
+					t.Fatalf("run %d counted %d", expected, c.count)
+				}
+			}
+
+			// a network sharing the store continues from the state
+			if store != nil {
+				other := flow.Network{StateStore: store}
+				c := &runs{}
+				if err := other.AddNamed("c", c); err != nil {
+					t.Fatal(err)
+				}
+				if err := other.Run(ctx); err != nil {
+					t.Fatal(err)
+				}
+				if c.count != 3 {
+					t.Fatalf("counted %d with the shared store, expected 3", c.count)
+				}
+			}
+		})
+	}
+
+	if _, err := flow.LoadState(ctx, "runs", func() int { return 0 }); err == nil {
+		t.Fatal("expected an error outside of a component")
+	}
+}
+
+func TestDirStateStore(t *testing.T) {
+	ctx := context.Background()
+	store := flow.DirStateStore{Dir: filepath.Join(t.TempDir(), "state")}
+
+	if data, err := store.Load(ctx, "a/b"); err != nil || data != nil {
+		t.Fatalf("loaded %q, %v before storing", data, err)
+	}
+	for _, value := range []string{"1", "2"} {
+		if err := store.Store(ctx, "a/b", []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := store.Load(ctx, "a/b"); err != nil || string(data) != value {
+			t.Fatalf("loaded %q, %v, expected %q", data, err, value)
+		}
+	}
+
+	// the key is a single file, without leftovers of the replacements
+	entries, err := os.ReadDir(store.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected a single file, got %d", len(entries))
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := flow.FileStore{Path: filepath.Join(t.TempDir(), "checkpoint.json")}
+
+	if snap, err := store.Load(ctx); err != nil || snap != nil {
+		t.Fatalf("loaded %v, %v before saving", snap, err)
+	}
+	saved := &flow.Snapshot{State: map[flow.Name][]byte{"src": []byte(`3`)}}
+	if err := store.Save(ctx, saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded.State["src"]) != "3" {
+		t.Fatalf("loaded state %q, expected 3", loaded.State["src"])
+	}
+}
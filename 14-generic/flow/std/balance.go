@@ -0,0 +1,296 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"fbp.example/flow"
+)
+
+// LoadBalance sends each value to the output with the fewest values
+// in flight or queued in its connection.
+//
+// A value is in flight from the moment it's assigned to an output until
+// Send returns, i.e. until the connected In has received it or, with a
+// buffered connection, until it's queued. Slow workers accumulate values
+// and receive fewer new ones, unlike with round-robin distribution.
+type LoadBalance[T any] struct {
+	In  flow.In[T]
+	Out []flow.Out[T]
+
+	// Capacity is the maximum number of values in flight per output,
+	// defaults to 1.
+	Capacity int
+}
+
+// NewLoadBalance creates a load balancer with n outputs.
+func NewLoadBalance[T any](n int) *LoadBalance[T] {
+	return &LoadBalance[T]{Out: make([]flow.Out[T], n)}
+}
+
+func (lb *LoadBalance[T]) Run(ctx context.Context) error {
+	return runBalanced(ctx, &lb.In, lb.Out, &lanes[T]{
+		capacity: lb.Capacity,
+		assign:   leastLoaded[T],
+		take:     takeOwn[T],
+		queued:   func(lane int) int { return lb.Out[lane].Queued() },
+	})
+}
+
+// WorkStealing distributes values round-robin to per-output queues,
+// outputs that have run out of work take values from the back of
+// the longest queue.
+type WorkStealing[T any] struct {
+	In  flow.In[T]
+	Out []flow.Out[T]
+
+	// Capacity is the maximum queue length per output, defaults to 1.
+	Capacity int
+}
+
+// NewWorkStealing creates a work stealing distributor with n outputs.
+func NewWorkStealing[T any](n int) *WorkStealing[T] {
+	return &WorkStealing[T]{Out: make([]flow.Out[T], n)}
+}
+
+func (ws *WorkStealing[T]) Run(ctx context.Context) error {
+	return runBalanced(ctx, &ws.In, ws.Out, &lanes[T]{
+		capacity: ws.Capacity,
+		assign:   roundRobin[T],
+		take:     takeOrSteal[T],
+	})
+}
+
+// lanes contains the values assigned to each output.
+type lanes[T any] struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	done    bool
+
+	capacity int
+	queue    [][]T
+	// inflight counts queued values and the value being sent.
+	inflight []int
+	next     int
+
+	// assign returns the lane for the next value or -1 when all are full.
+	assign func(l *lanes[T]) int
+	// take removes a value for the lane.
+	take func(l *lanes[T], lane int) (T, bool)
+	// queued returns the number of values queued in the connection of
+	// the lane, when it's taken into account.
+	queued func(lane int) int
+}
+
+// runBalanced reads values from in and sends them to outs according to l.
+func runBalanced[T any](ctx context.Context, in *flow.In[T], outs []flow.Out[T], l *lanes[T]) error {
+	if len(outs) == 0 {
+		return errors.New("no outputs")
+	}
+	if l.capacity <= 0 {
+		l.capacity = 1
+	}
+	l.queue = make([][]T, len(outs))
+	l.inflight = make([]int, len(outs))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(outs)+1)
+	for i := range outs {
+		i, out := i, &outs[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.drain(ctx, i, out); err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+
+	err := l.fill(ctx, in)
+	if err != nil {
+		errs <- err
+		cancel()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	return nil
+}
+
+// fill assigns received values to the lanes until end of stream.
+func (l *lanes[T]) fill(ctx context.Context, in *flow.In[T]) error {
+	defer l.finish()
+	for {
+		v, err := in.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		lane := l.assign(l)
+		for lane < 0 {
+			if err := l.wait(ctx); err != nil {
+				l.mu.Unlock()
+				return err
+			}
+			lane = l.assign(l)
+		}
+		l.queue[lane] = append(l.queue[lane], v)
+		l.inflight[lane]++
+		l.notify()
+		l.mu.Unlock()
+	}
+}
+
+// drain sends the values of a lane to out and closes it after
+// all the values have been sent.
+func (l *lanes[T]) drain(ctx context.Context, lane int, out *flow.Out[T]) error {
+	for {
+		l.mu.Lock()
+		v, ok := l.take(l, lane)
+		for !ok {
+			if l.done {
+				l.mu.Unlock()
+				return out.Close(ctx)
+			}
+			if err := l.wait(ctx); err != nil {
+				l.mu.Unlock()
+				return err
+			}
+			v, ok = l.take(l, lane)
+		}
+		l.mu.Unlock()
+
+		err := out.Send(ctx, v)
+
+		l.mu.Lock()
+		l.inflight[lane]--
+		l.notify()
+		l.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (l *lanes[T]) finish() {
+	l.mu.Lock()
+	l.done = true
+	l.notify()
+	l.mu.Unlock()
+}
+
+// wait waits for a change in the lanes, l.mu must be held.
+func (l *lanes[T]) wait(ctx context.Context) error {
+	if l.changed == nil {
+		l.changed = make(chan struct{})
+	}
+	changed := l.changed
+
+	l.mu.Unlock()
+	defer l.mu.Lock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-changed:
+		return nil
+	}
+}
+
+// notify wakes up everyone waiting, l.mu must be held.
+func (l *lanes[T]) notify() {
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// leastLoaded picks the lane with the fewest values in flight or
+// queued, ties are broken in turn.
+func leastLoaded[T any](l *lanes[T]) int {
+	best, least := -1, 0
+	for k := range l.inflight {
+		i := (l.next + k) % len(l.inflight)
+		if l.inflight[i] >= l.capacity {
+			continue
+		}
+		load := l.inflight[i]
+		if l.queued != nil {
+			load += l.queued(i)
+		}
+		if best < 0 || load < least {
+			best, least = i, load
+		}
+	}
+	if best >= 0 {
+		l.next = (best + 1) % len(l.inflight)
+	}
+	return best
+}
+
+// roundRobin picks the next lane that has room in its queue.
+func roundRobin[T any](l *lanes[T]) int {
+	for k := range l.queue {
+		i := (l.next + k) % len(l.queue)
+		if len(l.queue[i]) < l.capacity {
+			l.next = (i + 1) % len(l.queue)
+			return i
+		}
+	}
+	return -1
+}
+
+// takeOwn takes the oldest value from the lane.
+func takeOwn[T any](l *lanes[T], lane int) (T, bool) {
+	var zero T
+	q := l.queue[lane]
+	if len(q) == 0 {
+		return zero, false
+	}
+	v := q[0]
+	q[0] = zero
+	l.queue[lane] = q[1:]
+	return v, true
+}
+
+// takeOrSteal takes the oldest value from the lane, when the lane is empty
+// it takes the newest value from the longest lane.
+func takeOrSteal[T any](l *lanes[T], lane int) (T, bool) {
+	if v, ok := takeOwn(l, lane); ok {
+		return v, true
+	}
+
+	var zero T
+	victim := -1
+	for i, q := range l.queue {
+		if len(q) > 0 && (victim < 0 || len(q) > len(l.queue[victim])) {
+			victim = i
+		}
+	}
+	if victim < 0 {
+		return zero, false
+	}
+
+	q := l.queue[victim]
+	v := q[len(q)-1]
+	q[len(q)-1] = zero
+	l.queue[victim] = q[:len(q)-1]
+
+	l.inflight[victim]--
+	l.inflight[lane]++
+	return v, true
+}
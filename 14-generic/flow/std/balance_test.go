@@ -0,0 +1,53 @@
+package std_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+func TestLoadBalanceQueued(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lb := std.NewLoadBalance[int](2)
+	var in flow.Out[int]
+	var outs [2]flow.In[int]
+	flowtest.Connect(t, &in, &lb.In)
+	for i := range outs {
+		flowtest.Connect(t, &lb.Out[i], &outs[i], flow.WithSPSC(8))
+	}
+	go func() { _ = lb.Run(ctx) }()
+
+	// the first output is stuck, the second one keeps up
+	var received int32
+	go func() {
+		for {
+			if _, err := outs[1].Recv(ctx); err != nil {
+				return
+			}
+			atomic.AddInt32(&received, 1)
+		}
+	}()
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		if err := in.Send(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+		for int(atomic.LoadInt32(&received))+lb.Out[0].Queued() < i+1 {
+			if ctx.Err() != nil {
+				t.Fatal(ctx.Err())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if queued := lb.Out[0].Queued(); queued != 1 {
+		t.Fatalf("%d values queued for the stuck output, expected 1", queued)
+	}
+}
@@ -0,0 +1,141 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// ChaosDelay delays each value with probability Probability by a random
+// duration up to Max, for testing how the graph copes with it. The values
+// are delayed independently, hence the delayed values get reordered.
+// See also flow.Chaos.
+type ChaosDelay[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	Probability float64
+	Max         time.Duration
+	// Seed seeds the random decisions, zero uses a random seed.
+	Seed int64
+}
+
+func NewChaosDelay[T any](probability float64, max time.Duration) *ChaosDelay[T] {
+	return &ChaosDelay[T]{Probability: probability, Max: max}
+}
+
+func (d *ChaosDelay[T]) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	values := receive(ctx, &d.In)
+	rng := newRand(d.Seed)
+
+	type delayed struct {
+		v   T
+		due time.Time
+	}
+	// pending is ordered by due, the values due at the same time
+	// are kept in the order of arrival
+	var pending []delayed
+	eos := false
+
+	clock := flow.ClockFrom(ctx)
+	timer := clock.NewTimer(d.Max)
+	stopTimer(timer)
+	defer timer.Stop()
+
+	for {
+		if len(pending) > 0 {
+			stopTimer(timer)
+			timer.Reset(pending[0].due.Sub(clock.Now()))
+		} else if eos {
+			return d.Out.Close(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r := <-values:
+			if errors.Is(r.err, flow.EOS) {
+				eos, values = true, nil
+				continue
+			}
+			if r.err != nil {
+				return r.err
+			}
+			var delay time.Duration
+			if rng.Float64() < d.Probability && d.Max > 0 {
+				delay = time.Duration(rng.Int63n(int64(d.Max)))
+			}
+			due := clock.Now().Add(delay)
+			i := sort.Search(len(pending), func(i int) bool { return pending[i].due.After(due) })
+			pending = append(pending, delayed{})
+			copy(pending[i+1:], pending[i:])
+			pending[i] = delayed{r.v, due}
+		case <-timer.C():
+			next := pending[0]
+			pending[0] = delayed{}
+			pending = pending[1:]
+			if err := d.Out.Send(ctx, next.v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ChaosDrop drops each value with probability Drop and sends it twice
+// with probability Duplicate, for testing how the graph copes with it.
+// The duplicates are the same value, hence it doesn't mix with the
+// pooled values. See also flow.Chaos.
+type ChaosDrop[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	Drop      float64
+	Duplicate float64
+	// Seed seeds the random decisions, zero uses a random seed.
+	Seed int64
+}
+
+func NewChaosDrop[T any](drop, duplicate float64) *ChaosDrop[T] {
+	return &ChaosDrop[T]{Drop: drop, Duplicate: duplicate}
+}
+
+func (d *ChaosDrop[T]) Run(ctx context.Context) error {
+	rng := newRand(d.Seed)
+	for {
+		v, err := d.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return d.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if rng.Float64() < d.Drop {
+			flow.Release(v)
+			continue
+		}
+		if rng.Float64() < d.Duplicate {
+			if err := d.Out.Send(ctx, v); err != nil {
+				return err
+			}
+		}
+		if err := d.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// newRand returns a random source seeded with seed,
+// zero uses a random seed.
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
@@ -0,0 +1,35 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"fbp.example/flow"
+)
+
+// streamReader returns a reader over the chunks received from in.
+//
+// The reader returns io.EOF at end of stream and fails with the Recv error
+// otherwise. stop must be called to release the receiving goroutine.
+func streamReader(ctx context.Context, in *flow.In[[]byte]) (r io.Reader, stop func()) {
+	pr, pw := io.Pipe()
+	go func() {
+		for {
+			chunk, err := in.Recv(ctx)
+			if errors.Is(err, flow.EOS) {
+				_ = pw.Close()
+				return
+			}
+			if err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+			if _, err := pw.Write(chunk); err != nil {
+				// reader has been closed
+				return
+			}
+		}
+	}()
+	return pr, func() { _ = pr.Close() }
+}
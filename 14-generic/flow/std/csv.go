@@ -0,0 +1,275 @@
+package std
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+
+	"fbp.example/flow"
+)
+
+// CSVDecode decodes CSV rows from a byte stream into structs.
+//
+// Struct fields are matched to columns with the `csv:"name"` tag or
+// the field name, fields tagged with `csv:"-"` are skipped. When Header
+// is false the columns are assigned to the fields in declaration order.
+type CSVDecode[T any] struct {
+	In  flow.In[[]byte]
+	Out flow.Out[T]
+
+	Header bool
+	Comma  rune
+}
+
+// NewCSVDecode creates a decoder for comma separated values with a header.
+func NewCSVDecode[T any]() *CSVDecode[T] {
+	return &CSVDecode[T]{Header: true, Comma: ','}
+}
+
+func (d *CSVDecode[T]) Run(ctx context.Context) error {
+	fields, err := csvFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, stop := streamReader(ctx, &d.In)
+	defer stop()
+
+	reader := csv.NewReader(r)
+	if d.Comma != 0 {
+		reader.Comma = d.Comma
+	}
+	reader.ReuseRecord = true
+
+	// columns maps a column to the field index, -1 for ignored columns
+	var columns []int
+	if !d.Header {
+		for i := range fields {
+			columns = append(columns, i)
+		}
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return d.Out.Close(ctx)
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return err
+		}
+
+		if columns == nil {
+			columns = make([]int, len(row))
+			for i, name := range row {
+				columns[i] = -1
+				for k, field := range fields {
+					if field.name == name {
+						columns[i] = k
+					}
+				}
+			}
+			continue
+		}
+
+		var v T
+		rv := reflect.ValueOf(&v).Elem()
+		for i, text := range row {
+			if i >= len(columns) || columns[i] < 0 {
+				continue
+			}
+			field := fields[columns[i]]
+			if err := parseField(rv.FieldByIndex(field.index), text); err != nil {
+				line, _ := reader.FieldPos(i)
+				return fmt.Errorf("line %d, column %s: %w", line, field.name, err)
+			}
+		}
+
+		if err := d.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// CSVEncode encodes structs as CSV rows,
+// the fields are handled the same way as in CSVDecode.
+//
+// Each row is sent as a separate chunk, the header is sent before the first row.
+type CSVEncode[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[[]byte]
+
+	Header bool
+	Comma  rune
+}
+
+// NewCSVEncode creates an encoder for comma separated values with a header.
+func NewCSVEncode[T any]() *CSVEncode[T] {
+	return &CSVEncode[T]{Header: true, Comma: ','}
+}
+
+func (e *CSVEncode[T]) Run(ctx context.Context) error {
+	fields, err := csvFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+
+	row := make([]string, len(fields))
+	encode := func(row []string) ([]byte, error) {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if e.Comma != 0 {
+			w.Comma = e.Comma
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	}
+
+	if e.Header {
+		for i, field := range fields {
+			row[i] = field.name
+		}
+		line, err := encode(row)
+		if err != nil {
+			return err
+		}
+		if err := e.Out.Send(ctx, line); err != nil {
+			return err
+		}
+	}
+
+	for {
+		v, err := e.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return e.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		rv := reflect.ValueOf(v)
+		for i, field := range fields {
+			text, err := formatField(rv.FieldByIndex(field.index))
+			if err != nil {
+				return fmt.Errorf("column %s: %w", field.name, err)
+			}
+			row[i] = text
+		}
+
+		line, err := encode(row)
+		if err != nil {
+			return err
+		}
+		if err := e.Out.Send(ctx, line); err != nil {
+			return err
+		}
+	}
+}
+
+type csvField struct {
+	name  string
+	index []int
+}
+
+// csvFields returns the exported fields of a struct type.
+func csvFields(typ reflect.Type) ([]csvField, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("csv requires a struct, got %v", typ)
+	}
+
+	var fields []csvField
+	for _, f := range reflect.VisibleFields(typ) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("csv"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, csvField{name: name, index: f.Index})
+	}
+	return fields, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// parseField parses text into the field.
+func parseField(field reflect.Value, text string) error {
+	if reflect.PtrTo(field.Type()).Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		field.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(text, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(text, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(text, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(v)
+	default:
+		return fmt.Errorf("unsupported type %v", field.Type())
+	}
+	return nil
+}
+
+// formatField formats the field as text.
+func formatField(field reflect.Value) (string, error) {
+	if m, ok := field.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'g', -1, field.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("unsupported type %v", field.Type())
+	}
+}
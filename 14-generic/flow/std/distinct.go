@@ -0,0 +1,97 @@
+package std
+
+import (
+	"context"
+	"errors"
+
+	"fbp.example/flow"
+)
+
+// Dedup drops values that have been seen among the last Size distinct values.
+type Dedup[T comparable] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	// Size is the number of distinct values remembered,
+	// zero or less remembers every value.
+	Size int
+}
+
+func NewDedup[T comparable](size int) *Dedup[T] {
+	return &Dedup[T]{Size: size}
+}
+
+func (d *Dedup[T]) Run(ctx context.Context) error {
+	seen := map[T]struct{}{}
+	// order is a ring of the remembered values, oldest at head
+	var order []T
+	head := 0
+
+	for {
+		v, err := d.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return d.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, dup := seen[v]; dup {
+			flow.Release(v)
+			continue
+		}
+		seen[v] = struct{}{}
+		if d.Size > 0 {
+			if len(order) < d.Size {
+				order = append(order, v)
+			} else {
+				delete(seen, order[head])
+				order[head] = v
+				head = (head + 1) % len(order)
+			}
+		}
+
+		if err := d.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// DistinctUntilChanged drops values that are equal to the previous value.
+type DistinctUntilChanged[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	Equal func(a, b T) bool
+}
+
+// NewDistinctUntilChanged creates a component that compares values with ==.
+func NewDistinctUntilChanged[T comparable]() *DistinctUntilChanged[T] {
+	return &DistinctUntilChanged[T]{
+		Equal: func(a, b T) bool { return a == b },
+	}
+}
+
+func (d *DistinctUntilChanged[T]) Run(ctx context.Context) error {
+	var last T
+	first := true
+	for {
+		v, err := d.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return d.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !first && d.Equal(last, v) {
+			flow.Release(v)
+			continue
+		}
+		first, last = false, v
+
+		if err := d.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
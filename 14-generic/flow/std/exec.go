@@ -0,0 +1,262 @@
+package std
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"fbp.example/flow"
+)
+
+// ExecError is sent when a command fails.
+type ExecError struct {
+	Input string
+	// Stderr is the standard error of the command.
+	Stderr string
+	Err    error
+}
+
+func (err ExecError) Error() string {
+	if err.Stderr == "" {
+		return err.Err.Error()
+	}
+	return err.Err.Error() + ": " + strings.TrimSpace(err.Stderr)
+}
+
+func (err ExecError) Unwrap() error { return err.Err }
+
+// Exec runs a command for each received value, which lets shell tools
+// be stages of a graph. The value is written to the standard input of
+// the command and its standard output, without the trailing newline, is
+// sent to Out.
+//
+// The outputs are sent in the order the commands complete. Failed
+// commands are sent to Errors, when it's connected, otherwise they stop
+// the component.
+//
+// With Stream the command is run only once instead, every value is
+// written to its standard input as a line and every line of its
+// standard output is sent. The standard input is closed at end of
+// stream and the command must exit afterwards, a failure stops the
+// component.
+type Exec struct {
+	In     flow.In[string]
+	Out    flow.Out[string]
+	Errors flow.Out[ExecError]
+
+	// Path and Args are the command to run, see exec.Command.
+	Path string
+	Args []string
+	// Dir and Env are passed to exec.Cmd.
+	Dir string
+	Env []string
+
+	// Stream runs a single command for all the values.
+	Stream bool
+	// Stderr receives the standard error of a streaming command,
+	// defaults to os.Stderr.
+	Stderr io.Writer
+
+	// Concurrency limits the number of commands running, defaults to 1.
+	Concurrency int
+	// Timeout limits the duration of a single command, it doesn't apply
+	// to a streaming command.
+	Timeout time.Duration
+}
+
+func NewExec(path string, args ...string) *Exec {
+	return &Exec{Path: path, Args: args}
+}
+
+func (x *Exec) Run(ctx context.Context) error {
+	if x.Path == "" {
+		return errors.New("exec requires Path")
+	}
+	if x.Stream {
+		return x.stream(ctx)
+	}
+	concurrency := x.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+		cancel()
+	}
+
+	limit := make(chan struct{}, concurrency)
+	for {
+		input, err := x.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			break
+		}
+		if err != nil {
+			fail(err)
+			break
+		}
+
+		select {
+		case limit <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-limit }()
+
+			output, err := x.run(ctx, input)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !x.Errors.Connected() {
+					fail(fmt.Errorf("exec %s: %w", x.Path, err))
+					return
+				}
+				err = x.Errors.Send(ctx, err.(ExecError))
+			} else {
+				err = x.Out.Send(ctx, output)
+			}
+			if err != nil {
+				fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := x.Out.Close(ctx); err != nil {
+		return err
+	}
+	return x.Errors.Close(ctx)
+}
+
+// command returns the command to run.
+func (x *Exec) command(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, x.Path, x.Args...)
+	cmd.Dir = x.Dir
+	cmd.Env = x.Env
+	return cmd
+}
+
+// run runs the command for a single value, the error is an ExecError.
+func (x *Exec) run(ctx context.Context, input string) (string, error) {
+	if x.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, x.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := x.command(ctx)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return "", ExecError{Input: input, Stderr: stderr.String(), Err: err}
+	}
+
+	output := strings.TrimSuffix(stdout.String(), "\n")
+	return strings.TrimSuffix(output, "\r"), nil
+}
+
+// stream runs a single command for all the values.
+func (x *Exec) stream(ctx context.Context) error {
+	// the command is killed when either side fails
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := x.command(runCtx)
+	cmd.Stderr = x.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("exec %s: %w", x.Path, err)
+	}
+
+	var g errgroup.Group
+	g.Go(func() error {
+		defer func() { _ = stdin.Close() }()
+		for {
+			v, err := x.In.Recv(runCtx)
+			if errors.Is(err, flow.EOS) {
+				return nil
+			}
+			if err == nil {
+				// the command may answer a line before the next one arrives
+				_, err = io.WriteString(stdin, v+"\n")
+			}
+			if err != nil {
+				cancel()
+				return err
+			}
+		}
+	})
+	g.Go(func() error {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if err := x.Out.Send(runCtx, scanner.Text()); err != nil {
+				cancel()
+				return err
+			}
+		}
+		return scanner.Err()
+	})
+	err = g.Wait()
+	if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+		err = waitErr
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return fmt.Errorf("exec %s: %w", x.Path, err)
+	}
+	if err := x.Out.Close(ctx); err != nil {
+		return err
+	}
+	return x.Errors.Close(ctx)
+}
@@ -0,0 +1,288 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"fbp.example/flow"
+)
+
+// Split sends each value to the output selected by Route.
+//
+// Values routed outside of the Out range are dropped.
+type Split[T any] struct {
+	In  flow.In[T]
+	Out []flow.Out[T]
+
+	Route func(T) int
+}
+
+// NewSplit creates a splitter with n outputs.
+func NewSplit[T any](n int, route func(T) int) *Split[T] {
+	return &Split[T]{
+		Out:   make([]flow.Out[T], n),
+		Route: route,
+	}
+}
+
+func (s *Split[T]) Run(ctx context.Context) error {
+	for {
+		v, err := s.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return closeAll(ctx, s.Out)
+		}
+		if err != nil {
+			return err
+		}
+
+		i := s.Route(v)
+		if i < 0 || i >= len(s.Out) {
+			flow.Release(v)
+			continue
+		}
+		if err := s.Out[i].Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// Merge combines values from multiple inputs into a single output.
+//
+// By default values are forwarded in the order they arrive. When Ordered
+// is set, the inputs are read in turn, which makes the interleaving
+// deterministic, at the cost of waiting for the slowest input.
+type Merge[T any] struct {
+	In  []flow.In[T]
+	Out flow.Out[T]
+
+	Ordered bool
+}
+
+// NewMerge creates a merger with n inputs.
+func NewMerge[T any](n int, ordered bool) *Merge[T] {
+	return &Merge[T]{
+		In:      make([]flow.In[T], n),
+		Ordered: ordered,
+	}
+}
+
+func (m *Merge[T]) Run(ctx context.Context) error {
+	if m.Ordered {
+		return m.runOrdered(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(m.In))
+	for i := range m.In {
+		in := &m.In[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, err := in.Recv(ctx)
+				if errors.Is(err, flow.EOS) {
+					return
+				}
+				if err == nil {
+					err = m.Out.Send(ctx, v)
+				}
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	return m.Out.Close(ctx)
+}
+
+func (m *Merge[T]) runOrdered(ctx context.Context) error {
+	open := make([]bool, len(m.In))
+	for i := range open {
+		open[i] = true
+	}
+
+	for remaining := len(m.In); remaining > 0; {
+		for i := range m.In {
+			if !open[i] {
+				continue
+			}
+
+			v, err := m.In[i].Recv(ctx)
+			if errors.Is(err, flow.EOS) {
+				open[i] = false
+				remaining--
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := m.Out.Send(ctx, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return m.Out.Close(ctx)
+}
+
+// Sequenced is a value tagged with the input it arrived on
+// and its position on that input.
+type Sequenced[T any] struct {
+	Value  T
+	Source int
+	Seq    uint64
+}
+
+// SequencedMerge combines values from multiple inputs in a deterministic
+// order and tags them with their source and sequence number, so that the
+// downstream can rely on the interleaving in reproducible runs.
+//
+// When Less is set, every input must be sorted by it and the values are
+// merged in that order, ties are resolved by the input index. Otherwise
+// the inputs are read in turn, like with an ordered Merge.
+type SequencedMerge[T any] struct {
+	In  []flow.In[T]
+	Out flow.Out[Sequenced[T]]
+
+	Less func(a, b T) bool
+}
+
+// NewSequencedMerge creates a merger with n inputs, less may be nil.
+func NewSequencedMerge[T any](n int, less func(a, b T) bool) *SequencedMerge[T] {
+	return &SequencedMerge[T]{
+		In:   make([]flow.In[T], n),
+		Less: less,
+	}
+}
+
+func (m *SequencedMerge[T]) Run(ctx context.Context) error {
+	seq := make([]uint64, len(m.In))
+	send := func(i int, v T) error {
+		seq[i]++
+		return m.Out.Send(ctx, Sequenced[T]{Value: v, Source: i, Seq: seq[i] - 1})
+	}
+
+	// heads contains the next value of each input,
+	// nil once the input has ended
+	heads := make([]*T, len(m.In))
+	next := func(i int) error {
+		v, err := m.In[i].Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			heads[i] = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		heads[i] = &v
+		return nil
+	}
+
+	for i := range m.In {
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if m.Less == nil {
+			remaining := 0
+			for i, head := range heads {
+				if head == nil {
+					continue
+				}
+				remaining++
+				if err := send(i, *head); err != nil {
+					return err
+				}
+				if err := next(i); err != nil {
+					return err
+				}
+			}
+			if remaining == 0 {
+				return m.Out.Close(ctx)
+			}
+			continue
+		}
+
+		first := -1
+		for i, head := range heads {
+			if head != nil && (first < 0 || m.Less(*head, *heads[first])) {
+				first = i
+			}
+		}
+		if first < 0 {
+			return m.Out.Close(ctx)
+		}
+		if err := send(first, *heads[first]); err != nil {
+			return err
+		}
+		if err := next(first); err != nil {
+			return err
+		}
+	}
+}
+
+// Broadcast sends each value to every output, in order.
+//
+// Reference counted values, such as flow.Bytes, are retained for every
+// extra output, so each receiver releases its own reference.
+type Broadcast[T any] struct {
+	In  flow.In[T]
+	Out []flow.Out[T]
+}
+
+// NewBroadcast creates a broadcaster with n outputs.
+func NewBroadcast[T any](n int) *Broadcast[T] {
+	return &Broadcast[T]{Out: make([]flow.Out[T], n)}
+}
+
+func (b *Broadcast[T]) Run(ctx context.Context) error {
+	for {
+		v, err := b.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return closeAll(ctx, b.Out)
+		}
+		if err != nil {
+			return err
+		}
+
+		for i := 1; i < len(b.Out); i++ {
+			flow.Retain(v)
+		}
+		for i := range b.Out {
+			if err := b.Out[i].Send(ctx, v); err != nil {
+				// the references of the remaining outputs are still ours
+				for k := i; k < len(b.Out); k++ {
+					flow.Release(v)
+				}
+				return err
+			}
+		}
+	}
+}
+
+// closeAll closes all the outputs.
+func closeAll[T any](ctx context.Context, outs []flow.Out[T]) error {
+	for i := range outs {
+		if err := outs[i].Close(ctx); err != nil {
+			return fmt.Errorf("closing Out[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
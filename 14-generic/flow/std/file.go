@@ -0,0 +1,179 @@
+package std
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"fbp.example/flow"
+)
+
+// FileRead reads the files at the received paths and sends their lines,
+// without the line endings.
+type FileRead struct {
+	In  flow.In[string]
+	Out flow.Out[string]
+}
+
+func NewFileRead() *FileRead { return &FileRead{} }
+
+func (r *FileRead) Run(ctx context.Context) error {
+	for {
+		path, err := r.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return r.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := readFile(ctx, path, func(file *os.File) error {
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				if err := r.Out.Send(ctx, scanner.Text()); err != nil {
+					return err
+				}
+			}
+			return scanner.Err()
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// FileReadChunks reads the files at the received paths
+// and sends their content in chunks of at most Size bytes.
+type FileReadChunks struct {
+	In  flow.In[string]
+	Out flow.Out[[]byte]
+
+	Size int
+}
+
+func NewFileReadChunks(size int) *FileReadChunks {
+	return &FileReadChunks{Size: size}
+}
+
+func (r *FileReadChunks) Run(ctx context.Context) error {
+	if r.Size <= 0 {
+		return errors.New("chunk size must be positive")
+	}
+
+	for {
+		path, err := r.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return r.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := readFile(ctx, path, func(file *os.File) error {
+			for {
+				// chunks are owned by the receiver, so each needs a new buffer
+				chunk := make([]byte, r.Size)
+				n, err := io.ReadFull(file, chunk)
+				if n > 0 {
+					if err := r.Out.Send(ctx, chunk[:n]); err != nil {
+						return err
+					}
+				}
+				if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// readFile opens path and calls fn with it.
+// The file is closed when ctx is cancelled to interrupt blocked reads.
+func readFile(ctx context.Context, path string, fn func(*os.File) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = file.Close()
+		case <-done:
+		}
+	}()
+
+	err = fn(file)
+	closeErr := file.Close()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("closing %s: %w", path, closeErr)
+	}
+	return nil
+}
+
+// FileWrite writes the received values to the file at Path,
+// each followed by Separator.
+//
+// The file is synced and closed at end of stream.
+type FileWrite[T ~string | ~[]byte] struct {
+	In flow.In[T]
+
+	Path      string
+	Separator string
+	// Append appends to an existing file instead of truncating it.
+	Append bool
+}
+
+// NewFileWrite creates a writer that writes each value on a separate line.
+func NewFileWrite[T ~string | ~[]byte](path string) *FileWrite[T] {
+	return &FileWrite[T]{Path: path, Separator: "\n"}
+}
+
+func (w *FileWrite[T]) Run(ctx context.Context) (err error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if w.Append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(w.Path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("closing %s: %w", w.Path, closeErr)
+		}
+	}()
+
+	for {
+		v, err := w.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return file.Sync()
+		}
+		if err != nil {
+			return err
+		}
+
+		// a single write keeps the value and the separator together
+		// when several writers append to the same file
+		buf := make([]byte, 0, len(v)+len(w.Separator))
+		buf = append(append(buf, v...), w.Separator...)
+		if _, err := file.Write(buf); err != nil {
+			return fmt.Errorf("writing %s: %w", w.Path, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// HTTPError is sent when a request fails.
+type HTTPError[Req any] struct {
+	Request Req
+	Err     error
+}
+
+func (err HTTPError[Req]) Error() string { return err.Err.Error() }
+func (err HTTPError[Req]) Unwrap() error { return err.Err }
+
+// HTTPRequest performs an HTTP call for each received request.
+//
+// Responses are sent to Out in the order the calls complete. Failed calls
+// are sent to Errors, when it's connected, otherwise they stop the component.
+type HTTPRequest[Req, Resp any] struct {
+	In     flow.In[Req]
+	Out    flow.Out[Resp]
+	Errors flow.Out[HTTPError[Req]]
+
+	// Client is used for the calls, defaults to http.DefaultClient.
+	Client *http.Client
+	// Build creates the http request.
+	Build func(ctx context.Context, req Req) (*http.Request, error)
+	// Parse converts the response, the body is closed afterwards.
+	Parse func(req Req, resp *http.Response) (Resp, error)
+
+	// Concurrency limits the number of calls in progress, defaults to 1.
+	Concurrency int
+	// Timeout limits the duration of a single call, including Parse.
+	Timeout time.Duration
+}
+
+func NewHTTPRequest[Req, Resp any](
+	build func(ctx context.Context, req Req) (*http.Request, error),
+	parse func(req Req, resp *http.Response) (Resp, error),
+) *HTTPRequest[Req, Resp] {
+	return &HTTPRequest[Req, Resp]{Build: build, Parse: parse}
+}
+
+func (h *HTTPRequest[Req, Resp]) Run(ctx context.Context) error {
+	if h.Build == nil || h.Parse == nil {
+		return errors.New("http request requires Build and Parse")
+	}
+	concurrency := h.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+		cancel()
+	}
+
+	limit := make(chan struct{}, concurrency)
+	for {
+		req, err := h.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			break
+		}
+		if err != nil {
+			fail(err)
+			break
+		}
+
+		select {
+		case limit <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-limit }()
+
+			resp, err := h.call(ctx, req)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !h.Errors.Connected() {
+					fail(fmt.Errorf("http request: %w", err))
+					return
+				}
+				err = h.Errors.Send(ctx, HTTPError[Req]{Request: req, Err: err})
+			} else {
+				err = h.Out.Send(ctx, resp)
+			}
+			if err != nil {
+				fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := h.Out.Close(ctx); err != nil {
+		return err
+	}
+	return h.Errors.Close(ctx)
+}
+
+// call performs a single request.
+func (h *HTTPRequest[Req, Resp]) call(ctx context.Context, req Req) (Resp, error) {
+	var zero Resp
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	hreq, err := h.Build(ctx, req)
+	if err != nil {
+		return zero, err
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	hresp, err := client.Do(hreq)
+	if err != nil {
+		return zero, err
+	}
+	defer func() { _ = hresp.Body.Close() }()
+
+	return h.Parse(req, hresp)
+}
@@ -0,0 +1,76 @@
+package std
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"fbp.example/flow"
+)
+
+// JSONLDecode decodes newline delimited JSON records from a byte stream.
+//
+// The chunks may split records at arbitrary positions.
+type JSONLDecode[T any] struct {
+	In  flow.In[[]byte]
+	Out flow.Out[T]
+}
+
+func NewJSONLDecode[T any]() *JSONLDecode[T] { return &JSONLDecode[T]{} }
+
+func (d *JSONLDecode[T]) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, stop := streamReader(ctx, &d.In)
+	defer stop()
+
+	dec := json.NewDecoder(r)
+	for record := 1; ; record++ {
+		var v T
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			return d.Out.Close(ctx)
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("record %d: %w", record, err)
+		}
+
+		if err := d.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// JSONLEncode encodes each record as a line of JSON.
+type JSONLEncode[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[[]byte]
+}
+
+func NewJSONLEncode[T any]() *JSONLEncode[T] { return &JSONLEncode[T]{} }
+
+func (e *JSONLEncode[T]) Run(ctx context.Context) error {
+	for {
+		v, err := e.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return e.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		line, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := e.Out.Send(ctx, append(line, '\n')); err != nil {
+			return err
+		}
+	}
+}
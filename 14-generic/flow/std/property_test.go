@@ -0,0 +1,36 @@
+package std_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+	"fbp.example/flow/std/text"
+)
+
+// TestRandomGraphs runs random graphs of the components, the seeds are
+// fixed so that a failure is reproducible.
+func TestRandomGraphs(t *testing.T) {
+	flowtest.CheckGraphs(t, flowtest.GraphConfig{
+		Registry: flow.Registry{
+			"Even":      func() flow.Component { return std.NewFilter(func(v int) bool { return v%2 == 0 }) },
+			"Double":    func() flow.Component { return std.NewMap(func(v int) int { return 2 * v }) },
+			"Format":    func() flow.Component { return std.NewMap(strconv.Itoa) },
+			"Upper":     func() flow.Component { return &text.Upper{} },
+			"Sum":       func() flow.Component { return std.NewReduce(func(acc, v int) int { return acc + v }, 0) },
+			"Dedup":     func() flow.Component { return std.NewDedup[int](4) },
+			"Distinct":  func() flow.Component { return std.NewDistinctUntilChanged[int]() },
+			"Batch":     func() flow.Component { return std.NewBatch[int](3, time.Second) },
+			"Broadcast": func() flow.Component { return std.NewBroadcast[int](2) },
+			"Merge":     func() flow.Component { return std.NewMerge[int](2, false) },
+			"Collect":   func() flow.Component { return std.NewCollect[int]() },
+			"Count":     func() flow.Component { return std.NewCount[string]() },
+		},
+		MaxNodes: 8,
+		Graphs:   200,
+		Seed:     1,
+	})
+}
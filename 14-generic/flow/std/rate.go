@@ -0,0 +1,232 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// Throttle forwards at most PerSecond values per second.
+type Throttle[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	PerSecond float64
+}
+
+func NewThrottle[T any](perSecond float64) *Throttle[T] {
+	return &Throttle[T]{PerSecond: perSecond}
+}
+
+func (t *Throttle[T]) Run(ctx context.Context) error {
+	if t.PerSecond <= 0 {
+		return errors.New("throttle rate must be positive")
+	}
+	interval := time.Duration(float64(time.Second) / t.PerSecond)
+
+	clock := flow.ClockFrom(ctx)
+	var next time.Time
+	for {
+		v, err := t.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return t.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := flow.Sleep(ctx, next.Sub(clock.Now())); err != nil {
+			return err
+		}
+		next = clock.Now().Add(interval)
+
+		if err := t.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// Debounce forwards the last value after no new values
+// have arrived during Quiet.
+type Debounce[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	Quiet time.Duration
+}
+
+func NewDebounce[T any](quiet time.Duration) *Debounce[T] {
+	return &Debounce[T]{Quiet: quiet}
+}
+
+func (d *Debounce[T]) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	values := receive(ctx, &d.In)
+
+	timer := flow.ClockFrom(ctx).NewTimer(d.Quiet)
+	stopTimer(timer)
+	defer timer.Stop()
+
+	var last T
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r := <-values:
+			if errors.Is(r.err, flow.EOS) {
+				if pending {
+					if err := d.Out.Send(ctx, last); err != nil {
+						return err
+					}
+				}
+				return d.Out.Close(ctx)
+			}
+			if r.err != nil {
+				return r.err
+			}
+
+			if pending {
+				flow.Release(last)
+			}
+			last, pending = r.v, true
+			stopTimer(timer)
+			timer.Reset(d.Quiet)
+		case <-timer.C():
+			pending = false
+			if err := d.Out.Send(ctx, last); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Sample forwards a subset of the values.
+//
+// With Every set, every Every-th value is forwarded.
+// With Interval set, the latest value is forwarded once per Interval,
+// if any new values have arrived.
+type Sample[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	Every    int
+	Interval time.Duration
+}
+
+// NewSampleEvery creates a sampler that forwards every n-th value.
+func NewSampleEvery[T any](n int) *Sample[T] {
+	return &Sample[T]{Every: n}
+}
+
+// NewSampleInterval creates a sampler that forwards the latest value every interval.
+func NewSampleInterval[T any](interval time.Duration) *Sample[T] {
+	return &Sample[T]{Interval: interval}
+}
+
+func (s *Sample[T]) Run(ctx context.Context) error {
+	switch {
+	case s.Interval > 0:
+		return s.runInterval(ctx)
+	case s.Every > 0:
+		return s.runEvery(ctx)
+	default:
+		return errors.New("sample requires Every or Interval")
+	}
+}
+
+func (s *Sample[T]) runEvery(ctx context.Context) error {
+	for count := 1; ; count++ {
+		v, err := s.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return s.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if count%s.Every != 0 {
+			flow.Release(v)
+			continue
+		}
+		if err := s.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Sample[T]) runInterval(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	values := receive(ctx, &s.In)
+
+	ticker := flow.ClockFrom(ctx).NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	var last T
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r := <-values:
+			if errors.Is(r.err, flow.EOS) {
+				return s.Out.Close(ctx)
+			}
+			if r.err != nil {
+				return r.err
+			}
+			if pending {
+				flow.Release(last)
+			}
+			last, pending = r.v, true
+		case <-ticker.C():
+			if !pending {
+				continue
+			}
+			pending = false
+			if err := s.Out.Send(ctx, last); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// received is the result of In.Recv.
+type received[T any] struct {
+	v   T
+	err error
+}
+
+// receive forwards values from in to a channel, until Recv fails.
+// The goroutine exits when ctx is cancelled.
+func receive[T any](ctx context.Context, in *flow.In[T]) <-chan received[T] {
+	ch := make(chan received[T])
+	go func() {
+		for {
+			v, err := in.Recv(ctx)
+			select {
+			case ch <- received[T]{v, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// stopTimer stops the timer and drains its channel.
+func stopTimer(timer flow.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C():
+		default:
+		}
+	}
+}
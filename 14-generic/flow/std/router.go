@@ -0,0 +1,131 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"fbp.example/flow"
+)
+
+// Router sends each value to the output named by Key.
+//
+// The outputs can be created in a graph definition by referencing them,
+// e.g. `router.Out[error] -> alert.In`. Values with a key that doesn't
+// have a connected output are sent to Default, when it's connected,
+// otherwise they are dropped.
+//
+// Without Key the values are routed by the field given to Config, like
+// with NewFieldRouter, which configures the router from a graph
+// definition:
+//
+//	'{"field":"Level"}' -> router.Config
+type Router[T any] struct {
+	In      flow.In[T]
+	Out     map[string]*flow.Out[T]
+	Default flow.Out[T]
+	Config  flow.Config[RouterConfig]
+
+	Key func(T) string
+
+	// DropUnrouted drops values without a matching output
+	// instead of sending them to Default.
+	DropUnrouted bool
+}
+
+// RouterConfig configures a Router without Key.
+type RouterConfig struct {
+	// Field is the struct field or the map entry to route by.
+	Field string `json:"field"`
+}
+
+// NewRouter creates a router with the specified outputs.
+func NewRouter[T any](key func(T) string, outputs ...string) *Router[T] {
+	r := &Router[T]{
+		Out: make(map[string]*flow.Out[T], len(outputs)),
+		Key: key,
+	}
+	for _, name := range outputs {
+		r.Out[name] = &flow.Out[T]{}
+	}
+	return r
+}
+
+// NewFieldRouter creates a router that routes by the value of a struct field
+// or a map entry, formatted with fmt.Sprint.
+func NewFieldRouter[T any](field string, outputs ...string) *Router[T] {
+	return NewRouter(func(v T) string {
+		return fieldOf(v, field)
+	}, outputs...)
+}
+
+// fieldOf returns the struct field or the map entry of v formatted with
+// fmt.Sprint, or an empty string when v doesn't have it.
+func fieldOf(v any, field string) string {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return ""
+		}
+		rv = rv.Elem()
+	}
+
+	var fv reflect.Value
+	switch rv.Kind() {
+	case reflect.Struct:
+		fv = rv.FieldByName(field)
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			fv = rv.MapIndex(reflect.ValueOf(field).Convert(rv.Type().Key()))
+		}
+	}
+	if !fv.IsValid() || !fv.CanInterface() {
+		return ""
+	}
+	return fmt.Sprint(fv.Interface())
+}
+
+func (r *Router[T]) Run(ctx context.Context) error {
+	key := r.Key
+	if key == nil {
+		if _, err := r.Config.Await(ctx); err != nil {
+			return err
+		}
+		key = func(v T) string {
+			config, _ := r.Config.Get()
+			return fieldOf(v, config.Field)
+		}
+	}
+
+	for {
+		v, err := r.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return r.closeAll(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		out, ok := r.Out[key(v)]
+		if !ok || !out.Connected() {
+			if r.DropUnrouted || !r.Default.Connected() {
+				flow.Release(v)
+				continue
+			}
+			out = &r.Default
+		}
+		if err := out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Router[T]) closeAll(ctx context.Context) error {
+	for name, out := range r.Out {
+		if err := out.Close(ctx); err != nil {
+			return fmt.Errorf("closing Out[%s]: %w", name, err)
+		}
+	}
+	return r.Default.Close(ctx)
+}
@@ -0,0 +1,96 @@
+package std_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+func TestRouterUnconnectedOutput(t *testing.T) {
+	c := std.NewRouter(func(v string) string { return v[:1] }, "a", "b")
+	h := flowtest.New(t, c)
+	in := flowtest.NewInput(h, &c.In)
+	// Out[b] is not connected, its values go to Default
+	a := flowtest.Collect(h, c.Out["a"])
+	rest := flowtest.Collect(h, &c.Default)
+
+	in.Send("a1")
+	a.Expect("a1")
+	in.Send("b1")
+	rest.Expect("b1")
+	in.Send("c1")
+	rest.Expect("c1")
+	in.Close()
+	a.ExpectEOS()
+	rest.ExpectEOS()
+}
+
+func TestRouterDropUnconnectedOutput(t *testing.T) {
+	c := std.NewRouter(func(v string) string { return v[:1] }, "a", "b")
+	h := flowtest.New(t, c)
+	flowtest.Feed(h, &c.In, "a1", "b1", "a2")
+	flowtest.Collect(h, c.Out["a"]).Expect("a1", "a2").ExpectEOS()
+	if err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type event struct {
+	Level string
+	Text  string
+}
+
+func TestRouterConfig(t *testing.T) {
+	events := []event{{"error", "disk"}, {"info", "ok"}, {"error", "net"}, {"warn", "slow"}}
+	errs := std.NewCollect[event]()
+	rest := std.NewCollect[event]()
+	net := &flow.Network{Registry: flow.Registry{
+		"Router": func() flow.Component { return &std.Router[event]{} },
+	}}
+	net.AddNamed("errors", errs)
+	net.AddNamed("rest", rest)
+	err := net.Setup(`
+		: router Router
+		'{"field":"Level"}' -> router.Config
+		router.Out[error] -> errors.In
+		router.Default -> rest.In
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, _ := net.Node("router")
+	src := &feed[event]{values: events}
+	net.Add(src)
+	flowtest.Connect(t, &src.Out, &router.(*std.Router[event]).In)
+	if err := net.RunToCompletion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := errs.Values(), []event{events[0], events[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("errors got %v, expected %v", got, want)
+	}
+	if got, want := rest.Values(), []event{events[1], events[3]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rest got %v, expected %v", got, want)
+	}
+}
+
+// feed sends the values and closes the port.
+type feed[T any] struct {
+	Out flow.Out[T]
+
+	values []T
+}
+
+func (f *feed[T]) Run(ctx context.Context) error {
+	for _, v := range f.values {
+		if err := f.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+	return f.Out.Close(ctx)
+}
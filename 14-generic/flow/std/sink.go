@@ -0,0 +1,101 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"fbp.example/flow"
+)
+
+// Discard receives and drops all the values, releasing them, see
+// flow.Release.
+type Discard[T any] struct {
+	In flow.In[T]
+}
+
+func NewDiscard[T any]() *Discard[T] { return &Discard[T]{} }
+
+func (d *Discard[T]) Run(ctx context.Context) error {
+	for {
+		v, err := d.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		flow.Release(v)
+	}
+}
+
+// Collect accumulates the received values, e.g. for checking the output
+// of a network in a test.
+type Collect[T any] struct {
+	In flow.In[T]
+
+	mu     sync.Mutex
+	values []T
+}
+
+func NewCollect[T any]() *Collect[T] { return &Collect[T]{} }
+
+func (c *Collect[T]) Run(ctx context.Context) error {
+	for {
+		v, err := c.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.values = append(c.values, v)
+		c.mu.Unlock()
+	}
+}
+
+// Values returns the values received so far in the order of arrival.
+func (c *Collect[T]) Values() []T {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]T(nil), c.values...)
+}
+
+// Reset forgets the received values, so that the component can be
+// reused, see flow.Resetter.
+func (c *Collect[T]) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = nil
+}
+
+// Count counts and releases the received values, see flow.Release.
+type Count[T any] struct {
+	In flow.In[T]
+
+	n uint64
+}
+
+func NewCount[T any]() *Count[T] { return &Count[T]{} }
+
+func (c *Count[T]) Run(ctx context.Context) error {
+	for {
+		v, err := c.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		atomic.AddUint64(&c.n, 1)
+		flow.Release(v)
+	}
+}
+
+// Value returns the number of values received so far.
+func (c *Count[T]) Value() uint64 { return atomic.LoadUint64(&c.n) }
+
+// Reset sets the count to zero, see flow.Resetter.
+func (c *Count[T]) Reset() { atomic.StoreUint64(&c.n, 0) }
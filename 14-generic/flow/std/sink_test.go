@@ -0,0 +1,56 @@
+package std_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+type numbers struct {
+	Out flow.Out[int]
+
+	n int
+}
+
+func (s *numbers) Run(ctx context.Context) error {
+	for i := 0; i < s.n; i++ {
+		if err := s.Out.Send(ctx, i); err != nil {
+			return err
+		}
+	}
+	return s.Out.Close(ctx)
+}
+
+func TestSinks(t *testing.T) {
+	var net flow.Network
+	src := &numbers{n: 5}
+	broadcast := std.NewBroadcast[int](3)
+	collect := std.NewCollect[int]()
+	count := std.NewCount[int]()
+	discard := std.NewDiscard[int]()
+	net.Add(src, broadcast, collect, count, discard)
+	flowtest.Connect(t, &src.Out, &broadcast.In)
+	flowtest.Connect(t, &broadcast.Out[0], &collect.In)
+	flowtest.Connect(t, &broadcast.Out[1], &count.In)
+	flowtest.Connect(t, &broadcast.Out[2], &discard.In)
+
+	if err := net.RunToCompletion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := collect.Values(), []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %v, expected %v", got, want)
+	}
+	if got := count.Value(); got != 5 {
+		t.Errorf("counted %d, expected 5", got)
+	}
+
+	collect.Reset()
+	count.Reset()
+	if len(collect.Values()) != 0 || count.Value() != 0 {
+		t.Error("Reset did not clear the sinks")
+	}
+}
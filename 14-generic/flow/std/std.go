@@ -0,0 +1,5 @@
+// Package std contains generic components for building networks.
+//
+// All the components close their Out ports once their In ports have
+// reached end of stream.
+package std
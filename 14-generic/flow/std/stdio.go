@@ -0,0 +1,138 @@
+package std
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"fbp.example/flow"
+)
+
+// Stdin sends the lines read from the standard input, without the line
+// endings, and closes Out at the end of the input. It lets a network
+// take part in a Unix pipeline.
+//
+// A read of the standard input can't be interrupted, hence when ctx is
+// cancelled Run returns while the pending read continues in the
+// background.
+type Stdin struct {
+	Out flow.Out[string]
+
+	// Reader is read instead of os.Stdin, when set.
+	Reader io.Reader
+}
+
+func NewStdin() *Stdin { return &Stdin{} }
+
+func (s *Stdin) Run(ctx context.Context) error {
+	r := s.Reader
+	if r == nil {
+		r = os.Stdin
+	}
+
+	lines := make(chan string)
+	failed := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				failed <- ctx.Err()
+				return
+			}
+		}
+		failed <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				if err := <-failed; err != nil {
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						return ctxErr
+					}
+					return fmt.Errorf("reading stdin: %w", err)
+				}
+				return s.Out.Close(ctx)
+			}
+			if err := s.Out.Send(ctx, line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Stdout writes each received value to the standard output on a line
+// of its own. Strings and byte slices are written as they are, other
+// values are formatted with fmt.Sprint.
+type Stdout[T any] struct {
+	In flow.In[T]
+
+	// Writer is written instead of os.Stdout, when set.
+	Writer io.Writer
+}
+
+func NewStdout[T any]() *Stdout[T] { return &Stdout[T]{} }
+
+func (s *Stdout[T]) Run(ctx context.Context) error {
+	w := s.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	return writeLines(ctx, &s.In, w, "stdout")
+}
+
+// Stderr is like Stdout, except that it writes to the standard error,
+// e.g. the diagnostics of a network whose output is piped further.
+type Stderr[T any] struct {
+	In flow.In[T]
+
+	// Writer is written instead of os.Stderr, when set.
+	Writer io.Writer
+}
+
+func NewStderr[T any]() *Stderr[T] { return &Stderr[T]{} }
+
+func (s *Stderr[T]) Run(ctx context.Context) error {
+	w := s.Writer
+	if w == nil {
+		w = os.Stderr
+	}
+	return writeLines(ctx, &s.In, w, "stderr")
+}
+
+// writeLines writes the values received from in to w, one per line.
+func writeLines[T any](ctx context.Context, in *flow.In[T], w io.Writer, name string) error {
+	var buf []byte
+	for {
+		v, err := in.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// a single write keeps the lines of several writers apart
+		switch v := any(v).(type) {
+		case string:
+			buf = append(buf[:0], v...)
+		case []byte:
+			buf = append(buf[:0], v...)
+		default:
+			buf = append(buf[:0], fmt.Sprint(v)...)
+		}
+		buf = append(buf, '\n')
+		if _, err := w.Write(buf); err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package text contains components for processing strings.
+//
+// The components taking a pattern or other parameters receive them
+// through a Config port, usually from an IIP:
+//
+//	'^ERROR ([a-z]+)' -> errors.Config
+//	'{"pattern":" +","with":" "}' -> squash.Config
+//
+// Note that a backslash must be escaped within an IIP, e.g. '\\d+'.
+//
+// The configuration can be updated while the component runs, it's used
+// from the next value onwards.
+package text
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"fbp.example/flow"
+)
+
+// Regexp is a regular expression, which is compiled when it's parsed
+// from an IIP or JSON.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+func (r *Regexp) UnmarshalText(text []byte) error {
+	rx, err := regexp.Compile(string(text))
+	if err != nil {
+		return err
+	}
+	r.Regexp = rx
+	return nil
+}
+
+func (r Regexp) MarshalText() ([]byte, error) {
+	if r.Regexp == nil {
+		return nil, nil
+	}
+	return []byte(r.String()), nil
+}
+
+// await returns the pattern from config, which must be set.
+func await(ctx context.Context, config *flow.Config[Regexp]) (*regexp.Regexp, error) {
+	if _, err := config.Await(ctx); err != nil {
+		return nil, err
+	}
+	return current(config)
+}
+
+// current returns the latest pattern from config.
+func current(config *flow.Config[Regexp]) (*regexp.Regexp, error) {
+	rx, _ := config.Get()
+	if rx.Regexp == nil {
+		return nil, errors.New("pattern is not set")
+	}
+	return rx.Regexp, nil
+}
+
+// mapStrings sends every value from in converted with fn to out.
+func mapStrings(ctx context.Context, in *flow.In[string], out *flow.Out[string], fn func(string) (string, error)) error {
+	for {
+		v, err := in.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		v, err = fn(v)
+		if err != nil {
+			return err
+		}
+		if err := out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// Upper converts the values to upper case.
+type Upper struct {
+	In  flow.In[string]
+	Out flow.Out[string]
+}
+
+func (u *Upper) Run(ctx context.Context) error {
+	return mapStrings(ctx, &u.In, &u.Out, func(v string) (string, error) {
+		return strings.ToUpper(v), nil
+	})
+}
+
+// Lower converts the values to lower case.
+type Lower struct {
+	In  flow.In[string]
+	Out flow.Out[string]
+}
+
+func (l *Lower) Run(ctx context.Context) error {
+	return mapStrings(ctx, &l.In, &l.Out, func(v string) (string, error) {
+		return strings.ToLower(v), nil
+	})
+}
+
+// TrimSpace removes the leading and trailing white space of the values.
+type TrimSpace struct {
+	In  flow.In[string]
+	Out flow.Out[string]
+}
+
+func (t *TrimSpace) Run(ctx context.Context) error {
+	return mapStrings(ctx, &t.In, &t.Out, func(v string) (string, error) {
+		return strings.TrimSpace(v), nil
+	})
+}
+
+// SplitLines sends every line of the values separately, without the line
+// endings. A final line ending doesn't produce an empty line.
+type SplitLines struct {
+	In  flow.In[string]
+	Out flow.Out[string]
+}
+
+func (s *SplitLines) Run(ctx context.Context) error {
+	for {
+		v, err := s.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return s.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		v = strings.TrimSuffix(v, "\n")
+		for _, line := range strings.Split(v, "\n") {
+			if err := s.Out.Send(ctx, strings.TrimSuffix(line, "\r")); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ReplaceConfig configures Replace.
+type ReplaceConfig struct {
+	Pattern Regexp `json:"pattern"`
+	// With replaces the matches, $1 or ${name} in it are expanded to
+	// the submatches, see regexp.Regexp.Expand.
+	With string `json:"with"`
+}
+
+// Replace replaces the matches of the pattern in the values.
+type Replace struct {
+	In     flow.In[string]
+	Out    flow.Out[string]
+	Config flow.Config[ReplaceConfig]
+}
+
+func (r *Replace) Run(ctx context.Context) error {
+	if _, err := r.Config.Await(ctx); err != nil {
+		return err
+	}
+	return mapStrings(ctx, &r.In, &r.Out, func(v string) (string, error) {
+		config, _ := r.Config.Get()
+		if config.Pattern.Regexp == nil {
+			return "", errors.New("replace: pattern is not set")
+		}
+		return config.Pattern.ReplaceAllString(v, config.With), nil
+	})
+}
+
+// RegexMatch sends the values matching the pattern to Matched and the
+// rest to Unmatched. The unmatched values are dropped when Unmatched is
+// not connected.
+type RegexMatch struct {
+	In        flow.In[string]
+	Matched   flow.Out[string]
+	Unmatched flow.Out[string]
+	Config    flow.Config[Regexp]
+}
+
+func (m *RegexMatch) Run(ctx context.Context) error {
+	if _, err := await(ctx, &m.Config); err != nil {
+		return err
+	}
+	for {
+		v, err := m.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			if err := m.Matched.Close(ctx); err != nil {
+				return err
+			}
+			return m.Unmatched.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		rx, err := current(&m.Config)
+		if err != nil {
+			return err
+		}
+		switch {
+		case rx.MatchString(v):
+			err = m.Matched.Send(ctx, v)
+		case m.Unmatched.Connected():
+			err = m.Unmatched.Send(ctx, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RegexExtract sends the capture groups of the first match in every
+// value, or the whole match when the pattern has no groups. The values
+// that don't match are dropped.
+type RegexExtract struct {
+	In     flow.In[string]
+	Out    flow.Out[[]string]
+	Config flow.Config[Regexp]
+}
+
+func (x *RegexExtract) Run(ctx context.Context) error {
+	if _, err := await(ctx, &x.Config); err != nil {
+		return err
+	}
+	for {
+		v, err := x.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return x.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		rx, err := current(&x.Config)
+		if err != nil {
+			return err
+		}
+		match := rx.FindStringSubmatch(v)
+		if match == nil {
+			continue
+		}
+		if len(match) > 1 {
+			match = match[1:]
+		}
+		if err := x.Out.Send(ctx, match); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package text_test
+
+import (
+	"testing"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std/text"
+)
+
+var registry = flow.Registry{
+	"SplitLines":   func() flow.Component { return &text.SplitLines{} },
+	"TrimSpace":    func() flow.Component { return &text.TrimSpace{} },
+	"Upper":        func() flow.Component { return &text.Upper{} },
+	"RegexMatch":   func() flow.Component { return &text.RegexMatch{} },
+	"RegexExtract": func() flow.Component { return &text.RegexExtract{} },
+}
+
+func TestLogErrors(t *testing.T) {
+	net := &flow.Network{Registry: registry}
+	err := net.Setup(`
+		: lines SplitLines
+		: trim TrimSpace
+		: errors RegexMatch
+		: upper Upper
+		: code RegexExtract
+
+		lines.Out -> trim.In
+		trim.Out -> errors.In
+		'^ERROR' -> errors.Config
+		errors.Matched -> upper.In
+		errors.Unmatched -> code.In
+		'code=(\\d+)' -> code.Config
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flowtest.RunGraph(t, net, flowtest.Inputs{
+		"lines.In": {
+			"ERROR disk full\n  info code=200 \r\nERROR net down\n",
+			"warn code=503",
+		},
+	})
+}
@@ -0,0 +1,141 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// Ticker sends the current time every Interval.
+type Ticker struct {
+	Out flow.Out[time.Time]
+
+	Interval time.Duration
+	// Count limits the number of ticks, zero ticks until cancelled.
+	Count int
+}
+
+func NewTicker(interval time.Duration) *Ticker {
+	return &Ticker{Interval: interval}
+}
+
+func (t *Ticker) Run(ctx context.Context) error {
+	if t.Interval <= 0 {
+		return errors.New("ticker interval must be positive")
+	}
+
+	ticker := flow.ClockFrom(ctx).NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	for n := 0; t.Count <= 0 || n < t.Count; n++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C():
+			if err := t.Out.Send(ctx, now); err != nil {
+				return err
+			}
+		}
+	}
+	return t.Out.Close(ctx)
+}
+
+// Timer sends the current time once After has elapsed.
+type Timer struct {
+	Out flow.Out[time.Time]
+
+	After time.Duration
+}
+
+func NewTimer(after time.Duration) *Timer {
+	return &Timer{After: after}
+}
+
+func (t *Timer) Run(ctx context.Context) error {
+	if err := flow.Sleep(ctx, t.After); err != nil {
+		return err
+	}
+	if err := t.Out.Send(ctx, flow.ClockFrom(ctx).Now()); err != nil {
+		return err
+	}
+	return t.Out.Close(ctx)
+}
+
+// DefaultDelayCapacity is the default number of values Delay holds.
+const DefaultDelayCapacity = 1024
+
+// Delay forwards each value Duration after it was received.
+//
+// Values are delayed independently, so the spacing between them is
+// preserved as long as the downstream keeps up.
+type Delay[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	Duration time.Duration
+	// Capacity is the maximum number of values being delayed, defaults
+	// to DefaultDelayCapacity. Delay stops receiving while it's full.
+	Capacity int
+}
+
+func NewDelay[T any](d time.Duration) *Delay[T] {
+	return &Delay[T]{Duration: d}
+}
+
+func (d *Delay[T]) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	values := receive(ctx, &d.In)
+
+	type delayed struct {
+		v   T
+		due time.Time
+	}
+	var pending []delayed
+	eos := false
+	capacity := d.Capacity
+	if capacity <= 0 {
+		capacity = DefaultDelayCapacity
+	}
+
+	clock := flow.ClockFrom(ctx)
+	timer := clock.NewTimer(d.Duration)
+	stopTimer(timer)
+	defer timer.Stop()
+
+	for {
+		if len(pending) > 0 {
+			stopTimer(timer)
+			timer.Reset(pending[0].due.Sub(clock.Now()))
+		} else if eos {
+			return d.Out.Close(ctx)
+		}
+		in := values
+		if len(pending) >= capacity {
+			in = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r := <-in:
+			if errors.Is(r.err, flow.EOS) {
+				eos, values = true, nil
+				continue
+			}
+			if r.err != nil {
+				return r.err
+			}
+			pending = append(pending, delayed{r.v, clock.Now().Add(d.Duration)})
+		case <-timer.C():
+			next := pending[0]
+			pending[0] = delayed{}
+			pending = pending[1:]
+			if err := d.Out.Send(ctx, next.v); err != nil {
+				return err
+			}
+		}
+	}
+}
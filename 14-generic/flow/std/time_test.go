@@ -0,0 +1,56 @@
+package std_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+func TestDelayShutdown(t *testing.T) {
+	var net flow.Network
+	ticker := std.NewTicker(time.Millisecond)
+	delay := std.NewDelay[time.Time](50 * time.Millisecond)
+	count := std.NewCount[time.Time]()
+	net.Add(ticker, delay, count)
+	flowtest.Connect(t, &ticker.Out, &delay.In)
+	flowtest.Connect(t, &delay.Out, &count.In)
+
+	flowtest.CheckShutdown(t, &net)
+}
+
+func TestDelayCapacity(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	clock := flowtest.NewClock(time.Time{})
+	ctx = flow.WithClock(ctx, clock)
+
+	delay := std.NewDelay[int](time.Minute)
+	delay.Capacity = 2
+	var in flow.Out[int]
+	var out flow.In[int]
+	flowtest.Connect(t, &in, &delay.In)
+	flowtest.Connect(t, &delay.Out, &out)
+	go func() { _ = delay.Run(ctx) }()
+
+	// two values are delayed and the third one waits to be received
+	for i := 0; i < 3; i++ {
+		if err := in.Send(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	full, stop := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer stop()
+	if err := in.Send(full, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, expected the send to wait", err)
+	}
+
+	clock.Advance(time.Minute)
+	if v, err := out.Recv(ctx); err != nil || v != 0 {
+		t.Fatalf("received %v, %v, expected 0", v, err)
+	}
+}
@@ -0,0 +1,101 @@
+package std
+
+import (
+	"context"
+	"errors"
+
+	"fbp.example/flow"
+)
+
+// Filter forwards the values for which Pred returns true.
+type Filter[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[T]
+
+	Pred func(T) bool
+}
+
+func NewFilter[T any](pred func(T) bool) *Filter[T] {
+	return &Filter[T]{Pred: pred}
+}
+
+func (f *Filter[T]) Run(ctx context.Context) error {
+	for {
+		v, err := f.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return f.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !f.Pred(v) {
+			flow.Release(v)
+			continue
+		}
+		if err := f.Out.Send(ctx, v); err != nil {
+			return err
+		}
+	}
+}
+
+// Map converts every value with Fn.
+type Map[A, B any] struct {
+	In  flow.In[A]
+	Out flow.Out[B]
+
+	Fn func(A) B
+}
+
+func NewMap[A, B any](fn func(A) B) *Map[A, B] {
+	return &Map[A, B]{Fn: fn}
+}
+
+func (m *Map[A, B]) Run(ctx context.Context) error {
+	for {
+		v, err := m.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			return m.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := m.Out.Send(ctx, m.Fn(v)); err != nil {
+			return err
+		}
+	}
+}
+
+// Reduce combines all the values into an accumulator,
+// which is sent once the input has ended.
+type Reduce[A, B any] struct {
+	In  flow.In[A]
+	Out flow.Out[B]
+
+	Fn   func(acc B, v A) B
+	Init B
+}
+
+func NewReduce[A, B any](fn func(acc B, v A) B, init B) *Reduce[A, B] {
+	return &Reduce[A, B]{Fn: fn, Init: init}
+}
+
+func (r *Reduce[A, B]) Run(ctx context.Context) error {
+	acc := r.Init
+	for {
+		v, err := r.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		acc = r.Fn(acc, v)
+	}
+
+	if err := r.Out.Send(ctx, acc); err != nil {
+		return err
+	}
+	return r.Out.Close(ctx)
+}
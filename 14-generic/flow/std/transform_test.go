@@ -0,0 +1,61 @@
+package std_test
+
+import (
+	"strconv"
+	"testing"
+
+	"fbp.example/flow"
+	"fbp.example/flow/flowtest"
+	"fbp.example/flow/std"
+)
+
+func TestFilter(t *testing.T) {
+	c := std.NewFilter(func(v int) bool { return v%2 == 0 })
+	h := flowtest.New(t, c)
+	flowtest.Feed(h, &c.In, 1, 2, 3, 4)
+	flowtest.Collect(h, &c.Out).Expect(2, 4).ExpectEOS()
+}
+
+func TestMap(t *testing.T) {
+	c := std.NewMap(strconv.Itoa)
+	h := flowtest.New(t, c)
+	in := flowtest.NewInput(h, &c.In)
+	out := flowtest.Collect(h, &c.Out)
+
+	in.Send(1)
+	out.Expect("1")
+	in.Send(2)
+	out.Expect("2")
+	in.Close()
+	out.ExpectEOS()
+	if err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	c := std.NewReduce(func(acc, v int) int { return acc + v }, 0)
+	h := flowtest.New(t, c)
+	flowtest.Feed(h, &c.In, 1, 2, 3)
+	flowtest.Collect(h, &c.Out).Expect(6).ExpectEOS()
+}
+
+func TestDistinctUntilChangedRelease(t *testing.T) {
+	released := 0
+	pool := &flow.PacketPool[int]{Reset: func(v *int) { released++ }}
+	c := &std.DistinctUntilChanged[*flow.Packet[int]]{
+		Equal: func(a, b *flow.Packet[int]) bool { return a.Value == b.Value },
+	}
+	first, second := pool.Get(), pool.Get()
+	first.Value, second.Value = 1, 1
+
+	h := flowtest.New(t, c)
+	flowtest.Feed(h, &c.In, first, second)
+	flowtest.Collect(h, &c.Out).Expect(first).ExpectEOS()
+	if released != 1 {
+		t.Fatalf("released %d packets, expected the dropped one", released)
+	}
+
+	// a packet not from a pool is left alone
+	flow.Release(&flow.Packet[int]{Value: 1})
+}
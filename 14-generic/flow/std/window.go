@@ -0,0 +1,201 @@
+package std
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"fbp.example/flow"
+)
+
+// Batch groups values into slices of Size values.
+//
+// When Timeout is set, an incomplete batch is sent after Timeout
+// has passed since its first value.
+type Batch[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[[]T]
+
+	Size    int
+	Timeout time.Duration
+}
+
+func NewBatch[T any](size int, timeout time.Duration) *Batch[T] {
+	return &Batch[T]{Size: size, Timeout: timeout}
+}
+
+func (b *Batch[T]) Run(ctx context.Context) error {
+	if b.Size <= 0 {
+		return errors.New("batch size must be positive")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	values := receive(ctx, &b.In)
+
+	var timeout <-chan time.Time
+	var timer flow.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	batch := make([]T, 0, b.Size)
+	flush := func() error {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		full := batch
+		batch = make([]T, 0, b.Size)
+		return b.Out.Send(ctx, full)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r := <-values:
+			if errors.Is(r.err, flow.EOS) {
+				if err := flush(); err != nil {
+					return err
+				}
+				return b.Out.Close(ctx)
+			}
+			if r.err != nil {
+				return r.err
+			}
+
+			batch = append(batch, r.v)
+			if len(batch) == 1 && b.Timeout > 0 {
+				timer = flow.ClockFrom(ctx).NewTimer(b.Timeout)
+				timeout = timer.C()
+			}
+			if len(batch) >= b.Size {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-timeout:
+			timer, timeout = nil, nil
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Pane contains the values of a single window.
+type Pane[T any] struct {
+	Start, End time.Time
+	Values     []T
+}
+
+// Window groups values into windows based on their event time.
+//
+// Every Slide a new window of length Size starts. When Slide equals
+// Size (or is zero) the windows are tumbling, otherwise they are sliding
+// and a value may belong to multiple windows.
+//
+// Windows are emitted once the watermark passes their end. The watermark
+// is the latest event time seen minus Lateness. Values arriving for
+// already emitted windows are dropped.
+type Window[T any] struct {
+	In  flow.In[T]
+	Out flow.Out[Pane[T]]
+
+	Time     func(T) time.Time
+	Size     time.Duration
+	Slide    time.Duration
+	Lateness time.Duration
+
+	// Dropped counts the values that arrived too late.
+	Dropped int
+}
+
+// NewTumblingWindow creates non-overlapping windows of size.
+func NewTumblingWindow[T any](size time.Duration, eventTime func(T) time.Time) *Window[T] {
+	return &Window[T]{Time: eventTime, Size: size, Slide: size}
+}
+
+// NewSlidingWindow creates windows of size starting every slide.
+func NewSlidingWindow[T any](size, slide time.Duration, eventTime func(T) time.Time) *Window[T] {
+	return &Window[T]{Time: eventTime, Size: size, Slide: slide}
+}
+
+func (w *Window[T]) Run(ctx context.Context) error {
+	slide := w.Slide
+	if slide <= 0 {
+		slide = w.Size
+	}
+	if w.Size <= 0 || slide > w.Size {
+		return errors.New("window requires 0 < Slide <= Size")
+	}
+
+	open := map[time.Time]*Pane[T]{}
+	var watermark time.Time
+
+	// emit sends all the windows that end before the limit.
+	emit := func(limit time.Time, all bool) error {
+		var ready []*Pane[T]
+		for start, pane := range open {
+			if all || !pane.End.After(limit) {
+				ready = append(ready, pane)
+				delete(open, start)
+			}
+		}
+		sort.Slice(ready, func(i, k int) bool { return ready[i].Start.Before(ready[k].Start) })
+		for _, pane := range ready {
+			if err := w.Out.Send(ctx, *pane); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for {
+		v, err := w.In.Recv(ctx)
+		if errors.Is(err, flow.EOS) {
+			if err := emit(watermark, true); err != nil {
+				return err
+			}
+			return w.Out.Close(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		t := w.Time(v)
+		accepted := false
+		for start := t.Truncate(slide); start.Add(w.Size).After(t); start = start.Add(-slide) {
+			end := start.Add(w.Size)
+			if !watermark.IsZero() && !end.After(watermark) {
+				continue
+			}
+			pane, ok := open[start]
+			if !ok {
+				pane = &Pane[T]{Start: start, End: end}
+				open[start] = pane
+			}
+			pane.Values = append(pane.Values, v)
+			accepted = true
+		}
+		if !accepted {
+			w.Dropped++
+			flow.Release(v)
+			continue
+		}
+
+		if mark := t.Add(-w.Lateness); mark.After(watermark) {
+			watermark = mark
+			if err := emit(watermark, false); err != nil {
+				return err
+			}
+		}
+	}
+}
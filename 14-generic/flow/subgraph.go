@@ -0,0 +1,147 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Subgraph is a component made of a network, whose ports are the ports
+// exported in the graph definition:
+//
+//	: s Split
+//	: u Upper
+//	s.Left -> u.In
+//
+//	export s.In as IN
+//	export u.Out as OUT
+//
+// The exported ports are the ports of the inner nodes, so the packets
+// don't pass through any additional components.
+type Subgraph struct {
+	net     Network
+	exports map[string]port
+	done    []int32
+}
+
+// NewSubgraph creates the subgraph from a parsed graph definition.
+// The components are created using registry and the registered types.
+func NewSubgraph(w *Wiring, registry Registry) (*Subgraph, error) {
+	if len(w.Exports) == 0 {
+		return nil, errors.New("subgraph does not export any ports")
+	}
+
+	s := &Subgraph{exports: make(map[string]port)}
+	s.net.Registry = registry
+	if err := s.net.WireUp(w); err != nil {
+		return nil, err
+	}
+
+	var errs WiringErrors
+	for _, export := range w.Exports {
+		if _, dup := s.exports[string(export.As)]; dup {
+			errs = append(errs, WiringError{Pos: export.Pos, Err: fmt.Errorf("port %s exported twice", export.As)})
+			continue
+		}
+		p, err := s.net.endpoint(export.Node, export.Port)
+		if err != nil {
+			errs = append(errs, WiringError{Pos: export.Pos, Err: fmt.Errorf("export %s.%s: %w", export.Node, export.Port, err)})
+			continue
+		}
+		s.exports[string(export.As)] = p
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	s.done = make([]int32, len(s.net.components))
+	return s, nil
+}
+
+// SubgraphType parses the graph definition and returns a constructor
+// for the subgraph, which can be added to a Registry:
+//
+//	net.Registry["Pipeline"], err = flow.SubgraphType(def, registry)
+func SubgraphType(def string, registry Registry) (MakeFn, error) {
+	w, err := ParseWiring(def)
+	if err != nil {
+		return nil, err
+	}
+	// check that the subgraph can be created
+	if _, err := NewSubgraph(w, registry); err != nil {
+		return nil, err
+	}
+
+	return func() Component {
+		s, err := NewSubgraph(w, registry)
+		if err != nil {
+			// the same definition was successfully created before
+			panic(err)
+		}
+		return s
+	}, nil
+}
+
+// Network returns the inner network.
+func (s *Subgraph) Network() *Network { return &s.net }
+
+func (s *Subgraph) ports() map[string]port { return s.exports }
+
+// Run runs the inner components until they return,
+// the lifecycle hooks are called the same way as in Network.Run.
+func (s *Subgraph) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(s.net.withClock(ctx))
+	defer cancel()
+	if err := s.net.initialize(ctx); err != nil {
+		return err
+	}
+
+	await := s.net.hold()
+	var g errgroup.Group
+	for i, c := range s.net.components {
+		i, c := i, c
+		g.Go(func() error {
+			defer atomic.StoreInt32(&s.done[i], 1)
+			return s.net.run(ctx, c, nil)
+		})
+	}
+	var readyErr error
+	g.Go(func() error {
+		if readyErr = await(ctx); readyErr != nil {
+			cancel()
+		}
+		return nil
+	})
+	err := g.Wait()
+	if readyErr != nil {
+		err = readyErr
+	}
+
+	if downErr := shutdown(ctx, s.net.components); err == nil {
+		err = downErr
+	}
+	return err
+}
+
+// idle reports whether every running inner component is waiting for packets.
+func (s *Subgraph) idle() bool {
+	for i, c := range s.net.components {
+		if atomic.LoadInt32(&s.done[i]) != 0 {
+			continue
+		}
+		if idler, ok := c.(idler); ok {
+			if !idler.idle() {
+				return false
+			}
+			continue
+		}
+
+		if blocked, _ := receiving(inputsOf(c)); !blocked {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package flow
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+/*
+	A server can run a network per request, instead of sending the
+	requests through long-lived components shared by all of them. The
+	components of a request then run without any coordination with the
+	other requests, and a failing request doesn't affect the others.
+
+	A Template parses and checks the graph definition once, the networks
+	are instantiated from it by creating the components and connecting
+	them. The components implementing Resetter are pooled: once a network
+	has finished, Template.Release resets them and the next instances
+	reuse them. A NetworkPool goes further and reuses the networks with
+	their connections.
+*/
+
+// Resetter can be implemented by a component to be reused by a Template,
+// Reset must restore the state of a newly created component. The ports
+// are reset by the Template.
+type Resetter interface {
+	Reset()
+}
+
+// Template instantiates networks from a graph definition,
+// e.g. one per request of a server.
+type Template struct {
+	// Registry, Values and Params are used by the instances,
+	// like the fields of Network with the same name. They must not
+	// be modified once the Template has been compiled.
+	Registry Registry
+	Values   Values
+	Params   map[string]string
+
+	wiring *Wiring
+	pools  map[Type]*sync.Pool
+}
+
+// NewTemplate parses the graph definition and compiles it into a
+// Template, the components are created using registry in addition
+// to the globally registered ones.
+func NewTemplate(def string, registry Registry) (*Template, error) {
+	wiring, err := ParseWiring(def)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{Registry: registry}
+	if err := t.Compile(wiring); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Compile checks the wiring by instantiating it once, afterwards the
+// Template instantiates it with Instance.
+func (t *Template) Compile(w *Wiring) error {
+	t.wiring = w
+	t.pools = make(map[Type]*sync.Pool)
+	trial := &Network{Registry: t.Registry, Params: t.Params}
+	trial.Values.copyFrom(&t.Values)
+	for _, typ := range w.Decls {
+		if _, ok := t.pools[typ]; ok {
+			continue
+		}
+		mk, err := trial.lookup(typ)
+		if err != nil {
+			// reported by WireUp
+			continue
+		}
+		t.pools[typ] = &sync.Pool{New: func() any { return mk() }}
+	}
+	if err := trial.WireUp(w); err != nil {
+		t.wiring = nil
+		return err
+	}
+	return nil
+}
+
+// Instance returns a new network wired up according to the template.
+// The network can be configured further before it's run, once it has
+// finished its components can be returned with Release.
+func (t *Template) Instance() (*Network, error) {
+	if t.wiring == nil {
+		return nil, errors.New("template is not compiled")
+	}
+	net := &Network{Params: t.Params}
+	net.Values.copyFrom(&t.Values)
+	net.Registry = make(Registry, len(t.pools))
+	for typ, pool := range t.pools {
+		pool := pool
+		net.Registry[typ] = func() Component { return pool.Get().(Component) }
+	}
+	if err := net.WireUp(t.wiring); err != nil {
+		return nil, err
+	}
+	return net, nil
+}
+
+// Release returns the components of a network created by Instance to
+// the Template. The network must have finished and must not be used
+// afterwards. Only the components implementing Resetter are reused,
+// see Resetter.
+func (t *Template) Release(net *Network) {
+	for name, typ := range t.wiring.Decls {
+		c, ok := net.nodes[name]
+		if !ok {
+			continue
+		}
+		r, ok := c.(Resetter)
+		rv := reflect.ValueOf(c)
+		if !ok || rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		resetPorts(rv.Elem())
+		r.Reset()
+		t.pools[typ].Put(c)
+	}
+}
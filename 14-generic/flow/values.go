@@ -0,0 +1,137 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Values is a network-level store of named values.
+//
+// The type of a value is fixed by the first Set. Graph definitions
+// can reference values as `$values.Name -> node.Port`, which sends the
+// current value to the port and again every time it changes.
+type Values struct {
+	mu      sync.Mutex
+	entries map[string]*valueEntry
+}
+
+type valueEntry struct {
+	value   any
+	changed chan struct{}
+}
+
+// Set updates the value called name and notifies the connected ports.
+func (vs *Values) Set(name string, v any) error {
+	if v == nil {
+		return fmt.Errorf("value %s cannot be nil", name)
+	}
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	if vs.entries == nil {
+		vs.entries = make(map[string]*valueEntry)
+	}
+
+	entry, ok := vs.entries[name]
+	if !ok {
+		vs.entries[name] = &valueEntry{
+			value:   v,
+			changed: make(chan struct{}),
+		}
+		return nil
+	}
+
+	if prev, next := reflect.TypeOf(entry.value), reflect.TypeOf(v); prev != next {
+		return fmt.Errorf("value %s has type %v, got %v", name, prev, next)
+	}
+
+	entry.value = v
+	close(entry.changed)
+	entry.changed = make(chan struct{})
+	return nil
+}
+
+// Get returns the value called name.
+func (vs *Values) Get(name string) (any, bool) {
+	v, _, ok := vs.watch(name)
+	return v, ok
+}
+
+// setJSON decodes data into the type of the value called name and
+// updates it, see Network.AdminHandler.
+func (vs *Values) setJSON(name string, data []byte) error {
+	current, ok := vs.Get(name)
+	if !ok {
+		return fmt.Errorf("value %s does not exist", name)
+	}
+	next := reflect.New(reflect.TypeOf(current))
+	if err := json.Unmarshal(data, next.Interface()); err != nil {
+		return fmt.Errorf("value %s: %w", name, err)
+	}
+	return vs.Set(name, next.Elem().Interface())
+}
+
+// copyFrom sets the values of vs to the current ones of src.
+func (vs *Values) copyFrom(src *Values) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	for name, entry := range src.entries {
+		_ = vs.Set(name, entry.value)
+	}
+}
+
+// watch returns the current value and a channel that is closed when it changes.
+func (vs *Values) watch(name string) (any, chan struct{}, bool) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	entry, ok := vs.entries[name]
+	if !ok {
+		return nil, nil, false
+	}
+	return entry.value, entry.changed, true
+}
+
+// valueFeed is a component that sends a value to a port whenever it changes.
+type valueFeed struct {
+	net    *Network
+	values *Values
+	name   string
+	out    outPort
+
+	waiting int32
+}
+
+func (feed *valueFeed) idle() bool { return atomic.LoadInt32(&feed.waiting) != 0 }
+
+func (feed *valueFeed) Run(ctx context.Context) error {
+	for {
+		v, changed, ok := feed.values.watch(feed.name)
+		if !ok {
+			return fmt.Errorf("value %s does not exist", feed.name)
+		}
+
+		if err := feed.out.sendAny(ctx, v); err != nil {
+			return err
+		}
+		if feed.net.seq != nil || feed.net.shards != nil {
+			// changes are not delivered while running sequentially
+			return nil
+		}
+
+		atomic.StoreInt32(&feed.waiting, 1)
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		}
+		atomic.StoreInt32(&feed.waiting, 0)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package flow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	A graph definition may pin the version of a component type and the
+	hash of its ports, so that loading it fails when the components have
+	changed under it:
+
+		: gen Generator@1.2 ports=5d0e8a3c
+
+	The version is compatible when the major versions are equal and the
+	component's version is at least the pinned one, the versions before
+	1.0 must match in the minor version as well. The ports hash must
+	match exactly, see PortSchema.Hash, and the error lists how the ports
+	differ from what the graph uses.
+
+	The version of a type is declared by RegisterVersion, or by the
+	components implementing Versioned, e.g. the ones in Network.Registry.
+*/
+
+// Versioned can be implemented by a component to declare the semantic
+// version of its type, e.g. "1.4.2".
+type Versioned interface {
+	Version() string
+}
+
+// Pin is the version and the ports hash a graph requires of a node,
+// an empty field isn't checked.
+type Pin struct {
+	Version string
+	Ports   string
+	Pos     Pos
+}
+
+// String returns the pin in the format of a declaration.
+func (pin Pin) String() string {
+	var s string
+	if pin.Version != "" {
+		s = "@" + pin.Version
+	}
+	if pin.Ports != "" {
+		s += " ports=" + pin.Ports
+	}
+	return s
+}
+
+var versions = map[Type]string{}
+
+// RegisterVersion registers the component type like Register, declaring
+// its semantic version. It panics when version is not valid.
+func RegisterVersion(typ Type, version string, mk MakeFn) {
+	if _, err := parseVersion(version); err != nil {
+		panic("flow: RegisterVersion for " + string(typ) + ": " + err.Error())
+	}
+	Register(typ, mk)
+
+	registered.Lock()
+	defer registered.Unlock()
+	versions[typ] = version
+}
+
+// VersionOf returns the version of the component c of type typ,
+// it's empty when the version is not declared.
+func VersionOf(typ Type, c Component) string {
+	if v, ok := unwrap(c).(Versioned); ok {
+		return v.Version()
+	}
+	registered.Lock()
+	defer registered.Unlock()
+	return versions[typ]
+}
+
+// PortSchema contains the type of every port of a component by name,
+// e.g. "In[string]" or "[]Out[int]" for a slice of ports.
+type PortSchema map[PortName]string
+
+// SchemaOf returns the ports of the component c. The slice and map ports
+// are described by their field, hence they don't depend on the number
+// of the elements.
+func SchemaOf(c Component) PortSchema {
+	schema := PortSchema{}
+	if set, ok := unwrap(c).(portSet); ok {
+		for name, p := range set.ports() {
+			schema[PortName(name)] = describePort(p)
+		}
+		return schema
+	}
+
+	rv := reflect.ValueOf(unwrap(c))
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || !rv.CanAddr() {
+		return schema
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Field(i)
+		if !field.CanInterface() {
+			continue
+		}
+		name := PortName(rv.Type().Field(i).Name)
+		switch typ := field.Type(); {
+		case reflect.PtrTo(typ).Implements(portType):
+			schema[name] = describePort(field.Addr().Interface().(port))
+		case isPortList(typ):
+			elem := reflect.New(typ.Elem()).Interface().(port)
+			schema[name] = "[]" + describePort(elem)
+		case isPortMap(typ):
+			elem := reflect.New(typ.Elem().Elem()).Interface().(port)
+			schema[name] = "map[string]" + describePort(elem)
+		}
+	}
+	return schema
+}
+
+// describePort returns the direction and the element type of p.
+func describePort(p port) string {
+	if c, ok := p.(configPort); ok {
+		p = c.configIn()
+	}
+	dir := "Out"
+	if _, ok := p.(inPort); ok {
+		dir = "In"
+	}
+	return dir + "[" + p.elemType().String() + "]"
+}
+
+// Hash returns a short hash identifying the ports.
+func (schema PortSchema) Hash() string {
+	h := sha256.New()
+	for _, name := range schema.names() {
+		fmt.Fprintf(h, "%s %s\n", name, schema[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+func (schema PortSchema) names() []PortName {
+	names := make([]PortName, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, k int) bool { return names[i] < names[k] })
+	return names
+}
+
+// checkPin checks the component c created for the node against the pin,
+// the wires are used to tell how the ports differ.
+func checkPin(node Name, typ Type, c Component, pin Pin, wires []Wire) error {
+	if pin.Version != "" {
+		want, err := parseVersion(pin.Version)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", node, err)
+		}
+		version := VersionOf(typ, c)
+		if version == "" {
+			return fmt.Errorf("node %s: %s has no version, %s is required", node, typ, pin.Version)
+		}
+		got, err := parseVersion(version)
+		if err != nil {
+			return fmt.Errorf("node %s: %s: %w", node, typ, err)
+		}
+		if !got.satisfies(want) {
+			return fmt.Errorf("node %s: %s is version %s, %s is required", node, typ, version, pin.Version)
+		}
+	}
+
+	if pin.Ports == "" {
+		return nil
+	}
+	schema := SchemaOf(c)
+	if hash := schema.Hash(); hash != pin.Ports {
+		return fmt.Errorf("node %s: ports of %s changed, ports=%s is required, got ports=%s:\n%s",
+			node, typ, pin.Ports, hash, schema.diff(node, wires))
+	}
+	return nil
+}
+
+// diff describes the ports of the schema, marking the ones the wires
+// use that no longer exist or have the wrong direction.
+func (schema PortSchema) diff(node Name, wires []Wire) string {
+	used := map[PortName]string{}
+	for _, wire := range wires {
+		if wire.To == node {
+			used[portField(wire.Dst)] = "In"
+		}
+		if wire.From == node {
+			used[portField(wire.Src)] = "Out"
+		}
+	}
+
+	var lines []string
+	for _, name := range schema.names() {
+		desc := schema[name]
+		dir, wired := used[name]
+		switch {
+		case !wired:
+			lines = append(lines, fmt.Sprintf("\t  %s %s", name, desc))
+		case !strings.Contains(desc, dir+"["):
+			lines = append(lines, fmt.Sprintf("\t! %s %s, used as %s", name, desc, dir))
+		default:
+			lines = append(lines, fmt.Sprintf("\t= %s %s", name, desc))
+		}
+	}
+	var missing []PortName
+	for name := range used {
+		if _, ok := schema[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Slice(missing, func(i, k int) bool { return missing[i] < missing[k] })
+	for _, name := range missing {
+		lines = append(lines, fmt.Sprintf("\t- %s %s, removed", name, used[name]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// portField returns the field of a port name, e.g. Out for Out[2].
+func portField(name PortName) PortName {
+	if i := strings.IndexByte(string(name), '['); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// version is a semantic version, without the pre-release and build.
+type version struct {
+	major, minor, patch int
+	// parts is the number of the given parts, a pin may omit the
+	// minor and the patch version
+	parts int
+}
+
+func parseVersion(s string) (version, error) {
+	var v version
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	dst := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		*dst[i] = n
+	}
+	v.parts = len(parts)
+	return v, nil
+}
+
+// satisfies reports whether v is compatible with the required version.
+func (v version) satisfies(required version) bool {
+	if v.major != required.major {
+		return false
+	}
+	if v.major == 0 && required.parts > 1 && v.minor != required.minor {
+		return false
+	}
+	if v.minor != required.minor {
+		return v.minor > required.minor
+	}
+	return v.patch >= required.patch
+}
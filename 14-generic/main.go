@@ -27,20 +27,29 @@ import (
 */
 
 type Hello struct {
-	Out flow.Out[string]
+	// Config is the interval between the greetings.
+	Config flow.Config[time.Duration]
+	Out    flow.Out[string]
 
 	count int
 }
 
 func (e *Hello) Run(ctx context.Context) error {
+	if _, err := e.Config.Await(ctx); err != nil {
+		return err
+	}
 	for {
-		err := e.Out.Send(ctx, "Hello " + strconv.Itoa(e.count))
+		err := e.Out.Send(ctx, "Hello "+strconv.Itoa(e.count))
 		if err != nil {
 			return err
 		}
 
 		e.count++
-		time.Sleep(500*time.Millisecond)
+		interval, _ := e.Config.Get()
+		err = flow.Sleep(ctx, interval)
+		if err != nil {
+			return err
+		}
 	}
 }
 
@@ -85,6 +94,7 @@ func (u *Lower) Run(ctx context.Context) error {
 		}
 	}
 }
+
 type Printer[T any] struct {
 	In flow.In[T]
 }
@@ -104,29 +114,42 @@ func main() {
 	var net flow.Network
 
 	var (
-		hello Hello
-		upper Upper
-		lower Lower
+		hello   Hello
+		upper   Upper
+		lower   Lower
 		printer Printer[string]
 	)
 
 	net.Add(&hello, &upper, &lower, &printer)
+	flow.AddIIP(&net, &hello.Config.In, 500*time.Millisecond)
 
 	go net.Run(context.Background())
 
-	{
-		first := flow.Connect(&hello.Out, &upper.In)
-		second := flow.Connect(&upper.Out, &printer.In)
-		time.Sleep(3 * time.Second)
-		first.Disconnect()
-		second.Disconnect()
+	first, err := flow.Connect(&hello.Out, &upper.In)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
-
-	{
-		first := flow.Connect(&hello.Out, &lower.In)
-		second := flow.Connect(&lower.Out, &printer.In)
-		time.Sleep(3 * time.Second)
-		first.Disconnect()
-		second.Disconnect()
+	second, err := flow.Connect(&upper.Out, &printer.In)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	time.Sleep(3 * time.Second)
+
+	// switch to lower without letting any packet through a half-built path
+	conns, err := net.Rewire(func(tx *flow.RewireTx) {
+		tx.Disconnect(first)
+		tx.Disconnect(second)
+		tx.Connect(&hello.Out, &lower.In)
+		tx.Connect(&lower.Out, &printer.In)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
-}
\ No newline at end of file
+	time.Sleep(3 * time.Second)
+	for _, conn := range conns {
+		conn.Disconnect()
+	}
+}